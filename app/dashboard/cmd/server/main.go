@@ -79,6 +79,7 @@ func main() {
 	apiRouter.HandleFunc("/attendance/export", auth.JWTMiddleware(auth.SubscriberMiddleware(attendanceHandler.ExportAttendance))).Methods("GET")
 	apiRouter.HandleFunc("/attendance/{lessonId}", auth.JWTMiddleware(attendanceHandler.GetLessonAttendance)).Methods("GET")
 	apiRouter.HandleFunc("/attendance/{lessonId}", auth.JWTMiddleware(auth.SubscriberMiddleware(attendanceHandler.SaveAttendance))).Methods("POST")
+	apiRouter.HandleFunc("/attendance/{lessonId}", auth.JWTMiddleware(auth.SubscriberMiddleware(attendanceHandler.PatchAttendance))).Methods("PATCH")
 	apiRouter.HandleFunc("/attendance/{lessonId}", auth.JWTMiddleware(auth.SubscriberMiddleware(attendanceHandler.DeleteAttendance))).Methods("DELETE")
 
 	// Lab routes
@@ -100,6 +101,20 @@ func main() {
 	apiRouter.HandleFunc("/labs/{subject}/{group}/export", auth.JWTMiddleware(auth.SubscriberMiddleware(labHandler.ExportLabGrades))).Methods("GET")
 	apiRouter.HandleFunc("/labs/{subject}/{group}/share", auth.JWTMiddleware(auth.SubscriberMiddleware(labHandler.ShareLabGrades))).Methods("POST")
 
+	// Gradebook routes
+	gradebookHandler := handlers.NewGradebookHandler(database)
+	apiRouter.HandleFunc("/gradebook/{subject}/{group}", auth.JWTMiddleware(gradebookHandler.GetGradebook)).Methods("GET")
+	apiRouter.HandleFunc("/gradebook/{subject}/{group}/settings", auth.JWTMiddleware(auth.SubscriberMiddleware(gradebookHandler.UpdateGradebookSettings))).Methods("PUT")
+	apiRouter.HandleFunc("/gradebook/{subject}/{group}/export", auth.JWTMiddleware(auth.SubscriberMiddleware(gradebookHandler.ExportGradebook))).Methods("GET")
+
+	// Calendar feed routes
+	calendarHandler := handlers.NewCalendarHandler(database)
+	apiRouter.HandleFunc("/calendar/feed", auth.JWTMiddleware(calendarHandler.GetFeed)).Methods("GET")
+	apiRouter.HandleFunc("/calendar/feed", auth.JWTMiddleware(calendarHandler.RegenerateFeed)).Methods("POST")
+	apiRouter.HandleFunc("/calendar/feed", auth.JWTMiddleware(calendarHandler.DeleteFeed)).Methods("DELETE")
+	// Public access for calendar apps, protected by the secret token
+	apiRouter.HandleFunc("/calendar/{token}.ics", calendarHandler.GetCalendar).Methods("GET")
+
 	// Admin routes - ИСПРАВЛЕНО: добавлен JWTMiddleware перед AdminMiddleware
 	adminHandler := handlers.NewAdminHandler(database)
 	apiRouter.HandleFunc("/admin/users", auth.JWTMiddleware(auth.AdminMiddleware(adminHandler.GetUsers))).Methods("GET")
@@ -116,6 +131,7 @@ func main() {
 		AllowedOrigins:   []string{"*"}, // Allow all origins
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders:   []string{"*"}, // Allow all headers
+		ExposedHeaders:   []string{"ETag"},
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours
 	})
@@ -39,20 +39,36 @@ func InitDB() *gorm.DB {
 	// Auto-migrate the schema
 	err = DB.AutoMigrate(
 		&models.User{},
+		&models.Group{},
 		&models.Lesson{},
 		&models.Student{},
 		&models.Attendance{},
 		&models.Log{},
 		&models.LabSettings{},
 		&models.LabGrade{},
+		&models.GradebookSettings{},
 		&models.UserNotificationSettings{},
 		&models.SharedLabLink{},
+		&models.CalendarFeed{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to auto-migrate database:", err)
 	}
 
+	// Link rows created before groups became a separate table
+	if err := BackfillGroups(DB); err != nil {
+		log.Fatal("Failed to backfill groups:", err)
+	}
+
+	// Older attendance rows only carry the 0/1 attended flag
+	if err := DB.Exec(`
+		UPDATE attendances SET status = CASE WHEN attended = 1 THEN 'present' ELSE 'absent' END
+		WHERE status IS NULL OR status = ''
+	`).Error; err != nil {
+		log.Fatal("Failed to backfill attendance statuses:", err)
+	}
+
 	log.Println("Database initialized successfully")
 	return DB
 }
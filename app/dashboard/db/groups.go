@@ -0,0 +1,145 @@
+package db
+
+import (
+	"TeacherJournal/app/dashboard/models"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// SameNameGroupsSQL selects the IDs of the groups of every teacher that have the name of
+// the group with the given ID. A student is stored once per teacher, and these records
+// are matched by FIO and group name.
+const SameNameGroupsSQL = `SELECT id FROM groups WHERE name = (SELECT name FROM groups WHERE id = ?)`
+
+// StudentRecordsSQL selects the IDs of every record of a student; takes the FIO and a group ID
+const StudentRecordsSQL = `SELECT id FROM students WHERE student_fio = ? AND group_id IN (` + SameNameGroupsSQL + `)`
+
+// FindGroup returns the teacher's group with the given name
+func FindGroup(database *gorm.DB, teacherID int, name string) (models.Group, error) {
+	var group models.Group
+	err := database.Where("teacher_id = ? AND name = ?", teacherID, strings.TrimSpace(name)).First(&group).Error
+	return group, err
+}
+
+// FindOrCreateGroup returns the teacher's group with the given name, creating it if needed
+func FindOrCreateGroup(database *gorm.DB, teacherID int, name string) (models.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Group{}, errors.New("group name is required")
+	}
+
+	group, err := FindGroup(database, teacherID, name)
+	if err == nil {
+		return group, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Group{}, err
+	}
+
+	group = models.Group{
+		Name:      name,
+		TeacherID: teacherID,
+		CreatedAt: time.Now(),
+	}
+	if err := database.Create(&group).Error; err != nil {
+		return models.Group{}, err
+	}
+	return group, nil
+}
+
+// ResolveGroupIDs returns group IDs for the given names, creating missing groups
+func ResolveGroupIDs(database *gorm.DB, teacherID int, names []string) (pq.Int64Array, error) {
+	ids := pq.Int64Array{}
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		group, err := FindOrCreateGroup(database, teacherID, name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int64(group.ID))
+	}
+	return ids, nil
+}
+
+// SplitGroupNames splits a combined group name like "A, B" into separate names
+func SplitGroupNames(combined string) []string {
+	var names []string
+	for _, part := range strings.Split(combined, ",") {
+		if name := strings.TrimSpace(part); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// BackfillGroups creates groups from the legacy group name columns and links
+// existing rows to them. It only does work while unlinked rows remain.
+func BackfillGroups(database *gorm.DB) error {
+	var pending int64
+	if err := database.Raw(`
+		SELECT
+			(SELECT COUNT(*) FROM students WHERE group_id IS NULL) +
+			(SELECT COUNT(*) FROM lessons WHERE group_ids IS NULL) +
+			(SELECT COUNT(*) FROM lab_settings WHERE group_id IS NULL) +
+			(SELECT COUNT(*) FROM shared_lab_links WHERE group_id IS NULL)
+	`).Scan(&pending).Error; err != nil {
+		return err
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		// Create a group for every distinct (teacher, name) pair
+		if err := tx.Exec(`
+			INSERT INTO groups (name, teacher_id, faculty, course_year, created_at)
+			SELECT DISTINCT src.name, src.teacher_id, '', 0, NOW()
+			FROM (
+				SELECT teacher_id, TRIM(group_name) AS name FROM students
+				UNION
+				SELECT teacher_id, TRIM(g) FROM lessons,
+					unnest(COALESCE(groups, '{}') || string_to_array(group_name, ',')) AS g
+				UNION
+				SELECT teacher_id, TRIM(group_name) FROM lab_settings
+				UNION
+				SELECT teacher_id, TRIM(group_name) FROM shared_lab_links
+			) AS src
+			WHERE src.name <> '' AND src.teacher_id IS NOT NULL
+			ON CONFLICT (teacher_id, name) DO NOTHING
+		`).Error; err != nil {
+			return err
+		}
+
+		// Link rows that carry a single group name
+		for _, table := range []string{"students", "lab_settings", "shared_lab_links"} {
+			if err := tx.Exec(`
+				UPDATE ` + table + ` AS t SET group_id = g.id
+				FROM groups g
+				WHERE t.group_id IS NULL AND g.teacher_id = t.teacher_id AND g.name = TRIM(t.group_name)
+			`).Error; err != nil {
+				return err
+			}
+		}
+
+		// Lessons may belong to several groups at once
+		return tx.Exec(`
+			UPDATE lessons AS l SET group_ids = COALESCE((
+				SELECT array_agg(g.id ORDER BY g.name)
+				FROM groups g
+				WHERE g.teacher_id = l.teacher_id AND g.name IN (
+					SELECT TRIM(n) FROM unnest(
+						CASE WHEN cardinality(l.groups) > 0 THEN l.groups
+						ELSE string_to_array(l.group_name, ',') END
+					) AS n
+				)
+			), '{}')
+			WHERE l.group_ids IS NULL
+		`).Error
+	})
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"TeacherJournal/app/dashboard/db"
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -394,23 +396,17 @@ func (h *AdminHandler) GetTeacherGroups(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get groups for this teacher
-	var groupNames []string
-	if err := h.DB.Raw(`
-		SELECT DISTINCT group_name 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? 
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ?
-		) AS combined_groups 
-		ORDER BY group_name
-	`, teacherID, teacherID).Scan(&groupNames).Error; err != nil {
+	var teacherGroups []models.Group
+	if err := h.DB.Where("teacher_id = ?", teacherID).Order("name").Find(&teacherGroups).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving groups")
 		return
 	}
 
 	// Get details for each group
 	type GroupDetails struct {
+		ID           int    `json:"id"`
 		Name         string `json:"name"`
+		Archived     bool   `json:"archived"`
 		StudentCount int    `json:"student_count"`
 		Students     []struct {
 			ID  int    `json:"id"`
@@ -419,25 +415,21 @@ func (h *AdminHandler) GetTeacherGroups(w http.ResponseWriter, r *http.Request)
 	}
 
 	var groups []GroupDetails
-	for _, groupName := range groupNames {
+	for _, teacherGroup := range teacherGroups {
 		var group GroupDetails
-		group.Name = groupName
-
-		// Get student count
-		var count int64
-		h.DB.Model(&models.Student{}).
-			Where("teacher_id = ? AND group_name = ?", teacherID, groupName).
-			Count(&count)
-		group.StudentCount = int(count)
+		group.ID = teacherGroup.ID
+		group.Name = teacherGroup.Name
+		group.Archived = teacherGroup.ArchivedAt != nil
 
 		// Get students
 		if err := h.DB.Model(&models.Student{}).
 			Select("id, student_fio as fio").
-			Where("teacher_id = ? AND group_name = ?", teacherID, groupName).
+			Where("group_id = ?", teacherGroup.ID).
 			Order("student_fio").
 			Find(&group.Students).Error; err != nil {
 			continue // Skip on error
 		}
+		group.StudentCount = len(group.Students)
 
 		groups = append(groups, group)
 	}
@@ -503,29 +495,29 @@ func (h *AdminHandler) AddTeacherGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if group already exists for this teacher
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? 
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ?
-		) AS combined_groups
-		WHERE group_name = ?`,
-		teacherID, teacherID, req.GroupName).Count(&count)
-
-	if count > 0 {
+	if _, err := db.FindGroup(h.DB, teacherID, req.GroupName); err == nil {
 		utils.RespondWithError(w, http.StatusConflict, "Group with this name already exists for this teacher")
 		return
 	}
 
+	group := models.Group{
+		Name:      strings.TrimSpace(req.GroupName),
+		TeacherID: teacherID,
+		CreatedAt: time.Now(),
+	}
+	if err := h.DB.Create(&group).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating group")
+		return
+	}
+
 	// Add students if provided
 	var addedStudents int
 	for _, studentFIO := range req.Students {
 		if studentFIO != "" {
 			student := models.Student{
 				TeacherID:  teacherID,
-				GroupName:  req.GroupName,
+				GroupID:    &group.ID,
+				GroupName:  group.Name,
 				StudentFIO: studentFIO,
 			}
 
@@ -576,17 +568,17 @@ func (h *AdminHandler) GetTeacherAttendance(w http.ResponseWriter, r *http.Reque
 	// Build query
 	query := fmt.Sprintf(`
 		SELECT l.id as lesson_id, l.date, l.subject, l.group_name, l.topic, l.type,
-			(SELECT COUNT(*) FROM students s WHERE s.teacher_id = ? AND s.group_name = l.group_name) as total_students,
-			(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.attended = 1) as attended_students
+			(SELECT COUNT(*) FROM students s WHERE s.teacher_id = ? AND s.group_id = ANY (l.group_ids)) as total_students,
+			%s
 		FROM lessons l
 		WHERE l.teacher_id = ? AND EXISTS (SELECT 1 FROM attendances a WHERE a.lesson_id = l.id)
-	`)
+	`, attendanceStatusColumns)
 
 	args := []interface{}{teacherID, teacherID}
 
 	// Apply filters
 	if groupParam != "" {
-		query += " AND l.group_name = ?"
+		query += " AND (SELECT g.id FROM groups g WHERE g.teacher_id = l.teacher_id AND g.name = ?) = ANY (l.group_ids)"
 		args = append(args, groupParam)
 	}
 	if subjectParam != "" {
@@ -608,6 +600,7 @@ func (h *AdminHandler) GetTeacherAttendance(w http.ResponseWriter, r *http.Reque
 		TotalStudents    int     `json:"total_students"`
 		AttendedStudents int     `json:"attended_students"`
 		AttendanceRate   float64 `json:"attendance_rate"`
+		utils.AttendanceCounts
 	}
 
 	var records []AttendanceRecord
@@ -622,18 +615,19 @@ func (h *AdminHandler) GetTeacherAttendance(w http.ResponseWriter, r *http.Reque
 			records[i].Date = date.Format("02.01.2006")
 		}
 
-		if records[i].TotalStudents > 0 {
-			records[i].AttendanceRate = float64(records[i].AttendedStudents) / float64(records[i].TotalStudents) * 100
-		}
+		records[i].AttendedStudents = records[i].Attended()
+		records[i].AttendanceRate = records[i].AttendanceCounts.AttendanceRate()
 	}
 
 	// Get groups for filter options
 	var groups []string
-	h.DB.Model(&models.Lesson{}).
-		Where("teacher_id = ?", teacherID).
-		Distinct("group_name").
-		Order("group_name").
-		Pluck("group_name", &groups)
+	h.DB.Raw(`
+		SELECT g.name FROM groups g
+		WHERE g.teacher_id = ? AND EXISTS (
+			SELECT 1 FROM lessons l WHERE l.teacher_id = g.teacher_id AND g.id = ANY (l.group_ids)
+		)
+		ORDER BY g.name
+	`, teacherID).Scan(&groups)
 
 	// Get subjects for filter options
 	var subjects []string
@@ -715,22 +709,25 @@ func (h *AdminHandler) GetTeacherLabs(w http.ResponseWriter, r *http.Request) {
 			Subject: subject,
 		}
 
-		// Get groups for this subject
-		var groupNames []string
-		if err := h.DB.Model(&models.Lesson{}).
-			Where("teacher_id = ? AND subject = ?", teacherID, subject).
-			Distinct("group_name").
-			Order("group_name").
-			Pluck("group_name", &groupNames).Error; err != nil {
+		// Get groups for this subject, combined lessons count for each of their groups
+		var groups []models.Group
+		if err := h.DB.Raw(`
+			SELECT g.id, g.name FROM groups g
+			WHERE g.teacher_id = ? AND EXISTS (
+				SELECT 1 FROM lessons l
+				WHERE l.teacher_id = g.teacher_id AND l.subject = ? AND g.id = ANY (l.group_ids)
+			)
+			ORDER BY g.name
+		`, teacherID, subject).Scan(&groups).Error; err != nil {
 			continue // Skip on error
 		}
 
-		for _, groupName := range groupNames {
+		for _, group := range groups {
 			// Get lab settings
 			totalLabs := 5 // Default
 			var settings models.LabSettings
-			if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_name = ?",
-				teacherID, subject, groupName).First(&settings).Error; err == nil {
+			if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_id = ?",
+				teacherID, subject, group.ID).First(&settings).Error; err == nil {
 				totalLabs = settings.TotalLabs
 			}
 
@@ -740,15 +737,15 @@ func (h *AdminHandler) GetTeacherLabs(w http.ResponseWriter, r *http.Request) {
 				SELECT COALESCE(AVG(lg.grade), 0) 
 				FROM lab_grades lg
 				JOIN students s ON lg.student_id = s.id
-				WHERE lg.teacher_id = ? AND lg.subject = ? AND s.group_name = ?
-			`, teacherID, subject, groupName).Scan(&avgGrade)
+				WHERE lg.teacher_id = ? AND lg.subject = ? AND s.group_id = ?
+			`, teacherID, subject, group.ID).Scan(&avgGrade)
 
 			sg.Groups = append(sg.Groups, struct {
 				GroupName    string  `json:"group_name"`
 				TotalLabs    int     `json:"total_labs"`
 				GroupAverage float64 `json:"group_average"`
 			}{
-				GroupName:    groupName,
+				GroupName:    group.Name,
 				TotalLabs:    totalLabs,
 				GroupAverage: avgGrade,
 			})
@@ -4,13 +4,16 @@ import (
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"github.com/tealeg/xlsx"
 	"gorm.io/gorm"
 )
@@ -27,7 +30,16 @@ func NewAttendanceHandler(database *gorm.DB) *AttendanceHandler {
 	}
 }
 
-// AttendanceRecordResponse is the standard format for attendance summary data
+// attendanceStatusColumns selects per-status attendance counts for the lesson aliased as l
+const attendanceStatusColumns = `
+	(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.status = 'present') as present,
+	(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.status = 'late') as late,
+	(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.status = 'excused') as excused,
+	(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.status = 'sick') as sick,
+	(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.status = 'absent') as absent`
+
+// AttendanceRecordResponse is the standard format for attendance summary data.
+// AttendanceRate leaves excused and sick absences out of the denominator.
 type AttendanceRecordResponse struct {
 	LessonID         int     `json:"lesson_id"`
 	Date             string  `json:"date"`
@@ -36,6 +48,7 @@ type AttendanceRecordResponse struct {
 	TotalStudents    int     `json:"total_students"`
 	AttendedStudents int     `json:"attended_students"`
 	AttendanceRate   float64 `json:"attendance_rate"`
+	utils.AttendanceCounts
 }
 
 // GetAttendance returns all attendance records for the current user
@@ -56,17 +69,17 @@ func (h *AttendanceHandler) GetAttendance(w http.ResponseWriter, r *http.Request
 	// Build base query
 	query := fmt.Sprintf(`
 		SELECT l.id as lesson_id, l.date, l.subject, l.group_name, 
-			(SELECT COUNT(*) FROM students s WHERE s.teacher_id = ? AND s.group_name = l.group_name) as total_students,
-			(SELECT COUNT(*) FROM attendances a WHERE a.lesson_id = l.id AND a.attended = 1) as attended_students
+			(SELECT COUNT(*) FROM students s WHERE s.teacher_id = ? AND s.group_id = ANY (l.group_ids)) as total_students,
+			%s
 		FROM lessons l
 		WHERE l.teacher_id = ? AND EXISTS (SELECT 1 FROM attendances a WHERE a.lesson_id = l.id)
-	`)
+	`, attendanceStatusColumns)
 
 	args := []interface{}{userID, userID}
 
 	// Apply filters
 	if groupParam != "" {
-		query += " AND l.group_name = ?"
+		query += " AND (SELECT g.id FROM groups g WHERE g.teacher_id = l.teacher_id AND g.name = ?) = ANY (l.group_ids)"
 		args = append(args, groupParam)
 	}
 	if subjectParam != "" {
@@ -94,11 +107,8 @@ func (h *AttendanceHandler) GetAttendance(w http.ResponseWriter, r *http.Request
 
 	// Calculate attendance rates
 	for i := range records {
-		if records[i].TotalStudents > 0 {
-			records[i].AttendanceRate = float64(records[i].AttendedStudents) / float64(records[i].TotalStudents) * 100
-		} else {
-			records[i].AttendanceRate = 0
-		}
+		records[i].AttendedStudents = records[i].Attended()
+		records[i].AttendanceRate = records[i].AttendanceCounts.AttendanceRate()
 
 		// Format date to a more readable format
 		if date, err := time.Parse("2006-01-02", records[i].Date); err == nil {
@@ -114,6 +124,8 @@ type StudentAttendanceResponse struct {
 	ID       int    `json:"id"`
 	FIO      string `json:"fio"`
 	Attended bool   `json:"attended"`
+	Status   string `json:"status"`
+	Note     string `json:"note,omitempty"`
 }
 
 // GetLessonAttendance returns attendance for a specific lesson
@@ -134,12 +146,7 @@ func (h *AttendanceHandler) GetLessonAttendance(w http.ResponseWriter, r *http.R
 	}
 
 	// Verify the lesson belongs to this teacher
-	var groupName string
-	err = h.DB.Model(&models.Lesson{}).
-		Select("group_name").
-		Where("id = ? AND teacher_id = ?", lessonID, userID).
-		Pluck("group_name", &groupName).Error
-
+	groupIDs, err := lessonGroupIDs(h.DB, userID, lessonID)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusNotFound, "Lesson not found or access denied")
 		return
@@ -153,10 +160,11 @@ func (h *AttendanceHandler) GetLessonAttendance(w http.ResponseWriter, r *http.R
 		GroupName string `json:"group_name"`
 		Topic     string `json:"topic"`
 		Type      string `json:"type"`
+		Version   int    `json:"version"`
 	}
 
 	if err := h.DB.Model(&models.Lesson{}).
-		Select("id, date, subject, group_name, topic, type").
+		Select("id, date, subject, group_name, topic, type, attendance_version as version").
 		Where("id = ?", lessonID).
 		First(&lesson).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving lesson details")
@@ -173,12 +181,13 @@ func (h *AttendanceHandler) GetLessonAttendance(w http.ResponseWriter, r *http.R
 
 	// Note the use of "attendances" table name instead of "attendance"
 	err = h.DB.Raw(`
-		SELECT s.id, s.student_fio as fio, COALESCE(a.attended, 0) as attended
+		SELECT s.id, s.student_fio as fio, COALESCE(a.attended, 0) as attended,
+			COALESCE(a.status, 'absent') as status, COALESCE(a.note, '') as note
 		FROM students s
 		LEFT JOIN attendances a ON s.id = a.student_id AND a.lesson_id = ?
-		WHERE s.teacher_id = ? AND s.group_name = ?
+		WHERE s.teacher_id = ? AND s.group_id IN ?
 		ORDER BY s.student_fio
-	`, lessonID, userID, groupName).Scan(&students).Error
+	`, lessonID, userID, groupIDs).Scan(&students).Error
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving students attendance")
@@ -186,40 +195,45 @@ func (h *AttendanceHandler) GetLessonAttendance(w http.ResponseWriter, r *http.R
 	}
 
 	// Calculate statistics
-	totalStudents := len(students)
-	attendedStudents := 0
+	var counts utils.AttendanceCounts
 	for _, s := range students {
-		if s.Attended {
-			attendedStudents++
-		}
-	}
-
-	attendanceRate := 0.0
-	if totalStudents > 0 {
-		attendanceRate = float64(attendedStudents) / float64(totalStudents) * 100
+		counts.Add(s.Status, 1)
 	}
 
 	// Prepare response
 	response := struct {
-		Lesson           interface{} `json:"lesson"`
-		Students         interface{} `json:"students"`
-		TotalStudents    int         `json:"total_students"`
-		AttendedStudents int         `json:"attended_students"`
-		AttendanceRate   float64     `json:"attendance_rate"`
+		Lesson           interface{}            `json:"lesson"`
+		Students         interface{}            `json:"students"`
+		TotalStudents    int                    `json:"total_students"`
+		AttendedStudents int                    `json:"attended_students"`
+		AttendanceRate   float64                `json:"attendance_rate"`
+		Statuses         utils.AttendanceCounts `json:"statuses"`
 	}{
 		Lesson:           lesson,
 		Students:         students,
-		TotalStudents:    totalStudents,
-		AttendedStudents: attendedStudents,
-		AttendanceRate:   attendanceRate,
+		TotalStudents:    len(students),
+		AttendedStudents: counts.Attended(),
+		AttendanceRate:   counts.AttendanceRate(),
+		Statuses:         counts,
 	}
 
+	w.Header().Set("ETag", attendanceETag(lesson.Version))
 	utils.RespondWithSuccess(w, http.StatusOK, "Lesson attendance retrieved successfully", response)
 }
 
-// SaveAttendanceRequest defines the request body for saving attendance
+// AttendanceMark is a single student's attendance status for a lesson
+type AttendanceMark struct {
+	StudentID int    `json:"student_id"`
+	Status    string `json:"status"`
+	Note      string `json:"note,omitempty"`
+}
+
+// SaveAttendanceRequest defines the request body for saving attendance.
+// Records takes precedence; AttendedStudentIDs is kept for older clients
+// and marks the listed students present.
 type SaveAttendanceRequest struct {
-	AttendedStudentIDs []int `json:"attended_student_ids"`
+	AttendedStudentIDs []int            `json:"attended_student_ids"`
+	Records            []AttendanceMark `json:"records,omitempty"`
 }
 
 // SaveAttendance saves attendance records for a lesson
@@ -246,34 +260,47 @@ func (h *AttendanceHandler) SaveAttendance(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Verify the lesson belongs to this teacher
-	var groupName string
-	err = h.DB.Model(&models.Lesson{}).
-		Select("group_name").
-		Where("id = ? AND teacher_id = ?", lessonID, userID).
-		Pluck("group_name", &groupName).Error
+	// Validate statuses
+	for _, mark := range req.Records {
+		if !utils.IsValidAttendanceStatus(mark.Status) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid attendance status: "+mark.Status)
+			return
+		}
+	}
 
+	// Verify the lesson belongs to this teacher
+	groupIDs, err := lessonGroupIDs(h.DB, userID, lessonID)
 	if err != nil {
 		utils.RespondWithError(w, http.StatusNotFound, "Lesson not found or access denied")
 		return
 	}
 
+	// Honour If-Match when the client sends it
+	expectedVersion, hasVersion := parseIfMatch(r)
+
 	// Start transaction
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := bumpAttendanceVersion(tx, lessonID, expectedVersion, hasVersion); err != nil {
+			return err
+		}
+
 		// Delete existing attendance records - note the table name "attendances"
 		if err := tx.Where("lesson_id = ?", lessonID).Delete(&models.Attendance{}).Error; err != nil {
 			return err
 		}
 
 		// Create a map for faster lookup
-		attendedMap := make(map[int]bool)
+		marks := make(map[int]AttendanceMark)
 		for _, id := range req.AttendedStudentIDs {
-			attendedMap[id] = true
+			marks[id] = AttendanceMark{StudentID: id, Status: models.AttendanceStatusPresent}
+		}
+		for _, mark := range req.Records {
+			marks[mark.StudentID] = mark
 		}
 
-		// Get all students in this group
+		// Get all students of the lesson's groups
 		var students []models.Student
-		if err := tx.Where("teacher_id = ? AND group_name = ?", userID, groupName).Find(&students).Error; err != nil {
+		if err := tx.Where("teacher_id = ? AND group_id IN ?", userID, groupIDs).Find(&students).Error; err != nil {
 			return err
 		}
 
@@ -281,15 +308,17 @@ func (h *AttendanceHandler) SaveAttendance(w http.ResponseWriter, r *http.Reques
 		var attendanceRecords []models.Attendance
 
 		for _, student := range students {
-			attended := 0
-			if attendedMap[student.ID] {
-				attended = 1
+			mark, ok := marks[student.ID]
+			if !ok {
+				mark.Status = models.AttendanceStatusAbsent
 			}
 
 			attendanceRecords = append(attendanceRecords, models.Attendance{
 				LessonID:  lessonID,
 				StudentID: student.ID,
-				Attended:  attended,
+				Attended:  utils.AttendedValue(mark.Status),
+				Status:    mark.Status,
+				Note:      mark.Note,
 			})
 		}
 
@@ -301,6 +330,10 @@ func (h *AttendanceHandler) SaveAttendance(w http.ResponseWriter, r *http.Reques
 		return nil
 	})
 
+	if errors.Is(err, errAttendanceVersionConflict) {
+		utils.RespondWithError(w, http.StatusConflict, "Attendance was changed by someone else, reload and try again")
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving attendance")
 		return
@@ -308,11 +341,200 @@ func (h *AttendanceHandler) SaveAttendance(w http.ResponseWriter, r *http.Reques
 
 	// Log the action
 	utils.LogAction(h.DB, userID, "Save Attendance",
-		fmt.Sprintf("Saved attendance for lesson ID %d, group %s", lessonID, groupName))
+		fmt.Sprintf("Saved attendance for lesson ID %d", lessonID))
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Attendance saved successfully", nil)
 }
 
+// errAttendanceVersionConflict is returned when a client saves attendance against a stale version
+var errAttendanceVersionConflict = errors.New("attendance version conflict")
+
+// attendanceETag formats a lesson attendance version as an ETag value
+func attendanceETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// parseIfMatch reads the expected attendance version from the If-Match header
+func parseIfMatch(r *http.Request) (int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	value = strings.TrimPrefix(value, "W/")
+	value = strings.Trim(value, "\"")
+	if value == "" {
+		return 0, false
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return -1, true // never matches
+	}
+	return version, true
+}
+
+// bumpAttendanceVersion increments the lesson's attendance version. When check
+// is set the update only succeeds if the current version equals expected.
+func bumpAttendanceVersion(tx *gorm.DB, lessonID, expected int, check bool) error {
+	query := tx.Model(&models.Lesson{}).Where("id = ?", lessonID)
+	if check {
+		query = query.Where("attendance_version = ?", expected)
+	}
+
+	result := query.Update("attendance_version", gorm.Expr("attendance_version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errAttendanceVersionConflict
+	}
+	return nil
+}
+
+// PatchAttendanceRequest defines the request body for an incremental attendance update.
+// Version may be given instead of the If-Match header.
+type PatchAttendanceRequest struct {
+	Version *int             `json:"version,omitempty"`
+	Records []AttendanceMark `json:"records"`
+}
+
+// PatchAttendance updates only the listed students' marks for a lesson
+func (h *AttendanceHandler) PatchAttendance(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get lesson ID from URL
+	vars := mux.Vars(r)
+	lessonID, err := strconv.Atoi(vars["lessonId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid lesson ID")
+		return
+	}
+
+	// Parse request body
+	var req PatchAttendanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// The client must say which version it is editing
+	expectedVersion, hasVersion := parseIfMatch(r)
+	if !hasVersion && req.Version != nil {
+		expectedVersion, hasVersion = *req.Version, true
+	}
+	if !hasVersion {
+		utils.RespondWithError(w, http.StatusBadRequest, "Attendance version is required (If-Match header or version field)")
+		return
+	}
+
+	if len(req.Records) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "No attendance changes provided")
+		return
+	}
+	for _, mark := range req.Records {
+		if !utils.IsValidAttendanceStatus(mark.Status) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid attendance status: "+mark.Status)
+			return
+		}
+	}
+
+	// Verify the lesson belongs to this teacher
+	var lesson models.Lesson
+	if err := h.DB.Where("id = ? AND teacher_id = ?", lessonID, userID).First(&lesson).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Lesson not found or access denied")
+		return
+	}
+
+	// Load the students being marked
+	studentIDs := make([]int, 0, len(req.Records))
+	for _, mark := range req.Records {
+		studentIDs = append(studentIDs, mark.StudentID)
+	}
+	var students []models.Student
+	// A combined lesson has students of several groups
+	if err := h.DB.Where("id IN ? AND teacher_id = ? AND group_id IN ?", studentIDs, userID, []int64(lesson.GroupIDs)).
+		Find(&students).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving students")
+		return
+	}
+	studentNames := make(map[int]string, len(students))
+	for _, student := range students {
+		studentNames[student.ID] = student.StudentFIO
+	}
+	for _, mark := range req.Records {
+		if _, ok := studentNames[mark.StudentID]; !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Student %d is not in this lesson's groups", mark.StudentID))
+			return
+		}
+	}
+
+	changed := 0
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Bumping the version first also locks the lesson row against concurrent saves
+		if err := bumpAttendanceVersion(tx, lessonID, expectedVersion, true); err != nil {
+			return err
+		}
+
+		for _, mark := range req.Records {
+			var record models.Attendance
+			err := tx.Where("lesson_id = ? AND student_id = ?", lessonID, mark.StudentID).First(&record).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			oldStatus := "none"
+			if err == nil {
+				if record.Status == mark.Status && record.Note == mark.Note {
+					continue
+				}
+				oldStatus = record.Status
+				if err := tx.Model(&record).Updates(map[string]interface{}{
+					"status":   mark.Status,
+					"note":     mark.Note,
+					"attended": utils.AttendedValue(mark.Status),
+				}).Error; err != nil {
+					return err
+				}
+			} else {
+				record = models.Attendance{
+					LessonID:  lessonID,
+					StudentID: mark.StudentID,
+					Attended:  utils.AttendedValue(mark.Status),
+					Status:    mark.Status,
+					Note:      mark.Note,
+				}
+				if err := tx.Create(&record).Error; err != nil {
+					return err
+				}
+			}
+
+			changed++
+			utils.LogAction(tx, userID, "Update Attendance Mark",
+				fmt.Sprintf("Lesson ID %d, student %s (ID: %d): %s -> %s",
+					lessonID, studentNames[mark.StudentID], mark.StudentID, oldStatus, mark.Status))
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errAttendanceVersionConflict) {
+		utils.RespondWithError(w, http.StatusConflict, "Attendance was changed by someone else, reload and try again")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving attendance")
+		return
+	}
+
+	newVersion := expectedVersion + 1
+	w.Header().Set("ETag", attendanceETag(newVersion))
+	utils.RespondWithSuccess(w, http.StatusOK, "Attendance updated successfully", map[string]interface{}{
+		"version": newVersion,
+		"changed": changed,
+	})
+}
+
 // DeleteAttendance deletes attendance records for a lesson
 func (h *AttendanceHandler) DeleteAttendance(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -338,7 +560,13 @@ func (h *AttendanceHandler) DeleteAttendance(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Delete attendance records - note the table name "attendances"
-	if err := h.DB.Where("lesson_id = ?", lessonID).Delete(&models.Attendance{}).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := bumpAttendanceVersion(tx, lessonID, 0, false); err != nil {
+			return err
+		}
+		return tx.Where("lesson_id = ?", lessonID).Delete(&models.Attendance{}).Error
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting attendance records")
 		return
 	}
@@ -398,6 +626,32 @@ func (h *AttendanceHandler) ExportAttendance(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// attendanceMarks maps attendance statuses to the symbols used in exports
+var attendanceMarks = map[string]string{
+	models.AttendanceStatusPresent: "✓",
+	models.AttendanceStatusLate:    "О",
+	models.AttendanceStatusExcused: "У",
+	models.AttendanceStatusSick:    "Б",
+	models.AttendanceStatusAbsent:  "✗",
+}
+
+// attendanceLegend explains the export symbols
+const attendanceLegend = "✓ - present, О - late, У - excused, Б - sick, ✗ - absent"
+
+// lessonAttendanceStatus returns a student's status for a lesson, or absent if not recorded
+func (h *AttendanceHandler) lessonAttendanceStatus(lessonID, studentID int) string {
+	var status string
+	err := h.DB.Raw(`
+		SELECT COALESCE(status, 'absent')
+		FROM attendances
+		WHERE lesson_id = ? AND student_id = ?
+	`, lessonID, studentID).Scan(&status).Error
+	if err != nil || status == "" {
+		return models.AttendanceStatusAbsent
+	}
+	return status
+}
+
 // Helper function to export attendance by group
 func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.File) error {
 	// Get all subjects taught by this teacher with attendance
@@ -426,16 +680,16 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 
 		// Get all lessons for this subject with attendance
 		type LessonInfo struct {
-			ID      int
-			Date    string
-			DateFmt string
-			Group   string
-			Topic   string
+			ID       int
+			Date     string
+			DateFmt  string
+			GroupIDs pq.Int64Array
+			Topic    string
 		}
 
 		var lessons []LessonInfo
 		err = h.DB.Raw(`
-            SELECT l.id, l.date, l.group_name as Group, l.topic
+            SELECT l.id, l.date, l.group_ids, l.topic
             FROM lessons l
             WHERE l.teacher_id = ? AND l.subject = ? AND EXISTS (
                 SELECT 1 FROM attendances a WHERE a.lesson_id = l.id
@@ -488,17 +742,10 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 			headerCell := headerRow.AddCell()
 			headerCell.SetString(formattedDate)
 		}
+		headerRow.AddCell().SetString("Attendance %")
 
 		// Get all groups for this subject
-		var groups []string
-		err = h.DB.Raw(`
-            SELECT DISTINCT l.group_name
-            FROM lessons l
-            WHERE l.teacher_id = ? AND l.subject = ? AND EXISTS (
-                SELECT 1 FROM attendances a WHERE a.lesson_id = l.id
-            )
-            ORDER BY l.group_name
-        `, teacherID, subject).Scan(&groups).Error
+		groups, err := h.groupsWithAttendance(teacherID, subject)
 
 		if err != nil {
 			log.Printf("Error fetching groups for subject %s: %v", subject, err)
@@ -516,12 +763,12 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 			err = h.DB.Raw(`
                 SELECT id, student_fio
                 FROM students
-                WHERE teacher_id = ? AND group_name = ?
+                WHERE teacher_id = ? AND group_id = ?
                 ORDER BY student_fio
-            `, teacherID, group).Scan(&students).Error
+            `, teacherID, group.ID).Scan(&students).Error
 
 			if err != nil {
-				log.Printf("Error fetching students for group %s: %v", group, err)
+				log.Printf("Error fetching students for group %s: %v", group.Name, err)
 				return err
 			}
 
@@ -532,7 +779,7 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 
 				// Only show group name for first student in group
 				if firstStudent {
-					row.AddCell().SetString(group)
+					row.AddCell().SetString(group.Name)
 					firstStudent = false
 				} else {
 					row.AddCell().SetString("")
@@ -541,43 +788,38 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 				row.AddCell().SetString(student.StudentFIO)
 
 				// For each date
+				var counts utils.AttendanceCounts
 				for _, dateStr := range dates {
 					// Find all lessons for this date and group
-					var attended bool
-					var lessonFound bool
+					status := ""
 
 					for _, lesson := range lessonsByDate[dateStr] {
-						if lesson.Group == group {
-							lessonFound = true
-
-							// Check attendance
-							var attendanceValue int
-							err := h.DB.Raw(`
-                                SELECT COALESCE(attended, 0)
-                                FROM attendances
-                                WHERE lesson_id = ? AND student_id = ?
-                            `, lesson.ID, student.ID).Scan(&attendanceValue).Error
-
-							if err == nil && attendanceValue == 1 {
-								attended = true
+						if containsGroupID(lesson.GroupIDs, group.ID) {
+							// An attended lesson wins over other lessons on the same date
+							lessonStatus := h.lessonAttendanceStatus(lesson.ID, student.ID)
+							if status == "" || utils.AttendedValue(lessonStatus) == 1 {
+								status = lessonStatus
+							}
+							if utils.AttendedValue(status) == 1 {
 								break
 							}
 						}
 					}
 
 					attendanceCell := row.AddCell()
-					if lessonFound {
-						if attended {
-							attendanceCell.SetString("✓") // Present
-						} else {
-							attendanceCell.SetString("✗") // Absent
-						}
+					if status != "" {
+						attendanceCell.SetString(attendanceMarks[status])
+						counts.Add(status, 1)
 					} else {
 						attendanceCell.SetString("-") // No lesson for this group on this date
 					}
 				}
+				row.AddCell().SetFloatWithFormat(counts.AttendanceRate(), "0.0")
 			}
 		}
+
+		sheet.AddRow()
+		sheet.AddRow().AddCell().SetString(attendanceLegend)
 	}
 
 	return nil
@@ -586,15 +828,7 @@ func (h *AttendanceHandler) exportAttendanceByGroup(teacherID int, file *xlsx.Fi
 // Helper function to export attendance by lesson
 func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.File) error {
 	// Get all groups for this teacher with attendance data
-	var groups []string
-	err := h.DB.Raw(`
-		SELECT DISTINCT l.group_name
-		FROM lessons l
-		JOIN attendances a ON l.id = a.lesson_id
-		WHERE l.teacher_id = ?
-		ORDER BY l.group_name
-	`, teacherID).Scan(&groups).Error
-
+	groups, err := h.groupsWithAttendance(teacherID, "")
 	if err != nil {
 		return err
 	}
@@ -602,7 +836,7 @@ func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.F
 	// Process each group
 	for _, group := range groups {
 		// Create a worksheet for this group
-		sheet, err := file.AddSheet(group)
+		sheet, err := file.AddSheet(group.Name)
 		if err != nil {
 			return err
 		}
@@ -620,11 +854,11 @@ func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.F
 		err = h.DB.Raw(`
 			SELECT l.id, l.subject, l.topic, l.date
 			FROM lessons l
-			WHERE l.teacher_id = ? AND l.group_name = ? AND EXISTS (
+			WHERE l.teacher_id = ? AND ? = ANY (l.group_ids) AND EXISTS (
 				SELECT 1 FROM attendances a WHERE a.lesson_id = l.id
 			)
 			ORDER BY l.date
-		`, teacherID, group).Scan(&lessons).Error
+		`, teacherID, group.ID).Scan(&lessons).Error
 
 		if err != nil {
 			return err
@@ -655,6 +889,7 @@ func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.F
 			headerCell := headerRow.AddCell()
 			headerCell.SetString(fmt.Sprintf("%s: %s (%s)", lesson.Subject, lesson.Topic, lesson.DateFmt))
 		}
+		headerRow.AddCell().SetString("Attendance %")
 
 		// Get all students in this group
 		var students []struct {
@@ -665,9 +900,9 @@ func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.F
 		err = h.DB.Raw(`
 			SELECT id, student_fio
 			FROM students
-			WHERE teacher_id = ? AND group_name = ?
+			WHERE teacher_id = ? AND group_id = ?
 			ORDER BY student_fio
-		`, teacherID, group).Scan(&students).Error
+		`, teacherID, group.ID).Scan(&students).Error
 
 		if err != nil {
 			return err
@@ -679,23 +914,60 @@ func (h *AttendanceHandler) exportAttendanceByLesson(teacherID int, file *xlsx.F
 			row.AddCell().SetString(student.StudentFIO)
 
 			// Add attendance for each lesson
+			var counts utils.AttendanceCounts
 			for _, lesson := range lessons {
-				var attended int
-				err := h.DB.Raw(`
-					SELECT COALESCE(attended, 0)
-					FROM attendances
-					WHERE lesson_id = ? AND student_id = ?
-				`, lesson.ID, student.ID).Scan(&attended).Error
-
-				attendanceCell := row.AddCell()
-				if err == nil && attended == 1 {
-					attendanceCell.SetString("✓") // Present
-				} else {
-					attendanceCell.SetString("✗") // Absent
-				}
+				status := h.lessonAttendanceStatus(lesson.ID, student.ID)
+				counts.Add(status, 1)
+				row.AddCell().SetString(attendanceMarks[status])
 			}
+			row.AddCell().SetFloatWithFormat(counts.AttendanceRate(), "0.0")
 		}
+
+		sheet.AddRow()
+		sheet.AddRow().AddCell().SetString(attendanceLegend)
 	}
 
 	return nil
 }
+
+// lessonGroupIDs returns the groups of a lesson of the teacher; a combined lesson has several
+func lessonGroupIDs(database *gorm.DB, teacherID, lessonID int) ([]int64, error) {
+	var lesson models.Lesson
+	if err := database.Select("id, group_ids").Where("id = ? AND teacher_id = ?", lessonID, teacherID).
+		First(&lesson).Error; err != nil {
+		return nil, err
+	}
+	return []int64(lesson.GroupIDs), nil
+}
+
+// attendanceGroup is a group that has lessons with attendance
+type attendanceGroup struct {
+	ID   int
+	Name string
+}
+
+// groupsWithAttendance returns the teacher's groups with attendance records, of one subject when given
+func (h *AttendanceHandler) groupsWithAttendance(teacherID int, subject string) ([]attendanceGroup, error) {
+	var groups []attendanceGroup
+	err := h.DB.Raw(`
+		SELECT g.id, g.name
+		FROM groups g
+		WHERE g.teacher_id = ? AND EXISTS (
+			SELECT 1 FROM lessons l
+			WHERE l.teacher_id = g.teacher_id AND g.id = ANY (l.group_ids) AND (? = '' OR l.subject = ?)
+				AND EXISTS (SELECT 1 FROM attendances a WHERE a.lesson_id = l.id)
+		)
+		ORDER BY g.name
+	`, teacherID, subject, subject).Scan(&groups).Error
+	return groups, err
+}
+
+// containsGroupID reports whether a lesson is held for the group
+func containsGroupID(groupIDs pq.Int64Array, groupID int) bool {
+	for _, id := range groupIDs {
+		if id == int64(groupID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"TeacherJournal/app/dashboard/models"
+	"TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/config"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// calendarFeedHistoryDays limits how far back the feed publishes lessons
+const calendarFeedHistoryDays = 180
+
+// CalendarHandler handles iCalendar feed requests
+type CalendarHandler struct {
+	DB *gorm.DB
+}
+
+// NewCalendarHandler creates a new CalendarHandler
+func NewCalendarHandler(database *gorm.DB) *CalendarHandler {
+	return &CalendarHandler{
+		DB: database,
+	}
+}
+
+// feedURL builds the public subscription URL for a token
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := r.Host
+	if host == "" {
+		host = "localhost:8080" // Default for local development
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, host)
+	return fmt.Sprintf("%s/api/calendar/%s.ics", baseURL, token)
+}
+
+// feedResponse is returned by the feed management endpoints
+func feedResponse(r *http.Request, feed models.CalendarFeed) map[string]interface{} {
+	return map[string]interface{}{
+		"token":        feed.Token,
+		"url":          feedURL(r, feed.Token),
+		"created_at":   feed.CreatedAt.Format(time.RFC3339),
+		"access_count": feed.AccessCount,
+	}
+}
+
+// GetFeed returns the current teacher's calendar feed, creating it on first use
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var feed models.CalendarFeed
+	err = h.DB.Where("teacher_id = ?", userID).First(&feed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		token, err := generateToken(32)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error generating token")
+			return
+		}
+
+		feed = models.CalendarFeed{
+			Token:     token,
+			TeacherID: userID,
+			CreatedAt: time.Now(),
+		}
+		if err := h.DB.Create(&feed).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error creating calendar feed")
+			return
+		}
+
+		utils.LogAction(h.DB, userID, "Create Calendar Feed", "Created iCalendar feed link")
+	} else if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving calendar feed")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Calendar feed retrieved successfully", feedResponse(r, feed))
+}
+
+// RegenerateFeed replaces the feed token, invalidating old subscription URLs
+func (h *CalendarHandler) RegenerateFeed(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	token, err := generateToken(32)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+
+	// Drop the old link and create a fresh one
+	feed := models.CalendarFeed{
+		Token:     token,
+		TeacherID: userID,
+		CreatedAt: time.Now(),
+	}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("teacher_id = ?", userID).Delete(&models.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&feed).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error regenerating calendar feed")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Regenerate Calendar Feed", "Regenerated iCalendar feed link")
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Calendar feed regenerated successfully", feedResponse(r, feed))
+}
+
+// DeleteFeed disables the teacher's calendar feed
+func (h *CalendarHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	result := h.DB.Where("teacher_id = ?", userID).Delete(&models.CalendarFeed{})
+	if result.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting calendar feed")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "Calendar feed not found")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Delete Calendar Feed", "Deleted iCalendar feed link")
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Calendar feed deleted successfully", nil)
+}
+
+// GetCalendar serves the public iCalendar feed for a token
+func (h *CalendarHandler) GetCalendar(w http.ResponseWriter, r *http.Request) {
+	// Get token from URL
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	var feed models.CalendarFeed
+	if err := h.DB.Where("token = ?", token).First(&feed).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Calendar feed not found")
+		return
+	}
+
+	var teacher models.User
+	if err := h.DB.Select("id, fio").Where("id = ?", feed.TeacherID).First(&teacher).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving teacher information")
+		return
+	}
+
+	// Get lessons
+	fromDate := time.Now().AddDate(0, 0, -calendarFeedHistoryDays).Format("2006-01-02")
+	var lessons []models.Lesson
+	if err := h.DB.Where("teacher_id = ? AND date >= ?", feed.TeacherID, fromDate).
+		Order("date, time").
+		Find(&lessons).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving lessons")
+		return
+	}
+
+	events := make([]utils.ICSEvent, 0, len(lessons))
+	for _, lesson := range lessons {
+		groups := lesson.GroupName
+		if len(lesson.Groups) > 0 {
+			groups = strings.Join(lesson.Groups, ", ")
+		}
+
+		event := utils.ICSEvent{
+			UID:      fmt.Sprintf("lesson-%d@teacher-journal", lesson.ID),
+			Summary:  fmt.Sprintf("%s (%s)", lesson.Subject, lesson.Type),
+			Location: lesson.Auditorium,
+			Description: fmt.Sprintf("Тип: %s\nГруппы: %s\nТема: %s",
+				lesson.Type, groups, lesson.Topic),
+		}
+
+		// Lessons without a pair time become all-day events
+		start, end, err := utils.ParsePairTime(lesson.Date, lesson.Time, config.ScheduleLocation)
+		if err == nil {
+			event.Start, event.End = start, end
+		} else {
+			day, err := time.ParseInLocation("2006-01-02", lesson.Date, config.ScheduleLocation)
+			if err != nil {
+				log.Printf("Skipping lesson %d with invalid date %q", lesson.ID, lesson.Date)
+				continue
+			}
+			event.Start, event.AllDay = day, true
+		}
+
+		events = append(events, event)
+	}
+
+	// Update access statistics
+	now := time.Now()
+	h.DB.Model(&feed).Updates(map[string]interface{}{
+		"access_count":     gorm.Expr("access_count + 1"),
+		"last_accessed_at": now,
+	})
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=lessons.ics")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(utils.BuildICS("Занятия: "+teacher.FIO, events)))
+}
@@ -105,15 +105,28 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 
 	// Get groups
 	var groups []string
+	h.DB.Model(&models.Group{}).
+		Where("teacher_id = ? AND archived_at IS NULL", userID).
+		Order("name").
+		Pluck("name", &groups)
+
+	// Get attendance statistics
+	var statusCounts []struct {
+		Status string
+		Count  int
+	}
 	h.DB.Raw(`
-		SELECT DISTINCT group_name 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? 
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ?
-		) AS combined_groups 
-		ORDER BY group_name
-	`, userID, userID).Scan(&groups)
+		SELECT a.status, COUNT(*) as count
+		FROM attendances a
+		JOIN lessons l ON l.id = a.lesson_id
+		WHERE l.teacher_id = ? AND l.date >= ?
+		GROUP BY a.status
+	`, userID, dateStr).Scan(&statusCounts)
+
+	var attendance utils.AttendanceCounts
+	for _, sc := range statusCounts {
+		attendance.Add(sc.Status, sc.Count)
+	}
 
 	// Return statistics
 	utils.RespondWithSuccess(w, http.StatusOK, "Dashboard stats retrieved", map[string]interface{}{
@@ -122,5 +135,10 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 		"subjects":      subjects,
 		"groups":        groups,
 		"has_lessons":   totalLessons > 0,
+		"attendance": map[string]interface{}{
+			"statuses":               attendance,
+			"attendance_rate":        attendance.AttendanceRate(),
+			"unexcused_absence_rate": attendance.UnexcusedAbsenceRate(),
+		},
 	})
 }
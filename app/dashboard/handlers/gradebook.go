@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"TeacherJournal/app/dashboard/db"
+	"TeacherJournal/app/dashboard/models"
+	"TeacherJournal/app/dashboard/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/tealeg/xlsx"
+	"gorm.io/gorm"
+)
+
+// GradebookHandler handles gradebook requests
+type GradebookHandler struct {
+	DB *gorm.DB
+}
+
+// NewGradebookHandler creates a new GradebookHandler
+func NewGradebookHandler(database *gorm.DB) *GradebookHandler {
+	return &GradebookHandler{
+		DB: database,
+	}
+}
+
+// GradebookWeights is the weighting used for a subject and group
+type GradebookWeights struct {
+	Attendance    int `json:"attendance"`
+	Labs          int `json:"labs"`
+	Tests         int `json:"tests"`
+	PassThreshold int `json:"pass_threshold"`
+}
+
+// GradebookTest is a test that counts towards the gradebook
+type GradebookTest struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+// GradebookRow is one student's combined results
+type GradebookRow struct {
+	StudentID      int     `json:"student_id"`
+	StudentFIO     string  `json:"student_fio"`
+	AttendanceRate float64 `json:"attendance_rate"`
+	// False when the student has no records that count, e.g. only excused absences
+	AttendanceCounted bool            `json:"attendance_counted"`
+	LabAverage        float64         `json:"lab_average"`
+	LabPercent        float64         `json:"lab_percent"`
+	TestScores        map[int]float64 `json:"test_scores"`
+	TestPercent       float64         `json:"test_percent"`
+	Total             float64         `json:"total"`
+	FinalMark         int             `json:"final_mark"`
+	Passed            bool            `json:"passed"`
+	PassLabel         string          `json:"pass_label"`
+}
+
+// Gradebook is the combined grade sheet for a subject and group
+type Gradebook struct {
+	Subject       string           `json:"subject"`
+	GroupName     string           `json:"group_name"`
+	Weights       GradebookWeights `json:"weights"`
+	TotalLabs     int              `json:"total_labs"`
+	Tests         []GradebookTest  `json:"tests"`
+	HasAttendance bool             `json:"has_attendance"`
+	HasLabs       bool             `json:"has_labs"`
+	HasTests      bool             `json:"has_tests"`
+	Students      []GradebookRow   `json:"students"`
+	GroupAverage  float64          `json:"group_average"`
+}
+
+// loadWeights returns saved weights for the subject and group, or the defaults
+func (h *GradebookHandler) loadWeights(teacherID, groupID int, subject string) GradebookWeights {
+	weights := GradebookWeights{
+		Attendance:    utils.DefaultAttendanceWeight,
+		Labs:          utils.DefaultLabWeight,
+		Tests:         utils.DefaultTestWeight,
+		PassThreshold: utils.DefaultPassThreshold,
+	}
+
+	var settings models.GradebookSettings
+	if err := h.DB.Where("teacher_id = ? AND group_id = ? AND subject = ?",
+		teacherID, groupID, subject).First(&settings).Error; err == nil {
+		weights = GradebookWeights{
+			Attendance:    settings.AttendanceWeight,
+			Labs:          settings.LabWeight,
+			Tests:         settings.TestWeight,
+			PassThreshold: settings.PassThreshold,
+		}
+	}
+	return weights
+}
+
+// buildGradebook collects attendance, lab grades and test scores for every student of the group
+func (h *GradebookHandler) buildGradebook(teacherID int, subject string, group models.Group) (*Gradebook, error) {
+	book := &Gradebook{
+		Subject:   subject,
+		GroupName: group.Name,
+		Weights:   h.loadWeights(teacherID, group.ID, subject),
+		TotalLabs: 5, // Default
+		Tests:     []GradebookTest{},
+		Students:  []GradebookRow{},
+	}
+
+	// Get lab settings
+	var labSettings models.LabSettings
+	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_id = ?",
+		teacherID, subject, group.ID).First(&labSettings).Error; err == nil {
+		book.TotalLabs = labSettings.TotalLabs
+	}
+
+	// Get students in this group
+	var students []models.Student
+	if err := h.DB.Where("group_id = ?", group.ID).Order("student_fio").Find(&students).Error; err != nil {
+		return nil, err
+	}
+	if len(students) == 0 {
+		return book, nil
+	}
+
+	studentIDs := make([]int, 0, len(students))
+	for _, s := range students {
+		studentIDs = append(studentIDs, s.ID)
+	}
+
+	// Attendance per student and status for this subject
+	var attendanceRows []struct {
+		StudentID int
+		Status    string
+		Count     int
+	}
+	if err := h.DB.Raw(`
+		SELECT a.student_id, a.status, COUNT(*) as count
+		FROM attendances a
+		JOIN lessons l ON l.id = a.lesson_id
+		WHERE l.teacher_id = ? AND l.subject = ? AND ? = ANY (l.group_ids) AND a.student_id IN ?
+		GROUP BY a.student_id, a.status
+	`, teacherID, subject, group.ID, studentIDs).Scan(&attendanceRows).Error; err != nil {
+		return nil, err
+	}
+	attendance := make(map[int]*utils.AttendanceCounts)
+	for _, row := range attendanceRows {
+		if attendance[row.StudentID] == nil {
+			attendance[row.StudentID] = &utils.AttendanceCounts{}
+		}
+		attendance[row.StudentID].Add(row.Status, row.Count)
+	}
+	book.HasAttendance = len(attendanceRows) > 0
+
+	// Lab grades per student
+	var labRows []struct {
+		StudentID int
+		Total     int
+		Count     int
+	}
+	if err := h.DB.Raw(`
+		SELECT student_id, COALESCE(SUM(grade), 0) as total, COUNT(*) as count
+		FROM lab_grades
+		WHERE teacher_id = ? AND subject = ? AND student_id IN ? AND grade > 0
+		GROUP BY student_id
+	`, teacherID, subject, studentIDs).Scan(&labRows).Error; err != nil {
+		return nil, err
+	}
+	labs := make(map[int]int)
+	for _, row := range labRows {
+		labs[row.StudentID] = row.Total
+	}
+	book.HasLabs = len(labRows) > 0
+
+	// Tests assigned to this group; the tests service shares the database.
+	// Tests linked to a lab already count as lab grades.
+	if h.DB.Migrator().HasTable("tests") {
+		linked := ""
+		if h.DB.Migrator().HasTable("test_grade_links") {
+			linked = " AND NOT EXISTS (SELECT 1 FROM test_grade_links l WHERE l.test_id = t.id)"
+		}
+		if err := h.DB.Raw(`
+			SELECT DISTINCT t.id, t.title
+			FROM tests t
+			JOIN test_groups tg ON tg.test_id = t.id
+			WHERE t.creator_id = ? AND t.subject = ?
+				AND (tg.group_id = ? OR (tg.group_id IS NULL AND tg.group_name = ?))`+linked+`
+			ORDER BY t.id
+		`, teacherID, subject, group.ID, group.Name).Scan(&book.Tests).Error; err != nil {
+			log.Printf("Error retrieving tests for gradebook: %v", err)
+		}
+	}
+	book.HasTests = len(book.Tests) > 0
+
+	testIDs := make([]int, 0, len(book.Tests))
+	for _, t := range book.Tests {
+		testIDs = append(testIDs, t.ID)
+	}
+
+	var groupTotal float64
+	for _, student := range students {
+		row := GradebookRow{
+			StudentID:  student.ID,
+			StudentFIO: student.StudentFIO,
+			TestScores: map[int]float64{},
+		}
+
+		if counts := attendance[student.ID]; counts != nil {
+			row.AttendanceRate = counts.AttendanceRate()
+			row.AttendanceCounted = counts.Countable() > 0
+		}
+
+		if book.TotalLabs > 0 {
+			row.LabAverage = float64(labs[student.ID]) / float64(book.TotalLabs)
+			row.LabPercent = row.LabAverage / 5 * 100
+		}
+
+		if len(testIDs) > 0 {
+			// Best completed attempt per test, as a share of its weighted maximum score.
+			// A student has one row per teacher, so attempts made under any of their rows in this group count.
+			var scores []struct {
+				TestID  int
+				Percent float64
+			}
+			if err := h.DB.Raw(`
+				SELECT ta.test_id,
+					MAX(CASE WHEN ta.max_score > 0 THEN ta.score * 100.0 / ta.max_score ELSE 0 END) as percent
+				FROM test_attempts ta
+				WHERE ta.completed = true AND ta.test_id IN ?
+					AND ta.student_id IN (`+db.StudentRecordsSQL+`)
+				GROUP BY ta.test_id
+			`, testIDs, student.StudentFIO, group.ID).Scan(&scores).Error; err != nil {
+				return nil, err
+			}
+
+			var sum float64
+			for _, s := range scores {
+				row.TestScores[s.TestID] = s.Percent
+				sum += s.Percent
+			}
+			// Tests that were not taken count as zero
+			row.TestPercent = sum / float64(len(testIDs))
+		}
+
+		row.Total = utils.WeightedScore(
+			utils.GradeComponent{Weight: float64(book.Weights.Attendance), Percent: row.AttendanceRate, Present: row.AttendanceCounted},
+			utils.GradeComponent{Weight: float64(book.Weights.Labs), Percent: row.LabPercent, Present: book.HasLabs},
+			utils.GradeComponent{Weight: float64(book.Weights.Tests), Percent: row.TestPercent, Present: book.HasTests},
+		)
+		row.FinalMark = utils.FinalMark(row.Total)
+		row.Passed = row.Total >= float64(book.Weights.PassThreshold)
+		row.PassLabel = utils.PassLabel(row.Passed)
+
+		groupTotal += row.Total
+		book.Students = append(book.Students, row)
+	}
+
+	book.GroupAverage = groupTotal / float64(len(book.Students))
+	return book, nil
+}
+
+// resolveGroup finds the teacher's group from the URL and writes an error response if it is missing
+func (h *GradebookHandler) resolveGroup(w http.ResponseWriter, teacherID int, groupName string) (models.Group, bool) {
+	group, err := db.FindGroup(h.DB, teacherID, groupName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving group")
+		}
+		return models.Group{}, false
+	}
+	return group, true
+}
+
+// GetGradebook returns the combined gradebook for a subject and group
+func (h *GradebookHandler) GetGradebook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get subject and group from URL
+	vars := mux.Vars(r)
+	subject := vars["subject"]
+	group, ok := h.resolveGroup(w, userID, vars["group"])
+	if !ok {
+		return
+	}
+
+	book, err := h.buildGradebook(userID, subject, group)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error building gradebook")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Gradebook retrieved successfully", book)
+}
+
+// UpdateGradebookSettingsRequest defines the request body for updating gradebook weights
+type UpdateGradebookSettingsRequest struct {
+	AttendanceWeight int  `json:"attendance_weight"`
+	LabWeight        int  `json:"lab_weight"`
+	TestWeight       int  `json:"test_weight"`
+	PassThreshold    *int `json:"pass_threshold,omitempty"`
+}
+
+// UpdateGradebookSettings saves the weights for a subject and group
+func (h *GradebookHandler) UpdateGradebookSettings(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get subject and group from URL
+	vars := mux.Vars(r)
+	subject := vars["subject"]
+	group, ok := h.resolveGroup(w, userID, vars["group"])
+	if !ok {
+		return
+	}
+
+	// Parse request body
+	var req UpdateGradebookSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	// Validate inputs
+	if req.AttendanceWeight < 0 || req.LabWeight < 0 || req.TestWeight < 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Weights must not be negative")
+		return
+	}
+	if req.AttendanceWeight+req.LabWeight+req.TestWeight != 100 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Weights must add up to 100")
+		return
+	}
+	passThreshold := utils.DefaultPassThreshold
+	if req.PassThreshold != nil {
+		passThreshold = *req.PassThreshold
+	}
+	if passThreshold < 0 || passThreshold > 100 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Pass threshold must be between 0 and 100")
+		return
+	}
+
+	// Create or update settings
+	var settings models.GradebookSettings
+	err = h.DB.Where("teacher_id = ? AND group_id = ? AND subject = ?", userID, group.ID, subject).
+		First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating gradebook settings")
+		return
+	}
+
+	settings.TeacherID = userID
+	settings.GroupID = group.ID
+	settings.Subject = subject
+	settings.AttendanceWeight = req.AttendanceWeight
+	settings.LabWeight = req.LabWeight
+	settings.TestWeight = req.TestWeight
+	settings.PassThreshold = passThreshold
+
+	if err := h.DB.Save(&settings).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating gradebook settings")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Update Gradebook Settings",
+		fmt.Sprintf("Updated gradebook weights for %s, %s: attendance %d%%, labs %d%%, tests %d%%",
+			subject, group.Name, req.AttendanceWeight, req.LabWeight, req.TestWeight))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Gradebook settings updated successfully", nil)
+}
+
+// ExportGradebook exports the gradebook to Excel
+func (h *GradebookHandler) ExportGradebook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get subject and group from URL
+	vars := mux.Vars(r)
+	subject := vars["subject"]
+	group, ok := h.resolveGroup(w, userID, vars["group"])
+	if !ok {
+		return
+	}
+
+	book, err := h.buildGradebook(userID, subject, group)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error building gradebook")
+		return
+	}
+
+	// Create Excel file
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet(group.Name)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating Excel sheet")
+		return
+	}
+
+	// Add header row
+	header := sheet.AddRow()
+	header.AddCell().SetString("ФИО")
+	header.AddCell().SetString(fmt.Sprintf("Посещаемость, %% (%d%%)", book.Weights.Attendance))
+	header.AddCell().SetString(fmt.Sprintf("Лабораторные, %% (%d%%)", book.Weights.Labs))
+	for _, t := range book.Tests {
+		header.AddCell().SetString(t.Title)
+	}
+	header.AddCell().SetString(fmt.Sprintf("Тесты, %% (%d%%)", book.Weights.Tests))
+	header.AddCell().SetString("Итог, %")
+	header.AddCell().SetString("Оценка")
+	header.AddCell().SetString("Зачёт")
+
+	// Add student rows
+	for _, student := range book.Students {
+		row := sheet.AddRow()
+		row.AddCell().SetString(student.StudentFIO)
+		attendanceCell := row.AddCell()
+		if student.AttendanceCounted {
+			attendanceCell.SetString(fmt.Sprintf("%.2f", student.AttendanceRate))
+		}
+		// Students with only excused absences have no attendance rate
+		row.AddCell().SetString(fmt.Sprintf("%.2f", student.LabPercent))
+		for _, t := range book.Tests {
+			cell := row.AddCell()
+			if score, ok := student.TestScores[t.ID]; ok {
+				cell.SetString(fmt.Sprintf("%.2f", score))
+			}
+			// Tests that were not taken stay empty
+		}
+		row.AddCell().SetString(fmt.Sprintf("%.2f", student.TestPercent))
+		row.AddCell().SetString(fmt.Sprintf("%.2f", student.Total))
+		row.AddCell().SetInt(student.FinalMark)
+		row.AddCell().SetString(student.PassLabel)
+	}
+
+	// Add group average row
+	if len(book.Students) > 0 {
+		avgRow := sheet.AddRow()
+		avgRow.AddCell().SetString("Средний балл группы")
+
+		// Empty cells up to the total column
+		for i := 0; i < len(book.Tests)+3; i++ {
+			avgRow.AddCell().SetString("")
+		}
+		avgRow.AddCell().SetString(fmt.Sprintf("%.2f", book.GroupAverage))
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Export Gradebook",
+		fmt.Sprintf("Exported gradebook for %s, %s", subject, group.Name))
+
+	// Set headers for file download
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=gradebook_%s_%s.xlsx", subject, group.Name))
+
+	// Write the file to the response
+	if err := file.Write(w); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error writing Excel file")
+		return
+	}
+}
@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"TeacherJournal/app/dashboard/db"
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -26,10 +29,20 @@ func NewGroupHandler(database *gorm.DB) *GroupHandler {
 
 // GroupResponse is the standard format for group data returned in API responses
 type GroupResponse struct {
+	ID           int    `json:"id"`
 	Name         string `json:"name"`
+	Faculty      string `json:"faculty,omitempty"`
+	CourseYear   int    `json:"course_year,omitempty"`
+	Archived     bool   `json:"archived"`
 	StudentCount int    `json:"student_count"`
 }
 
+// findTeacherGroup looks up a group by name among the teacher's groups
+func (h *GroupHandler) findTeacherGroup(teacherID int, name string) (models.Group, bool) {
+	group, err := db.FindGroup(h.DB, teacherID, name)
+	return group, err == nil
+}
+
 // GetGroups returns all groups for the current user
 func (h *GroupHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -39,42 +52,32 @@ func (h *GroupHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get groups
-	var rawNames []string
-	if err := h.DB.Raw(`
-                SELECT DISTINCT group_name
-                FROM (
-                        SELECT group_name FROM lessons WHERE teacher_id = ?
-                        UNION
-                        SELECT group_name FROM students WHERE teacher_id = ?
-                ) AS combined_groups
-                ORDER BY group_name
-        `, userID, userID).Scan(&rawNames).Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving groups")
-		return
+	// Archived groups are hidden unless requested
+	query := h.DB.Where("teacher_id = ?", userID)
+	if r.URL.Query().Get("archived") != "true" {
+		query = query.Where("archived_at IS NULL")
 	}
 
-	groupSet := make(map[string]struct{})
-	for _, combined := range rawNames {
-		parts := strings.Split(combined, ",")
-		for _, p := range parts {
-			name := strings.TrimSpace(p)
-			if name != "" {
-				groupSet[name] = struct{}{}
-			}
-		}
+	var rows []models.Group
+	if err := query.Order("name").Find(&rows).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving groups")
+		return
 	}
 
 	// Get student count for each group
-	var groups []GroupResponse
-	for name := range groupSet {
+	groups := make([]GroupResponse, 0, len(rows))
+	for _, group := range rows {
 		var count int64
 		h.DB.Model(&models.Student{}).
-			Where("teacher_id = ? AND group_name = ?", userID, name).
+			Where("group_id = ?", group.ID).
 			Count(&count)
 
 		groups = append(groups, GroupResponse{
-			Name:         name,
+			ID:           group.ID,
+			Name:         group.Name,
+			Faculty:      group.Faculty,
+			CourseYear:   group.CourseYear,
+			Archived:     group.ArchivedAt != nil,
 			StudentCount: int(count),
 		})
 	}
@@ -93,20 +96,8 @@ func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Get group name from URL
 	vars := mux.Vars(r)
-	groupName := vars["name"]
-
-	// Check if group exists
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? AND group_name = ?
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ? AND group_name = ?
-		) AS combined_groups
-	`, userID, groupName, userID, groupName).Count(&count)
-
-	if count == 0 {
+	group, ok := h.findTeacherGroup(userID, vars["name"])
+	if !ok {
 		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
 		return
 	}
@@ -114,33 +105,40 @@ func (h *GroupHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
 	// Get student count
 	var studentCount int64
 	h.DB.Model(&models.Student{}).
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
+		Where("group_id = ?", group.ID).
 		Count(&studentCount)
 
 	// Get subjects taught to this group
 	var subjects []string
 	h.DB.Model(&models.Lesson{}).
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
+		Where("teacher_id = ? AND ? = ANY (group_ids)", userID, group.ID).
 		Distinct("subject").
 		Pluck("subject", &subjects)
 
-	group := struct {
-		Name         string   `json:"name"`
-		StudentCount int      `json:"student_count"`
-		Subjects     []string `json:"subjects"`
+	response := struct {
+		GroupResponse
+		Subjects []string `json:"subjects"`
 	}{
-		Name:         groupName,
-		StudentCount: int(studentCount),
-		Subjects:     subjects,
+		GroupResponse: GroupResponse{
+			ID:           group.ID,
+			Name:         group.Name,
+			Faculty:      group.Faculty,
+			CourseYear:   group.CourseYear,
+			Archived:     group.ArchivedAt != nil,
+			StudentCount: int(studentCount),
+		},
+		Subjects: subjects,
 	}
 
-	utils.RespondWithSuccess(w, http.StatusOK, "Group retrieved successfully", group)
+	utils.RespondWithSuccess(w, http.StatusOK, "Group retrieved successfully", response)
 }
 
 // CreateGroupRequest defines the request body for creating a group
 type CreateGroupRequest struct {
-	Name     string   `json:"name"`
-	Students []string `json:"students,omitempty"`
+	Name       string   `json:"name"`
+	Faculty    string   `json:"faculty,omitempty"`
+	CourseYear int      `json:"course_year,omitempty"`
+	Students   []string `json:"students,omitempty"`
 }
 
 // CreateGroup creates a new group
@@ -160,28 +158,30 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate inputs
+	req.Name = strings.TrimSpace(req.Name)
 	if req.Name == "" {
 		utils.RespondWithError(w, http.StatusBadRequest, "Group name is required")
 		return
 	}
 
 	// Check if group already exists
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? 
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ?
-		) AS combined_groups
-		WHERE group_name = ?`,
-		userID, userID, req.Name).Count(&count)
-
-	if count > 0 {
+	if _, exists := h.findTeacherGroup(userID, req.Name); exists {
 		utils.RespondWithError(w, http.StatusConflict, "Group with this name already exists")
 		return
 	}
 
+	group := models.Group{
+		Name:       req.Name,
+		TeacherID:  userID,
+		Faculty:    strings.TrimSpace(req.Faculty),
+		CourseYear: req.CourseYear,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.DB.Create(&group).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating group")
+		return
+	}
+
 	// Add students if provided
 	var addedStudents int
 	for _, studentFIO := range req.Students {
@@ -189,7 +189,8 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 		if studentFIO != "" {
 			student := models.Student{
 				TeacherID:  userID,
-				GroupName:  req.Name,
+				GroupID:    &group.ID,
+				GroupName:  group.Name,
 				StudentFIO: studentFIO,
 			}
 
@@ -201,17 +202,21 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Log the action
 	utils.LogAction(h.DB, userID, "Create Group",
-		fmt.Sprintf("Created group %s with %d students", req.Name, addedStudents))
+		fmt.Sprintf("Created group %s with %d students", group.Name, addedStudents))
 
 	utils.RespondWithSuccess(w, http.StatusCreated, "Group created successfully", map[string]interface{}{
-		"name":           req.Name,
+		"id":             group.ID,
+		"name":           group.Name,
 		"students_added": addedStudents,
 	})
 }
 
 // UpdateGroupRequest defines the request body for updating a group
 type UpdateGroupRequest struct {
-	NewName string `json:"new_name,omitempty"`
+	NewName    string  `json:"new_name,omitempty"`
+	Faculty    *string `json:"faculty,omitempty"`
+	CourseYear *int    `json:"course_year,omitempty"`
+	Archived   *bool   `json:"archived,omitempty"`
 }
 
 // UpdateGroup updates a group
@@ -225,20 +230,8 @@ func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Get group name from URL
 	vars := mux.Vars(r)
-	groupName := vars["name"]
-
-	// Check if group exists
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? AND group_name = ?
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ? AND group_name = ?
-		) AS combined_groups
-	`, userID, groupName, userID, groupName).Count(&count)
-
-	if count == 0 {
+	group, ok := h.findTeacherGroup(userID, vars["name"])
+	if !ok {
 		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
 		return
 	}
@@ -250,49 +243,99 @@ func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if a new name is provided
-	if req.NewName == "" {
+	// At least one field has to change
+	req.NewName = strings.TrimSpace(req.NewName)
+	if req.NewName == "" && req.Faculty == nil && req.CourseYear == nil && req.Archived == nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "New group name is required")
 		return
 	}
 
 	// Check if the new name already exists
-	if req.NewName != groupName {
-		h.DB.Raw(`
-			SELECT COUNT(*) 
-			FROM (
-				SELECT group_name FROM lessons WHERE teacher_id = ? 
-				UNION 
-				SELECT group_name FROM students WHERE teacher_id = ?
-			) AS combined_groups
-			WHERE group_name = ?`,
-			userID, userID, req.NewName).Count(&count)
-
-		if count > 0 {
+	oldName := group.Name
+	renamed := req.NewName != "" && req.NewName != oldName
+	if renamed {
+		if _, exists := h.findTeacherGroup(userID, req.NewName); exists {
 			utils.RespondWithError(w, http.StatusConflict, "Group with this name already exists")
 			return
 		}
 	}
 
-	// Update group name in lessons
-	if err := h.DB.Model(&models.Lesson{}).
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
-		Update("group_name", req.NewName).Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating lessons")
-		return
+	updates := map[string]interface{}{}
+	if renamed {
+		updates["name"] = req.NewName
+	}
+	if req.Faculty != nil {
+		updates["faculty"] = strings.TrimSpace(*req.Faculty)
+	}
+	if req.CourseYear != nil {
+		updates["course_year"] = *req.CourseYear
+	}
+	if req.Archived != nil {
+		if *req.Archived && group.ArchivedAt == nil {
+			updates["archived_at"] = time.Now()
+		} else if !*req.Archived {
+			updates["archived_at"] = nil
+		}
 	}
 
-	// Update group name in students
-	if err := h.DB.Model(&models.Student{}).
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
-		Update("group_name", req.NewName).Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating students")
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&group).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if !renamed {
+			return nil
+		}
+
+		// Keep the denormalized group names in sync
+		for _, model := range []interface{}{&models.Student{}, &models.LabSettings{}, &models.SharedLabLink{}} {
+			if err := tx.Model(model).
+				Where("group_id = ?", group.ID).
+				Update("group_name", req.NewName).Error; err != nil {
+				return err
+			}
+		}
+
+		var lessons []models.Lesson
+		if err := tx.Where("teacher_id = ? AND ? = ANY (group_ids)", userID, group.ID).Find(&lessons).Error; err != nil {
+			return err
+		}
+		for _, lesson := range lessons {
+			names := db.SplitGroupNames(lesson.GroupName)
+			for i, name := range names {
+				if name == oldName {
+					names[i] = req.NewName
+				}
+			}
+			for i, name := range lesson.Groups {
+				if strings.TrimSpace(name) == oldName {
+					lesson.Groups[i] = req.NewName
+				}
+			}
+			if err := tx.Model(&lesson).Updates(map[string]interface{}{
+				"group_name": strings.Join(names, ", "),
+				"groups":     lesson.Groups,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating group")
 		return
 	}
 
 	// Log the action
-	utils.LogAction(h.DB, userID, "Update Group",
-		fmt.Sprintf("Updated group name from %s to %s", groupName, req.NewName))
+	if renamed {
+		utils.LogAction(h.DB, userID, "Update Group",
+			fmt.Sprintf("Updated group name from %s to %s", oldName, req.NewName))
+	} else {
+		utils.LogAction(h.DB, userID, "Update Group",
+			fmt.Sprintf("Updated group %s", oldName))
+	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Group updated successfully", nil)
 }
@@ -308,37 +351,66 @@ func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Get group name from URL
 	vars := mux.Vars(r)
-	groupName := vars["name"]
-
-	// Check if group exists
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? AND group_name = ?
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ? AND group_name = ?
-		) AS combined_groups
-	`, userID, groupName, userID, groupName).Count(&count)
-
-	if count == 0 {
+	group, ok := h.findTeacherGroup(userID, vars["name"])
+	if !ok {
 		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
 		return
 	}
 
 	// Start a transaction to delete group data
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		// Delete lessons for this group
-		if err := tx.Where("teacher_id = ? AND group_name = ?", userID, groupName).Delete(&models.Lesson{}).Error; err != nil {
+		// Delete lessons held for this group only
+		if err := tx.Where("teacher_id = ? AND group_ids = ARRAY[?]::integer[]", userID, group.ID).Delete(&models.Lesson{}).Error; err != nil {
+			return err
+		}
+
+		// Combined lessons stay for the other groups
+		var lessons []models.Lesson
+		if err := tx.Where("teacher_id = ? AND ? = ANY (group_ids)", userID, group.ID).Find(&lessons).Error; err != nil {
 			return err
 		}
+		for _, lesson := range lessons {
+			groupIDs := pq.Int64Array{}
+			for _, id := range lesson.GroupIDs {
+				if id != int64(group.ID) {
+					groupIDs = append(groupIDs, id)
+				}
+			}
+			var names []string
+			for _, name := range db.SplitGroupNames(lesson.GroupName) {
+				if name != group.Name {
+					names = append(names, name)
+				}
+			}
+			groups := pq.StringArray{}
+			for _, name := range lesson.Groups {
+				if strings.TrimSpace(name) != group.Name {
+					groups = append(groups, name)
+				}
+			}
+			if err := tx.Model(&lesson).Updates(map[string]interface{}{
+				"group_ids":  groupIDs,
+				"group_name": strings.Join(names, ", "),
+				"groups":     groups,
+			}).Error; err != nil {
+				return err
+			}
+		}
 
 		// Delete students for this group
-		if err := tx.Where("teacher_id = ? AND group_name = ?", userID, groupName).Delete(&models.Student{}).Error; err != nil {
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.Student{}).Error; err != nil {
 			return err
 		}
 
-		return nil
+		// Delete lab settings and shared links for this group
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.LabSettings{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.SharedLabLink{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&group).Error
 	})
 
 	if err != nil {
@@ -348,7 +420,7 @@ func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Log the action
 	utils.LogAction(h.DB, userID, "Delete Group",
-		fmt.Sprintf("Deleted group %s with all lessons and students", groupName))
+		fmt.Sprintf("Deleted group %s with its lessons and students", group.Name))
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Group deleted successfully", nil)
 }
@@ -372,11 +444,17 @@ func (h *GroupHandler) GetStudentsInGroup(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	groupName := vars["name"]
 
+	group, ok := h.findTeacherGroup(userID, groupName)
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
 	// Get students
 	var students []StudentResponse
 	if err := h.DB.Model(&models.Student{}).
 		Select("id, student_fio as fio").
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
+		Where("group_id = ?", group.ID).
 		Order("student_fio").
 		Find(&students).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving students")
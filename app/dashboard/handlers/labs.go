@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"TeacherJournal/app/dashboard/db"
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"crypto/rand"
@@ -61,32 +62,24 @@ func (h *LabHandler) GetAllLabs(w http.ResponseWriter, r *http.Request) {
 
 	// Get all groups with student counts
 	type GroupInfo struct {
+		ID           int
 		Name         string
 		StudentCount int
 	}
 
 	var groups []GroupInfo
 	if err := h.DB.Raw(`
-		SELECT g.group_name as name, COUNT(s.id) as student_count
-		FROM (
-			SELECT DISTINCT group_name
-			FROM students
-			WHERE teacher_id = ?
-		) g
-		LEFT JOIN students s ON g.group_name = s.group_name AND s.teacher_id = ?
-		GROUP BY g.group_name
-		ORDER BY g.group_name
+		SELECT g.id, g.name, COUNT(s.id) as student_count
+		FROM groups g
+		JOIN students s ON s.group_id = g.id AND s.teacher_id = ?
+		WHERE g.teacher_id = ?
+		GROUP BY g.id, g.name
+		ORDER BY g.name
 	`, userID, userID).Scan(&groups).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving groups")
 		return
 	}
 
-	// Create a map of groups by name for quick lookup
-	groupMap := make(map[string]GroupInfo)
-	for _, g := range groups {
-		groupMap[g.Name] = g
-	}
-
 	// For each subject, find groups that have lessons in this subject
 	var response []SubjectGroupResponse
 	for _, subject := range subjects {
@@ -94,24 +87,28 @@ func (h *LabHandler) GetAllLabs(w http.ResponseWriter, r *http.Request) {
 			Subject: subject,
 		}
 
-		// Get groups for this subject
-		var groupNames []string
-		if err := h.DB.Model(&models.Lesson{}).
-			Distinct("group_name").
-			Where("teacher_id = ? AND subject = ?", userID, subject).
-			Order("group_name").
-			Pluck("group_name", &groupNames).Error; err != nil {
+		// Get groups for this subject, combined lessons count for each of their groups
+		var groupIDs []int
+		if err := h.DB.Raw(`
+			SELECT DISTINCT unnest(group_ids)
+			FROM lessons
+			WHERE teacher_id = ? AND subject = ?
+		`, userID, subject).Scan(&groupIDs).Error; err != nil {
 			continue // Skip on error
 		}
+		subjectGroups := make(map[int]bool)
+		for _, id := range groupIDs {
+			subjectGroups[id] = true
+		}
 
 		// For each group, get lab settings and average
-		for _, groupName := range groupNames {
-			if groupInfo, exists := groupMap[groupName]; exists {
+		for _, groupInfo := range groups {
+			if subjectGroups[groupInfo.ID] {
 				// Get default total labs (5) or from settings if exists
 				totalLabs := 5
 				var settings models.LabSettings
-				if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_name = ?",
-					userID, subject, groupName).First(&settings).Error; err == nil {
+				if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_id = ?",
+					userID, subject, groupInfo.ID).First(&settings).Error; err == nil {
 					totalLabs = settings.TotalLabs
 				}
 
@@ -121,8 +118,8 @@ func (h *LabHandler) GetAllLabs(w http.ResponseWriter, r *http.Request) {
 					SELECT COALESCE(AVG(lg.grade), 0) 
 					FROM lab_grades lg
 					JOIN students s ON lg.student_id = s.id
-					WHERE lg.teacher_id = ? AND lg.subject = ? AND s.group_name = ?
-				`, userID, subject, groupName).Scan(&avgGrade)
+					WHERE lg.teacher_id = ? AND lg.subject = ? AND s.group_id = ?
+				`, userID, subject, groupInfo.ID).Scan(&avgGrade)
 
 				sg.Groups = append(sg.Groups, struct {
 					Name         string  `json:"name"`
@@ -130,7 +127,7 @@ func (h *LabHandler) GetAllLabs(w http.ResponseWriter, r *http.Request) {
 					TotalLabs    int     `json:"total_labs"`
 					GroupAverage float64 `json:"group_average"`
 				}{
-					Name:         groupName,
+					Name:         groupInfo.Name,
 					StudentCount: groupInfo.StudentCount,
 					TotalLabs:    totalLabs,
 					GroupAverage: avgGrade,
@@ -155,6 +152,33 @@ type StudentLabSummary struct {
 	Average    float64 `json:"average"`
 }
 
+// LinkedTest is a test of the tests service that writes the grades of a lab
+type LinkedTest struct {
+	TestID    int    `json:"test_id"`
+	Title     string `json:"title"`
+	LabNumber int    `json:"lab_number"`
+	Policy    string `json:"policy"` // best or last attempt
+}
+
+// linkedTests returns the teacher's tests linked to labs of a subject;
+// the tests service shares the database
+func (h *LabHandler) linkedTests(teacherID int, subject string) []LinkedTest {
+	links := []LinkedTest{}
+	if !h.DB.Migrator().HasTable("test_grade_links") {
+		return links
+	}
+	if err := h.DB.Raw(`
+		SELECT t.id as test_id, t.title, l.lab_number, l.policy
+		FROM test_grade_links l
+		JOIN tests t ON t.id = l.test_id
+		WHERE t.creator_id = ? AND l.subject = ?
+		ORDER BY l.lab_number
+	`, teacherID, subject).Scan(&links).Error; err != nil {
+		log.Printf("Error retrieving tests linked to labs: %v", err)
+	}
+	return links
+}
+
 // GetLabGrades returns lab grades for a specific subject and group
 func (h *LabHandler) GetLabGrades(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -169,11 +193,17 @@ func (h *LabHandler) GetLabGrades(w http.ResponseWriter, r *http.Request) {
 	subject := vars["subject"]
 	groupName := vars["group"]
 
+	group, err := db.FindGroup(h.DB, userID, groupName)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
 	// Get lab settings (or defaults)
 	totalLabs := 5 // Default
 	var settings models.LabSettings
-	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_name = ?",
-		userID, subject, groupName).First(&settings).Error; err == nil {
+	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_id = ?",
+		userID, subject, group.ID).First(&settings).Error; err == nil {
 		totalLabs = settings.TotalLabs
 	}
 
@@ -184,7 +214,7 @@ func (h *LabHandler) GetLabGrades(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.DB.Model(&models.Student{}).
 		Select("id, student_fio as fio").
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
+		Where("teacher_id = ? AND group_id = ?", userID, group.ID).
 		Order("student_fio").
 		Find(&students).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving students")
@@ -264,12 +294,14 @@ func (h *LabHandler) GetLabGrades(w http.ResponseWriter, r *http.Request) {
 		TotalLabs    int                 `json:"total_labs"`
 		Students     []StudentLabSummary `json:"students"`
 		GroupAverage float64             `json:"group_average"`
+		LinkedTests  []LinkedTest        `json:"linked_tests"`
 	}{
 		Subject:      subject,
 		GroupName:    groupName,
 		TotalLabs:    totalLabs,
 		Students:     summaries,
 		GroupAverage: groupAverage,
+		LinkedTests:  h.linkedTests(userID, subject),
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Lab grades retrieved successfully", response)
@@ -307,25 +339,32 @@ func (h *LabHandler) UpdateLabSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	group, err := db.FindGroup(h.DB, userID, groupName)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
 	// Check if settings already exist
 	var count int64
 	h.DB.Model(&models.LabSettings{}).
-		Where("teacher_id = ? AND group_name = ? AND subject = ?",
-			userID, groupName, subject).
+		Where("teacher_id = ? AND group_id = ? AND subject = ?",
+			userID, group.ID, subject).
 		Count(&count)
 
 	var err2 error
 	if count > 0 {
 		// Update existing settings
 		err2 = h.DB.Model(&models.LabSettings{}).
-			Where("teacher_id = ? AND group_name = ? AND subject = ?",
-				userID, groupName, subject).
+			Where("teacher_id = ? AND group_id = ? AND subject = ?",
+				userID, group.ID, subject).
 			Update("total_labs", req.TotalLabs).Error
 	} else {
 		// Insert new settings
 		newSettings := models.LabSettings{
 			TeacherID: userID,
-			GroupName: groupName,
+			GroupName: group.Name,
+			GroupID:   &group.ID,
 			Subject:   subject,
 			TotalLabs: req.TotalLabs,
 		}
@@ -374,11 +413,17 @@ func (h *LabHandler) UpdateLabGrades(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	group, err := db.FindGroup(h.DB, userID, groupName)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
 	// Verify all students belong to this teacher and group
 	for _, grade := range req.Grades {
 		var count int64
 		h.DB.Model(&models.Student{}).
-			Where("id = ? AND teacher_id = ? AND group_name = ?", grade.StudentID, userID, groupName).
+			Where("id = ? AND teacher_id = ? AND group_id = ?", grade.StudentID, userID, group.ID).
 			Count(&count)
 
 		if count == 0 {
@@ -411,11 +456,11 @@ func (h *LabHandler) UpdateLabGrades(w http.ResponseWriter, r *http.Request) {
 				Count(&count)
 
 			if count > 0 {
-				// Update existing grade
+				// Update existing grade; a grade entered by hand is no longer the test result
 				if err := tx.Model(&models.LabGrade{}).
 					Where("student_id = ? AND subject = ? AND lab_number = ?",
 						g.StudentID, subject, g.LabNumber).
-					Update("grade", g.Grade).Error; err != nil {
+					Updates(map[string]interface{}{"grade": g.Grade, "test_id": nil}).Error; err != nil {
 					return err
 				}
 			} else {
@@ -461,11 +506,17 @@ func (h *LabHandler) ExportLabGrades(w http.ResponseWriter, r *http.Request) {
 	subject := vars["subject"]
 	groupName := vars["group"]
 
+	group, err := db.FindGroup(h.DB, userID, groupName)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
 	// Get lab summary
 	totalLabs := 5 // Default
 	var settings models.LabSettings
-	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_name = ?",
-		userID, subject, groupName).First(&settings).Error; err == nil {
+	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_id = ?",
+		userID, subject, group.ID).First(&settings).Error; err == nil {
 		totalLabs = settings.TotalLabs
 	}
 
@@ -476,7 +527,7 @@ func (h *LabHandler) ExportLabGrades(w http.ResponseWriter, r *http.Request) {
 	}
 	if err := h.DB.Model(&models.Student{}).
 		Select("id, student_fio as fio").
-		Where("teacher_id = ? AND group_name = ?", userID, groupName).
+		Where("teacher_id = ? AND group_id = ?", userID, group.ID).
 		Order("student_fio").
 		Find(&students).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving students")
@@ -640,6 +691,9 @@ func (h *LabHandler) ShareLabGrades(w http.ResponseWriter, r *http.Request) {
 		ExpiresAt:   &expiresAt,
 		AccessCount: 0,
 	}
+	if group, err := db.FindGroup(h.DB, userID, groupName); err == nil {
+		sharedLink.GroupID = &group.ID
+	}
 
 	// Save to database
 	if err := h.DB.Create(&sharedLink).Error; err != nil {
@@ -712,8 +766,13 @@ func (h *LabHandler) GetSharedLabGrades(w http.ResponseWriter, r *http.Request)
 	// Get lab summary similar to GetLabGrades but for the shared link
 	totalLabs := 5 // Default
 	var settings models.LabSettings
-	if err := h.DB.Where("teacher_id = ? AND subject = ? AND group_name = ?",
-		link.TeacherID, link.Subject, link.GroupName).First(&settings).Error; err == nil {
+	settingsQuery := h.DB.Where("teacher_id = ? AND subject = ?", link.TeacherID, link.Subject)
+	if link.GroupID != nil {
+		settingsQuery = settingsQuery.Where("group_id = ?", *link.GroupID)
+	} else {
+		settingsQuery = settingsQuery.Where("group_name = ?", link.GroupName)
+	}
+	if err := settingsQuery.First(&settings).Error; err == nil {
 		totalLabs = settings.TotalLabs
 	} else {
 		log.Printf("Using default lab count. No settings found for Teacher=%d, Subject=%s, Group=%s: %v",
@@ -725,9 +784,13 @@ func (h *LabHandler) GetSharedLabGrades(w http.ResponseWriter, r *http.Request)
 		ID  int
 		FIO string
 	}
-	if err := h.DB.Model(&models.Student{}).
-		Select("id, student_fio as fio").
-		Where("teacher_id = ? AND group_name = ?", link.TeacherID, link.GroupName).
+	studentQuery := h.DB.Model(&models.Student{}).Select("id, student_fio as fio")
+	if link.GroupID != nil {
+		studentQuery = studentQuery.Where("group_id = ?", *link.GroupID)
+	} else {
+		studentQuery = studentQuery.Where("teacher_id = ? AND group_name = ?", link.TeacherID, link.GroupName)
+	}
+	if err := studentQuery.
 		Order("student_fio").
 		Find(&students).Error; err != nil {
 		log.Printf("Error retrieving students: %v", err)
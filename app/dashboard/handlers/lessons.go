@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"TeacherJournal/app/dashboard/db"
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"encoding/json"
@@ -40,6 +41,7 @@ type LessonResponse struct {
 	Topic     string         `json:"topic"`
 	Hours     int            `json:"hours"`
 	Date      string         `json:"date"`
+	Time      string         `json:"time,omitempty"`
 	Type      string         `json:"type"`
 }
 
@@ -160,12 +162,13 @@ func (h *LessonHandler) GetLesson(w http.ResponseWriter, r *http.Request) {
 
 // CreateLessonRequest defines the request body for creating a lesson
 type CreateLessonRequest struct {
-	GroupName string `json:"group_name"`
-	Subject   string `json:"subject"`
-	Topic     string `json:"topic"`
-	Hours     int    `json:"hours"`
-	Date      string `json:"date"`
-	Type      string `json:"type"`
+	GroupName string  `json:"group_name"`
+	Subject   string  `json:"subject"`
+	Topic     string  `json:"topic"`
+	Hours     int     `json:"hours"`
+	Date      string  `json:"date"`
+	Time      *string `json:"time,omitempty"` // Nil - keep the pair time of an existing lesson
+	Type      string  `json:"type"`
 }
 
 // CreateLesson creates a new lesson
@@ -195,14 +198,27 @@ func (h *LessonHandler) CreateLesson(w http.ResponseWriter, r *http.Request) {
 		req.Type = "Лекция"
 	}
 
+	// Link the lesson to its groups
+	groupIDs, err := db.ResolveGroupIDs(h.DB, userID, db.SplitGroupNames(req.GroupName))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error resolving lesson groups")
+		return
+	}
+
 	// Create lesson
+	var lessonTime string
+	if req.Time != nil {
+		lessonTime = *req.Time
+	}
 	lesson := models.Lesson{
 		TeacherID: userID,
 		GroupName: req.GroupName,
+		GroupIDs:  groupIDs,
 		Subject:   req.Subject,
 		Topic:     req.Topic,
 		Hours:     req.Hours,
 		Date:      req.Date,
+		Time:      lessonTime,
 		Type:      req.Type,
 	}
 
@@ -266,17 +282,29 @@ func (h *LessonHandler) UpdateLesson(w http.ResponseWriter, r *http.Request) {
 		req.Type = "Лекция"
 	}
 
-	// Update lesson
+	// Link the lesson to its groups
+	groupIDs, err := db.ResolveGroupIDs(h.DB, userID, db.SplitGroupNames(req.GroupName))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error resolving lesson groups")
+		return
+	}
+
+	// Update lesson; the form does not send the pair time, so it changes only when given
+	updates := map[string]interface{}{
+		"group_name": req.GroupName,
+		"group_ids":  groupIDs,
+		"subject":    req.Subject,
+		"topic":      req.Topic,
+		"hours":      req.Hours,
+		"date":       req.Date,
+		"type":       req.Type,
+	}
+	if req.Time != nil {
+		updates["time"] = *req.Time
+	}
 	if err := h.DB.Model(&models.Lesson{}).
 		Where("id = ? AND teacher_id = ?", lessonID, userID).
-		Updates(map[string]interface{}{
-			"group_name": req.GroupName,
-			"subject":    req.Subject,
-			"topic":      req.Topic,
-			"hours":      req.Hours,
-			"date":       req.Date,
-			"type":       req.Type,
-		}).Error; err != nil {
+		Updates(updates).Error; err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating lesson")
 		return
 	}
@@ -667,7 +695,7 @@ func (h *LessonHandler) ExportWorkloadJournal(w http.ResponseWriter, r *http.Req
 		query = query.Where("subject IN ?", subjects)
 	}
 	if groupFilter != "" {
-		query = query.Where("group_name = ?", groupFilter)
+		query = query.Where("(SELECT g.id FROM groups g WHERE g.teacher_id = lessons.teacher_id AND g.name = ?) = ANY (group_ids)", groupFilter)
 	}
 	if fromDateFilter != "" {
 		query = query.Where("date >= ?", fromDateFilter)
@@ -785,7 +813,7 @@ func (h *LessonHandler) createMainWorkloadSheet(userID int, teacher models.User,
 		query = query.Where("subject = ?", subjectFilter)
 	}
 	if groupFilter != "" {
-		query = query.Where("group_name = ?", groupFilter)
+		query = query.Where("(SELECT g.id FROM groups g WHERE g.teacher_id = lessons.teacher_id AND g.name = ?) = ANY (group_ids)", groupFilter)
 	}
 	if fromDateFilter != "" {
 		query = query.Where("date >= ?", fromDateFilter)
@@ -874,7 +902,7 @@ func (h *LessonHandler) createSummarySheet(userID int, teacher models.User, subj
 		query = query.Where("subject = ?", subjectFilter)
 	}
 	if groupFilter != "" {
-		query = query.Where("group_name = ?", groupFilter)
+		query = query.Where("(SELECT g.id FROM groups g WHERE g.teacher_id = lessons.teacher_id AND g.name = ?) = ANY (group_ids)", groupFilter)
 	}
 	if fromDateFilter != "" {
 		query = query.Where("date >= ?", fromDateFilter)
@@ -1147,7 +1175,7 @@ func (h *LessonHandler) createMainWorkloadSheetX(userID int, subjects []string,
 		query = query.Where("subject IN ?", subjects)
 	}
 	if groupFilter != "" {
-		query = query.Where("group_name = ?", groupFilter)
+		query = query.Where("(SELECT g.id FROM groups g WHERE g.teacher_id = lessons.teacher_id AND g.name = ?) = ANY (group_ids)", groupFilter)
 	}
 	if fromDateFilter != "" {
 		query = query.Where("date >= ?", fromDateFilter)
@@ -1231,7 +1259,7 @@ func (h *LessonHandler) createSummarySheetX(userID int, subjects []string, group
 		query = query.Where("subject IN ?", subjects)
 	}
 	if groupFilter != "" {
-		query = query.Where("group_name = ?", groupFilter)
+		query = query.Where("(SELECT g.id FROM groups g WHERE g.teacher_id = lessons.teacher_id AND g.name = ?) = ANY (group_ids)", groupFilter)
 	}
 	if fromDateFilter != "" {
 		query = query.Where("date >= ?", fromDateFilter)
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"TeacherJournal/app/dashboard/db"
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/dashboard/utils"
 	"encoding/json"
@@ -50,7 +51,7 @@ func (h *StudentHandler) GetStudents(w http.ResponseWriter, r *http.Request) {
 
 	// Apply group filter if provided
 	if groupName != "" {
-		query = query.Where("group_name = ?", groupName)
+		query = query.Where("group_id = (SELECT id FROM groups WHERE teacher_id = ? AND name = ?)", userID, groupName)
 	}
 
 	// Get students
@@ -124,17 +125,8 @@ func (h *StudentHandler) CreateStudent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if group exists
-	var count int64
-	h.DB.Raw(`
-		SELECT COUNT(*) 
-		FROM (
-			SELECT group_name FROM lessons WHERE teacher_id = ? AND group_name = ?
-			UNION 
-			SELECT group_name FROM students WHERE teacher_id = ? AND group_name = ?
-		) AS combined_groups
-	`, userID, req.GroupName, userID, req.GroupName).Count(&count)
-
-	if count == 0 {
+	group, err := db.FindGroup(h.DB, userID, req.GroupName)
+	if err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Group not found")
 		return
 	}
@@ -142,7 +134,8 @@ func (h *StudentHandler) CreateStudent(w http.ResponseWriter, r *http.Request) {
 	// Create student
 	student := models.Student{
 		TeacherID:  userID,
-		GroupName:  req.GroupName,
+		GroupID:    &group.ID,
+		GroupName:  group.Name,
 		StudentFIO: req.FIO,
 	}
 
@@ -208,22 +201,14 @@ func (h *StudentHandler) UpdateStudent(w http.ResponseWriter, r *http.Request) {
 	// Check and add group update if provided
 	if req.GroupName != "" && req.GroupName != currentStudent.GroupName {
 		// Verify the new group exists
-		var count int64
-		h.DB.Raw(`
-			SELECT COUNT(*) 
-			FROM (
-				SELECT group_name FROM lessons WHERE teacher_id = ? AND group_name = ?
-				UNION 
-				SELECT group_name FROM students WHERE teacher_id = ? AND group_name = ?
-			) AS combined_groups
-		`, userID, req.GroupName, userID, req.GroupName).Count(&count)
-
-		if count == 0 {
+		group, err := db.FindGroup(h.DB, userID, req.GroupName)
+		if err != nil {
 			utils.RespondWithError(w, http.StatusBadRequest, "New group not found")
 			return
 		}
 
-		updates["group_name"] = req.GroupName
+		updates["group_id"] = group.ID
+		updates["group_name"] = group.Name
 	}
 
 	// If no updates provided
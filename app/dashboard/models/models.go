@@ -15,6 +15,18 @@ type User struct {
 	Role     string `gorm:"not null"`
 }
 
+// Group represents a study group owned by a teacher
+type Group struct {
+	ID         int        `gorm:"primaryKey"`
+	Name       string     `gorm:"not null;uniqueIndex:idx_groups_teacher_name"`
+	TeacherID  int        `gorm:"not null;uniqueIndex:idx_groups_teacher_name"`
+	Teacher    User       `gorm:"foreignKey:TeacherID"`
+	Faculty    string     `gorm:""`
+	CourseYear int        `gorm:"not null;default:0"`
+	CreatedAt  time.Time  `gorm:"not null"`
+	ArchivedAt *time.Time `gorm:"index"`
+}
+
 // Lesson represents a teaching lesson
 type Lesson struct {
 	ID         int            `gorm:"primaryKey"`
@@ -22,12 +34,16 @@ type Lesson struct {
 	Teacher    User           `gorm:"foreignKey:TeacherID"`
 	GroupName  string         `gorm:"not null"`
 	Groups     pq.StringArray `gorm:"type:text[]" json:"groups"`
+	GroupIDs   pq.Int64Array  `gorm:"type:integer[]" json:"group_ids"`
 	Subject    string         `gorm:"not null"`
 	Topic      string         `gorm:"not null"`
 	Hours      int            `gorm:"not null"`
 	Date       string         `gorm:"not null"`
+	Time       string         `gorm:""` // Pair time, e.g. "08:30-10:00"
 	Type       string         `gorm:"not null;default:Лекция"`
 	Auditorium string         `gorm:""`
+	// AttendanceVersion is bumped on every attendance change and used as the ETag
+	AttendanceVersion int `gorm:"not null;default:0"`
 }
 
 // Student represents a student in a group
@@ -35,10 +51,21 @@ type Student struct {
 	ID         int    `gorm:"primaryKey"`
 	TeacherID  int    `gorm:"index"`
 	Teacher    User   `gorm:"foreignKey:TeacherID"`
+	GroupID    *int   `gorm:"index"`
+	Group      *Group `gorm:"foreignKey:GroupID"`
 	GroupName  string `gorm:"not null;index"`
 	StudentFIO string `gorm:"not null"`
 }
 
+// Attendance statuses
+const (
+	AttendanceStatusPresent = "present"
+	AttendanceStatusLate    = "late"
+	AttendanceStatusExcused = "excused" // absent with a supporting document
+	AttendanceStatusSick    = "sick"
+	AttendanceStatusAbsent  = "absent"
+)
+
 // Attendance represents attendance record for a student
 type Attendance struct {
 	ID        int     `gorm:"primaryKey"`
@@ -46,7 +73,9 @@ type Attendance struct {
 	Lesson    Lesson  `gorm:"foreignKey:LessonID"`
 	StudentID int     `gorm:"index"`
 	Student   Student `gorm:"foreignKey:StudentID"`
-	Attended  int     `gorm:"not null;default:0"`
+	Attended  int     `gorm:"not null;default:0"` // 1 when the student was in class (present or late)
+	Status    string  `gorm:"type:varchar(16);index"`
+	Note      string  `gorm:""`
 }
 
 // TableName overrides the table name to "attendances"
@@ -69,6 +98,8 @@ type LabSettings struct {
 	ID        int    `gorm:"primaryKey"`
 	TeacherID int    `gorm:"index"`
 	Teacher   User   `gorm:"foreignKey:TeacherID"`
+	GroupID   *int   `gorm:"index"`
+	Group     *Group `gorm:"foreignKey:GroupID"`
 	GroupName string `gorm:"not null"`
 	Subject   string `gorm:"not null"`
 	TotalLabs int    `gorm:"not null;default:5"`
@@ -84,6 +115,21 @@ type LabGrade struct {
 	Subject   string  `gorm:"not null"`
 	LabNumber int     `gorm:"not null"`
 	Grade     int     `gorm:"not null"`
+	TestID    *int    `gorm:"index"` // Test of the tests service that sets the grade, nil when entered by hand
+}
+
+// GradebookSettings holds the component weights used to compute final marks
+type GradebookSettings struct {
+	ID               int    `gorm:"primaryKey"`
+	TeacherID        int    `gorm:"index"`
+	Teacher          User   `gorm:"foreignKey:TeacherID"`
+	GroupID          int    `gorm:"index"`
+	Group            Group  `gorm:"foreignKey:GroupID"`
+	Subject          string `gorm:"not null"`
+	AttendanceWeight int    `gorm:"not null;default:20"`
+	LabWeight        int    `gorm:"not null;default:50"`
+	TestWeight       int    `gorm:"not null;default:30"`
+	PassThreshold    int    `gorm:"not null;default:50"`
 }
 
 // UserNotificationSettings represents notification preferences for a user
@@ -96,12 +142,25 @@ type UserNotificationSettings struct {
 	NotifyTicketStatus  bool `gorm:"not null;default:true"`
 }
 
+// CalendarFeed represents a teacher's secret iCalendar subscription link
+type CalendarFeed struct {
+	ID             int       `gorm:"primaryKey"`
+	Token          string    `gorm:"uniqueIndex;not null"`
+	TeacherID      int       `gorm:"uniqueIndex;not null"`
+	Teacher        User      `gorm:"foreignKey:TeacherID"`
+	CreatedAt      time.Time `gorm:"not null"`
+	LastAccessedAt *time.Time
+	AccessCount    int `gorm:"not null;default:0"`
+}
+
 // SharedLabLink represents a shareable link for lab grades
 type SharedLabLink struct {
 	ID          int       `gorm:"primaryKey"`
 	Token       string    `gorm:"uniqueIndex;not null"`
 	TeacherID   int       `gorm:"index;not null"`
 	Teacher     User      `gorm:"foreignKey:TeacherID"`
+	GroupID     *int      `gorm:"index"`
+	Group       *Group    `gorm:"foreignKey:GroupID"`
 	GroupName   string    `gorm:"not null"`
 	Subject     string    `gorm:"not null"`
 	CreatedAt   time.Time `gorm:"not null"`
@@ -0,0 +1,90 @@
+package utils
+
+import "TeacherJournal/app/dashboard/models"
+
+// AttendanceStatuses lists valid attendance statuses in display order
+var AttendanceStatuses = []string{
+	models.AttendanceStatusPresent,
+	models.AttendanceStatusLate,
+	models.AttendanceStatusExcused,
+	models.AttendanceStatusSick,
+	models.AttendanceStatusAbsent,
+}
+
+// IsValidAttendanceStatus reports whether status is a known attendance status
+func IsValidAttendanceStatus(status string) bool {
+	for _, s := range AttendanceStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AttendedValue returns the legacy 0/1 attended flag for a status
+func AttendedValue(status string) int {
+	if status == models.AttendanceStatusPresent || status == models.AttendanceStatusLate {
+		return 1
+	}
+	return 0
+}
+
+// AttendanceCounts holds the number of records per attendance status
+type AttendanceCounts struct {
+	Present int `json:"present"`
+	Late    int `json:"late"`
+	Excused int `json:"excused"`
+	Sick    int `json:"sick"`
+	Absent  int `json:"absent"`
+}
+
+// Add counts n records with the given status
+func (c *AttendanceCounts) Add(status string, n int) {
+	switch status {
+	case models.AttendanceStatusPresent:
+		c.Present += n
+	case models.AttendanceStatusLate:
+		c.Late += n
+	case models.AttendanceStatusExcused:
+		c.Excused += n
+	case models.AttendanceStatusSick:
+		c.Sick += n
+	default:
+		c.Absent += n
+	}
+}
+
+// Total returns the number of counted records
+func (c AttendanceCounts) Total() int {
+	return c.Present + c.Late + c.Excused + c.Sick + c.Absent
+}
+
+// Attended returns the number of students who were in class
+func (c AttendanceCounts) Attended() int {
+	return c.Present + c.Late
+}
+
+// Countable returns the number of records that count towards attendance;
+// excused and sick absences are left out
+func (c AttendanceCounts) Countable() int {
+	return c.Present + c.Late + c.Absent
+}
+
+// AttendanceRate returns the percentage of attended records among those that
+// count towards attendance. Excused and sick absences are left out.
+func (c AttendanceCounts) AttendanceRate() float64 {
+	countable := c.Countable()
+	if countable == 0 {
+		return 0
+	}
+	return float64(c.Attended()) / float64(countable) * 100
+}
+
+// UnexcusedAbsenceRate returns the percentage of unexcused absences among all records
+func (c AttendanceCounts) UnexcusedAbsenceRate() float64 {
+	total := c.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(c.Absent) / float64(total) * 100
+}
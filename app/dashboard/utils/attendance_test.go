@@ -0,0 +1,48 @@
+package utils
+
+import (
+    "TeacherJournal/app/dashboard/models"
+    "testing"
+)
+
+func TestAttendanceCountsRate(t *testing.T) {
+    var c AttendanceCounts
+    c.Add(models.AttendanceStatusPresent, 6)
+    c.Add(models.AttendanceStatusLate, 2)
+    c.Add(models.AttendanceStatusExcused, 1)
+    c.Add(models.AttendanceStatusSick, 1)
+    c.Add(models.AttendanceStatusAbsent, 2)
+
+    if c.Total() != 12 || c.Attended() != 8 {
+        t.Fatalf("unexpected totals: %+v", c)
+    }
+    if rate := c.AttendanceRate(); rate != 80 {
+        t.Fatalf("expected rate 80 got %v", rate)
+    }
+    if rate := c.UnexcusedAbsenceRate(); rate < 16.6 || rate > 16.7 {
+        t.Fatalf("expected unexcused rate ~16.67 got %v", rate)
+    }
+}
+
+func TestAttendanceCountsEmpty(t *testing.T) {
+    var c AttendanceCounts
+    c.Add(models.AttendanceStatusSick, 3)
+    if rate := c.AttendanceRate(); rate != 0 {
+        t.Fatalf("expected 0 got %v", rate)
+    }
+    if c.Countable() != 0 {
+        t.Fatalf("sick records must not be countable: %+v", c)
+    }
+}
+
+func TestAttendedValue(t *testing.T) {
+    if AttendedValue(models.AttendanceStatusLate) != 1 {
+        t.Fatalf("late should count as attended")
+    }
+    if AttendedValue(models.AttendanceStatusExcused) != 0 {
+        t.Fatalf("excused should not count as attended")
+    }
+    if IsValidAttendanceStatus("unknown") {
+        t.Fatalf("unexpected valid status")
+    }
+}
@@ -0,0 +1,55 @@
+package utils
+
+// Default gradebook weights and pass threshold, in percent
+const (
+	DefaultAttendanceWeight = 20
+	DefaultLabWeight        = 50
+	DefaultTestWeight       = 30
+	DefaultPassThreshold    = 50
+)
+
+// GradeComponent is one weighted part of a final grade
+type GradeComponent struct {
+	Weight  float64
+	Percent float64 // 0-100
+	Present bool    // false when the group has no data for this component
+}
+
+// WeightedScore combines components into a 0-100 score. Components without
+// data are skipped and the remaining weights are renormalized.
+func WeightedScore(components ...GradeComponent) float64 {
+	var sum, weights float64
+	for _, c := range components {
+		if !c.Present || c.Weight <= 0 {
+			continue
+		}
+		sum += c.Weight * c.Percent
+		weights += c.Weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// FinalMark converts a 0-100 score to the 5-point scale
+func FinalMark(score float64) int {
+	switch {
+	case score >= 85:
+		return 5
+	case score >= 70:
+		return 4
+	case score >= 50:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// PassLabel returns the pass/fail label used in grade sheets
+func PassLabel(passed bool) string {
+	if passed {
+		return "зачёт"
+	}
+	return "незачёт"
+}
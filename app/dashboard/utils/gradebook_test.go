@@ -0,0 +1,40 @@
+package utils
+
+import "testing"
+
+func TestWeightedScore(t *testing.T) {
+    score := WeightedScore(
+        GradeComponent{Weight: 20, Percent: 100, Present: true},
+        GradeComponent{Weight: 50, Percent: 80, Present: true},
+        GradeComponent{Weight: 30, Percent: 60, Present: true},
+    )
+    if score != 78 {
+        t.Fatalf("expected 78 got %v", score)
+    }
+}
+
+func TestWeightedScoreSkipsMissing(t *testing.T) {
+    score := WeightedScore(
+        GradeComponent{Weight: 20, Percent: 100, Present: true},
+        GradeComponent{Weight: 50, Percent: 70, Present: true},
+        GradeComponent{Weight: 30, Percent: 0, Present: false},
+    )
+    if score < 78.57 || score > 78.58 {
+        t.Fatalf("expected ~78.57 got %v", score)
+    }
+    if WeightedScore() != 0 {
+        t.Fatalf("expected 0 for no components")
+    }
+}
+
+func TestFinalMark(t *testing.T) {
+    cases := map[float64]int{100: 5, 85: 5, 84.9: 4, 70: 4, 50: 3, 49.9: 2, 0: 2}
+    for score, want := range cases {
+        if got := FinalMark(score); got != want {
+            t.Fatalf("FinalMark(%v) = %d, want %d", score, got, want)
+        }
+    }
+    if PassLabel(true) != "зачёт" || PassLabel(false) != "незачёт" {
+        t.Fatalf("unexpected pass labels")
+    }
+}
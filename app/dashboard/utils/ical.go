@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ICSEvent is a single VEVENT in an iCalendar feed
+type ICSEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+}
+
+// ParsePairTime parses a date ("2006-01-02") and a pair time ("08:30-10:00")
+// into start and end times in loc
+func ParsePairTime(date, pair string, loc *time.Location) (time.Time, time.Time, error) {
+	parts := strings.Split(strings.TrimSpace(pair), "-")
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid pair time %q", pair)
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+strings.TrimSpace(parts[0]), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04", date+" "+strings.TrimSpace(parts[1]), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// escapeICSText escapes a TEXT value per RFC 5545
+func escapeICSText(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return s
+}
+
+// foldICSLine splits a content line into 75-octet chunks without breaking UTF-8 runes
+func foldICSLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := limit
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		width = limit - 1 // continuation lines start with a space
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// BuildICS renders events as an iCalendar document
+func BuildICS(calendarName string, events []ICSEvent) string {
+	var lines []string
+	add := func(line string) {
+		lines = append(lines, foldICSLine(line))
+	}
+
+	add("BEGIN:VCALENDAR")
+	add("VERSION:2.0")
+	add("PRODID:-//TeacherJournal//Lessons//RU")
+	add("CALSCALE:GREGORIAN")
+	add("METHOD:PUBLISH")
+	add("X-WR-CALNAME:" + escapeICSText(calendarName))
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		add("BEGIN:VEVENT")
+		add("UID:" + e.UID)
+		add("DTSTAMP:" + stamp)
+		if e.AllDay {
+			add("DTSTART;VALUE=DATE:" + e.Start.Format("20060102"))
+			add("DTEND;VALUE=DATE:" + e.Start.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			add("DTSTART:" + e.Start.UTC().Format("20060102T150405Z"))
+			add("DTEND:" + e.End.UTC().Format("20060102T150405Z"))
+		}
+		add("SUMMARY:" + escapeICSText(e.Summary))
+		if e.Description != "" {
+			add("DESCRIPTION:" + escapeICSText(e.Description))
+		}
+		if e.Location != "" {
+			add("LOCATION:" + escapeICSText(e.Location))
+		}
+		add("END:VEVENT")
+	}
+	add("END:VCALENDAR")
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParsePairTime(t *testing.T) {
+    loc := time.FixedZone("MSK", 3*60*60)
+    start, end, err := ParsePairTime("2024-09-02", "08:30-10:00", loc)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if start.UTC().Hour() != 5 || start.Minute() != 30 || end.Sub(start) != 90*time.Minute {
+        t.Fatalf("unexpected times: %v %v", start, end)
+    }
+    if _, _, err := ParsePairTime("2024-09-02", "", loc); err == nil {
+        t.Fatalf("expected error for empty pair time")
+    }
+}
+
+func TestBuildICS(t *testing.T) {
+    start := time.Date(2024, 9, 2, 5, 30, 0, 0, time.UTC)
+    ics := BuildICS("Занятия", []ICSEvent{{
+        UID:      "lesson-1@teacher-journal",
+        Summary:  "Базы данных, лекция",
+        Location: "ауд. 101",
+        Start:    start,
+        End:      start.Add(90 * time.Minute),
+    }})
+
+    for _, want := range []string{
+        "BEGIN:VCALENDAR\r\n",
+        "DTSTART:20240902T053000Z\r\n",
+        "DTEND:20240902T070000Z\r\n",
+        `SUMMARY:Базы данных\, лекция`,
+        "LOCATION:ауд. 101\r\n",
+        "END:VCALENDAR\r\n",
+    } {
+        if !strings.Contains(ics, want) {
+            t.Fatalf("expected %q in output:\n%s", want, ics)
+        }
+    }
+}
+
+func TestFoldICSLine(t *testing.T) {
+    line := "DESCRIPTION:" + strings.Repeat("я", 60)
+    folded := foldICSLine(line)
+    for _, part := range strings.Split(folded, "\r\n") {
+        if len(part) > 75 {
+            t.Fatalf("line longer than 75 octets: %d", len(part))
+        }
+    }
+    if strings.ReplaceAll(folded, "\r\n ", "") != line {
+        t.Fatalf("unfolded line does not match original")
+    }
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"TeacherJournal/app/dashboard/db"
+	scheduleDB "TeacherJournal/app/schedule/db"
 	"TeacherJournal/app/schedule/handlers"
 	"TeacherJournal/app/schedule/middleware"
 	"log"
@@ -23,6 +24,11 @@ func main() {
 	}
 	defer sqlDB.Close()
 
+	// Migrate schedule service tables
+	if err := scheduleDB.Migrate(database); err != nil {
+		log.Fatal("Failed to migrate schedule tables:", err)
+	}
+
 	// Create router
 	router := mux.NewRouter()
 
@@ -34,14 +40,35 @@ func main() {
 	// Initialize schedule handler
 	scheduleHandler := handlers.NewScheduleHandler(database)
 
+	// Resume fetch jobs interrupted by a restart and clean up old results
+	handlers.StartJobWorker(database)
+
+	// Nightly sync of subscribed teachers' schedules
+	handlers.StartSyncScheduler(database)
+
 	// Schedule routes
 	scheduleRouter.HandleFunc("", scheduleHandler.GetSchedule).Methods("GET")
 	scheduleRouter.HandleFunc("/async", scheduleHandler.StartAsyncFetch).Methods("POST")
 	scheduleRouter.HandleFunc("/progress/{jobID}", scheduleHandler.GetProgress).Methods("GET")
 	scheduleRouter.HandleFunc("/results/{jobID}", scheduleHandler.GetResults).Methods("GET")
+	scheduleRouter.HandleFunc("/events/{jobID}", scheduleHandler.StreamJob).Methods("GET")
+	scheduleRouter.HandleFunc("/events/{jobID}/token", scheduleHandler.CreateStreamToken).Methods("POST")
 	scheduleRouter.HandleFunc("/lesson", scheduleHandler.AddLesson).Methods("POST")
 	scheduleRouter.HandleFunc("/lessons", scheduleHandler.AddAllLessons).Methods("POST")
 
+	// Schedule source routes
+	scheduleRouter.HandleFunc("/source", scheduleHandler.GetSource).Methods("GET")
+	scheduleRouter.HandleFunc("/source", scheduleHandler.UpdateSource).Methods("PUT")
+	scheduleRouter.HandleFunc("/source/upload", scheduleHandler.UploadSource).Methods("POST")
+
+	// Nightly sync routes
+	scheduleRouter.HandleFunc("/sync", scheduleHandler.GetSyncSettings).Methods("GET")
+	scheduleRouter.HandleFunc("/sync", scheduleHandler.UpdateSyncSettings).Methods("PUT")
+	scheduleRouter.HandleFunc("/sync/run", scheduleHandler.RunSync).Methods("POST")
+	scheduleRouter.HandleFunc("/changes", scheduleHandler.GetChanges).Methods("GET")
+	scheduleRouter.HandleFunc("/changes/{id}/apply", scheduleHandler.ApplyChange).Methods("POST")
+	scheduleRouter.HandleFunc("/changes/{id}/dismiss", scheduleHandler.DismissChange).Methods("POST")
+
 	// CORS setup for React frontend
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // Allow all origins
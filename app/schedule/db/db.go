@@ -0,0 +1,17 @@
+package db
+
+import (
+	"TeacherJournal/app/schedule/models"
+
+	"gorm.io/gorm"
+)
+
+// Migrate creates the tables owned by the schedule service. The service
+// shares the dashboard database, which is initialized by the dashboard db package.
+func Migrate(database *gorm.DB) error {
+	return database.AutoMigrate(
+		&models.ScheduleSourceSettings{},
+		&models.ScheduleJob{},
+		&models.ScheduleChange{},
+	)
+}
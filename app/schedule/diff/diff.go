@@ -0,0 +1,250 @@
+// Package diff compares a fetched schedule with the lessons already in the journal.
+package diff
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"TeacherJournal/app/schedule/sources"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change kinds
+const (
+	KindAdded       = "added"        // New pair in the schedule
+	KindCancelled   = "cancelled"    // Lesson no longer in the schedule
+	KindRoomChanged = "room_changed" // Same pair moved to another auditorium
+	KindTimeChanged = "time_changed" // Same pair moved to another time on the same day, possibly to another room
+)
+
+// Lesson is the part of a journal lesson compared with the schedule
+type Lesson struct {
+	ID         int
+	Date       string
+	Time       string
+	Subject    string
+	Groups     []string // Group names including the subgroup suffix
+	Auditorium string
+}
+
+// Change is one difference between the schedule and the journal
+type Change struct {
+	Kind          string
+	LessonID      int // Zero for added pairs
+	Date          string
+	Subject       string
+	Groups        []string
+	OldTime       string
+	NewTime       string
+	OldAuditorium string
+	NewAuditorium string
+	Item          *scheduleModels.ScheduleItem // Schedule item for added and changed pairs
+}
+
+// Safe reports whether the change can be applied without losing data.
+// Cancellations would delete attendance records and always need confirmation.
+func (c Change) Safe() bool {
+	return c.Kind != KindCancelled
+}
+
+// Describe returns a short Russian description for the teacher
+func (c Change) Describe() string {
+	groups := strings.Join(c.Groups, ", ")
+	switch c.Kind {
+	case KindAdded:
+		return fmt.Sprintf("Новая пара: %s, %s %s, %s", c.Subject, c.Date, c.NewTime, groups)
+	case KindCancelled:
+		return fmt.Sprintf("Пара отменена: %s, %s %s, %s", c.Subject, c.Date, c.OldTime, groups)
+	case KindRoomChanged:
+		return fmt.Sprintf("Смена аудитории: %s, %s %s, %s → %s", c.Subject, c.Date, c.NewTime, c.OldAuditorium, c.NewAuditorium)
+	case KindTimeChanged:
+		if c.NewAuditorium != "" && c.NewAuditorium != c.OldAuditorium {
+			return fmt.Sprintf("Перенос пары: %s, %s, %s → %s, %s → %s", c.Subject, c.Date, c.OldTime, c.NewTime, c.OldAuditorium, c.NewAuditorium)
+		}
+		return fmt.Sprintf("Перенос пары: %s, %s, %s → %s", c.Subject, c.Date, c.OldTime, c.NewTime)
+	}
+	return c.Kind
+}
+
+// ItemGroups returns the group names of a schedule item as stored in lessons,
+// with the subgroup appended for subgroup classes
+func ItemGroups(item scheduleModels.ScheduleItem) []string {
+	groups := item.Groups
+	if len(groups) == 0 {
+		groups = strings.Split(item.Group, ",")
+	}
+
+	result := []string{}
+	for _, g := range groups {
+		grp := strings.TrimSpace(g)
+		if grp == "" {
+			continue
+		}
+		if item.Subgroup != "" && item.Subgroup != sources.SubgroupWhole && item.Subgroup != sources.SubgroupStream {
+			grp = fmt.Sprintf("%s %s", grp, item.Subgroup)
+		}
+		result = append(result, grp)
+	}
+	return result
+}
+
+// pairKey identifies a pair independent of its time and room
+func pairKey(date, subject string, groups []string) string {
+	sorted := append([]string(nil), groups...)
+	for i := range sorted {
+		sorted[i] = strings.ToLower(strings.TrimSpace(sorted[i]))
+	}
+	sort.Strings(sorted)
+	return date + "|" + strings.ToLower(strings.TrimSpace(subject)) + "|" + strings.Join(sorted, ",")
+}
+
+type scheduled struct {
+	item   scheduleModels.ScheduleItem
+	groups []string
+}
+
+// Compare returns the changes needed to bring lessons in line with the schedule.
+// Both sides must cover the same date range. Pairs are matched by date, subject and
+// groups; several pairs of the same subject on one day are matched by time first.
+func Compare(lessons []Lesson, items []scheduleModels.ScheduleItem) []Change {
+	byKey := map[string][]scheduled{}
+	var keys []string
+	for _, item := range items {
+		groups := ItemGroups(item)
+		if len(groups) == 0 {
+			continue
+		}
+		key := pairKey(item.Date, item.Subject, groups)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], scheduled{item: item, groups: groups})
+	}
+
+	lessonsByKey := map[string][]Lesson{}
+	for _, lesson := range lessons {
+		key := pairKey(lesson.Date, lesson.Subject, lesson.Groups)
+		if _, ok := lessonsByKey[key]; !ok {
+			if _, inItems := byKey[key]; !inItems {
+				keys = append(keys, key)
+			}
+		}
+		lessonsByKey[key] = append(lessonsByKey[key], lesson)
+	}
+
+	var changes []Change
+	for _, key := range keys {
+		pending := append([]scheduled(nil), byKey[key]...)
+		unmatched := append([]Lesson(nil), lessonsByKey[key]...)
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].item.Time < pending[j].item.Time })
+		sort.SliceStable(unmatched, func(i, j int) bool { return unmatched[i].Time < unmatched[j].Time })
+
+		// Lessons at the same time as a pair, or without a time, are the same pair
+		var rest []scheduled
+		for _, s := range pending {
+			idx := -1
+			for i, lesson := range unmatched {
+				if lesson.Time == s.item.Time || lesson.Time == "" {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				rest = append(rest, s)
+				continue
+			}
+			changes = append(changes, compareMatched(unmatched[idx], s)...)
+			unmatched = append(unmatched[:idx], unmatched[idx+1:]...)
+		}
+
+		// Remaining pairs on the same day were moved to another time
+		for _, s := range rest {
+			if len(unmatched) == 0 {
+				item := s.item
+				changes = append(changes, Change{
+					Kind:          KindAdded,
+					Date:          item.Date,
+					Subject:       item.Subject,
+					Groups:        s.groups,
+					NewTime:       item.Time,
+					NewAuditorium: item.Auditorium,
+					Item:          &item,
+				})
+				continue
+			}
+
+			// The move carries the new auditorium too, applying it updates both
+			lesson := unmatched[0]
+			unmatched = unmatched[1:]
+			item := s.item
+			changes = append(changes, Change{
+				Kind:          KindTimeChanged,
+				LessonID:      lesson.ID,
+				Date:          item.Date,
+				Subject:       item.Subject,
+				Groups:        s.groups,
+				OldTime:       lesson.Time,
+				NewTime:       item.Time,
+				OldAuditorium: lesson.Auditorium,
+				NewAuditorium: item.Auditorium,
+				Item:          &item,
+			})
+		}
+
+		// Lessons left without a pair were cancelled
+		for _, lesson := range unmatched {
+			changes = append(changes, Change{
+				Kind:          KindCancelled,
+				LessonID:      lesson.ID,
+				Date:          lesson.Date,
+				Subject:       lesson.Subject,
+				Groups:        lesson.Groups,
+				OldTime:       lesson.Time,
+				OldAuditorium: lesson.Auditorium,
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Date == changes[j].Date {
+			return firstNonEmpty(changes[i].NewTime, changes[i].OldTime) < firstNonEmpty(changes[j].NewTime, changes[j].OldTime)
+		}
+		return changes[i].Date < changes[j].Date
+	})
+	return changes
+}
+
+// compareMatched reports the differences of a lesson matched to a pair
+func compareMatched(lesson Lesson, s scheduled) []Change {
+	// An empty auditorium in the schedule is not a change
+	if s.item.Auditorium != "" && s.item.Auditorium != lesson.Auditorium {
+		return []Change{roomChange(lesson, s)}
+	}
+	return nil
+}
+
+// roomChange describes a pair moved to another auditorium
+func roomChange(lesson Lesson, s scheduled) Change {
+	item := s.item
+	return Change{
+		Kind:          KindRoomChanged,
+		LessonID:      lesson.ID,
+		Date:          item.Date,
+		Subject:       item.Subject,
+		Groups:        s.groups,
+		OldTime:       lesson.Time,
+		NewTime:       item.Time,
+		OldAuditorium: lesson.Auditorium,
+		NewAuditorium: item.Auditorium,
+		Item:          &item,
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package diff
+
+import (
+    scheduleModels "TeacherJournal/app/schedule/models"
+    "testing"
+)
+
+func TestCompare(t *testing.T) {
+    lessons := []Lesson{
+        {ID: 1, Date: "2024-09-02", Time: "08:30-10:00", Subject: "Базы данных", Groups: []string{"ИС2-227-ОТ", "ИС1-227-ОТ"}, Auditorium: "101/1"},
+        {ID: 2, Date: "2024-09-02", Time: "10:10-11:40", Subject: "Базы данных", Groups: []string{"ИС1-227-ОТ 1 п.г."}, Auditorium: "305/1"},
+        {ID: 3, Date: "2024-09-03", Time: "08:30-10:00", Subject: "Программирование", Groups: []string{"ИС1-227-ОТ"}, Auditorium: "212/2"},
+        {ID: 4, Date: "2024-09-04", Time: "12:10-13:40", Subject: "Экономика", Groups: []string{"ЭК1-221-ОБ"}},
+    }
+    items := []scheduleModels.ScheduleItem{
+        // Unchanged
+        {Date: "2024-09-02", Time: "08:30-10:00", Subject: "Базы данных", Groups: []string{"ИС1-227-ОТ", "ИС2-227-ОТ"}, Subgroup: "Поток", Auditorium: "101/1"},
+        // Moved to another room
+        {Date: "2024-09-02", Time: "10:10-11:40", Subject: "Базы данных", Groups: []string{"ИС1-227-ОТ"}, Subgroup: "1 п.г.", Auditorium: "310/1"},
+        // Moved to another time, room unknown
+        {Date: "2024-09-03", Time: "12:10-13:40", Subject: "Программирование", Groups: []string{"ИС1-227-ОТ"}, Subgroup: "Вся группа"},
+        // New pair
+        {Date: "2024-09-05", Time: "08:30-10:00", Subject: "Экономика", Groups: []string{"ЭК1-221-ОБ"}, Subgroup: "Вся группа", Auditorium: "118/4"},
+    }
+
+    changes := Compare(lessons, items)
+    want := []struct {
+        kind     string
+        lessonID int
+    }{
+        {KindRoomChanged, 2},
+        {KindTimeChanged, 3},
+        {KindCancelled, 4},
+        {KindAdded, 0},
+    }
+    if len(changes) != len(want) {
+        t.Fatalf("expected %d changes got %d: %+v", len(want), len(changes), changes)
+    }
+    for i, w := range want {
+        if changes[i].Kind != w.kind || changes[i].LessonID != w.lessonID {
+            t.Fatalf("change %d: expected %s/%d got %s/%d", i, w.kind, w.lessonID, changes[i].Kind, changes[i].LessonID)
+        }
+    }
+    if changes[0].OldAuditorium != "305/1" || changes[0].NewAuditorium != "310/1" {
+        t.Fatalf("unexpected room change: %+v", changes[0])
+    }
+    if changes[1].OldTime != "08:30-10:00" || changes[1].NewTime != "12:10-13:40" {
+        t.Fatalf("unexpected time change: %+v", changes[1])
+    }
+    if changes[2].Safe() || !changes[3].Safe() {
+        t.Fatalf("cancellations must not be safe")
+    }
+}
+
+func TestCompareSameSubjectTwiceADay(t *testing.T) {
+    lessons := []Lesson{
+        {ID: 1, Date: "2024-09-02", Time: "08:30-10:00", Subject: "Физика", Groups: []string{"ФЗ1-231-ОБ"}},
+        {ID: 2, Date: "2024-09-02", Time: "10:10-11:40", Subject: "Физика", Groups: []string{"ФЗ1-231-ОБ"}},
+    }
+    items := []scheduleModels.ScheduleItem{
+        {Date: "2024-09-02", Time: "10:10-11:40", Subject: "Физика", Groups: []string{"ФЗ1-231-ОБ"}, Subgroup: "Вся группа"},
+    }
+
+    changes := Compare(lessons, items)
+    if len(changes) != 1 || changes[0].Kind != KindCancelled || changes[0].LessonID != 1 {
+        t.Fatalf("expected lesson 1 to be cancelled: %+v", changes)
+    }
+}
+
+func TestCompareMovedToAnotherTimeAndRoom(t *testing.T) {
+    lessons := []Lesson{
+        {ID: 1, Date: "2024-09-02", Time: "08:30-10:00", Subject: "Физика", Groups: []string{"ФЗ1-231-ОБ"}, Auditorium: "101/1"},
+    }
+    items := []scheduleModels.ScheduleItem{
+        {Date: "2024-09-02", Time: "12:10-13:40", Subject: "Физика", Groups: []string{"ФЗ1-231-ОБ"}, Subgroup: "Вся группа", Auditorium: "204/2"},
+    }
+
+    changes := Compare(lessons, items)
+    if len(changes) != 1 || changes[0].Kind != KindTimeChanged {
+        t.Fatalf("expected a single time change: %+v", changes)
+    }
+    if changes[0].OldAuditorium != "101/1" || changes[0].NewAuditorium != "204/2" {
+        t.Fatalf("expected the time change to carry the new room: %+v", changes[0])
+    }
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"TeacherJournal/app/dashboard/utils"
+	scheduleModels "TeacherJournal/app/schedule/models"
+	scheduleUtils "TeacherJournal/app/schedule/utils"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// eventHeartbeatInterval keeps proxies from closing idle streams
+	eventHeartbeatInterval = 15 * time.Second
+	// eventPollInterval picks up progress made by workers in other replicas
+	eventPollInterval = 2 * time.Second
+	// eventRetryMillis is the reconnection delay suggested to clients
+	eventRetryMillis = 3000
+)
+
+// jobNotifier wakes event streams when a job running in this process changes
+type jobNotifier struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]bool
+}
+
+var jobEvents = &jobNotifier{
+	subscribers: make(map[string]map[chan struct{}]bool),
+}
+
+// subscribe registers a channel that receives a signal on every job update
+func (n *jobNotifier) subscribe(jobID string) chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.subscribers[jobID] == nil {
+		n.subscribers[jobID] = make(map[chan struct{}]bool)
+	}
+	n.subscribers[jobID][ch] = true
+	return ch
+}
+
+// unsubscribe removes a channel when its client disconnects
+func (n *jobNotifier) unsubscribe(jobID string, ch chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.subscribers[jobID], ch)
+	if len(n.subscribers[jobID]) == 0 {
+		delete(n.subscribers, jobID)
+	}
+}
+
+// notify signals all subscribers of a job without blocking
+func (n *jobNotifier) notify(jobID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subscribers[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default: // A signal is already pending
+		}
+	}
+}
+
+// JobItemsEvent is sent when a period adds schedule items
+type JobItemsEvent struct {
+	Completed int                           `json:"completed"` // Periods fetched so far
+	Items     []scheduleModels.ScheduleItem `json:"items"`
+}
+
+// writeEvent writes one server-sent event
+func writeEvent(w http.ResponseWriter, id int, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload)
+	return err
+}
+
+// CreateStreamToken issues a short-lived token that opens the event stream of a job.
+// EventSource cannot send the Authorization header, so the stream is opened with
+// ?stream_token= instead of the session token, which would end up in access logs.
+func (h *ScheduleHandler) CreateStreamToken(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	userRole, _ := utils.GetUserRoleFromContext(r.Context())
+	token, expiresAt, err := scheduleUtils.GenerateStreamToken(job.UserID, userRole, job.ID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error generating stream token")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Stream token created", map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// StreamJob pushes job progress and newly fetched schedule items as server-sent events.
+// Event IDs are the number of items delivered so far, so a client reconnecting with
+// Last-Event-ID only receives the items it has not seen.
+func (h *ScheduleHandler) StreamJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.loadJob(w, r)
+	if !ok {
+		return
+	}
+
+	// Resume after the items the client already has
+	sent := 0
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	if lastEventID != "" {
+		n, err := strconv.Atoi(lastEventID)
+		if err != nil || n < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		sent = n
+	}
+
+	// The stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Could not clear write deadline for job stream %s: %v", job.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+
+	updates := jobEvents.subscribe(job.ID)
+	defer jobEvents.unsubscribe(job.ID, updates)
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	var lastProgress scheduleModels.ProgressResponse
+	first := true
+	for {
+		// Send items added since the last event
+		if job.ItemCount > sent {
+			var items []scheduleModels.ScheduleItem
+			if err := json.Unmarshal([]byte(job.Items), &items); err != nil {
+				log.Printf("Error decoding items of job %s: %v", job.ID, err)
+				return
+			}
+			if sent < len(items) {
+				if err := writeEvent(w, len(items), "items", JobItemsEvent{Completed: job.Completed, Items: items[sent:]}); err != nil {
+					return
+				}
+				sent = len(items)
+			}
+		}
+
+		// Send progress when it changes
+		progress := jobProgress(job)
+		if first || progress != lastProgress {
+			event := "progress"
+			if job.Finished {
+				event = "done"
+			}
+			if err := writeEvent(w, sent, event, progress); err != nil {
+				return
+			}
+			lastProgress = progress
+			first = false
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if job.Finished {
+			return
+		}
+
+		// Wait for the next change
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-updates:
+				break wait
+			case <-poll.C:
+				break wait
+			}
+		}
+
+		if err := h.DB.Where("id = ?", job.ID).First(&job).Error; err != nil {
+			log.Printf("Job %s disappeared while streaming: %v", job.ID, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"TeacherJournal/app/schedule/sources"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// jobLeaseDuration is how long a worker owns a job without reporting progress.
+	// A job whose lease expired is resumed by the next worker scan.
+	jobLeaseDuration = 2 * time.Minute
+	// jobResultTTL is how long finished jobs and their results are kept
+	jobResultTTL = 24 * time.Hour
+	// jobWorkerInterval is how often orphaned jobs are resumed and old ones removed
+	jobWorkerInterval = time.Minute
+)
+
+// workerID identifies this process in job leases
+var workerID = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "schedule"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// StartJobWorker resumes unfinished jobs left by stopped processes and
+// periodically removes expired results
+func StartJobWorker(database *gorm.DB) {
+	go func() {
+		resumeJobs(database)
+		gcJobs(database)
+
+		ticker := time.NewTicker(jobWorkerInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			resumeJobs(database)
+			gcJobs(database)
+		}
+	}()
+}
+
+// createJob stores a new job leased to this worker
+func createJob(database *gorm.DB, job *scheduleModels.ScheduleJob) error {
+	leaseUntil := time.Now().Add(jobLeaseDuration)
+	job.State = scheduleModels.JobStatusRunning
+	job.Status = "Initializing..."
+	job.Items = "[]"
+	job.LockedBy = workerID
+	job.LockedUntil = &leaseUntil
+	return database.Create(job).Error
+}
+
+// resumeJobs claims unfinished jobs whose lease has expired and runs them
+func resumeJobs(database *gorm.DB) {
+	var jobIDs []string
+	if err := database.Model(&scheduleModels.ScheduleJob{}).
+		Where("finished = ? AND (locked_until IS NULL OR locked_until < ?)", false, time.Now()).
+		Pluck("id", &jobIDs).Error; err != nil {
+		log.Printf("Error listing unfinished schedule jobs: %v", err)
+		return
+	}
+
+	for _, jobID := range jobIDs {
+		claimed, err := claimJob(database, jobID)
+		if err != nil {
+			log.Printf("Error claiming schedule job %s: %v", jobID, err)
+			continue
+		}
+		if claimed {
+			log.Printf("Resuming schedule job %s", jobID)
+			go runJob(database, jobID)
+		}
+	}
+}
+
+// claimJob takes over the lease of an unfinished job. It returns false when
+// another worker holds a valid lease.
+func claimJob(database *gorm.DB, jobID string) (bool, error) {
+	now := time.Now()
+	result := database.Model(&scheduleModels.ScheduleJob{}).
+		Where("id = ? AND finished = ? AND (locked_until IS NULL OR locked_until < ?)", jobID, false, now).
+		Updates(map[string]interface{}{
+			"locked_by":    workerID,
+			"locked_until": now.Add(jobLeaseDuration),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// gcJobs deletes finished jobs older than jobResultTTL
+func gcJobs(database *gorm.DB) {
+	result := database.Where("finished = ? AND finished_at < ?", true, time.Now().Add(-jobResultTTL)).
+		Delete(&scheduleModels.ScheduleJob{})
+	if result.Error != nil {
+		log.Printf("Error removing expired schedule jobs: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("Removed %d expired schedule jobs", result.RowsAffected)
+	}
+}
+
+// updateLeasedJob applies updates while this worker still owns the job and
+// extends the lease. It returns false if the lease was lost.
+func updateLeasedJob(database *gorm.DB, jobID string, updates map[string]interface{}) bool {
+	updates["locked_until"] = time.Now().Add(jobLeaseDuration)
+	result := database.Model(&scheduleModels.ScheduleJob{}).
+		Where("id = ? AND locked_by = ? AND finished = ?", jobID, workerID, false).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("Error updating schedule job %s: %v", jobID, result.Error)
+		return false
+	}
+	if result.RowsAffected != 1 {
+		return false
+	}
+
+	// Wake event streams following this job
+	jobEvents.notify(jobID)
+	return true
+}
+
+// failJob marks a job as finished with an error
+func failJob(database *gorm.DB, jobID, debugInfo string, err error) {
+	now := time.Now()
+	updateLeasedJob(database, jobID, map[string]interface{}{
+		"state":       scheduleModels.JobStatusError,
+		"status":      fmt.Sprintf("Error: %v", err),
+		"debug_info":  debugInfo + fmt.Sprintf("Error: %v\n", err),
+		"progress":    100,
+		"finished":    true,
+		"finished_at": now,
+	})
+}
+
+// runJob fetches the remaining periods of a job leased to this worker,
+// saving items and progress after every period so it can be resumed
+func runJob(database *gorm.DB, jobID string) {
+	var job scheduleModels.ScheduleJob
+	if err := database.Where("id = ?", jobID).First(&job).Error; err != nil {
+		log.Printf("Error loading schedule job %s: %v", jobID, err)
+		return
+	}
+
+	// Rebuild the source from the teacher's settings
+	settings, err := loadSourceSettings(database, job.UserID)
+	if err != nil {
+		failJob(database, jobID, job.DebugInfo, err)
+		return
+	}
+	if settings.SourceType == "" {
+		settings.SourceType = sources.TypeKIS
+	}
+	if settings.SourceType != job.SourceType {
+		failJob(database, jobID, job.DebugInfo, fmt.Errorf("schedule source changed from %s to %s", job.SourceType, settings.SourceType))
+		return
+	}
+	source, err := newSource(settings)
+	if err != nil {
+		failJob(database, jobID, job.DebugInfo, err)
+		return
+	}
+
+	// Parse dates for calculations
+	startDateParsed, err := time.Parse("2006-01-02", job.StartDate)
+	if err != nil {
+		failJob(database, jobID, job.DebugInfo, fmt.Errorf("error parsing start date: %w", err))
+		return
+	}
+	endDateParsed, err := time.Parse("2006-01-02", job.EndDate)
+	if err != nil {
+		failJob(database, jobID, job.DebugInfo, fmt.Errorf("error parsing end date: %w", err))
+		return
+	}
+
+	var items []scheduleModels.ScheduleItem
+	if err := json.Unmarshal([]byte(job.Items), &items); err != nil {
+		failJob(database, jobID, job.DebugInfo, fmt.Errorf("error decoding saved items: %w", err))
+		return
+	}
+
+	// Split the range into the periods the source can serve per request
+	periods := schedulePeriods(source, startDateParsed, endDateParsed)
+	numPeriods := len(periods)
+	debugInfo := job.DebugInfo
+	warnings := job.Warnings
+
+	if job.Completed == 0 {
+		totalDays := int(endDateParsed.Sub(startDateParsed).Hours()/24) + 1
+		debugInfo += fmt.Sprintf("Requesting schedule for %d days (%d periods) from %s source\n\n", totalDays, numPeriods, source.Name())
+	} else {
+		debugInfo += fmt.Sprintf("\n=== Resumed at period %d of %d ===\n", job.Completed+1, numPeriods)
+	}
+
+	if !updateLeasedJob(database, jobID, map[string]interface{}{
+		"total_periods": numPeriods,
+		"status":        fmt.Sprintf("Starting fetch for %d periods", numPeriods),
+		"progress":      5 + (job.Completed * 90 / numPeriods),
+	}) {
+		return
+	}
+
+	// Process each remaining period
+	for i := job.Completed; i < numPeriods; i++ {
+		period := periods[i]
+		currentDateStr := period[0].Format("2006-01-02")
+
+		// Update progress
+		if !updateLeasedJob(database, jobID, map[string]interface{}{
+			"status": fmt.Sprintf("Loading period %d of %d", i+1, numPeriods),
+		}) {
+			log.Printf("Lost lease on schedule job %s", jobID)
+			return
+		}
+
+		debugInfo += fmt.Sprintf("=== Request #%d: %s ===\n", i+1, currentDateStr)
+
+		// Fetch schedule from the source
+		result, err := source.Fetch(context.Background(), job.TeacherName, period[0], period[1])
+		debugInfo += result.DebugInfo
+		if err != nil {
+			debugInfo += fmt.Sprintf("Error fetching schedule for %s: %v\n", currentDateStr, err)
+		} else {
+			// Number items continuously across periods
+			prepareScheduleItems(database, job.UserID, result.Items, len(items))
+			items = append(items, result.Items...)
+			warnings = append(warnings, result.Warnings...)
+			job.ResponseSize += result.ResponseSize
+		}
+
+		encoded, err := json.Marshal(items)
+		if err != nil {
+			failJob(database, jobID, debugInfo, err)
+			return
+		}
+
+		// Save the period so a restart continues from the next one
+		if !updateLeasedJob(database, jobID, map[string]interface{}{
+			"completed":     i + 1,
+			"progress":      5 + ((i + 1) * 90 / numPeriods), // 5% at start, 95% at end
+			"item_count":    len(items),
+			"response_size": job.ResponseSize,
+			"items":         string(encoded),
+			"debug_info":    debugInfo,
+			"warnings":      warnings,
+		}) {
+			log.Printf("Lost lease on schedule job %s", jobID)
+			return
+		}
+	}
+
+	debugInfo += fmt.Sprintf("\n=== Total: found %d items for the entire period ===\n", len(items))
+
+	// Items keep their fetch order so event streams can resume by position;
+	// results are sorted when returned
+	now := time.Now()
+	updateLeasedJob(database, jobID, map[string]interface{}{
+		"state":       scheduleModels.JobStatusCompleted,
+		"status":      "Fetch completed",
+		"progress":    100,
+		"debug_info":  debugInfo,
+		"finished":    true,
+		"finished_at": now,
+	})
+}
+
+// jobProgress converts a job into a progress response
+func jobProgress(job scheduleModels.ScheduleJob) scheduleModels.ProgressResponse {
+	return scheduleModels.ProgressResponse{
+		JobID:        job.ID,
+		Progress:     job.Progress,
+		Status:       job.Status,
+		TotalPeriods: job.TotalPeriods,
+		Completed:    job.Completed,
+		ItemCount:    job.ItemCount,
+		Finished:     job.Finished,
+	}
+}
+
+// jobResult converts a finished job into the results response
+func jobResult(job scheduleModels.ScheduleJob) (scheduleModels.AsyncJobResult, error) {
+	result := scheduleModels.AsyncJobResult{
+		JobID:         job.ID,
+		TeacherName:   job.TeacherName,
+		StartDate:     job.StartDate,
+		EndDate:       job.EndDate,
+		ScheduleItems: []scheduleModels.ScheduleItem{},
+		ResponseSize:  job.ResponseSize,
+		ItemCount:     job.ItemCount,
+		DebugInfo:     job.DebugInfo,
+		Warnings:      job.Warnings,
+		Status:        job.State,
+	}
+	if job.FinishedAt != nil {
+		result.CompletionTime = job.FinishedAt.Format("2006-01-02 15:04:05")
+	}
+	if err := json.Unmarshal([]byte(job.Items), &result.ScheduleItems); err != nil {
+		return result, err
+	}
+
+	// Sort all items by date and time
+	sources.SortItems(result.ScheduleItems)
+	return result, nil
+}
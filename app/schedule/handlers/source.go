@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"TeacherJournal/app/dashboard/models"
+	"TeacherJournal/app/dashboard/utils"
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"TeacherJournal/app/schedule/sources"
+	"TeacherJournal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UpdateSourceRequest defines the request body for selecting a schedule source
+type UpdateSourceRequest struct {
+	SourceType  string `json:"source_type"`
+	TeacherName string `json:"teacher_name"`
+	ICSURL      string `json:"ics_url"`
+	// Calendars from other timetables name groups differently
+	ICSGroupPattern string `json:"ics_group_pattern"`
+	ICSDefaultGroup string `json:"ics_default_group"`
+}
+
+// loadSourceSettings returns the teacher's source settings, defaulting to KIS
+// with the teacher's own name
+func loadSourceSettings(database *gorm.DB, userID int) (scheduleModels.ScheduleSourceSettings, error) {
+	var settings scheduleModels.ScheduleSourceSettings
+	err := database.Where("user_id = ?", userID).First(&settings).Error
+	if err == nil {
+		return settings, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return settings, err
+	}
+
+	var user models.User
+	database.Select("fio").Where("id = ?", userID).First(&user)
+	return scheduleModels.ScheduleSourceSettings{
+		UserID:      userID,
+		SourceType:  sources.TypeKIS,
+		TeacherName: user.FIO,
+	}, nil
+}
+
+// newSource builds the schedule source described by the settings
+func newSource(settings scheduleModels.ScheduleSourceSettings) (sources.ScheduleSource, error) {
+	switch settings.SourceType {
+	case "", sources.TypeKIS:
+		return sources.NewKIS(), nil
+	case sources.TypeICS:
+		options, err := sources.NewICSOptions(settings.ICSGroupPattern, settings.ICSDefaultGroup)
+		if err != nil {
+			return nil, err
+		}
+		if settings.ICSURL != "" {
+			return sources.NewICS(settings.ICSURL, options), nil
+		}
+		if len(settings.UploadData) == 0 {
+			return nil, fmt.Errorf("no calendar URL or file configured")
+		}
+		return sources.NewICSFile(settings.UploadData, options)
+	case sources.TypeFile:
+		if len(settings.UploadData) == 0 {
+			return nil, fmt.Errorf("no schedule file uploaded")
+		}
+		return sources.FromUpload(settings.UploadFormat, settings.UploadData)
+	}
+	return nil, fmt.Errorf("unknown schedule source %q", settings.SourceType)
+}
+
+// sourceForRequest resolves the teacher's source and the teacher name to query.
+// An explicit teacher name overrides the saved one.
+func sourceForRequest(database *gorm.DB, userID int, teacher string) (sources.ScheduleSource, string, error) {
+	settings, err := loadSourceSettings(database, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	source, err := newSource(settings)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if teacher == "" {
+		teacher = settings.TeacherName
+	}
+	return source, teacher, nil
+}
+
+// sourceResponse describes the settings without the uploaded file contents
+func sourceResponse(settings scheduleModels.ScheduleSourceSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"source_type":       settings.SourceType,
+		"teacher_name":      settings.TeacherName,
+		"ics_url":           settings.ICSURL,
+		"ics_group_pattern": settings.ICSGroupPattern,
+		"ics_default_group": settings.ICSDefaultGroup,
+		"upload_name":       settings.UploadName,
+		"upload_format":     settings.UploadFormat,
+		"has_upload":        len(settings.UploadData) > 0,
+		"updated_at":        settings.UpdatedAt,
+	}
+}
+
+// GetSource returns the teacher's schedule source settings
+func (h *ScheduleHandler) GetSource(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := loadSourceSettings(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving schedule source")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Schedule source retrieved successfully", sourceResponse(settings))
+}
+
+// UpdateSource selects the schedule source for the teacher
+func (h *ScheduleHandler) UpdateSource(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req UpdateSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	settings, err := loadSourceSettings(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving schedule source")
+		return
+	}
+
+	req.TeacherName = strings.TrimSpace(req.TeacherName)
+	req.ICSURL = strings.TrimSpace(req.ICSURL)
+
+	switch req.SourceType {
+	case sources.TypeKIS:
+		if req.TeacherName == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Teacher name is required")
+			return
+		}
+	case sources.TypeICS:
+		if req.ICSURL != "" {
+			u, err := url.Parse(req.ICSURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") || u.Host == "" {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid calendar URL")
+				return
+			}
+			if u.Scheme == "webcal" {
+				u.Scheme = "https"
+				req.ICSURL = u.String()
+			}
+		} else if settings.UploadFormat != sources.FormatICS {
+			utils.RespondWithError(w, http.StatusBadRequest, "Calendar URL is required")
+			return
+		}
+		if _, err := sources.NewICSOptions(req.ICSGroupPattern, req.ICSDefaultGroup); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case sources.TypeFile:
+		if len(settings.UploadData) == 0 || settings.UploadFormat == sources.FormatICS {
+			utils.RespondWithError(w, http.StatusBadRequest, "Upload a CSV or XLSX file first")
+			return
+		}
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Source type must be kis, ics or file")
+		return
+	}
+
+	settings.SourceType = req.SourceType
+	if req.TeacherName != "" {
+		settings.TeacherName = req.TeacherName
+	}
+	settings.ICSURL = req.ICSURL
+	settings.ICSGroupPattern = strings.TrimSpace(req.ICSGroupPattern)
+	settings.ICSDefaultGroup = strings.TrimSpace(req.ICSDefaultGroup)
+	settings.UpdatedAt = time.Now()
+
+	if err := h.DB.Save(&settings).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving schedule source")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Update Schedule Source",
+		fmt.Sprintf("Selected schedule source %s", settings.SourceType))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Schedule source updated successfully", sourceResponse(settings))
+}
+
+// UploadSource stores an ICS, CSV or XLSX schedule file and selects it as the source
+func (h *ScheduleHandler) UploadSource(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse multipart form
+	if err := r.ParseMultipartForm(config.MaxFileSize); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	// Get file from form
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "No file uploaded")
+		return
+	}
+	defer file.Close()
+
+	format, err := sources.DetectFormat(header.Filename)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, config.MaxFileSize))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Error reading file")
+		return
+	}
+
+	// Validate the file before saving it
+	source, err := sources.FromUpload(format, data)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing schedule file: %v", err))
+		return
+	}
+	itemCount := 0
+	switch s := source.(type) {
+	case *sources.Static:
+		itemCount = len(s.Items)
+	case *sources.ICS:
+		itemCount = s.EventCount()
+	}
+
+	settings, err := loadSourceSettings(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving schedule source")
+		return
+	}
+
+	settings.SourceType = source.Name()
+	settings.ICSURL = ""
+	settings.UploadName = header.Filename
+	settings.UploadFormat = format
+	settings.UploadData = data
+	settings.UpdatedAt = time.Now()
+
+	if err := h.DB.Save(&settings).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving schedule source")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Upload Schedule File",
+		fmt.Sprintf("Uploaded %s with %d classes", header.Filename, itemCount))
+
+	response := sourceResponse(settings)
+	response["item_count"] = itemCount
+	utils.RespondWithSuccess(w, http.StatusOK, "Schedule file uploaded successfully", response)
+}
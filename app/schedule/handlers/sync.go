@@ -0,0 +1,584 @@
+package handlers
+
+import (
+	dashboardDB "TeacherJournal/app/dashboard/db"
+	"TeacherJournal/app/dashboard/models"
+	"TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/app/schedule/diff"
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"TeacherJournal/app/schedule/sources"
+	"TeacherJournal/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+const (
+	// syncHour is the local hour after which the nightly sync runs
+	syncHour = 3
+	// syncCheckInterval is how often the scheduler looks for teachers due for a sync
+	syncCheckInterval = 10 * time.Minute
+	// syncMaxWeeks limits how far ahead a teacher can sync
+	syncMaxWeeks = 8
+)
+
+// UpdateSyncRequest defines the request body for nightly sync settings
+type UpdateSyncRequest struct {
+	Enabled   bool `json:"enabled"`
+	AutoApply bool `json:"auto_apply"`
+	Weeks     int  `json:"weeks"`
+}
+
+// SyncSummary reports the outcome of a sync run
+type SyncSummary struct {
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	Items       int            `json:"items"`
+	Changes     map[string]int `json:"changes"`
+	Applied     int            `json:"applied"`
+	Pending     int            `json:"pending"`
+	Outdated    int            `json:"outdated"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	SkippedNote string         `json:"skipped_note,omitempty"`
+}
+
+// StartSyncScheduler runs the nightly sync for subscribed teachers. Each teacher is
+// claimed through last_sync_at, so several replicas never sync the same teacher twice.
+func StartSyncScheduler(database *gorm.DB) {
+	go func() {
+		ticker := time.NewTicker(syncCheckInterval)
+		defer ticker.Stop()
+		for {
+			syncDueTeachers(database)
+			<-ticker.C
+		}
+	}()
+}
+
+// syncDueTeachers syncs every subscribed teacher not yet synced since tonight's run time
+func syncDueTeachers(database *gorm.DB) {
+	now := time.Now().In(config.ScheduleLocation)
+	runAt := time.Date(now.Year(), now.Month(), now.Day(), syncHour, 0, 0, 0, config.ScheduleLocation)
+	if now.Before(runAt) {
+		return
+	}
+
+	var userIDs []int
+	if err := database.Model(&scheduleModels.ScheduleSourceSettings{}).
+		Where("sync_enabled = ? AND (last_sync_at IS NULL OR last_sync_at < ?)", true, runAt).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		log.Printf("Error listing teachers for schedule sync: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		// Claim the teacher for this run
+		result := database.Model(&scheduleModels.ScheduleSourceSettings{}).
+			Where("user_id = ? AND sync_enabled = ? AND (last_sync_at IS NULL OR last_sync_at < ?)", userID, true, runAt).
+			Update("last_sync_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		summary, err := runSync(database, userID)
+		if err != nil {
+			log.Printf("Schedule sync for user %d failed: %v", userID, err)
+			continue
+		}
+		log.Printf("Schedule sync for user %d: %d changes applied, %d pending", userID, summary.Applied, summary.Pending)
+	}
+}
+
+// changeSignature identifies a change across sync runs
+func changeSignature(kind string, lessonID int, date, subject string, groups []string, newTime, newAuditorium string) string {
+	return fmt.Sprintf("%s|%d|%s|%s|%s|%s|%s", kind, lessonID, date, subject, strings.Join(groups, ","), newTime, newAuditorium)
+}
+
+// runSync fetches the teacher's upcoming weeks, compares them with the journal and
+// records the changes, applying safe ones if the teacher opted in
+func runSync(database *gorm.DB, userID int) (SyncSummary, error) {
+	settings, err := loadSourceSettings(database, userID)
+	if err != nil {
+		return SyncSummary{}, err
+	}
+
+	summary, err := syncSettings(database, settings)
+
+	// Remember the outcome for the settings page
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	database.Model(&scheduleModels.ScheduleSourceSettings{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"last_sync_at":    time.Now(),
+			"last_sync_error": lastError,
+		})
+
+	if err == nil {
+		utils.LogAction(database, userID, "Sync Schedule",
+			fmt.Sprintf("Schedule sync %s – %s: %d applied, %d pending", summary.From, summary.To, summary.Applied, summary.Pending))
+	}
+	return summary, err
+}
+
+// syncSettings performs the sync for loaded settings
+func syncSettings(database *gorm.DB, settings scheduleModels.ScheduleSourceSettings) (SyncSummary, error) {
+	summary := SyncSummary{Changes: map[string]int{}}
+	userID := settings.UserID
+
+	source, err := newSource(settings)
+	if err != nil {
+		return summary, err
+	}
+
+	weeks := settings.SyncWeeks
+	if weeks <= 0 {
+		weeks = 2
+	}
+
+	// Upcoming weeks starting tomorrow, so today's lessons are never touched
+	now := time.Now().In(config.ScheduleLocation)
+	from := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, weeks*7-1)
+	summary.From = from.Format("2006-01-02")
+	summary.To = to.Format("2006-01-02")
+
+	// A missing period would look like a week of cancellations, so any fetch error aborts the sync
+	var items []scheduleModels.ScheduleItem
+	for _, period := range schedulePeriods(source, from, to) {
+		result, err := source.Fetch(context.Background(), settings.TeacherName, period[0], period[1])
+		if err != nil {
+			return summary, fmt.Errorf("fetching %s: %w", period[0].Format("2006-01-02"), err)
+		}
+		items = append(items, result.Items...)
+		summary.Warnings = append(summary.Warnings, result.Warnings...)
+	}
+	summary.Items = len(items)
+
+	// Lessons in the same window
+	var lessons []models.Lesson
+	if err := database.Where("teacher_id = ? AND date >= ? AND date <= ?", userID, summary.From, summary.To).
+		Find(&lessons).Error; err != nil {
+		return summary, err
+	}
+
+	current := make([]diff.Lesson, 0, len(lessons))
+	for _, lesson := range lessons {
+		groups := []string(lesson.Groups)
+		if len(groups) == 0 {
+			groups = dashboardDB.SplitGroupNames(lesson.GroupName)
+		}
+		current = append(current, diff.Lesson{
+			ID:         lesson.ID,
+			Date:       lesson.Date,
+			Time:       lesson.Time,
+			Subject:    lesson.Subject,
+			Groups:     groups,
+			Auditorium: lesson.Auditorium,
+		})
+	}
+
+	changes := diff.Compare(current, items)
+
+	// Pages the parser did not fully understand may be missing pairs
+	if len(summary.Warnings) > 0 {
+		kept := changes[:0]
+		for _, change := range changes {
+			if change.Kind != diff.KindCancelled {
+				kept = append(kept, change)
+			}
+		}
+		if len(kept) != len(changes) {
+			summary.SkippedNote = "Cancellations were not recorded because parts of the schedule could not be parsed"
+		}
+		changes = kept
+	}
+
+	err = database.Transaction(func(tx *gorm.DB) error {
+		// Pending and dismissed changes from earlier runs in the same window
+		var previous []scheduleModels.ScheduleChange
+		if err := tx.Where("user_id = ? AND status IN ? AND date >= ? AND date <= ?",
+			userID, []string{scheduleModels.ChangeStatusPending, scheduleModels.ChangeStatusDismissed}, summary.From, summary.To).
+			Find(&previous).Error; err != nil {
+			return err
+		}
+		pendingBySignature := map[string]scheduleModels.ScheduleChange{}
+		dismissed := map[string]bool{}
+		for _, p := range previous {
+			lessonID := 0
+			if p.LessonID != nil {
+				lessonID = *p.LessonID
+			}
+			signature := changeSignature(p.Kind, lessonID, p.Date, p.Subject, p.Groups, p.NewTime, p.NewAuditorium)
+			if p.Status == scheduleModels.ChangeStatusDismissed {
+				dismissed[signature] = true
+			} else {
+				pendingBySignature[signature] = p
+			}
+		}
+
+		for _, change := range changes {
+			summary.Changes[change.Kind]++
+
+			signature := changeSignature(change.Kind, change.LessonID, change.Date, change.Subject, change.Groups, change.NewTime, change.NewAuditorium)
+			if _, ok := pendingBySignature[signature]; ok {
+				// Already waiting for confirmation
+				delete(pendingBySignature, signature)
+				summary.Pending++
+				continue
+			}
+			if dismissed[signature] {
+				// The teacher rejected this change before
+				continue
+			}
+
+			record := scheduleModels.ScheduleChange{
+				UserID:        userID,
+				Kind:          change.Kind,
+				Status:        scheduleModels.ChangeStatusPending,
+				Date:          change.Date,
+				Subject:       change.Subject,
+				Groups:        change.Groups,
+				OldTime:       change.OldTime,
+				NewTime:       change.NewTime,
+				OldAuditorium: change.OldAuditorium,
+				NewAuditorium: change.NewAuditorium,
+				Description:   change.Describe(),
+				CreatedAt:     time.Now(),
+			}
+			if change.LessonID != 0 {
+				lessonID := change.LessonID
+				record.LessonID = &lessonID
+			}
+			if change.Item != nil {
+				encoded, err := json.Marshal(change.Item)
+				if err != nil {
+					return err
+				}
+				record.Item = string(encoded)
+			}
+
+			if settings.SyncAutoApply && change.Safe() {
+				// A failed change is rolled back to a savepoint and stays pending
+				if err := tx.Transaction(func(nested *gorm.DB) error {
+					return applyChange(nested, &record)
+				}); err != nil {
+					log.Printf("Could not apply schedule change for user %d: %v", userID, err)
+				} else {
+					summary.Applied++
+				}
+			}
+			if record.Status == scheduleModels.ChangeStatusPending {
+				summary.Pending++
+			}
+
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		// Changes the schedule no longer reports
+		now := time.Now()
+		for _, stale := range pendingBySignature {
+			if err := tx.Model(&scheduleModels.ScheduleChange{}).Where("id = ?", stale.ID).
+				Updates(map[string]interface{}{
+					"status":      scheduleModels.ChangeStatusOutdated,
+					"resolved_at": now,
+				}).Error; err != nil {
+				return err
+			}
+			summary.Outdated++
+		}
+		return nil
+	})
+
+	return summary, err
+}
+
+// applyChange updates the journal according to a change and marks it applied
+func applyChange(tx *gorm.DB, change *scheduleModels.ScheduleChange) error {
+	switch change.Kind {
+	case diff.KindAdded:
+		var item scheduleModels.ScheduleItem
+		if err := json.Unmarshal([]byte(change.Item), &item); err != nil {
+			return err
+		}
+		lesson, err := lessonFromScheduleItem(tx, change.UserID, item)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&lesson).Error; err != nil {
+			return err
+		}
+		change.LessonID = &lesson.ID
+
+	case diff.KindRoomChanged, diff.KindTimeChanged:
+		if change.LessonID == nil {
+			return fmt.Errorf("change has no lesson")
+		}
+		updates := map[string]interface{}{}
+		if change.NewAuditorium != "" {
+			updates["auditorium"] = change.NewAuditorium
+		}
+		if change.Kind == diff.KindTimeChanged {
+			updates["time"] = change.NewTime
+		}
+		result := tx.Model(&models.Lesson{}).
+			Where("id = ? AND teacher_id = ?", *change.LessonID, change.UserID).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("lesson %d no longer exists", *change.LessonID)
+		}
+
+	case diff.KindCancelled:
+		if change.LessonID == nil {
+			return fmt.Errorf("change has no lesson")
+		}
+		if err := tx.Where("lesson_id = ?", *change.LessonID).Delete(&models.Attendance{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND teacher_id = ?", *change.LessonID, change.UserID).Delete(&models.Lesson{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("lesson %d no longer exists", *change.LessonID)
+		}
+
+	default:
+		return fmt.Errorf("unknown change kind %q", change.Kind)
+	}
+
+	now := time.Now()
+	change.Status = scheduleModels.ChangeStatusApplied
+	change.ResolvedAt = &now
+	return nil
+}
+
+// syncResponse describes the nightly sync settings
+func syncResponse(settings scheduleModels.ScheduleSourceSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":         settings.SyncEnabled,
+		"auto_apply":      settings.SyncAutoApply,
+		"weeks":           settings.SyncWeeks,
+		"source_type":     settings.SourceType,
+		"last_sync_at":    settings.LastSyncAt,
+		"last_sync_error": settings.LastSyncError,
+	}
+}
+
+// GetSyncSettings returns the teacher's nightly sync settings
+func (h *ScheduleHandler) GetSyncSettings(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	settings, err := loadSourceSettings(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving sync settings")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Sync settings retrieved successfully", syncResponse(settings))
+}
+
+// UpdateSyncSettings subscribes the teacher to the nightly sync or unsubscribes them
+func (h *ScheduleHandler) UpdateSyncSettings(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req UpdateSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Weeks == 0 {
+		req.Weeks = 2
+	}
+	if req.Weeks < 1 || req.Weeks > syncMaxWeeks {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Weeks must be between 1 and %d", syncMaxWeeks))
+		return
+	}
+
+	settings, err := loadSourceSettings(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving sync settings")
+		return
+	}
+
+	if req.Enabled {
+		if _, err := newSource(settings); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Schedule source is not configured: %v", err))
+			return
+		}
+		if settings.SourceType == sources.TypeKIS && settings.TeacherName == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Teacher name is required")
+			return
+		}
+	}
+
+	settings.SyncEnabled = req.Enabled
+	settings.SyncAutoApply = req.AutoApply
+	settings.SyncWeeks = req.Weeks
+	settings.UpdatedAt = time.Now()
+
+	if err := h.DB.Save(&settings).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving sync settings")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Update Schedule Sync",
+		fmt.Sprintf("Nightly sync enabled: %t, auto-apply: %t, weeks: %d", req.Enabled, req.AutoApply, req.Weeks))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Sync settings updated successfully", syncResponse(settings))
+}
+
+// RunSync runs the sync for the current teacher immediately
+func (h *ScheduleHandler) RunSync(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	summary, err := runSync(h.DB, userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadGateway, fmt.Sprintf("Schedule sync failed: %v", err))
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Schedule synced successfully", summary)
+}
+
+// GetChanges lists schedule changes, pending ones by default
+func (h *ScheduleHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = scheduleModels.ChangeStatusPending
+	}
+
+	query := h.DB.Where("user_id = ?", userID)
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var changes []scheduleModels.ScheduleChange
+	if err := query.Order("date, new_time, old_time").Limit(500).Find(&changes).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving schedule changes")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Schedule changes retrieved successfully", changes)
+}
+
+// resolveChange loads a pending change of the current teacher
+func (h *ScheduleHandler) resolveChange(w http.ResponseWriter, r *http.Request) (scheduleModels.ScheduleChange, int, bool) {
+	var change scheduleModels.ScheduleChange
+
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return change, 0, false
+	}
+
+	// Get change ID from URL
+	vars := mux.Vars(r)
+	changeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid change ID")
+		return change, 0, false
+	}
+
+	if err := h.DB.Where("id = ? AND user_id = ?", changeID, userID).First(&change).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Change not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving change")
+		}
+		return change, 0, false
+	}
+
+	if change.Status != scheduleModels.ChangeStatusPending {
+		utils.RespondWithError(w, http.StatusConflict, "Change has already been resolved")
+		return change, 0, false
+	}
+
+	return change, userID, true
+}
+
+// ApplyChange applies a pending schedule change to the journal
+func (h *ScheduleHandler) ApplyChange(w http.ResponseWriter, r *http.Request) {
+	change, userID, ok := h.resolveChange(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyChange(tx, &change); err != nil {
+			return err
+		}
+		return tx.Save(&change).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusConflict, fmt.Sprintf("Could not apply change: %v", err))
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Apply Schedule Change", change.Description)
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Change applied successfully", change)
+}
+
+// DismissChange rejects a pending schedule change
+func (h *ScheduleHandler) DismissChange(w http.ResponseWriter, r *http.Request) {
+	change, userID, ok := h.resolveChange(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	change.Status = scheduleModels.ChangeStatusDismissed
+	change.ResolvedAt = &now
+	if err := h.DB.Save(&change).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving change")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Dismiss Schedule Change", change.Description)
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Change dismissed successfully", change)
+}
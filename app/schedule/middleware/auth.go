@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"TeacherJournal/app/dashboard/utils" // Продолжаем использовать dashboard utils
+	scheduleUtils "TeacherJournal/app/schedule/utils"
 	"log"
 	"net/http"
 	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 // JWTMiddleware validates JWT token and authorizes the request
@@ -21,6 +24,23 @@ func JWTMiddleware(next http.Handler) http.Handler {
 
 		// Get token from Authorization header
 		authHeader := r.Header.Get("Authorization")
+
+		// EventSource cannot set headers, so event streams pass a short-lived
+		// stream token of their job as a query parameter
+		if authHeader == "" && r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			if streamToken := r.URL.Query().Get("stream_token"); streamToken != "" {
+				claims, err := scheduleUtils.ParseStreamToken(streamToken, mux.Vars(r)["jobID"])
+				if err != nil {
+					log.Printf("JWT Middleware: Stream token validation failed: %v", err)
+					utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired stream token")
+					return
+				}
+				ctx := utils.SetUserContext(r.Context(), claims.UserID, claims.UserRole, "")
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+		}
+
 		if authHeader == "" {
 			log.Println("JWT Middleware: No Authorization header found")
 			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header is required")
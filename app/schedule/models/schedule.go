@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
 
 // ScheduleItem represents information about a schedule item
 type ScheduleItem struct {
@@ -47,6 +51,7 @@ type ScheduleResponse struct {
 	ResponseSize  int            `json:"responseSize"`
 	ItemCount     int            `json:"itemCount"`
 	DebugInfo     string         `json:"debugInfo,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"` // Parts of the source the parser could not interpret
 }
 
 // AsyncJobResult represents the result of an asynchronous fetch job
@@ -59,6 +64,7 @@ type AsyncJobResult struct {
 	ResponseSize   int            `json:"responseSize"`
 	ItemCount      int            `json:"itemCount"`
 	DebugInfo      string         `json:"debugInfo,omitempty"`
+	Warnings       []string       `json:"warnings,omitempty"` // Parts of the source the parser could not interpret
 	CompletionTime string         `json:"completionTime"`
 	Status         string         `json:"status"` // running, completed, error
 }
@@ -73,18 +79,85 @@ type AddAllLessonsRequest struct {
 	ScheduleItems []ScheduleItem `json:"scheduleItems"`
 }
 
-// AsyncJob represents an asynchronous job for fetching schedule
-type AsyncJob struct {
-	ID           string
-	TeacherName  string
-	StartDate    string
-	EndDate      string
-	Progress     int
-	Status       string
-	TotalPeriods int
-	Completed    int
-	Result       AsyncJobResult
-	ClientChans  map[chan ProgressResponse]bool
-	Finished     bool
-	LastUpdated  time.Time
+// Schedule job states
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusError     = "error"
+)
+
+// ScheduleJob is an asynchronous schedule fetch persisted in the database so
+// that it survives restarts and can be resumed by any replica
+type ScheduleJob struct {
+	ID           string         `gorm:"primaryKey;type:varchar(64)" json:"jobID"`
+	UserID       int            `gorm:"index;not null" json:"-"`
+	SourceType   string         `gorm:"type:varchar(16)" json:"sourceType"`
+	TeacherName  string         `json:"teacherName"`
+	StartDate    string         `json:"startDate"`
+	EndDate      string         `json:"endDate"`
+	State        string         `gorm:"type:varchar(16);index;not null;default:running" json:"state"` // running, completed, error
+	Status       string         `json:"status"`                                                       // Human-readable progress message
+	Progress     int            `json:"progress"`
+	TotalPeriods int            `json:"totalPeriods"`
+	Completed    int            `json:"completed"` // Periods fetched so far
+	ItemCount    int            `json:"itemCount"`
+	ResponseSize int            `json:"responseSize"`
+	Items        string         `gorm:"type:text" json:"-"` // JSON-encoded []ScheduleItem
+	DebugInfo    string         `gorm:"type:text" json:"-"`
+	Warnings     pq.StringArray `gorm:"type:text[]" json:"-"`
+	Finished     bool           `gorm:"index" json:"finished"`
+	LockedBy     string         `json:"-"` // Worker currently running the job
+	LockedUntil  *time.Time     `json:"-"` // Lease expiry; another worker may resume after it
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+	FinishedAt   *time.Time     `gorm:"index" json:"finishedAt,omitempty"`
+}
+
+// ScheduleSourceSettings stores which schedule source a teacher imports from
+type ScheduleSourceSettings struct {
+	UserID          int       `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	SourceType      string    `gorm:"type:varchar(16);not null;default:kis" json:"source_type"` // kis, ics, file
+	TeacherName     string    `json:"teacher_name"`                                             // Teacher name on kis.vgltu.ru
+	ICSURL          string    `gorm:"column:ics_url" json:"ics_url"`                            // iCalendar subscription URL
+	ICSGroupPattern string    `gorm:"column:ics_group_pattern" json:"ics_group_pattern"`        // Regexp of group names in events; empty - VGLTU codes
+	ICSDefaultGroup string    `gorm:"column:ics_default_group" json:"ics_default_group"`        // Group of events that name none
+	UploadName      string    `json:"upload_name"`                                              // Original name of the uploaded file
+	UploadFormat    string    `gorm:"type:varchar(8)" json:"upload_format"`                     // ics, csv or xlsx
+	UploadData      []byte    `json:"-"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	// Nightly sync of upcoming weeks against the journal
+	SyncEnabled   bool       `gorm:"not null;default:false" json:"sync_enabled"`
+	SyncAutoApply bool       `gorm:"not null;default:false" json:"sync_auto_apply"` // Apply safe changes without confirmation
+	SyncWeeks     int        `gorm:"not null;default:2" json:"sync_weeks"`
+	LastSyncAt    *time.Time `json:"last_sync_at"`
+	LastSyncError string     `json:"last_sync_error"`
+}
+
+// Schedule change statuses
+const (
+	ChangeStatusPending   = "pending"   // Waiting for the teacher's confirmation
+	ChangeStatusApplied   = "applied"   // Applied to the journal
+	ChangeStatusDismissed = "dismissed" // Rejected by the teacher
+	ChangeStatusOutdated  = "outdated"  // No longer reported by the schedule
+)
+
+// ScheduleChange is a difference between the schedule and the journal found by the nightly sync
+type ScheduleChange struct {
+	ID            int            `gorm:"primaryKey" json:"id"`
+	UserID        int            `gorm:"index;not null" json:"-"`
+	Kind          string         `gorm:"type:varchar(16);not null" json:"kind"` // added, cancelled, room_changed, time_changed
+	Status        string         `gorm:"type:varchar(16);index;not null" json:"status"`
+	LessonID      *int           `gorm:"index" json:"lesson_id,omitempty"`
+	Date          string         `gorm:"index" json:"date"`
+	Subject       string         `json:"subject"`
+	Groups        pq.StringArray `gorm:"type:text[]" json:"groups"`
+	OldTime       string         `json:"old_time"`
+	NewTime       string         `json:"new_time"`
+	OldAuditorium string         `json:"old_auditorium"`
+	NewAuditorium string         `json:"new_auditorium"`
+	Description   string         `json:"description"`
+	Item          string         `gorm:"type:text" json:"-"` // JSON-encoded ScheduleItem for added pairs
+	CreatedAt     time.Time      `json:"created_at"`
+	ResolvedAt    *time.Time     `json:"resolved_at,omitempty"`
 }
@@ -0,0 +1,184 @@
+package sources
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Upload formats accepted by FromUpload
+const (
+	FormatICS  = "ics"
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// tableColumns maps accepted header names (English or Russian) to columns
+var tableColumns = map[string]string{
+	"date":       "date",
+	"дата":       "date",
+	"time":       "time",
+	"время":      "time",
+	"type":       "type",
+	"тип":        "type",
+	"вид":        "type",
+	"subject":    "subject",
+	"дисциплина": "subject",
+	"предмет":    "subject",
+	"groups":     "groups",
+	"group":      "groups",
+	"группы":     "groups",
+	"группа":     "groups",
+	"subgroup":   "subgroup",
+	"подгруппа":  "subgroup",
+	"auditorium": "auditorium",
+	"room":       "auditorium",
+	"аудитория":  "auditorium",
+}
+
+// DetectFormat returns the upload format for a file name
+func DetectFormat(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ics", ".ical":
+		return FormatICS, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported file type %q, use .ics, .csv or .xlsx", filepath.Ext(filename))
+}
+
+// FromUpload parses an uploaded file into a source: a static one for tables and a
+// calendar for ICS files, whose recurring events are expanded on every fetch
+func FromUpload(format string, data []byte) (ScheduleSource, error) {
+	var items []scheduleModels.ScheduleItem
+	var err error
+
+	switch format {
+	case FormatICS:
+		return NewICSFile(data, ICSOptions{})
+	case FormatCSV:
+		items, err = ParseCSV(data)
+	case FormatXLSX:
+		items, err = ParseXLSX(data)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Static{SourceName: TypeFile, Items: items}, nil
+}
+
+// ParseCSV reads a schedule table with a header row. Both comma and semicolon
+// separators are accepted, the latter being the default of Russian Excel.
+func ParseCSV(data []byte) ([]scheduleModels.ScheduleItem, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if firstLine, _, _ := bytes.Cut(data, []byte("\n")); bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	return parseTable(rows)
+}
+
+// ParseXLSX reads the first sheet of a workbook as a schedule table
+func ParseXLSX(data []byte) ([]scheduleModels.ScheduleItem, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error opening XLSX: %w", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("error reading sheet: %w", err)
+	}
+	return parseTable(rows)
+}
+
+// parseTable converts rows with a header into schedule items
+func parseTable(rows [][]string) ([]scheduleModels.ScheduleItem, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+
+	columns := map[string]int{}
+	for i, header := range rows[0] {
+		if column, ok := tableColumns[strings.ToLower(strings.TrimSpace(header))]; ok {
+			columns[column] = i
+		}
+	}
+	for _, required := range []string{"date", "subject", "groups"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing required column %q", required)
+		}
+	}
+
+	items := []scheduleModels.ScheduleItem{}
+	for n, row := range rows[1:] {
+		cell := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		// Skip blank lines
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		date, err := ParseDate(cell("date"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", n+2, err)
+		}
+
+		groups := SplitGroups(cell("groups"))
+		if cell("subject") == "" || len(groups) == 0 {
+			return nil, fmt.Errorf("row %d: subject and groups are required", n+2)
+		}
+
+		item := scheduleModels.ScheduleItem{
+			Date:       date.Format("2006-01-02"),
+			Time:       strings.ReplaceAll(strings.ReplaceAll(cell("time"), " ", ""), "–", "-"),
+			ClassType:  NormalizeClassType(cell("type")),
+			Subject:    cell("subject"),
+			Group:      strings.Join(groups, ", "),
+			Groups:     groups,
+			Subgroup:   cell("subgroup"),
+			Auditorium: cell("auditorium"),
+		}
+		if item.Subgroup == "" {
+			item.Subgroup = SubgroupWhole
+			if item.ClassType == ClassTypeNames["лек"] {
+				item.Subgroup = SubgroupStream
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	SortItems(items)
+	return items, nil
+}
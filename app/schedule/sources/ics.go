@@ -0,0 +1,398 @@
+package sources
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"TeacherJournal/config"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxICSSize limits downloaded calendars
+const maxICSSize = 10 << 20
+
+var (
+	icsGroupRegex    = regexp.MustCompile(`([А-Я]+\d+-\d+-[А-Я]{2})`)
+	icsSubgroupRegex = regexp.MustCompile(`(\d+)\s*п\.?\s*г\.?`)
+	icsTypeRegex     = regexp.MustCompile(`(?i)^\s*(лаб|пр|лек)\.?\s+`)
+)
+
+// ICSOptions tells how calendar events are matched to journal groups
+type ICSOptions struct {
+	// GroupPattern finds group names in the summary and description; nil - VGLTU group codes
+	GroupPattern *regexp.Regexp
+	// DefaultGroup is used for events that name no group; empty - such events are skipped
+	DefaultGroup string
+}
+
+// NewICSOptions builds options from a group pattern and default group given in the source settings
+func NewICSOptions(groupPattern, defaultGroup string) (ICSOptions, error) {
+	options := ICSOptions{DefaultGroup: strings.TrimSpace(defaultGroup)}
+	if groupPattern = strings.TrimSpace(groupPattern); groupPattern != "" {
+		pattern, err := regexp.Compile(groupPattern)
+		if err != nil {
+			return options, fmt.Errorf("invalid group pattern: %w", err)
+		}
+		options.GroupPattern = pattern
+	}
+	return options, nil
+}
+
+// groupPattern returns the pattern that finds group names
+func (o ICSOptions) groupPattern() *regexp.Regexp {
+	if o.GroupPattern != nil {
+		return o.GroupPattern
+	}
+	return icsGroupRegex
+}
+
+// ICS is a source backed by an iCalendar subscription URL, downloaded on every fetch,
+// or by an uploaded calendar file. Recurring events are expanded within the fetched range.
+type ICS struct {
+	URL     string
+	Data    []byte // Uploaded calendar; used instead of URL when set
+	Options ICSOptions
+	Client  *http.Client
+}
+
+// NewICS creates an ICS source for a calendar URL
+func NewICS(calendarURL string, options ICSOptions) *ICS {
+	return &ICS{
+		URL:     calendarURL,
+		Options: options,
+		Client: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// NewICSFile creates an ICS source for an uploaded calendar, checking that it can be read
+func NewICSFile(data []byte, options ICSOptions) (*ICS, error) {
+	if _, err := parseICSEvents(data); err != nil {
+		return nil, err
+	}
+	return &ICS{Data: data, Options: options}, nil
+}
+
+// Name returns the source type identifier
+func (s *ICS) Name() string {
+	return TypeICS
+}
+
+// EventCount returns the number of events in an uploaded calendar
+func (s *ICS) EventCount() int {
+	events, _ := parseICSEvents(s.Data)
+	return len(events)
+}
+
+// Fetch downloads the calendar and returns the events within the range
+func (s *ICS) Fetch(ctx context.Context, teacher string, from, to time.Time) (FetchResult, error) {
+	var result FetchResult
+	body := s.Data
+	if body == nil {
+		var err error
+		result.DebugInfo = fmt.Sprintf("Fetching URL: %s\n", s.URL)
+		if body, err = s.download(ctx, &result); err != nil {
+			return result, err
+		}
+	}
+	result.ResponseSize = len(body)
+
+	items, warnings, err := ParseICS(body, s.Options, from, to)
+	if err != nil {
+		return result, err
+	}
+
+	result.Items = items
+	result.Warnings = warnings
+	return result, nil
+}
+
+// download fetches the calendar from its URL
+func (s *ICS) download(ctx context.Context, result *FetchResult) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result.DebugInfo += fmt.Sprintf("Response status: %s\n", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar returned status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxICSSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading calendar: %w", err)
+	}
+	return body, nil
+}
+
+// icsProperty is one unfolded content line
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// unfoldICS joins continuation lines per RFC 5545
+func unfoldICS(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(data, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICSLine splits a content line into name, parameters and value
+func parseICSLine(line string) (icsProperty, bool) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return icsProperty{}, false
+	}
+
+	head := strings.Split(line[:colon], ";")
+	prop := icsProperty{
+		Name:   strings.ToUpper(head[0]),
+		Params: map[string]string{},
+		Value:  line[colon+1:],
+	}
+	for _, param := range head[1:] {
+		if eq := strings.Index(param, "="); eq > 0 {
+			prop.Params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+		}
+	}
+	return prop, true
+}
+
+// unescapeICSText reverses TEXT escaping
+func unescapeICSText(s string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(s)
+}
+
+// parseICSTime parses DTSTART/DTEND values in UTC, floating or TZID form
+func parseICSTime(prop icsProperty) (time.Time, bool, error) {
+	if prop.Params["VALUE"] == "DATE" || len(prop.Value) == 8 {
+		t, err := time.ParseInLocation("20060102", prop.Value, config.ScheduleLocation)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(prop.Value, "Z") {
+		t, err := time.Parse("20060102T150405Z", prop.Value)
+		return t, false, err
+	}
+
+	loc := config.ScheduleLocation
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", prop.Value, loc)
+	return t, false, err
+}
+
+// icsEvent is one VEVENT. Props holds the first value of every property except
+// EXDATE, which may repeat.
+type icsEvent struct {
+	Props   map[string]icsProperty
+	ExDates []icsProperty
+}
+
+// parseICSEvents reads the VEVENTs of a calendar
+func parseICSEvents(data []byte) ([]icsEvent, error) {
+	lines := unfoldICS(string(data))
+	if len(lines) == 0 || !strings.Contains(strings.ToUpper(string(data)), "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	events := []icsEvent{}
+	var event *icsEvent
+	for _, line := range lines {
+		prop, ok := parseICSLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case prop.Name == "BEGIN" && strings.EqualFold(prop.Value, "VEVENT"):
+			event = &icsEvent{Props: map[string]icsProperty{}}
+		case prop.Name == "END" && strings.EqualFold(prop.Value, "VEVENT"):
+			if event != nil {
+				events = append(events, *event)
+			}
+			event = nil
+		case event != nil && prop.Name == "EXDATE":
+			event.ExDates = append(event.ExDates, prop)
+		case event != nil:
+			if _, exists := event.Props[prop.Name]; !exists {
+				event.Props[prop.Name] = prop
+			}
+		}
+	}
+	return events, nil
+}
+
+// ParseICS converts the VEVENTs between from and to, both inclusive, into schedule items.
+// Recurring events are expanded by their RRULE, leaving out EXDATEs and occurrences
+// replaced by a RECURRENCE-ID event. The class type is taken from CATEGORIES or a
+// "лек."/"пр."/"лаб." prefix of SUMMARY, groups from the summary and description.
+func ParseICS(data []byte, options ICSOptions, from, to time.Time) ([]scheduleModels.ScheduleItem, []string, error) {
+	events, err := parseICSEvents(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rangeStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, config.ScheduleLocation)
+	rangeEnd := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, config.ScheduleLocation).AddDate(0, 0, 1)
+
+	// Occurrences moved or changed by separate events
+	overridden := map[string]map[int64]bool{}
+	for _, event := range events {
+		uid := event.Props["UID"].Value
+		recurrenceID, ok := event.Props["RECURRENCE-ID"]
+		if !ok || uid == "" {
+			continue
+		}
+		if t, _, err := parseICSTime(recurrenceID); err == nil {
+			if overridden[uid] == nil {
+				overridden[uid] = map[int64]bool{}
+			}
+			overridden[uid][t.Unix()] = true
+		}
+	}
+
+	items := []scheduleModels.ScheduleItem{}
+	var warnings []string
+	withoutGroup := 0
+	for _, event := range events {
+		startProp, ok := event.Props["DTSTART"]
+		if !ok {
+			continue
+		}
+		start, allDay, err := parseICSTime(startProp)
+		if err != nil {
+			continue
+		}
+		duration := 90 * time.Minute
+		if endProp, ok := event.Props["DTEND"]; ok {
+			if end, _, err := parseICSTime(endProp); err == nil && end.After(start) {
+				duration = end.Sub(start)
+			}
+		}
+
+		starts := []time.Time{start}
+		uid := event.Props["UID"].Value
+		_, isOverride := event.Props["RECURRENCE-ID"]
+		if ruleProp, ok := event.Props["RRULE"]; ok && !isOverride {
+			rule, err := parseRRule(ruleProp.Value, start.Location())
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %v, only the first occurrence is imported",
+					unescapeICSText(event.Props["SUMMARY"].Value), err))
+			} else {
+				starts = rule.expand(start, rangeEnd)
+			}
+		}
+		excluded := exDates(event.ExDates)
+
+		for _, occurrence := range starts {
+			if occurrence.Before(rangeStart) || !occurrence.Before(rangeEnd) {
+				continue
+			}
+			if excluded.has(occurrence) || (!isOverride && overridden[uid][occurrence.Unix()]) {
+				continue
+			}
+
+			item := icsEventItem(event.Props, occurrence, occurrence.Add(duration), allDay, options)
+			if item.Subject == "" {
+				continue
+			}
+			if len(item.Groups) == 0 {
+				withoutGroup++
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+
+	if withoutGroup > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d events name no group and were skipped; set a group pattern or a default group for the calendar", withoutGroup))
+	}
+
+	SortItems(items)
+	return items, warnings, nil
+}
+
+// icsEventItem builds a schedule item from the properties of one VEVENT occurring at start.
+// Items without a subject or groups are returned empty of them for the caller to skip.
+func icsEventItem(event map[string]icsProperty, start, end time.Time, allDay bool, options ICSOptions) scheduleModels.ScheduleItem {
+	start = start.In(config.ScheduleLocation)
+
+	item := scheduleModels.ScheduleItem{
+		Date:       start.Format("2006-01-02"),
+		Auditorium: unescapeICSText(event["LOCATION"].Value),
+	}
+
+	if !allDay {
+		item.Time = fmt.Sprintf("%s-%s", start.Format("15:04"), end.In(config.ScheduleLocation).Format("15:04"))
+	}
+
+	summary := unescapeICSText(event["SUMMARY"].Value)
+	description := unescapeICSText(event["DESCRIPTION"].Value)
+
+	// Class type from categories or a summary prefix
+	classType := unescapeICSText(event["CATEGORIES"].Value)
+	if m := icsTypeRegex.FindStringSubmatch(summary); m != nil {
+		if classType == "" {
+			classType = m[1]
+		}
+		summary = summary[len(m[0]):]
+	}
+	item.ClassType = NormalizeClassType(classType)
+
+	// Groups mentioned in the summary are removed from the subject name
+	groupPattern := options.groupPattern()
+	text := summary + "\n" + description
+	seen := map[string]bool{}
+	for _, g := range groupPattern.FindAllString(text, -1) {
+		if g = strings.TrimSpace(g); g != "" && !seen[g] {
+			seen[g] = true
+			item.Groups = append(item.Groups, g)
+		}
+	}
+	if len(item.Groups) == 0 && options.DefaultGroup != "" {
+		item.Groups = SplitGroups(options.DefaultGroup)
+	}
+	subject := groupPattern.ReplaceAllString(summary, "")
+	subject = icsSubgroupRegex.ReplaceAllString(subject, "")
+	item.Subject = strings.Trim(strings.TrimSpace(subject), ",;()- ")
+	item.Group = strings.Join(item.Groups, ", ")
+
+	item.Subgroup = SubgroupWhole
+	if m := icsSubgroupRegex.FindStringSubmatch(text); m != nil {
+		item.Subgroup = fmt.Sprintf("%s п.г.", m[1])
+	} else if item.ClassType == ClassTypeNames["лек"] {
+		item.Subgroup = SubgroupStream
+	}
+
+	return item
+}
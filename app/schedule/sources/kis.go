@@ -0,0 +1,388 @@
+package sources
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// KISBaseURL is the kis.vgltu.ru schedule page
+const KISBaseURL = "https://kis.vgltu.ru/schedule"
+
+// KISPeriodDays is the number of days a single KIS page covers
+const KISPeriodDays = 14
+
+var (
+	// Opening tag of a day block, used to detect blocks the full regex misses
+	kisDayMarkerRegex = regexp.MustCompile(`<div[^>]*margin-bottom: 25px[^>]*>`)
+	// Regular expression for finding day blocks
+	kisDayBlockRegex = regexp.MustCompile(`(?s)<div[^>]*margin-bottom: 25px[^>]*>\s*<div>\s*<strong>(\d+) ([а-яА-Я]+) (\d{4})</strong>\s*</div>\s*<div>\s*([а-яА-Я]+)\s*</div>\s*<table>(.*?)</table>\s*</div>`)
+	kisClassRegex    = regexp.MustCompile(`(?s)<tr>\s*<td[^>]*>(\d+:\d+-\d+:\d+)</td>\s*<td[^>]*>(.*?)</td>\s*</tr>`)
+	kisSubjectRegex  = regexp.MustCompile(`(лаб|пр|лек)\.\s+([^<\r\n]+)`)
+	kisGroupRegex    = regexp.MustCompile(`([А-Я]+\d+-\d+-[А-Я]{2})`)
+	kisSubgroupRegex = regexp.MustCompile(`(\d+)\s+п\.г\.`)
+	kisAuditRegex    = regexp.MustCompile(`<a href="https://vgltu.ru/map/rasp\?auditory=([^"]+)">([^<]+)</a>`)
+)
+
+// russianMonths maps genitive month names to month numbers
+var russianMonths = map[string]string{
+	"января":   "01",
+	"февраля":  "02",
+	"марта":    "03",
+	"апреля":   "04",
+	"мая":      "05",
+	"июня":     "06",
+	"июля":     "07",
+	"августа":  "08",
+	"сентября": "09",
+	"октября":  "10",
+	"ноября":   "11",
+	"декабря":  "12",
+}
+
+// KIS scrapes the kis.vgltu.ru timetable by teacher name
+type KIS struct {
+	BaseURL string
+	Client  *http.Client
+	// Delay is the minimum pause between requests to avoid API rate limiting
+	Delay time.Duration
+
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+// NewKIS creates a KIS source with default settings
+func NewKIS() *KIS {
+	return &KIS{
+		BaseURL: KISBaseURL,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		Delay: 500 * time.Millisecond,
+	}
+}
+
+// Name returns the source type identifier
+func (s *KIS) Name() string {
+	return TypeKIS
+}
+
+// PeriodDays returns the number of days covered by one KIS page
+func (s *KIS) PeriodDays() int {
+	return KISPeriodDays
+}
+
+// Fetch requests one KIS page per 14 days of the range and parses the classes
+func (s *KIS) Fetch(ctx context.Context, teacher string, from, to time.Time) (FetchResult, error) {
+	var result FetchResult
+	var debugBuilder strings.Builder
+
+	if teacher == "" {
+		return result, fmt.Errorf("teacher name is required")
+	}
+
+	for current := from; !current.After(to); current = current.AddDate(0, 0, KISPeriodDays) {
+		if err := s.wait(ctx); err != nil {
+			return result, err
+		}
+
+		apiDebugInfo, content, err := s.fetchPage(ctx, teacher, current.Format("2006-01-02"))
+		debugBuilder.WriteString(apiDebugInfo)
+		if err != nil {
+			result.DebugInfo = debugBuilder.String()
+			return result, err
+		}
+
+		result.ResponseSize += len(content)
+
+		items, diag := ParseKISHTML(content)
+		debugBuilder.WriteString(fmt.Sprintf("Parsed %d classes from %d day blocks\n", diag.Items, diag.DayBlocks))
+		if !diag.OK() {
+			log.Printf("KIS page for %s on %s: %d blocks not recognized", teacher, current.Format("2006-01-02"), len(diag.Unmatched))
+			for _, warning := range diag.Warnings() {
+				debugBuilder.WriteString("WARNING: " + warning + "\n")
+			}
+			result.Warnings = append(result.Warnings, diag.Warnings()...)
+		}
+		result.Items = append(result.Items, items...)
+	}
+
+	result.Items = filterRange(result.Items, from, to)
+	result.DebugInfo = debugBuilder.String()
+	return result, nil
+}
+
+// wait enforces the delay between consecutive requests
+func (s *KIS) wait(ctx context.Context) error {
+	s.mu.Lock()
+	pause := s.Delay - time.Since(s.lastRequest)
+	s.mu.Unlock()
+
+	if pause > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+
+	s.mu.Lock()
+	s.lastRequest = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// fetchPage makes a direct request to the schedule API
+func (s *KIS) fetchPage(ctx context.Context, teacher, date string) (string, string, error) {
+	var debugBuilder strings.Builder
+
+	// API URL
+	apiURL := fmt.Sprintf("%s?teacher=%s&date=%s", s.BaseURL, url.QueryEscape(teacher), date)
+	debugBuilder.WriteString(fmt.Sprintf("Fetching URL: %s\n", apiURL))
+
+	// Create request
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		log.Printf("Error creating request: %v", err)
+		return debugBuilder.String(), "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	// Add headers
+	req.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8")
+	req.Header.Add("Accept-Language", "ru-RU,ru;q=0.8,en-US;q=0.5,en;q=0.3")
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
+
+	// Execute request
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		log.Printf("Error making API request: %v", err)
+		return debugBuilder.String(), "", fmt.Errorf("error making API request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Log response status
+	debugBuilder.WriteString(fmt.Sprintf("Response status: %s\n", resp.Status))
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading response: %v", err)
+		return debugBuilder.String(), "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	content := string(body)
+	debugBuilder.WriteString(fmt.Sprintf("\nResponse length: %d bytes\n", len(content)))
+
+	// Check for empty response
+	if content == "" {
+		log.Printf("Empty response received from API")
+		return debugBuilder.String(), "", fmt.Errorf("empty response received from API")
+	}
+
+	return debugBuilder.String(), content, nil
+}
+
+// ParseDiagnostics reports the parts of a KIS page the parser could not interpret,
+// so markup changes on the site show up instead of silently yielding no items
+type ParseDiagnostics struct {
+	DayBlocks  int              `json:"dayBlocks"`  // Day blocks found on the page
+	ParsedDays int              `json:"parsedDays"` // Day blocks with a recognized date
+	EmptyDays  int              `json:"emptyDays"`  // Days marked "Нет пар"
+	Items      int              `json:"items"`      // Classes extracted
+	Unmatched  []UnmatchedBlock `json:"unmatched,omitempty"`
+}
+
+// UnmatchedBlock is a fragment of the page that was skipped
+type UnmatchedBlock struct {
+	Date    string `json:"date,omitempty"` // Date of the day block, if known
+	Reason  string `json:"reason"`
+	Snippet string `json:"snippet"`
+}
+
+// OK reports whether every block on the page was understood
+func (d ParseDiagnostics) OK() bool {
+	return len(d.Unmatched) == 0
+}
+
+// Warnings formats unmatched blocks as human-readable messages
+func (d ParseDiagnostics) Warnings() []string {
+	warnings := make([]string, 0, len(d.Unmatched))
+	for _, u := range d.Unmatched {
+		msg := u.Reason
+		if u.Date != "" {
+			msg = fmt.Sprintf("%s: %s", u.Date, msg)
+		}
+		warnings = append(warnings, fmt.Sprintf("%s (%s)", msg, u.Snippet))
+	}
+	return warnings
+}
+
+func (d *ParseDiagnostics) unmatched(date, reason, fragment string) {
+	d.Unmatched = append(d.Unmatched, UnmatchedBlock{Date: date, Reason: reason, Snippet: snippet(fragment)})
+}
+
+// snippet shortens a fragment of markup for diagnostics
+func snippet(fragment string) string {
+	const limit = 160
+	text := strings.Join(strings.Fields(fragment), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit]) + "…"
+}
+
+// ParseKISHTML extracts schedule items from a KIS schedule page
+func ParseKISHTML(page string) ([]scheduleModels.ScheduleItem, ParseDiagnostics) {
+	scheduleItems := []scheduleModels.ScheduleItem{}
+	var diag ParseDiagnostics
+
+	// Decode HTML entities
+	page = html.UnescapeString(page)
+
+	// Check for empty HTML
+	if strings.TrimSpace(page) == "" {
+		return scheduleItems, diag
+	}
+
+	// Day blocks the strict regex recognized, by start offset
+	matchedAt := map[int]bool{}
+	dayBlocks := kisDayBlockRegex.FindAllStringSubmatchIndex(page, -1)
+	for _, loc := range dayBlocks {
+		matchedAt[loc[0]] = true
+	}
+
+	// Every day block starts with the same marker; any marker outside a match
+	// means the block's markup has changed
+	markers := kisDayMarkerRegex.FindAllStringIndex(page, -1)
+	diag.DayBlocks = len(markers)
+	for _, loc := range markers {
+		if !matchedAt[loc[0]] {
+			end := loc[0] + 400
+			if end > len(page) {
+				end = len(page)
+			}
+			diag.unmatched("", "day block markup not recognized", page[loc[0]:end])
+		}
+	}
+	if len(markers) == 0 {
+		diag.unmatched("", "no day blocks found on the page", page)
+	}
+
+	for _, loc := range dayBlocks {
+		block := page[loc[0]:loc[1]]
+		day := page[loc[2]:loc[3]]
+		monthRussian := strings.ToLower(page[loc[4]:loc[5]])
+		year := page[loc[6]:loc[7]]
+		scheduleTable := page[loc[10]:loc[11]]
+
+		// Get numeric month
+		month, ok := russianMonths[monthRussian]
+		if !ok {
+			diag.unmatched("", fmt.Sprintf("unknown month %q", monthRussian), block)
+			continue
+		}
+
+		// Format date as YYYY-MM-DD
+		if len(day) == 1 {
+			day = "0" + day
+		}
+		dbFormatDate := fmt.Sprintf("%s-%s-%s", year, month, day)
+		diag.ParsedDays++
+
+		// Skip days with no classes
+		if strings.Contains(scheduleTable, "Нет пар") {
+			diag.EmptyDays++
+			continue
+		}
+
+		// Find all classes in this day's schedule
+		classes := kisClassRegex.FindAllStringSubmatch(scheduleTable, -1)
+		if rows := strings.Count(scheduleTable, "<tr"); rows > len(classes) {
+			diag.unmatched(dbFormatDate, fmt.Sprintf("%d of %d table rows not recognized", rows-len(classes), rows), scheduleTable)
+		}
+
+		for _, class := range classes {
+			item, reason := parseKISClass(dbFormatDate, class[1], class[2])
+			if reason != "" {
+				diag.unmatched(dbFormatDate, reason, class[2])
+				continue
+			}
+			scheduleItems = append(scheduleItems, item)
+		}
+	}
+
+	diag.Items = len(scheduleItems)
+	return scheduleItems, diag
+}
+
+// parseKISClass extracts one class from a schedule table row, returning the
+// reason when the row cannot be parsed
+func parseKISClass(date, classTime, classContent string) (scheduleModels.ScheduleItem, string) {
+	// Find class type and subject name
+	subjectMatch := kisSubjectRegex.FindStringSubmatch(classContent)
+	if len(subjectMatch) < 3 {
+		return scheduleModels.ScheduleItem{}, "class type and subject not found"
+	}
+
+	classType := subjectMatch[1]
+	subjectName := strings.TrimSpace(subjectMatch[2])
+
+	// Get full class type name
+	classTypeFull, ok := ClassTypeNames[classType]
+	if !ok {
+		classTypeFull = classType + "."
+	}
+
+	// Find all groups (e.g., ИС1-227-ОТ)
+	groups := []string{}
+	for _, match := range kisGroupRegex.FindAllStringSubmatch(classContent, -1) {
+		if len(match) >= 2 {
+			groups = append(groups, match[1])
+		}
+	}
+
+	// Skip if no groups found
+	if len(groups) == 0 {
+		return scheduleModels.ScheduleItem{}, "no groups found"
+	}
+
+	// Find subgroup (e.g., 1 п.г. or 2 п.г.)
+	subgroupMatch := kisSubgroupRegex.FindStringSubmatch(classContent)
+
+	subgroup := SubgroupWhole
+	if len(subgroupMatch) >= 2 {
+		subgroup = fmt.Sprintf("%s п.г.", subgroupMatch[1])
+	}
+
+	// For lectures, usually no subgroup is specified
+	if classType == "лек" && len(subgroupMatch) == 0 {
+		subgroup = SubgroupStream
+	}
+
+	// Find auditorium information
+	auditorium := ""
+	if auditoriumMatch := kisAuditRegex.FindStringSubmatch(classContent); len(auditoriumMatch) >= 3 {
+		auditorium = auditoriumMatch[2] // Use the text content of the link
+	}
+
+	return scheduleModels.ScheduleItem{
+		Date:       date,
+		Time:       classTime,
+		ClassType:  classTypeFull,
+		Subject:    subjectName,
+		Group:      strings.Join(groups, ", "),
+		Groups:     groups,
+		Subgroup:   subgroup,
+		Auditorium: auditorium,
+	}, ""
+}
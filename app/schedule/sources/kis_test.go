@@ -0,0 +1,102 @@
+package sources
+
+import (
+    scheduleModels "TeacherJournal/app/schedule/models"
+    "encoding/json"
+    "flag"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestParseKISHTMLGolden parses every saved page in testdata/kis and compares
+// the items with the .json file next to it. Run with -update after checking
+// a new page by hand.
+func TestParseKISHTMLGolden(t *testing.T) {
+    pages, err := filepath.Glob(filepath.Join("testdata", "kis", "*.html"))
+    if err != nil {
+        t.Fatalf("glob error: %v", err)
+    }
+    if len(pages) == 0 {
+        t.Fatalf("no fixtures found")
+    }
+
+    for _, page := range pages {
+        t.Run(filepath.Base(page), func(t *testing.T) {
+            content, err := os.ReadFile(page)
+            if err != nil {
+                t.Fatalf("read error: %v", err)
+            }
+            items, _ := ParseKISHTML(string(content))
+
+            golden := strings.TrimSuffix(page, ".html") + ".json"
+            if *updateGolden {
+                out, _ := json.MarshalIndent(items, "", "  ")
+                if err := os.WriteFile(golden, append(out, '\n'), 0644); err != nil {
+                    t.Fatalf("write error: %v", err)
+                }
+            }
+
+            data, err := os.ReadFile(golden)
+            if err != nil {
+                t.Fatalf("read golden: %v", err)
+            }
+            var want []scheduleModels.ScheduleItem
+            if err := json.Unmarshal(data, &want); err != nil {
+                t.Fatalf("unmarshal golden: %v", err)
+            }
+            if !reflect.DeepEqual(items, want) {
+                got, _ := json.MarshalIndent(items, "", "  ")
+                t.Fatalf("items differ from %s:\n%s", golden, got)
+            }
+        })
+    }
+}
+
+func TestParseKISHTMLDiagnostics(t *testing.T) {
+    content, err := os.ReadFile(filepath.Join("testdata", "kis", "regular_week.html"))
+    if err != nil {
+        t.Fatalf("read error: %v", err)
+    }
+    _, diag := ParseKISHTML(string(content))
+    if !diag.OK() || diag.DayBlocks != 4 || diag.ParsedDays != 4 || diag.EmptyDays != 1 || diag.Items != 5 {
+        t.Fatalf("unexpected diagnostics: %+v", diag)
+    }
+
+    content, err = os.ReadFile(filepath.Join("testdata", "kis", "changed_markup.html"))
+    if err != nil {
+        t.Fatalf("read error: %v", err)
+    }
+    _, diag = ParseKISHTML(string(content))
+    if diag.DayBlocks != 2 || diag.ParsedDays != 1 || diag.Items != 1 {
+        t.Fatalf("unexpected diagnostics: %+v", diag)
+    }
+
+    reasons := []string{}
+    for _, u := range diag.Unmatched {
+        reasons = append(reasons, u.Reason)
+    }
+    want := []string{
+        "day block markup not recognized",
+        "1 of 4 table rows not recognized",
+        "class type and subject not found",
+        "no groups found",
+    }
+    if !reflect.DeepEqual(reasons, want) {
+        t.Fatalf("unexpected reasons: %q", reasons)
+    }
+}
+
+func TestParseKISHTMLEmptyPage(t *testing.T) {
+    items, diag := ParseKISHTML("<html><body>Сервис недоступен</body></html>")
+    if len(items) != 0 || diag.OK() {
+        t.Fatalf("expected a diagnostic for a page without day blocks: %+v", diag)
+    }
+    if _, diag := ParseKISHTML(""); !diag.OK() {
+        t.Fatalf("empty response should not produce diagnostics")
+    }
+}
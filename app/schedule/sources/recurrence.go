@@ -0,0 +1,215 @@
+package sources
+
+import (
+	"TeacherJournal/config"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrencePeriods bounds the expansion of rules without an end
+const maxRecurrencePeriods = 10000
+
+// icsWeekdays maps RRULE day names to weekdays
+var icsWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// rrule is the part of an RFC 5545 recurrence rule used by timetables:
+// a daily, weekly, monthly or yearly frequency with INTERVAL, COUNT, UNTIL,
+// plain BYDAY weekdays and WKST
+type rrule struct {
+	Freq      string
+	Interval  int
+	Count     int       // 0 - unlimited
+	Until     time.Time // Zero - unlimited
+	ByDay     []time.Weekday
+	WeekStart time.Weekday
+}
+
+// parseRRule reads an RRULE value; times in UNTIL without a zone are in loc
+func parseRRule(value string, loc *time.Location) (rrule, error) {
+	rule := rrule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		val = strings.ToUpper(strings.TrimSpace(val))
+		switch strings.ToUpper(strings.TrimSpace(name)) {
+		case "FREQ":
+			rule.Freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid COUNT %q", val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(val, loc)
+			if err != nil {
+				return rule, fmt.Errorf("invalid UNTIL %q", val)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				weekday, ok := icsWeekdays[day]
+				if !ok {
+					return rule, fmt.Errorf("unsupported BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "WKST":
+			weekday, ok := icsWeekdays[val]
+			if !ok {
+				return rule, fmt.Errorf("invalid WKST %q", val)
+			}
+			rule.WeekStart = weekday
+		default:
+			return rule, fmt.Errorf("unsupported recurrence rule part %s", name)
+		}
+	}
+
+	switch rule.Freq {
+	case "DAILY", "WEEKLY":
+	case "MONTHLY", "YEARLY":
+		if len(rule.ByDay) > 0 {
+			return rule, fmt.Errorf("unsupported BYDAY in %s rule", rule.Freq)
+		}
+	default:
+		return rule, fmt.Errorf("unsupported recurrence frequency %q", rule.Freq)
+	}
+	return rule, nil
+}
+
+// parseUntil reads the UNTIL date; a date without time includes the whole day
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	switch {
+	case len(value) == 8:
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t.AddDate(0, 0, 1).Add(-time.Second), err
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	default:
+		return time.ParseInLocation("20060102T150405", value, loc)
+	}
+}
+
+// expand returns the occurrences of an event starting at start, up to but not including end.
+// The wall clock time of start is kept across daylight saving changes.
+func (r rrule) expand(start, end time.Time) []time.Time {
+	var occurrences []time.Time
+	emitted := 0
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		for _, candidate := range r.candidates(start, period) {
+			if candidate.Before(start) {
+				continue
+			}
+			if (!r.Until.IsZero() && candidate.After(r.Until)) || (r.Count > 0 && emitted >= r.Count) || !candidate.Before(end) {
+				return occurrences
+			}
+			emitted++
+			occurrences = append(occurrences, candidate)
+		}
+	}
+	return occurrences
+}
+
+// candidates returns the possible occurrences in the period-th interval of the rule
+func (r rrule) candidates(start time.Time, period int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+	step := period * r.Interval
+
+	switch r.Freq {
+	case "DAILY":
+		day := at(start.Year(), start.Month(), start.Day()+step)
+		if len(r.ByDay) > 0 && !containsWeekday(r.ByDay, day.Weekday()) {
+			return nil
+		}
+		return []time.Time{day}
+	case "WEEKLY":
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		weekStart := start.Day() - (int(start.Weekday())-int(r.WeekStart)+7)%7 + 7*step
+		var result []time.Time
+		for offset := 0; offset < 7; offset++ {
+			if containsWeekday(days, time.Weekday((int(r.WeekStart)+offset)%7)) {
+				result = append(result, at(start.Year(), start.Month(), weekStart+offset))
+			}
+		}
+		return result
+	case "MONTHLY":
+		// Months without the day of the start are skipped, as RFC 5545 requires
+		day := at(start.Year(), start.Month()+time.Month(step), start.Day())
+		if day.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{day}
+	case "YEARLY":
+		day := at(start.Year()+step, start.Month(), start.Day())
+		if day.Day() != start.Day() {
+			return nil
+		}
+		return []time.Time{day}
+	}
+	return nil
+}
+
+// containsWeekday reports whether days contains day
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// icsExDates is the set of occurrences removed by EXDATE properties
+type icsExDates struct {
+	times map[int64]bool
+	dates map[string]bool // Dates of VALUE=DATE exclusions in the schedule time zone
+}
+
+// exDates collects the values of EXDATE properties, each of which may list several
+func exDates(props []icsProperty) icsExDates {
+	excluded := icsExDates{times: map[int64]bool{}, dates: map[string]bool{}}
+	for _, prop := range props {
+		for _, value := range strings.Split(prop.Value, ",") {
+			single := prop
+			single.Value = strings.TrimSpace(value)
+			t, allDay, err := parseICSTime(single)
+			if err != nil {
+				continue
+			}
+			if allDay {
+				excluded.dates[t.Format("2006-01-02")] = true
+			} else {
+				excluded.times[t.Unix()] = true
+			}
+		}
+	}
+	return excluded
+}
+
+// has reports whether an occurrence is excluded
+func (e icsExDates) has(occurrence time.Time) bool {
+	return e.times[occurrence.Unix()] || e.dates[occurrence.In(config.ScheduleLocation).Format("2006-01-02")]
+}
@@ -0,0 +1,163 @@
+// Package sources provides the schedule sources a teacher can import lessons from.
+package sources
+
+import (
+	scheduleModels "TeacherJournal/app/schedule/models"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source type identifiers stored in the teacher's settings
+const (
+	TypeKIS  = "kis"  // kis.vgltu.ru timetable scraper
+	TypeICS  = "ics"  // iCalendar file or subscription URL
+	TypeFile = "file" // uploaded CSV or XLSX table
+)
+
+// Subgroup values used for whole-group and stream classes
+const (
+	SubgroupWhole  = "Вся группа"
+	SubgroupStream = "Поток"
+)
+
+// FetchResult is what a source returns for one date range
+type FetchResult struct {
+	Items        []scheduleModels.ScheduleItem
+	ResponseSize int
+	DebugInfo    string
+	// Warnings lists parts of the source data that could not be interpreted
+	Warnings []string
+}
+
+// ScheduleSource fetches a teacher's schedule for a date range.
+// Returned items have no ID and InSystem set; the caller fills them in.
+type ScheduleSource interface {
+	// Name returns the source type identifier
+	Name() string
+	// Fetch returns the items between from and to, both inclusive
+	Fetch(ctx context.Context, teacher string, from, to time.Time) (FetchResult, error)
+}
+
+// Paged is implemented by sources that serve a limited number of days per request.
+// Callers split long ranges into periods of PeriodDays to report progress.
+type Paged interface {
+	PeriodDays() int
+}
+
+// PeriodDays returns the period length for a source, or 0 if the whole range
+// can be fetched at once
+func PeriodDays(src ScheduleSource) int {
+	if p, ok := src.(Paged); ok {
+		return p.PeriodDays()
+	}
+	return 0
+}
+
+// ClassTypeNames maps class type abbreviations to full names
+var ClassTypeNames = map[string]string{
+	"пр":  "Практика",
+	"лек": "Лекция",
+	"лаб": "Лабораторная работа",
+}
+
+// NormalizeClassType converts an abbreviation or free-form class type to the full name
+func NormalizeClassType(value string) string {
+	v := strings.ToLower(strings.TrimSpace(value))
+	v = strings.TrimSuffix(v, ".")
+	if full, ok := ClassTypeNames[v]; ok {
+		return full
+	}
+	switch {
+	case strings.HasPrefix(v, "лек"):
+		return ClassTypeNames["лек"]
+	case strings.HasPrefix(v, "лаб"):
+		return ClassTypeNames["лаб"]
+	case strings.HasPrefix(v, "пр") || strings.HasPrefix(v, "сем"):
+		return ClassTypeNames["пр"]
+	}
+	if value == "" {
+		return ClassTypeNames["лек"]
+	}
+	return strings.TrimSpace(value)
+}
+
+// SplitGroups splits a group list separated by commas or semicolons
+func SplitGroups(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+	groups := []string{}
+	for _, f := range fields {
+		if g := strings.TrimSpace(f); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// ParseDate accepts YYYY-MM-DD and DD.MM.YYYY dates
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "02.01.2006", "2.1.2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// inRange reports whether date (YYYY-MM-DD) lies between from and to
+func inRange(date string, from, to time.Time) bool {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+	return !d.Before(dateOnly(from)) && !d.After(dateOnly(to))
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// filterRange keeps items within the range and sorts them by date and time
+func filterRange(items []scheduleModels.ScheduleItem, from, to time.Time) []scheduleModels.ScheduleItem {
+	result := []scheduleModels.ScheduleItem{}
+	for _, item := range items {
+		if inRange(item.Date, from, to) {
+			result = append(result, item)
+		}
+	}
+	SortItems(result)
+	return result
+}
+
+// SortItems sorts schedule items by date and time
+func SortItems(items []scheduleModels.ScheduleItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Date == items[j].Date {
+			return items[i].Time < items[j].Time
+		}
+		return items[i].Date < items[j].Date
+	})
+}
+
+// Static is a source backed by a fixed list of items, used for uploaded data and tests
+type Static struct {
+	SourceName string
+	Items      []scheduleModels.ScheduleItem
+}
+
+// Name returns the source type identifier
+func (s *Static) Name() string {
+	return s.SourceName
+}
+
+// Fetch returns the stored items within the range
+func (s *Static) Fetch(ctx context.Context, teacher string, from, to time.Time) (FetchResult, error) {
+	items := filterRange(s.Items, from, to)
+	return FetchResult{
+		Items:     items,
+		DebugInfo: fmt.Sprintf("%s: %d items between %s and %s\n", s.SourceName, len(items), from.Format("2006-01-02"), to.Format("2006-01-02")),
+	}, nil
+}
@@ -0,0 +1,191 @@
+package sources
+
+import (
+    scheduleModels "TeacherJournal/app/schedule/models"
+    "context"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestStaticFetchFiltersRange(t *testing.T) {
+    var src ScheduleSource = &Static{SourceName: "fake", Items: []scheduleModels.ScheduleItem{
+        {Date: "2024-09-10", Time: "10:10-11:40", Subject: "B"},
+        {Date: "2024-09-01", Time: "08:30-10:00", Subject: "out"},
+        {Date: "2024-09-10", Time: "08:30-10:00", Subject: "A"},
+        {Date: "2024-09-15", Time: "08:30-10:00", Subject: "C"},
+    }}
+    from := time.Date(2024, 9, 2, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 9, 15, 0, 0, 0, 0, time.UTC)
+    res, err := src.Fetch(context.Background(), "", from, to)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(res.Items) != 3 || res.Items[0].Subject != "A" || res.Items[2].Subject != "C" {
+        t.Fatalf("unexpected items: %+v", res.Items)
+    }
+}
+
+func TestParseCSV(t *testing.T) {
+    data := "\xef\xbb\xbfДата;Время;Тип;Дисциплина;Группы;Аудитория\n" +
+        "02.09.2024;08:30-10:00;лек;Базы данных;ИС1-227-ОТ, ИС2-227-ОТ;101\n" +
+        "\n" +
+        "2024-09-03;10:10-11:40;лаб;Базы данных;ИС1-227-ОТ;202\n"
+    items, err := ParseCSV([]byte(data))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(items) != 2 {
+        t.Fatalf("expected 2 items got %d", len(items))
+    }
+    first := items[0]
+    if first.Date != "2024-09-02" || first.ClassType != "Лекция" || first.Subgroup != SubgroupStream || len(first.Groups) != 2 {
+        t.Fatalf("unexpected first item: %+v", first)
+    }
+    if items[1].ClassType != "Лабораторная работа" || items[1].Subgroup != SubgroupWhole || items[1].Auditorium != "202" {
+        t.Fatalf("unexpected second item: %+v", items[1])
+    }
+}
+
+func TestParseCSVMissingColumn(t *testing.T) {
+    if _, err := ParseCSV([]byte("date,time\n2024-09-02,08:30-10:00\n")); err == nil {
+        t.Fatalf("expected error for missing columns")
+    }
+}
+
+func TestParseICS(t *testing.T) {
+    data := "BEGIN:VCALENDAR\r\n" +
+        "VERSION:2.0\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART:20240902T053000Z\r\n" +
+        "DTEND:20240902T070000Z\r\n" +
+        "SUMMARY:пр. Программирование ИС1-227-ОТ 1 п.г.\r\n" +
+        "LOCATION:ауд. 3\\, корпус 1\r\n" +
+        "END:VEVENT\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART;TZID=Europe/Moscow:20240903T101000\r\n" +
+        "DTEND;TZID=Europe/Moscow:20240903T114000\r\n" +
+        "SUMMARY:Экономика\r\n" +
+        "CATEGORIES:Лекция\r\n" +
+        "DESCRIPTION:Группы: ЭК1-221-ОБ\\, ЭК2-221-ОБ\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"
+    from := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC)
+    items, _, err := ParseICS([]byte(data), ICSOptions{}, from, to)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(items) != 2 {
+        t.Fatalf("expected 2 items got %d", len(items))
+    }
+    first := items[0]
+    if first.Time != "08:30-10:00" || first.ClassType != "Практика" || first.Subject != "Программирование" ||
+        first.Subgroup != "1 п.г." || first.Auditorium != "ауд. 3, корпус 1" {
+        t.Fatalf("unexpected first item: %+v", first)
+    }
+    second := items[1]
+    if second.Time != "10:10-11:40" || second.Subgroup != SubgroupStream || strings.Join(second.Groups, ",") != "ЭК1-221-ОБ,ЭК2-221-ОБ" {
+        t.Fatalf("unexpected second item: %+v", second)
+    }
+}
+
+func TestParseICSRecurrence(t *testing.T) {
+    data := "BEGIN:VCALENDAR\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "UID:db\r\n" +
+        "DTSTART;TZID=Europe/Moscow:20240902T083000\r\n" +
+        "DTEND;TZID=Europe/Moscow:20240902T100000\r\n" +
+        "RRULE:FREQ=WEEKLY;BYDAY=MO,TH;COUNT=6\r\n" +
+        "EXDATE;TZID=Europe/Moscow:20240905T083000\r\n" +
+        "SUMMARY:лаб. Базы данных ИС1-227-ОТ\r\n" +
+        "END:VEVENT\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "UID:db\r\n" +
+        "RECURRENCE-ID;TZID=Europe/Moscow:20240909T083000\r\n" +
+        "DTSTART;TZID=Europe/Moscow:20240910T101000\r\n" +
+        "DTEND;TZID=Europe/Moscow:20240910T114000\r\n" +
+        "SUMMARY:лаб. Базы данных ИС1-227-ОТ\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"
+    from := time.Date(2024, 9, 3, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC)
+    items, warnings, err := ParseICS([]byte(data), ICSOptions{}, from, to)
+    if err != nil || len(warnings) != 0 {
+        t.Fatalf("unexpected result: %v %v", err, warnings)
+    }
+    var dates []string
+    for _, item := range items {
+        dates = append(dates, item.Date+" "+item.Time)
+    }
+    // 2 Sep is before the range, 5 Sep is excluded, 9 Sep moved to 10 Sep, COUNT ends after 19 Sep
+    want := "2024-09-10 10:10-11:40,2024-09-12 08:30-10:00,2024-09-16 08:30-10:00,2024-09-19 08:30-10:00"
+    if strings.Join(dates, ",") != want {
+        t.Fatalf("unexpected occurrences %v", dates)
+    }
+}
+
+func TestParseICSUntilAndUnsupported(t *testing.T) {
+    data := "BEGIN:VCALENDAR\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART:20240902T053000Z\r\n" +
+        "RRULE:FREQ=DAILY;INTERVAL=2;UNTIL=20240906\r\n" +
+        "SUMMARY:пр. Физика ИС1-227-ОТ\r\n" +
+        "END:VEVENT\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART:20240902T053000Z\r\n" +
+        "RRULE:FREQ=MONTHLY;BYSETPOS=1\r\n" +
+        "SUMMARY:Собрание ИС1-227-ОТ\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"
+    from := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)
+    items, warnings, err := ParseICS([]byte(data), ICSOptions{}, from, to)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(items) != 4 || items[3].Date != "2024-09-06" || len(warnings) != 1 {
+        t.Fatalf("unexpected result: %+v %v", items, warnings)
+    }
+}
+
+func TestParseICSGroupOptions(t *testing.T) {
+    data := "BEGIN:VCALENDAR\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART:20240902T053000Z\r\n" +
+        "SUMMARY:Математика (гр. 101)\r\n" +
+        "END:VEVENT\r\n" +
+        "BEGIN:VEVENT\r\n" +
+        "DTSTART:20240903T053000Z\r\n" +
+        "SUMMARY:Консультация\r\n" +
+        "END:VEVENT\r\n" +
+        "END:VCALENDAR\r\n"
+    from := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC)
+
+    items, warnings, _ := ParseICS([]byte(data), ICSOptions{}, from, to)
+    if len(items) != 0 || len(warnings) != 1 {
+        t.Fatalf("events without VGLTU groups should be skipped with a warning: %+v %v", items, warnings)
+    }
+
+    options, err := NewICSOptions(`гр\. \d+`, "Общая")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    items, _, _ = ParseICS([]byte(data), options, from, to)
+    if len(items) != 2 || items[0].Group != "гр. 101" || items[0].Subject != "Математика" || items[1].Group != "Общая" {
+        t.Fatalf("unexpected items: %+v", items)
+    }
+    if _, err := NewICSOptions("(", ""); err == nil {
+        t.Fatalf("expected error for invalid pattern")
+    }
+}
+
+func TestDetectFormat(t *testing.T) {
+    if f, err := DetectFormat("raspisanie.XLSX"); err != nil || f != FormatXLSX {
+        t.Fatalf("unexpected result: %q %v", f, err)
+    }
+    if _, err := DetectFormat("schedule.pdf"); err == nil {
+        t.Fatalf("expected error for unsupported file")
+    }
+}
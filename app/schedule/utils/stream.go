@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// StreamTokenTTL is how long a job event stream token can be used to connect
+const StreamTokenTTL = 5 * time.Minute
+
+// streamTokenPurpose tells stream tokens apart from session tokens
+const streamTokenPurpose = "job_events"
+
+// StreamClaims contains the claims of a token that opens the event stream of one job.
+// EventSource cannot send headers, so the token travels in the query string and
+// must not be usable for anything else.
+type StreamClaims struct {
+	UserID   int    `json:"user_id"`
+	UserRole string `json:"user_role"`
+	JobID    string `json:"job_id"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// streamKey derives the stream token key from the session secret, so session
+// tokens are never accepted as stream tokens and the other way round
+func streamKey() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(streamTokenPurpose))
+	return mac.Sum(nil)
+}
+
+// GenerateStreamToken generates a short-lived token for the event stream of a job
+func GenerateStreamToken(userID int, userRole, jobID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(StreamTokenTTL)
+	claims := StreamClaims{
+		UserID:   userID,
+		UserRole: userRole,
+		JobID:    jobID,
+		Purpose:  streamTokenPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(streamKey())
+	return tokenString, expiresAt, err
+}
+
+// ParseStreamToken validates a stream token for the event stream of the given job
+func ParseStreamToken(tokenString, jobID string) (*StreamClaims, error) {
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&StreamClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return streamKey(), nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*StreamClaims)
+	if !ok || !token.Valid || claims.Purpose != streamTokenPurpose || claims.UserID <= 0 || claims.JobID != jobID {
+		return nil, errors.New("invalid stream token")
+	}
+	return claims, nil
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+    "testing"
+)
+
+func TestStreamToken(t *testing.T) {
+    token, _, err := GenerateStreamToken(7, "teacher", "job-1")
+    if err != nil {
+        t.Fatalf("GenerateStreamToken error: %v", err)
+    }
+
+    claims, err := ParseStreamToken(token, "job-1")
+    if err != nil {
+        t.Fatalf("ParseStreamToken error: %v", err)
+    }
+    if claims.UserID != 7 || claims.UserRole != "teacher" {
+        t.Fatalf("unexpected claims: %+v", claims)
+    }
+
+    if _, err := ParseStreamToken(token, "job-2"); err == nil {
+        t.Fatalf("stream token must only open the stream of its job")
+    }
+}
+
+func TestStreamAndSessionTokensAreNotInterchangeable(t *testing.T) {
+    streamToken, _, err := GenerateStreamToken(7, "teacher", "job-1")
+    if err != nil {
+        t.Fatalf("GenerateStreamToken error: %v", err)
+    }
+    if _, err := ParseJWT(streamToken); err == nil {
+        t.Fatalf("stream token must not be accepted as a session token")
+    }
+
+    sessionToken, err := GenerateJWT(7, "teacher", "teach@example.com")
+    if err != nil {
+        t.Fatalf("GenerateJWT error: %v", err)
+    }
+    if _, err := ParseStreamToken(sessionToken, "job-1"); err == nil {
+        t.Fatalf("session token must not be accepted as a stream token")
+    }
+}
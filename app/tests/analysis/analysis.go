@@ -0,0 +1,218 @@
+// Package analysis computes classical test theory metrics for test items.
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Item flags
+const (
+	FlagTooHard                = "too_hard"                // Almost nobody answers correctly
+	FlagTooEasy                = "too_easy"                // Almost everybody answers correctly
+	FlagLowDiscrimination      = "low_discrimination"      // Barely separates strong and weak students
+	FlagNegativeDiscrimination = "negative_discrimination" // Weak students do better than strong ones
+)
+
+// Thresholds commonly used in classical test theory
+const (
+	hardDifficulty      = 0.2
+	easyDifficulty      = 0.9
+	lowDiscrimination   = 0.2
+	minDistractorRate   = 0.05
+	minAttemptsForFlags = 5
+	minItemsForAlpha    = 2
+	minAttemptsForAlpha = 2
+)
+
+// Attempt holds the points an attempt earned per question. Questions drawn
+// for the attempt but left unanswered must be present with zero points.
+type Attempt map[int]float64
+
+// ItemStats are the metrics of one question
+type ItemStats struct {
+	QuestionID     int      `json:"question_id"`
+	Attempts       int      `json:"attempts"`       // Attempts the question was part of
+	Difficulty     float64  `json:"difficulty"`     // Mean share of the points earned: 0 - nobody, 1 - everybody
+	Discrimination *float64 `json:"discrimination"` // Point-biserial correlation with the rest of the test; nil when undefined
+	Flags          []string `json:"flags"`
+}
+
+// Reliability is the internal consistency of the test
+type Reliability struct {
+	CronbachAlpha *float64 `json:"cronbach_alpha"` // Nil when it cannot be computed
+	Items         int      `json:"items"`          // Questions shared by all attempts used for alpha
+	Attempts      int      `json:"attempts"`
+}
+
+// Items computes the difficulty and discrimination of every question.
+// maxPoints holds the weight of each question.
+func Items(attempts []Attempt, maxPoints map[int]float64) []ItemStats {
+	questionIDs := make(map[int]bool)
+	for _, attempt := range attempts {
+		for questionID := range attempt {
+			questionIDs[questionID] = true
+		}
+	}
+
+	totals := make([]float64, len(attempts))
+	for i, attempt := range attempts {
+		for _, points := range attempt {
+			totals[i] += points
+		}
+	}
+
+	stats := make([]ItemStats, 0, len(questionIDs))
+	for questionID := range questionIDs {
+		weight := maxPoints[questionID]
+		if weight <= 0 {
+			weight = 1
+		}
+
+		// Item score against the rest of the test, so the item does not correlate with itself
+		var item, rest []float64
+		shareSum := 0.0
+		for i, attempt := range attempts {
+			points, ok := attempt[questionID]
+			if !ok {
+				continue
+			}
+			item = append(item, points)
+			rest = append(rest, totals[i]-points)
+			shareSum += points / weight
+		}
+
+		s := ItemStats{QuestionID: questionID, Attempts: len(item)}
+		if len(item) > 0 {
+			s.Difficulty = round(shareSum / float64(len(item)))
+		}
+		if r, ok := Pearson(item, rest); ok {
+			r = round(r)
+			s.Discrimination = &r
+		}
+		s.Flags = flags(s)
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].QuestionID < stats[j].QuestionID })
+	return stats
+}
+
+// flags marks questions worth a second look
+func flags(s ItemStats) []string {
+	result := []string{}
+	if s.Attempts < minAttemptsForFlags {
+		return result
+	}
+	if s.Difficulty < hardDifficulty {
+		result = append(result, FlagTooHard)
+	}
+	if s.Difficulty > easyDifficulty {
+		result = append(result, FlagTooEasy)
+	}
+	if s.Discrimination != nil {
+		if *s.Discrimination < 0 {
+			result = append(result, FlagNegativeDiscrimination)
+		} else if *s.Discrimination < lowDiscrimination {
+			result = append(result, FlagLowDiscrimination)
+		}
+	}
+	return result
+}
+
+// CronbachAlpha computes the reliability over the questions present in every attempt;
+// with questions drawn at random from banks only the shared ones count
+func CronbachAlpha(attempts []Attempt) Reliability {
+	result := Reliability{Attempts: len(attempts)}
+	if len(attempts) < minAttemptsForAlpha {
+		return result
+	}
+
+	var common []int
+	for questionID := range attempts[0] {
+		shared := true
+		for _, attempt := range attempts[1:] {
+			if _, ok := attempt[questionID]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			common = append(common, questionID)
+		}
+	}
+	result.Items = len(common)
+	if len(common) < minItemsForAlpha {
+		return result
+	}
+
+	totals := make([]float64, len(attempts))
+	itemVariance := 0.0
+	for _, questionID := range common {
+		scores := make([]float64, len(attempts))
+		for i, attempt := range attempts {
+			scores[i] = attempt[questionID]
+			totals[i] += scores[i]
+		}
+		itemVariance += variance(scores)
+	}
+
+	totalVariance := variance(totals)
+	if totalVariance == 0 {
+		return result
+	}
+
+	k := float64(len(common))
+	alpha := round(k / (k - 1) * (1 - itemVariance/totalVariance))
+	result.CronbachAlpha = &alpha
+	return result
+}
+
+// WeakDistractor reports whether a wrong option is chosen so rarely it does not work as a distractor
+func WeakDistractor(rate float64, isCorrect bool, responses int) bool {
+	return !isCorrect && responses >= minAttemptsForFlags && rate < minDistractorRate
+}
+
+// Pearson returns the correlation of two samples; false when it is undefined
+// because a sample is too short or constant
+func Pearson(x, y []float64) (float64, bool) {
+	if len(x) != len(y) || len(x) < 2 {
+		return 0, false
+	}
+
+	meanX, meanY := mean(x), mean(y)
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance is the population variance, as used by Cronbach's alpha
+func variance(values []float64) float64 {
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values))
+}
+
+// round keeps three decimals for the report
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
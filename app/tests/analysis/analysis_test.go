@@ -0,0 +1,91 @@
+package analysis
+
+import (
+    "math"
+    "testing"
+)
+
+// Six students, five questions of one point; question 4 is answered only by the weakest ones
+func sampleAttempts() []Attempt {
+    return []Attempt{
+        {1: 1, 2: 1, 3: 1, 4: 0, 5: 1},
+        {1: 1, 2: 1, 3: 1, 4: 0, 5: 1},
+        {1: 1, 2: 1, 3: 0, 4: 0, 5: 1},
+        {1: 1, 2: 0, 3: 1, 4: 0, 5: 0},
+        {1: 1, 2: 0, 3: 0, 4: 1, 5: 0},
+        {1: 1, 2: 0, 3: 0, 4: 1, 5: 0},
+    }
+}
+
+func TestItems(t *testing.T) {
+    stats := Items(sampleAttempts(), map[int]float64{1: 1, 2: 1, 3: 1, 4: 1, 5: 1})
+    if len(stats) != 5 {
+        t.Fatalf("expected 5 items got %d", len(stats))
+    }
+
+    easy := stats[0]
+    if easy.Difficulty != 1 || easy.Discrimination != nil || !hasFlag(easy, FlagTooEasy) {
+        t.Fatalf("everybody answering makes an easy item without discrimination: %+v", easy)
+    }
+
+    good := stats[1]
+    if good.Difficulty != 0.5 || good.Discrimination == nil || *good.Discrimination <= lowDiscrimination || len(good.Flags) != 0 {
+        t.Fatalf("expected a discriminating item: %+v", good)
+    }
+
+    bad := stats[3]
+    if bad.Discrimination == nil || *bad.Discrimination >= 0 || !hasFlag(bad, FlagNegativeDiscrimination) {
+        t.Fatalf("expected negative discrimination: %+v", bad)
+    }
+}
+
+func TestItemsPartialCredit(t *testing.T) {
+    attempts := []Attempt{{1: 2}, {1: 1}, {1: 0}}
+    stats := Items(attempts, map[int]float64{1: 2})
+    if stats[0].Difficulty != 0.5 {
+        t.Fatalf("expected the mean share of two points to be 0.5 got %v", stats[0].Difficulty)
+    }
+}
+
+func TestCronbachAlpha(t *testing.T) {
+    // Perfectly consistent items give alpha = 1
+    consistent := []Attempt{
+        {1: 1, 2: 1, 3: 1},
+        {1: 0, 2: 0, 3: 0},
+        {1: 1, 2: 1, 3: 1},
+        {1: 0, 2: 0, 3: 0},
+    }
+    got := CronbachAlpha(consistent)
+    if got.CronbachAlpha == nil || math.Abs(*got.CronbachAlpha-1) > 1e-9 || got.Items != 3 {
+        t.Fatalf("expected alpha 1 over 3 items got %+v", got)
+    }
+
+    // Only questions shared by all attempts count
+    drawn := []Attempt{
+        {1: 1, 2: 1, 5: 1},
+        {1: 0, 2: 1, 6: 0},
+        {1: 1, 2: 0, 5: 0},
+    }
+    if got := CronbachAlpha(drawn); got.Items != 2 || got.CronbachAlpha == nil {
+        t.Fatalf("expected alpha over the 2 shared items got %+v", got)
+    }
+
+    if got := CronbachAlpha(sampleAttempts()[:1]); got.CronbachAlpha != nil {
+        t.Fatalf("alpha needs at least two attempts")
+    }
+}
+
+func TestWeakDistractor(t *testing.T) {
+    if !WeakDistractor(0.01, false, 40) || WeakDistractor(0.01, true, 40) || WeakDistractor(0.2, false, 40) || WeakDistractor(0, false, 3) {
+        t.Fatalf("unexpected weak distractor result")
+    }
+}
+
+func hasFlag(s ItemStats, flag string) bool {
+    for _, f := range s.Flags {
+        if f == flag {
+            return true
+        }
+    }
+    return false
+}
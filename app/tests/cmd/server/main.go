@@ -33,15 +33,21 @@ func main() {
 	studentHandler := handlers.NewStudentHandler(database)
 	adminHandler := handlers.NewAdminHandler(database)
 	testHandler := handlers.NewTestHandler(database)
+	bankHandler := handlers.NewBankHandler(database)
+	reviewHandler := handlers.NewReviewHandler(database)
+
+	// Complete attempts whose time ran out or which were abandoned
+	handlers.StartAttemptSweeper(database)
 
 	// Student registration and authentication routes
 	apiRouter.HandleFunc("/students/register", studentHandler.RegisterStudent).Methods("POST")
 	apiRouter.HandleFunc("/students/login", studentHandler.LoginStudent).Methods("POST")
-	apiRouter.HandleFunc("/students/info", studentHandler.GetStudentInfoByID).Methods("GET")
+	apiRouter.HandleFunc("/students/info", middleware.StudentAuthMiddleware(studentHandler.GetStudentInfoByID)).Methods("GET")
 
 	// Admin routes (require JWT auth and admin/teacher role)
 	apiRouter.HandleFunc("/admin/tests", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.CreateTest))).Methods("POST")
 	apiRouter.HandleFunc("/admin/tests", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.GetAllTests))).Methods("GET")
+	apiRouter.HandleFunc("/admin/tests/import", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.ImportTest))).Methods("POST")
 	apiRouter.HandleFunc("/admin/tests/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.GetTestDetails))).Methods("GET")
 	apiRouter.HandleFunc("/admin/tests/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.UpdateTest))).Methods("PUT")
 	apiRouter.HandleFunc("/admin/tests/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.DeleteTest))).Methods("DELETE")
@@ -49,14 +55,35 @@ func main() {
 	apiRouter.HandleFunc("/admin/tests/{test_id}/questions/{question_id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.UpdateQuestion))).Methods("PUT")
 	apiRouter.HandleFunc("/admin/tests/{test_id}/questions/{question_id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.DeleteQuestion))).Methods("DELETE")
 	apiRouter.HandleFunc("/admin/tests/{id}/statistics", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.GetTestStatistics))).Methods("GET")
+	apiRouter.HandleFunc("/admin/tests/{id}/statistics/export", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.ExportTestStatistics))).Methods("GET")
+	apiRouter.HandleFunc("/admin/tests/{id}/rules", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.UpdateTestRules))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/tests/{id}/groups", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.UpdateTestGroups))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/tests/{id}/grade-link", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.SetGradeLink))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/tests/{id}/grade-link", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.DeleteGradeLink))).Methods("DELETE")
+	apiRouter.HandleFunc("/admin/tests/{id}/export", middleware.JWTMiddleware(middleware.TeacherMiddleware(adminHandler.ExportTest))).Methods("GET")
+
+	// Question bank routes
+	apiRouter.HandleFunc("/admin/banks", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.CreateBank))).Methods("POST")
+	apiRouter.HandleFunc("/admin/banks", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.GetBanks))).Methods("GET")
+	apiRouter.HandleFunc("/admin/banks/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.GetBank))).Methods("GET")
+	apiRouter.HandleFunc("/admin/banks/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.UpdateBank))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/banks/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.DeleteBank))).Methods("DELETE")
+	apiRouter.HandleFunc("/admin/banks/{id}/questions", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.AddBankQuestion))).Methods("POST")
+	apiRouter.HandleFunc("/admin/banks/{bank_id}/questions/{question_id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.UpdateBankQuestion))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/banks/{bank_id}/questions/{question_id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(bankHandler.DeleteBankQuestion))).Methods("DELETE")
+
+	// Review queue of free text answers
+	apiRouter.HandleFunc("/admin/reviews", middleware.JWTMiddleware(middleware.TeacherMiddleware(reviewHandler.GetReviewQueue))).Methods("GET")
+	apiRouter.HandleFunc("/admin/reviews/{id}", middleware.JWTMiddleware(middleware.TeacherMiddleware(reviewHandler.GradeResponse))).Methods("PUT")
 
-	// Student test-taking routes
-	apiRouter.HandleFunc("/available", testHandler.GetAvailableTests).Methods("GET")
-	apiRouter.HandleFunc("/start/{id}", testHandler.StartTest).Methods("POST")
-	apiRouter.HandleFunc("/attempt/{attempt_id}/next", testHandler.GetNextQuestion).Methods("GET")
-	apiRouter.HandleFunc("/attempt/{attempt_id}/submit", testHandler.SubmitAnswer).Methods("POST")
-	apiRouter.HandleFunc("/attempt/{attempt_id}/results", testHandler.GetTestResults).Methods("GET")
-	apiRouter.HandleFunc("/history", testHandler.GetStudentTestHistory).Methods("GET")
+	// Student test-taking routes (require a student session token)
+	apiRouter.HandleFunc("/available", middleware.StudentAuthMiddleware(testHandler.GetAvailableTests)).Methods("GET")
+	apiRouter.HandleFunc("/start/{id}", middleware.StudentAuthMiddleware(testHandler.StartTest)).Methods("POST")
+	apiRouter.HandleFunc("/attempt/{attempt_id}/next", middleware.StudentAuthMiddleware(testHandler.GetNextQuestion)).Methods("GET")
+	apiRouter.HandleFunc("/attempt/{attempt_id}/submit", middleware.StudentAuthMiddleware(testHandler.SubmitAnswer)).Methods("POST")
+	apiRouter.HandleFunc("/attempt/{attempt_id}/events", middleware.StudentAuthMiddleware(testHandler.RecordEvents)).Methods("POST")
+	apiRouter.HandleFunc("/attempt/{attempt_id}/results", middleware.StudentAuthMiddleware(testHandler.GetTestResults)).Methods("GET")
+	apiRouter.HandleFunc("/history", middleware.StudentAuthMiddleware(testHandler.GetStudentTestHistory)).Methods("GET")
 
 	// CORS setup to allow requests from any origin
 	c := cors.New(cors.Options{
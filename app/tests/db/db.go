@@ -47,14 +47,25 @@ func InitDB() *gorm.DB {
 		log.Println("Email field added successfully to Student table")
 	}
 
+	// Колонки взвешенных баллов заполняются один раз, когда миграция их добавляет
+	backfillPoints := DB.Migrator().HasTable(&models.StudentResponse{}) &&
+		!DB.Migrator().HasColumn(&models.StudentResponse{}, "max_points")
+	backfillMaxScore := DB.Migrator().HasTable(&models.TestAttempt{}) &&
+		!DB.Migrator().HasColumn(&models.TestAttempt{}, "max_score")
+
 	// Auto-migrate the test models
 	err = DB.AutoMigrate(
 		&models.Test{},
+		&models.QuestionBank{},
+		&models.TestRule{},
 		&models.Question{},
 		&models.Answer{},
 		&models.TestAttempt{},
 		&models.StudentResponse{},
 		&models.TestGroup{}, // Добавляем новую модель для миграции
+		&models.AttemptQuestion{},
+		&models.AttemptEvent{},
+		&models.TestGradeLink{},
 	)
 
 	if err != nil {
@@ -73,6 +84,7 @@ func InitDB() *gorm.DB {
 			CREATE TABLE IF NOT EXISTS test_groups (
 				id SERIAL PRIMARY KEY,
 				test_id INT NOT NULL,
+				group_id INT,
 				group_name VARCHAR(255) NOT NULL,
 				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 				FOREIGN KEY (test_id) REFERENCES tests(id) ON DELETE CASCADE,
@@ -100,6 +112,55 @@ func InitDB() *gorm.DB {
 		log.Println("Таблица test_groups создана и заполнена начальными данными")
 	}
 
+	// Привязываем старые связи test_groups к группам по id
+	if err := DB.Exec(`
+		UPDATE test_groups tg SET group_id = g.id
+		FROM tests t, groups g
+		WHERE tg.group_id IS NULL AND t.id = tg.test_id
+			AND g.teacher_id = t.creator_id AND g.name = tg.group_name
+	`).Error; err != nil {
+		log.Println("Failed to backfill test_groups.group_id:", err)
+	}
+
+	// Ответы и попытки до взвешенных баллов: один балл за верный ответ
+	if backfillPoints {
+		if err := DB.Exec(`
+			UPDATE student_responses SET max_points = 1, points = CASE WHEN is_correct THEN 1 ELSE 0 END
+		`).Error; err != nil {
+			log.Println("Failed to backfill student_responses.points:", err)
+		}
+	}
+	if backfillMaxScore {
+		if err := DB.Exec("UPDATE test_attempts SET max_score = total_questions").Error; err != nil {
+			log.Println("Failed to backfill test_attempts.max_score:", err)
+		}
+	}
+
+	// Один ответ на вопрос попытки. Повторные ответы мешают уникальному индексу:
+	// оставляем первый и вычитаем баллы удаленных ответов из попытки
+	if !DB.Migrator().HasIndex(&models.StudentResponse{}, "idx_student_responses_attempt_question") {
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`
+				WITH removed AS (
+					DELETE FROM student_responses r
+					USING student_responses k
+					WHERE r.attempt_id = k.attempt_id AND r.question_id = k.question_id AND r.id > k.id
+					RETURNING r.attempt_id, r.points
+				)
+				UPDATE test_attempts ta SET score = ta.score - d.points
+				FROM (SELECT attempt_id, SUM(points) AS points FROM removed GROUP BY attempt_id) d
+				WHERE ta.id = d.attempt_id
+			`).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_student_responses_attempt_question
+				ON student_responses (attempt_id, question_id)`).Error
+		})
+		if err != nil {
+			log.Fatal("Failed to create the unique index of student responses:", err)
+		}
+	}
+
 	log.Println("Test database models initialized successfully")
 	return DB
 }
@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	dashboardDB "TeacherJournal/app/dashboard/db"
 	dashboardModels "TeacherJournal/app/dashboard/models"
 	dashboardUtils "TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/app/tests/interchange"
 	"TeacherJournal/app/tests/models"
 	"TeacherJournal/app/tests/utils"
+	"TeacherJournal/config"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -27,6 +34,45 @@ func NewAdminHandler(database *gorm.DB) *AdminHandler {
 	}
 }
 
+// newTestGroup links a test to a group, preferring the group owned by the test creator
+func newTestGroup(tx *gorm.DB, creatorID, testID int, groupName string) models.TestGroup {
+	testGroup := models.TestGroup{
+		TestID:    testID,
+		GroupName: groupName,
+		CreatedAt: time.Now(),
+	}
+
+	group, err := dashboardDB.FindGroup(tx, creatorID, groupName)
+	if err != nil {
+		err = tx.Where("name = ? AND archived_at IS NULL", groupName).Order("id").First(&group).Error
+	}
+	if err == nil {
+		testGroup.GroupID = &group.ID
+	}
+	return testGroup
+}
+
+// linkTestGroups opens a new test to the given groups, or to all active groups when none are given
+func linkTestGroups(tx *gorm.DB, creatorID, testID int, groupNames []string) error {
+	if len(groupNames) == 0 {
+		// Если группы не указаны, добавляем все доступные группы
+		if err := tx.Model(&dashboardModels.Group{}).
+			Where("archived_at IS NULL").
+			Distinct("name").
+			Pluck("name", &groupNames).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, groupName := range groupNames {
+		testGroup := newTestGroup(tx, creatorID, testID, groupName)
+		if err := tx.Create(&testGroup).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Path: app/tests/handlers/admin_handler.go
 
 // Обновленные структуры запросов. Добавьте эти структуры в начало файла admin_handler.go,
@@ -34,27 +80,35 @@ func NewAdminHandler(database *gorm.DB) *AdminHandler {
 
 // CreateTestRequest defines the request body for creating a test
 type CreateTestRequest struct {
-	Title           string                  `json:"title"`
-	Description     string                  `json:"description"`
-	Subject         string                  `json:"subject"`
-	TimePerQuestion int                     `json:"time_per_question"`
-	MaxAttempts     int                     `json:"max_attempts"`
-	Questions       []CreateQuestionRequest `json:"questions"`
-	Groups          []string                `json:"groups"` // Добавлено: список групп
+	Title            string                  `json:"title"`
+	Description      string                  `json:"description"`
+	Subject          string                  `json:"subject"`
+	TimePerQuestion  int                     `json:"time_per_question"`
+	TimeLimit        int                     `json:"time_limit"` // Whole test time in minutes, 0 - no limit
+	MaxAttempts      int                     `json:"max_attempts"`
+	Questions        []CreateQuestionRequest `json:"questions"`
+	Rules            []TestRuleRequest       `json:"rules"` // Random questions drawn from banks
+	ShuffleQuestions bool                    `json:"shuffle_questions"`
+	ShuffleAnswers   bool                    `json:"shuffle_answers"`
+	Groups           []string                `json:"groups"` // Добавлено: список групп
 }
 
 // CreateQuestionRequest defines the request body for creating a question
 type CreateQuestionRequest struct {
 	QuestionText string                `json:"question_text"`
 	QuestionType string                `json:"question_type"`
+	Points       float64               `json:"points"` // Question weight, 1 by default
 	Position     int                   `json:"position"`
 	Answers      []CreateAnswerRequest `json:"answers"`
 }
 
 // CreateAnswerRequest defines the request body for creating an answer
 type CreateAnswerRequest struct {
-	AnswerText string `json:"answer_text"`
-	IsCorrect  bool   `json:"is_correct"`
+	AnswerText string  `json:"answer_text"`
+	IsCorrect  bool    `json:"is_correct"`
+	MatchText  string  `json:"match_text"` // Matching: right side of the pair
+	Tolerance  float64 `json:"tolerance"`  // Numeric: allowed deviation
+	Position   int     `json:"position"`   // Ordering: correct place of the item
 }
 
 // CreateTest creates a new test
@@ -81,8 +135,24 @@ func (h *AdminHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate inputs
-	if req.Title == "" || req.Subject == "" || len(req.Questions) == 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Title, subject, and questions are required")
+	if req.Title == "" || req.Subject == "" || (len(req.Questions) == 0 && len(req.Rules) == 0) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Title, subject, and questions or bank rules are required")
+		return
+	}
+
+	// Check the bank rules before creating anything
+	rules, err := buildRules(h.DB, userID, userRole == "admin", 0, req.Rules)
+	if err != nil {
+		if errors.Is(err, errInvalidRule) {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error checking rules: "+err.Error())
+		}
+		return
+	}
+
+	if req.TimeLimit < 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Time limit cannot be negative")
 		return
 	}
 
@@ -99,15 +169,18 @@ func (h *AdminHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
 		// Create test
 		test := models.Test{
-			Title:           req.Title,
-			Description:     req.Description,
-			Subject:         req.Subject,
-			CreatorID:       userID,
-			TimePerQuestion: req.TimePerQuestion,
-			MaxAttempts:     req.MaxAttempts,
-			IsActive:        true,
-			CreatedAt:       time.Now(),
-			UpdatedAt:       time.Now(),
+			Title:            req.Title,
+			Description:      req.Description,
+			Subject:          req.Subject,
+			CreatorID:        userID,
+			TimePerQuestion:  req.TimePerQuestion,
+			TimeLimit:        req.TimeLimit,
+			ShuffleQuestions: req.ShuffleQuestions,
+			ShuffleAnswers:   req.ShuffleAnswers,
+			MaxAttempts:      req.MaxAttempts,
+			IsActive:         true,
+			CreatedAt:        time.Now(),
+			UpdatedAt:        time.Now(),
 		}
 
 		if err := tx.Create(&test).Error; err != nil {
@@ -116,50 +189,32 @@ func (h *AdminHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 
 		testID = test.ID
 
-		// Создаем связи с группами
-		if len(req.Groups) > 0 {
-			for _, groupName := range req.Groups {
-				testGroup := models.TestGroup{
-					TestID:    test.ID,
-					GroupName: groupName,
-					CreatedAt: time.Now(),
-				}
-
-				if err := tx.Create(&testGroup).Error; err != nil {
-					return err
-				}
-			}
-		} else {
-			// Если группы не указаны, добавляем все доступные группы
-			var groupNames []string
-			if err := tx.Model(&dashboardModels.Student{}).Distinct("group_name").Pluck("group_name", &groupNames).Error; err != nil {
-				return err
-			}
-
-			for _, groupName := range groupNames {
-				testGroup := models.TestGroup{
-					TestID:    test.ID,
-					GroupName: groupName,
-					CreatedAt: time.Now(),
-				}
+		if err := replaceRules(tx, test.ID, rules); err != nil {
+			return err
+		}
 
-				if err := tx.Create(&testGroup).Error; err != nil {
-					return err
-				}
-			}
+		// Создаем связи с группами
+		if err := linkTestGroups(tx, userID, test.ID, req.Groups); err != nil {
+			return err
 		}
 
 		// Create questions and answers
-		for _, q := range req.Questions {
+		for i, q := range req.Questions {
 			questionType := q.QuestionType
 			if questionType == "" {
-				questionType = "multiple_choice" // Default question type
+				questionType = models.QuestionMultipleChoice // Default question type
+			}
+
+			answers := buildAnswers(questionType, q.Answers)
+			if err := validateQuestion(questionType, questionWeight(q.Points), answers); err != nil {
+				return fmt.Errorf("question %d: %w", i+1, err)
 			}
 
 			question := models.Question{
-				TestID:       test.ID,
+				TestID:       &test.ID,
 				QuestionText: q.QuestionText,
 				QuestionType: questionType,
+				Points:       questionWeight(q.Points),
 				Position:     q.Position,
 				CreatedAt:    time.Now(),
 				UpdatedAt:    time.Now(),
@@ -170,24 +225,18 @@ func (h *AdminHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Create answers for the question
-			for _, a := range q.Answers {
-				answer := models.Answer{
-					QuestionID: question.ID,
-					AnswerText: a.AnswerText,
-					IsCorrect:  a.IsCorrect,
-					CreatedAt:  time.Now(),
-					UpdatedAt:  time.Now(),
-				}
-
-				if err := tx.Create(&answer).Error; err != nil {
-					return err
-				}
+			if err := createAnswers(tx, question.ID, answers); err != nil {
+				return err
 			}
 		}
 
 		return nil
 	})
 
+	if errors.Is(err, errInvalidQuestion) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question: "+err.Error())
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating test: "+err.Error())
 		return
@@ -221,13 +270,14 @@ func (h *AdminHandler) GetAllTests(w http.ResponseWriter, r *http.Request) {
 		AttemptsCount   int       `json:"attempts_count"`
 		MaxAttempts     int       `json:"max_attempts"`
 		TimePerQuestion int       `json:"time_per_question"`
+		TimeLimit       int       `json:"time_limit"`
 	}
 
 	// Query for tests with question counts and attempt counts
 	query := `
 		SELECT 
-			t.id, t.title, t.subject, t.is_active, t.created_at, t.max_attempts, t.time_per_question,
-			COUNT(DISTINCT q.id) as questions_count,
+			t.id, t.title, t.subject, t.is_active, t.created_at, t.max_attempts, t.time_per_question, t.time_limit,
+			COUNT(DISTINCT q.id) + COALESCE((SELECT SUM(tr.count) FROM test_rules tr WHERE tr.test_id = t.id), 0) as questions_count,
 			COUNT(DISTINCT ta.id) as attempts_count
 		FROM tests t
 		LEFT JOIN questions q ON t.id = q.test_id
@@ -278,25 +328,32 @@ func (h *AdminHandler) GetTestDetails(w http.ResponseWriter, r *http.Request) {
 
 	// Get questions with answers
 	var questions []struct {
-		ID           int    `json:"id"`
-		QuestionText string `json:"question_text"`
-		QuestionType string `json:"question_type"`
-		Position     int    `json:"position"`
+		ID           int     `json:"id"`
+		QuestionText string  `json:"question_text"`
+		QuestionType string  `json:"question_type"`
+		Points       float64 `json:"points"`
+		Position     int     `json:"position"`
 		Answers      []struct {
-			ID         int    `json:"id"`
-			AnswerText string `json:"answer_text"`
-			IsCorrect  bool   `json:"is_correct"`
+			ID         int     `json:"id"`
+			AnswerText string  `json:"answer_text"`
+			IsCorrect  bool    `json:"is_correct"`
+			MatchText  string  `json:"match_text"`
+			Tolerance  float64 `json:"tolerance"`
+			Position   int     `json:"position"`
 		} `json:"answers"`
 	}
 
 	if err := h.DB.Raw(`
 		SELECT 
-			q.id, q.question_text, q.question_type, q.position,
+			q.id, q.question_text, q.question_type, q.points, q.position,
 			JSON_AGG(
 				JSON_BUILD_OBJECT(
 					'id', a.id,
 					'answer_text', a.answer_text,
-					'is_correct', a.is_correct
+					'is_correct', a.is_correct,
+					'match_text', a.match_text,
+					'tolerance', a.tolerance,
+					'position', a.position
 				) ORDER BY a.id
 			) as answers
 		FROM questions q
@@ -314,9 +371,12 @@ func (h *AdminHandler) GetTestDetails(w http.ResponseWriter, r *http.Request) {
 		// Manually get answers for each question
 		for i, q := range questions {
 			var answers []struct {
-				ID         int    `json:"id"`
-				AnswerText string `json:"answer_text"`
-				IsCorrect  bool   `json:"is_correct"`
+				ID         int     `json:"id"`
+				AnswerText string  `json:"answer_text"`
+				IsCorrect  bool    `json:"is_correct"`
+				MatchText  string  `json:"match_text"`
+				Tolerance  float64 `json:"tolerance"`
+				Position   int     `json:"position"`
 			}
 			if err := h.DB.Model(&models.Answer{}).Where("question_id = ?", q.ID).Find(&answers).Error; err != nil {
 				utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving answers")
@@ -358,6 +418,20 @@ func (h *AdminHandler) GetTestDetails(w http.ResponseWriter, r *http.Request) {
 		groups[i] = group.GroupName
 	}
 
+	// Get the rules drawing questions from banks
+	var rules []models.TestRule
+	if err := h.DB.Where("test_id = ?", testID).Order("position").Find(&rules).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving test rules")
+		return
+	}
+
+	// The lab grade written by the test, if linked
+	var gradeLink *models.TestGradeLink
+	var link models.TestGradeLink
+	if err := h.DB.Where("test_id = ?", testID).First(&link).Error; err == nil {
+		gradeLink = &link
+	}
+
 	response := map[string]interface{}{
 		"id":                test.ID,
 		"title":             test.Title,
@@ -369,9 +443,15 @@ func (h *AdminHandler) GetTestDetails(w http.ResponseWriter, r *http.Request) {
 		"updated_at":        test.UpdatedAt,
 		"max_attempts":      test.MaxAttempts,
 		"time_per_question": test.TimePerQuestion,
+		"time_limit":        test.TimeLimit,
+		"shuffle_questions": test.ShuffleQuestions,
+		"shuffle_answers":   test.ShuffleAnswers,
 		"questions":         questions,
+		"rules":             rules,
 		"stats":             stats,
 		"groups":            groups, // Добавляем группы в ответ
+		"group_settings":    testGroups,
+		"grade_link":        gradeLink,
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Test details retrieved successfully", response)
@@ -379,13 +459,16 @@ func (h *AdminHandler) GetTestDetails(w http.ResponseWriter, r *http.Request) {
 
 // UpdateTestRequest defines the request body for updating a test
 type UpdateTestRequest struct {
-	Title           string   `json:"title,omitempty"`
-	Description     string   `json:"description,omitempty"`
-	Subject         string   `json:"subject,omitempty"`
-	IsActive        *bool    `json:"is_active,omitempty"`
-	MaxAttempts     int      `json:"max_attempts,omitempty"`
-	TimePerQuestion int      `json:"time_per_question,omitempty"`
-	Groups          []string `json:"groups,omitempty"` // Добавлено: список групп
+	Title            string   `json:"title,omitempty"`
+	Description      string   `json:"description,omitempty"`
+	Subject          string   `json:"subject,omitempty"`
+	IsActive         *bool    `json:"is_active,omitempty"`
+	MaxAttempts      int      `json:"max_attempts,omitempty"`
+	TimePerQuestion  int      `json:"time_per_question,omitempty"`
+	TimeLimit        *int     `json:"time_limit,omitempty"` // Minutes, 0 removes the limit
+	ShuffleQuestions *bool    `json:"shuffle_questions,omitempty"`
+	ShuffleAnswers   *bool    `json:"shuffle_answers,omitempty"`
+	Groups           []string `json:"groups,omitempty"` // Добавлено: список групп
 }
 
 // UpdateTest updates a test's basic information
@@ -447,6 +530,19 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 	if req.TimePerQuestion > 0 {
 		updates["time_per_question"] = req.TimePerQuestion
 	}
+	if req.TimeLimit != nil {
+		if *req.TimeLimit < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Time limit cannot be negative")
+			return
+		}
+		updates["time_limit"] = *req.TimeLimit
+	}
+	if req.ShuffleQuestions != nil {
+		updates["shuffle_questions"] = *req.ShuffleQuestions
+	}
+	if req.ShuffleAnswers != nil {
+		updates["shuffle_answers"] = *req.ShuffleAnswers
+	}
 
 	// Update test in transaction
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
@@ -458,25 +554,11 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		// Обновляем группы если они указаны
+		// Обновляем группы если они указаны; оставшиеся группы сохраняют своё расписание
 		if req.Groups != nil {
-			// Удаляем существующие связи с группами
-			if err := tx.Where("test_id = ?", testID).Delete(&models.TestGroup{}).Error; err != nil {
+			if _, err := syncTestGroups(tx, test.CreatorID, testID, req.Groups); err != nil {
 				return err
 			}
-
-			// Создаем новые связи с группами
-			for _, groupName := range req.Groups {
-				testGroup := models.TestGroup{
-					TestID:    testID,
-					GroupName: groupName,
-					CreatedAt: time.Now(),
-				}
-
-				if err := tx.Create(&testGroup).Error; err != nil {
-					return err
-				}
-			}
 		}
 
 		return nil
@@ -531,11 +613,34 @@ func (h *AdminHandler) DeleteTest(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		// Delete the drawn questions of all attempts
+		if err := tx.Exec("DELETE FROM attempt_questions WHERE attempt_id IN (SELECT id FROM test_attempts WHERE test_id = ?)", testID).Error; err != nil {
+			return err
+		}
+
+		// Delete the client events of all attempts
+		if err := tx.Exec("DELETE FROM attempt_events WHERE attempt_id IN (SELECT id FROM test_attempts WHERE test_id = ?)", testID).Error; err != nil {
+			return err
+		}
+
 		// Delete all test attempts
 		if err := tx.Where("test_id = ?", testID).Delete(&models.TestAttempt{}).Error; err != nil {
 			return err
 		}
 
+		// Lab grades written by the test stay as grades entered by hand
+		if err := tx.Exec("UPDATE lab_grades SET test_id = NULL WHERE test_id = ?", testID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("test_id = ?", testID).Delete(&models.TestGradeLink{}).Error; err != nil {
+			return err
+		}
+
+		// Delete the bank rules; the banks stay
+		if err := tx.Where("test_id = ?", testID).Delete(&models.TestRule{}).Error; err != nil {
+			return err
+		}
+
 		// Delete all answers for all questions in the test
 		if err := tx.Exec("DELETE FROM answers WHERE question_id IN (SELECT id FROM questions WHERE test_id = ?)", testID).Error; err != nil {
 			return err
@@ -569,6 +674,7 @@ func (h *AdminHandler) DeleteTest(w http.ResponseWriter, r *http.Request) {
 type AddQuestionRequest struct {
 	QuestionText string                `json:"question_text"`
 	QuestionType string                `json:"question_type"`
+	Points       float64               `json:"points"` // Question weight, 1 by default
 	Position     int                   `json:"position"`
 	Answers      []CreateAnswerRequest `json:"answers"`
 }
@@ -619,7 +725,14 @@ func (h *AdminHandler) AddQuestion(w http.ResponseWriter, r *http.Request) {
 
 	questionType := req.QuestionType
 	if questionType == "" {
-		questionType = "multiple_choice" // Default
+		questionType = models.QuestionMultipleChoice // Default
+	}
+
+	// The answers must fit the question type
+	answers := buildAnswers(questionType, req.Answers)
+	if err := validateQuestion(questionType, questionWeight(req.Points), answers); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question: "+err.Error())
+		return
 	}
 
 	// Set position if not provided
@@ -634,9 +747,10 @@ func (h *AdminHandler) AddQuestion(w http.ResponseWriter, r *http.Request) {
 	err = h.DB.Transaction(func(tx *gorm.DB) error {
 		// Create question
 		question := models.Question{
-			TestID:       testID,
+			TestID:       &testID,
 			QuestionText: req.QuestionText,
 			QuestionType: questionType,
+			Points:       questionWeight(req.Points),
 			Position:     req.Position,
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
@@ -649,21 +763,7 @@ func (h *AdminHandler) AddQuestion(w http.ResponseWriter, r *http.Request) {
 		questionID = question.ID
 
 		// Create answers
-		for _, a := range req.Answers {
-			answer := models.Answer{
-				QuestionID: question.ID,
-				AnswerText: a.AnswerText,
-				IsCorrect:  a.IsCorrect,
-				CreatedAt:  time.Now(),
-				UpdatedAt:  time.Now(),
-			}
-
-			if err := tx.Create(&answer).Error; err != nil {
-				return err
-			}
-		}
-
-		return nil
+		return createAnswers(tx, question.ID, answers)
 	})
 
 	if err != nil {
@@ -683,15 +783,19 @@ func (h *AdminHandler) AddQuestion(w http.ResponseWriter, r *http.Request) {
 type UpdateQuestionRequest struct {
 	QuestionText string                `json:"question_text,omitempty"`
 	QuestionType string                `json:"question_type,omitempty"`
+	Points       *float64              `json:"points,omitempty"`
 	Position     int                   `json:"position,omitempty"`
 	Answers      []UpdateAnswerRequest `json:"answers,omitempty"`
 }
 
 // UpdateAnswerRequest defines the request body for updating an answer
 type UpdateAnswerRequest struct {
-	ID         int    `json:"id"`
-	AnswerText string `json:"answer_text,omitempty"`
-	IsCorrect  *bool  `json:"is_correct,omitempty"`
+	ID         int      `json:"id"`
+	AnswerText string   `json:"answer_text,omitempty"`
+	IsCorrect  *bool    `json:"is_correct,omitempty"`
+	MatchText  *string  `json:"match_text,omitempty"`
+	Tolerance  *float64 `json:"tolerance,omitempty"`
+	Position   *int     `json:"position,omitempty"`
 }
 
 // UpdateQuestion updates an existing question and its answers
@@ -756,6 +860,9 @@ func (h *AdminHandler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 		if req.QuestionType != "" {
 			updates["question_type"] = req.QuestionType
 		}
+		if req.Points != nil {
+			updates["points"] = questionWeight(*req.Points)
+		}
 		if req.Position > 0 {
 			updates["position"] = req.Position
 		}
@@ -779,6 +886,15 @@ func (h *AdminHandler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 				if a.IsCorrect != nil {
 					answerUpdates["is_correct"] = *a.IsCorrect
 				}
+				if a.MatchText != nil {
+					answerUpdates["match_text"] = *a.MatchText
+				}
+				if a.Tolerance != nil {
+					answerUpdates["tolerance"] = *a.Tolerance
+				}
+				if a.Position != nil {
+					answerUpdates["position"] = *a.Position
+				}
 
 				// Only update if there are changes
 				if len(answerUpdates) > 0 {
@@ -797,9 +913,14 @@ func (h *AdminHandler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		return nil
+		// The updated question must still be scorable
+		return validateStoredQuestion(tx, questionID)
 	})
 
+	if errors.Is(err, errInvalidQuestion) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question: "+err.Error())
+		return
+	}
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating question: "+err.Error())
 		return
@@ -865,6 +986,11 @@ func (h *AdminHandler) DeleteQuestion(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		// Remove the question from attempts that drew it
+		if err := tx.Where("question_id = ?", questionID).Delete(&models.AttemptQuestion{}).Error; err != nil {
+			return err
+		}
+
 		// Delete answers for this question
 		if err := tx.Where("question_id = ?", questionID).Delete(&models.Answer{}).Error; err != nil {
 			return err
@@ -925,9 +1051,12 @@ func (h *AdminHandler) GetTestStatistics(w http.ResponseWriter, r *http.Request)
 		TotalAttempts     int     `json:"total_attempts"`
 		CompletedAttempts int     `json:"completed_attempts"`
 		AverageScore      float64 `json:"average_score"`
-		HighestScore      int     `json:"highest_score"`
-		LowestScore       int     `json:"lowest_score"`
-		AverageDuration   int     `json:"average_duration"` // In seconds
+		AveragePercent    float64 `json:"average_percent"` // Of the attempt maximum score
+		HighestScore      float64 `json:"highest_score"`
+		LowestScore       float64 `json:"lowest_score"`
+		AverageDuration   int     `json:"average_duration"`          // In seconds
+		PendingReviews    int     `json:"pending_reviews"`           // Free text answers not graded yet
+		FlaggedAttempts   int     `gorm:"-" json:"flagged_attempts"` // Attempts with cheating signals
 	}
 
 	h.DB.Raw(`
@@ -935,50 +1064,108 @@ func (h *AdminHandler) GetTestStatistics(w http.ResponseWriter, r *http.Request)
 			COUNT(*) as total_attempts,
 			SUM(CASE WHEN completed = true THEN 1 ELSE 0 END) as completed_attempts,
 			COALESCE(AVG(CASE WHEN completed = true THEN score ELSE NULL END), 0) as average_score,
+			COALESCE(AVG(CASE WHEN completed = true AND max_score > 0 THEN score * 100.0 / max_score ELSE NULL END), 0) as average_percent,
 			COALESCE(MAX(CASE WHEN completed = true THEN score ELSE 0 END), 0) as highest_score,
 			COALESCE(MIN(CASE WHEN completed = true THEN score ELSE 0 END), 0) as lowest_score,
 			COALESCE(AVG(CASE WHEN completed = true AND end_time IS NOT NULL 
-				THEN EXTRACT(EPOCH FROM (end_time - start_time)) ELSE NULL END), 0) as average_duration
+				THEN EXTRACT(EPOCH FROM (end_time - start_time)) ELSE NULL END), 0) as average_duration,
+			(SELECT COUNT(*) FROM student_responses sr
+				WHERE sr.needs_review = true AND sr.reviewed_at IS NULL
+					AND sr.attempt_id IN (SELECT id FROM test_attempts WHERE test_id = ?)) as pending_reviews
 		FROM test_attempts
 		WHERE test_id = ?
-	`, testID).Scan(&overallStats)
+	`, testID, testID).Scan(&overallStats)
 
-	// Get question-specific statistics
+	// Get question-specific statistics. Bank questions are shared between tests,
+	// so only responses from attempts of this test are counted
 	var questionStats []struct {
 		QuestionID       int     `json:"question_id"`
 		QuestionText     string  `json:"question_text"`
+		QuestionType     string  `json:"question_type"`
 		Position         int     `json:"position"`
+		BankID           *int    `json:"bank_id"`
+		Difficulty       string  `json:"difficulty"`
+		Points           float64 `json:"points"`
+		DrawnCount       int     `json:"drawn_count"` // Attempts the question was drawn for
 		CorrectCount     int     `json:"correct_count"`
 		AttemptedCount   int     `json:"attempted_count"`
 		CorrectPercent   float64 `json:"correct_percent"`
+		AveragePoints    float64 `json:"average_points"`     // Includes partial credit
 		AverageTimeSpent int     `json:"average_time_spent"` // In seconds
+
+		// Item analysis of completed attempts
+		DifficultyIndex     float64       `gorm:"-" json:"difficulty_index"`
+		DiscriminationIndex *float64      `gorm:"-" json:"discrimination_index"`
+		Flags               []string      `gorm:"-" json:"flags"`
+		Options             []OptionStats `gorm:"-" json:"options,omitempty"`
 	}
 
 	h.DB.Raw(`
+		WITH test_attempt_ids AS (
+			SELECT id FROM test_attempts WHERE test_id = ?
+		)
 		SELECT 
 			q.id as question_id,
 			q.question_text,
+			q.question_type,
 			q.position,
+			q.bank_id,
+			q.difficulty,
+			q.points,
+			(SELECT COUNT(*) FROM attempt_questions aq
+				WHERE aq.question_id = q.id AND aq.attempt_id IN (SELECT id FROM test_attempt_ids)) as drawn_count,
 			COUNT(sr.id) as attempted_count,
 			SUM(CASE WHEN sr.is_correct = true THEN 1 ELSE 0 END) as correct_count,
 			CASE WHEN COUNT(sr.id) > 0 
 				THEN (SUM(CASE WHEN sr.is_correct = true THEN 1 ELSE 0 END) * 100.0 / COUNT(sr.id)) 
 				ELSE 0 END as correct_percent,
+			COALESCE(AVG(sr.points), 0) as average_points,
 			COALESCE(AVG(sr.time_spent), 0) as average_time_spent
 		FROM questions q
 		LEFT JOIN student_responses sr ON q.id = sr.question_id
-		WHERE q.test_id = ?
-		GROUP BY q.id, q.question_text, q.position
-		ORDER BY q.position
-	`, testID).Scan(&questionStats)
+			AND sr.attempt_id IN (SELECT id FROM test_attempt_ids)
+		WHERE q.test_id = ? OR q.id IN (
+			SELECT aq.question_id FROM attempt_questions aq WHERE aq.attempt_id IN (SELECT id FROM test_attempt_ids)
+		)
+		GROUP BY q.id, q.question_text, q.question_type, q.position, q.bank_id, q.difficulty, q.points
+		ORDER BY q.bank_id NULLS FIRST, q.position, q.id
+	`, testID, testID).Scan(&questionStats)
+
+	items, reliability, err := itemAnalysis(h.DB, testID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error computing item analysis")
+		return
+	}
+	itemsByQuestion := make(map[int]ItemReport, len(items))
+	for _, item := range items {
+		itemsByQuestion[item.QuestionID] = item
+	}
+	for i := range questionStats {
+		item := itemsByQuestion[questionStats[i].QuestionID]
+		questionStats[i].DifficultyIndex = item.Difficulty
+		questionStats[i].DiscriminationIndex = item.Discrimination
+		questionStats[i].Flags = item.Flags
+		questionStats[i].Options = item.Options
+		if questionStats[i].Flags == nil {
+			questionStats[i].Flags = []string{}
+		}
+	}
+
+	// Cheating signals of the attempts
+	integrityFlags, err := integrityReports(h.DB, testID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking attempts for cheating signals")
+		return
+	}
+	overallStats.FlaggedAttempts = len(integrityFlags)
 
 	// Get student performance
 	var studentPerformance []struct {
-		StudentID    int    `json:"student_id"`
-		StudentName  string `json:"student_name"`
-		AttemptCount int    `json:"attempt_count"`
-		HighestScore int    `json:"highest_score"`
-		LastAttempt  string `json:"last_attempt"`
+		StudentID    int     `json:"student_id"`
+		StudentName  string  `json:"student_name"`
+		AttemptCount int     `json:"attempt_count"`
+		HighestScore float64 `json:"highest_score"`
+		LastAttempt  string  `json:"last_attempt"`
 	}
 
 	h.DB.Raw(`
@@ -1005,8 +1192,430 @@ func (h *AdminHandler) GetTestStatistics(w http.ResponseWriter, r *http.Request)
 		},
 		"overall_stats":       overallStats,
 		"question_stats":      questionStats,
+		"reliability":         reliability,
+		"integrity_flags":     integrityFlags,
 		"student_performance": studentPerformance,
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Test statistics retrieved successfully", response)
 }
+
+// UpdateTestRules replaces the rules drawing random bank questions into a test
+func (h *AdminHandler) UpdateTestRules(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	// Check if test exists and belongs to the user
+	var test models.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to modify this test")
+		return
+	}
+
+	// Parse request body
+	var req []TestRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	rules, err := buildRules(h.DB, test.CreatorID, userRole == "admin", testID, req)
+	if err != nil {
+		if errors.Is(err, errInvalidRule) {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error checking rules: "+err.Error())
+		}
+		return
+	}
+
+	// A test needs at least its own questions or one rule
+	var questionCount int64
+	h.DB.Model(&models.Question{}).Where("test_id = ?", testID).Count(&questionCount)
+	if questionCount == 0 && len(rules) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest, "A test without questions needs at least one rule")
+		return
+	}
+
+	// Attempts already started keep their drawn questions
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRules(tx, testID, rules)
+	}); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving rules: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Update Test Rules", fmt.Sprintf("Set %d bank rules for test ID %d", len(rules), testID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Test rules updated successfully", rules)
+}
+
+// TestGroupRequest defines the schedule of a test for one group
+type TestGroupRequest struct {
+	GroupName   string     `json:"group_name"`
+	OpensAt     *time.Time `json:"opens_at"`
+	ClosesAt    *time.Time `json:"closes_at"`
+	AccessCode  string     `json:"access_code"`
+	MaxAttempts *int       `json:"max_attempts"` // Null keeps the test's limit
+}
+
+// UpdateTestGroups replaces the groups of a test with their open and close times,
+// access codes and attempt limits
+func (h *AdminHandler) UpdateTestGroups(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	// Check if test exists and belongs to the user
+	var test models.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to modify this test")
+		return
+	}
+
+	// Parse request body
+	var req []TestGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	groupNames := make([]string, 0, len(req))
+	for i, group := range req {
+		req[i].GroupName = strings.TrimSpace(group.GroupName)
+		req[i].AccessCode = strings.TrimSpace(group.AccessCode)
+		if req[i].GroupName == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Group name is required")
+			return
+		}
+		if group.OpensAt != nil && group.ClosesAt != nil && !group.ClosesAt.After(*group.OpensAt) {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Group %s closes before it opens", req[i].GroupName))
+			return
+		}
+		if group.MaxAttempts != nil && *group.MaxAttempts < 1 {
+			utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Group %s needs at least one attempt", req[i].GroupName))
+			return
+		}
+		groupNames = append(groupNames, req[i].GroupName)
+	}
+
+	var testGroups []models.TestGroup
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		links, err := syncTestGroups(tx, test.CreatorID, testID, groupNames)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range req {
+			link := links[group.GroupName]
+			if err := tx.Model(link).Updates(map[string]interface{}{
+				"opens_at":     group.OpensAt,
+				"closes_at":    group.ClosesAt,
+				"access_code":  group.AccessCode,
+				"max_attempts": group.MaxAttempts,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("test_id = ?", testID).Order("group_name").Find(&testGroups).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving test groups: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Update Test Groups", fmt.Sprintf("Set schedule of %d groups for test ID %d", len(testGroups), testID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Test groups updated successfully", testGroups)
+}
+
+// ImportTest imports questions from a Moodle XML or GIFT file. Form fields: file, format
+// (detected from the file name when empty), test_id to add the questions to an existing test,
+// or title, subject and groups for a new test. Questions of unsupported types are skipped and reported.
+func (h *AdminHandler) ImportTest(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+
+	// Parse multipart form
+	if err := r.ParseMultipartForm(config.MaxFileSize); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	// Get file from form
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "No file uploaded")
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	if format == "" {
+		if format, err = interchange.DetectFormat(header.Filename); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, config.MaxFileSize))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Error reading file")
+		return
+	}
+
+	quiz, err := interchange.Parse(format, data)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing test file: %v", err))
+		return
+	}
+	if len(quiz.Questions) == 0 {
+		utils.RespondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("No supported questions found in the file, %d skipped", len(quiz.Skipped)))
+		return
+	}
+
+	// Either add to an existing test or create a new one
+	var test models.Test
+	if value := r.FormValue("test_id"); value != "" {
+		testID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+			return
+		}
+		if err := h.DB.First(&test, testID).Error; err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+			return
+		}
+		if test.CreatorID != userID && userRole != "admin" {
+			utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to modify this test")
+			return
+		}
+	} else {
+		test = models.Test{
+			Title:           strings.TrimSpace(r.FormValue("title")),
+			Subject:         strings.TrimSpace(r.FormValue("subject")),
+			Description:     r.FormValue("description"),
+			CreatorID:       userID,
+			TimePerQuestion: 60, // Default 60 seconds per question
+			MaxAttempts:     1,  // Default 1 attempt
+			IsActive:        true,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		}
+		if test.Title == "" {
+			test.Title = quiz.Category
+		}
+		if test.Title == "" {
+			test.Title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+		if test.Subject == "" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Subject is required for a new test")
+			return
+		}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if test.ID == 0 {
+			if err := tx.Create(&test).Error; err != nil {
+				return err
+			}
+			if err := linkTestGroups(tx, userID, test.ID, r.MultipartForm.Value["groups"]); err != nil {
+				return err
+			}
+		}
+
+		// Imported questions go after the existing ones
+		var maxPosition int
+		if err := tx.Model(&models.Question{}).Where("test_id = ?", test.ID).
+			Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+
+		for i, question := range quiz.Questions {
+			answers := question.Answers
+			question.Answers = nil
+			question.TestID = &test.ID
+			question.Position = maxPosition + i + 1
+			question.CreatedAt = time.Now()
+			question.UpdatedAt = time.Now()
+			if err := tx.Create(&question).Error; err != nil {
+				return err
+			}
+			if err := createAnswers(tx, question.ID, answers); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error importing test: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Import Test",
+		fmt.Sprintf("Imported %d questions from %s into test ID %d, skipped %d", len(quiz.Questions), header.Filename, test.ID, len(quiz.Skipped)))
+
+	if quiz.Skipped == nil {
+		quiz.Skipped = []interchange.Skipped{}
+	}
+	utils.RespondWithSuccess(w, http.StatusCreated, "Test imported successfully", map[string]interface{}{
+		"test_id":  test.ID,
+		"imported": len(quiz.Questions),
+		"skipped":  quiz.Skipped,
+	})
+}
+
+// ExportTest exports the questions of a test as Moodle XML or GIFT (?format=moodle_xml|gift).
+// Questions drawn from banks by rules are not part of the test and are not exported;
+// questions the format cannot express are counted in the X-Skipped-Questions header.
+func (h *AdminHandler) ExportTest(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	var test models.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to export this test")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = interchange.FormatMoodleXML
+	}
+
+	preloadAnswers := func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}
+
+	var questions []models.Question
+	if err := h.DB.Preload("Answers", preloadAnswers).
+		Where("test_id = ?", testID).Order("position, id").Find(&questions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving questions")
+		return
+	}
+
+	// The bank questions the rules draw from go to a category per rule. The test's own
+	// questions come last, so the file is imported back under the test title.
+	var rules []models.TestRule
+	if err := h.DB.Preload("Bank").Where("test_id = ?", testID).Order("position, id").Find(&rules).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving test rules")
+		return
+	}
+	var sections []interchange.Section
+	exported := make(map[int]bool)
+	bankQuestions := 0
+	for _, rule := range rules {
+		var drawn []models.Question
+		if err := ruleQuery(h.DB, rule).Preload("Answers", preloadAnswers).
+			Order("position, id").Find(&drawn).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving bank questions")
+			return
+		}
+		section := interchange.Section{Category: []string{test.Title, ruleCategory(rule)}}
+		for _, question := range drawn {
+			if !exported[question.ID] {
+				exported[question.ID] = true
+				section.Questions = append(section.Questions, question)
+			}
+		}
+		bankQuestions += len(section.Questions)
+		sections = append(sections, section)
+	}
+	sections = append(sections, interchange.Section{Category: []string{test.Title}, Questions: questions})
+
+	data, skipped, err := interchange.WriteSections(format, sections)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Export Test",
+		fmt.Sprintf("Exported test ID %d as %s with %d bank questions, skipped %d questions",
+			testID, format, bankQuestions, len(skipped)))
+
+	// Set headers for file download
+	contentType := "application/xml; charset=utf-8"
+	if format == interchange.FormatGIFT {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=test_%d%s", testID, interchange.FileExtension(format)))
+	w.Header().Set("X-Skipped-Questions", strconv.Itoa(len(skipped)))
+	w.Write(data)
+}
+
+// ruleCategory names the export category of the bank questions a rule draws from
+func ruleCategory(rule models.TestRule) string {
+	filters := []string{fmt.Sprintf("%d random", rule.Count)}
+	if rule.Difficulty != "" {
+		filters = append(filters, rule.Difficulty)
+	}
+	filters = append(filters, rule.Tags...)
+	return fmt.Sprintf("%s (%s)", rule.Bank.Title, strings.Join(filters, ", "))
+}
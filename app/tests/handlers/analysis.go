@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	dashboardUtils "TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/app/tests/analysis"
+	"TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tealeg/xlsx"
+	"gorm.io/gorm"
+)
+
+// OptionStats is how often an answer option of a choice question was selected
+type OptionStats struct {
+	AnswerID       int     `json:"answer_id"`
+	AnswerText     string  `json:"answer_text"`
+	IsCorrect      bool    `json:"is_correct"`
+	Selected       int     `json:"selected"`
+	SelectionRate  float64 `json:"selection_rate"`  // Share of the responses to the question
+	WeakDistractor bool    `json:"weak_distractor"` // A wrong option almost nobody picks
+}
+
+// ItemReport is the item analysis of one question
+type ItemReport struct {
+	analysis.ItemStats
+	QuestionText string        `json:"question_text"`
+	QuestionType string        `json:"question_type"`
+	Points       float64       `json:"points"`
+	Responses    int           `json:"responses"`
+	Options      []OptionStats `json:"options,omitempty"` // Only for choice questions
+}
+
+// itemAnalysis computes the item analysis of the completed attempts of a test.
+// Questions drawn for an attempt and left unanswered count as zero points.
+func itemAnalysis(db *gorm.DB, testID int) ([]ItemReport, analysis.Reliability, error) {
+	var attemptIDs []int
+	if err := db.Model(&models.TestAttempt{}).
+		Where("test_id = ? AND completed = true", testID).
+		Order("id").Pluck("id", &attemptIDs).Error; err != nil {
+		return nil, analysis.Reliability{}, err
+	}
+	if len(attemptIDs) == 0 {
+		return []ItemReport{}, analysis.Reliability{}, nil
+	}
+
+	var slots []models.AttemptQuestion
+	if err := db.Select("attempt_id, question_id").Where("attempt_id IN ?", attemptIDs).Find(&slots).Error; err != nil {
+		return nil, analysis.Reliability{}, err
+	}
+
+	var responses []models.StudentResponse
+	if err := db.Select("attempt_id, question_id, answer_id, answer_data, points").
+		Where("attempt_id IN ?", attemptIDs).Find(&responses).Error; err != nil {
+		return nil, analysis.Reliability{}, err
+	}
+
+	// Attempts started before question order was frozen have no slots; they got the test's own questions
+	var testQuestionIDs []int
+	if err := db.Model(&models.Question{}).Where("test_id = ?", testID).Pluck("id", &testQuestionIDs).Error; err != nil {
+		return nil, analysis.Reliability{}, err
+	}
+
+	scores := make(map[int]analysis.Attempt, len(attemptIDs))
+	for _, id := range attemptIDs {
+		scores[id] = analysis.Attempt{}
+	}
+	for _, slot := range slots {
+		scores[slot.AttemptID][slot.QuestionID] = 0
+	}
+	for _, id := range attemptIDs {
+		if len(scores[id]) == 0 {
+			for _, questionID := range testQuestionIDs {
+				scores[id][questionID] = 0
+			}
+		}
+	}
+
+	// Selections of answer options by question
+	selected := make(map[int]map[int]int)
+	responded := make(map[int]int)
+	for _, response := range responses {
+		scores[response.AttemptID][response.QuestionID] += response.Points
+		responded[response.QuestionID]++
+
+		answerIDs := response.Data.AnswerIDs
+		if len(answerIDs) == 0 && response.AnswerID != nil {
+			answerIDs = []int{*response.AnswerID}
+		}
+		if selected[response.QuestionID] == nil {
+			selected[response.QuestionID] = make(map[int]int)
+		}
+		for _, answerID := range answerIDs {
+			selected[response.QuestionID][answerID]++
+		}
+	}
+
+	attempts := make([]analysis.Attempt, 0, len(attemptIDs))
+	questionIDs := make(map[int]bool)
+	for _, id := range attemptIDs {
+		attempts = append(attempts, scores[id])
+		for questionID := range scores[id] {
+			questionIDs[questionID] = true
+		}
+	}
+
+	ids := make([]int, 0, len(questionIDs))
+	for id := range questionIDs {
+		ids = append(ids, id)
+	}
+	var questions []models.Question
+	if err := db.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id IN ?", ids).Find(&questions).Error; err != nil {
+		return nil, analysis.Reliability{}, err
+	}
+	byID := make(map[int]models.Question, len(questions))
+	maxPoints := make(map[int]float64, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+		maxPoints[question.ID] = questionWeight(question.Points)
+	}
+
+	items := analysis.Items(attempts, maxPoints)
+	reports := make([]ItemReport, 0, len(items))
+	for _, item := range items {
+		question := byID[item.QuestionID]
+		report := ItemReport{
+			ItemStats:    item,
+			QuestionText: question.QuestionText,
+			QuestionType: question.QuestionType,
+			Points:       maxPoints[item.QuestionID],
+			Responses:    responded[item.QuestionID],
+		}
+
+		if question.QuestionType == models.QuestionSingleChoice || question.QuestionType == models.QuestionMultipleChoice {
+			for _, answer := range question.Answers {
+				option := OptionStats{
+					AnswerID:   answer.ID,
+					AnswerText: answer.AnswerText,
+					IsCorrect:  answer.IsCorrect,
+					Selected:   selected[question.ID][answer.ID],
+				}
+				if report.Responses > 0 {
+					option.SelectionRate = math.Round(float64(option.Selected)/float64(report.Responses)*1000) / 1000
+				}
+				option.WeakDistractor = analysis.WeakDistractor(option.SelectionRate, answer.IsCorrect, report.Responses)
+				report.Options = append(report.Options, option)
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, analysis.CronbachAlpha(attempts), nil
+}
+
+// ExportTestStatistics exports the item analysis of a test as an XLSX file
+func (h *AdminHandler) ExportTestStatistics(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	var test models.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to view statistics for this test")
+		return
+	}
+
+	items, reliability, err := itemAnalysis(h.DB, testID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error computing item analysis")
+		return
+	}
+
+	file := xlsx.NewFile()
+	sheet, err := file.AddSheet("Анализ заданий")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating Excel file")
+		return
+	}
+
+	titleRow := sheet.AddRow()
+	titleRow.AddCell().SetString(test.Title)
+	alphaRow := sheet.AddRow()
+	alphaRow.AddCell().SetString("Альфа Кронбаха")
+	if reliability.CronbachAlpha != nil {
+		alphaRow.AddCell().SetString(fmt.Sprintf("%.3f", *reliability.CronbachAlpha))
+	} else {
+		alphaRow.AddCell().SetString("—")
+	}
+	alphaRow.AddCell().SetString(fmt.Sprintf("Заданий: %d, попыток: %d", reliability.Items, reliability.Attempts))
+	sheet.AddRow()
+
+	header := sheet.AddRow()
+	header.AddCell().SetString("ID")
+	header.AddCell().SetString("Вопрос")
+	header.AddCell().SetString("Тип")
+	header.AddCell().SetString("Баллы")
+	header.AddCell().SetString("Попыток")
+	header.AddCell().SetString("Ответов")
+	header.AddCell().SetString("Индекс трудности")
+	header.AddCell().SetString("Индекс дискриминации")
+	header.AddCell().SetString("Замечания")
+
+	for _, item := range items {
+		row := sheet.AddRow()
+		row.AddCell().SetInt(item.QuestionID)
+		row.AddCell().SetString(item.QuestionText)
+		row.AddCell().SetString(item.QuestionType)
+		row.AddCell().SetString(fmt.Sprintf("%g", item.Points))
+		row.AddCell().SetInt(item.Attempts)
+		row.AddCell().SetInt(item.Responses)
+		row.AddCell().SetString(fmt.Sprintf("%.3f", item.Difficulty))
+		if item.Discrimination != nil {
+			row.AddCell().SetString(fmt.Sprintf("%.3f", *item.Discrimination))
+		} else {
+			row.AddCell().SetString("—")
+		}
+		row.AddCell().SetString(flagLabels(item.Flags))
+	}
+
+	options, err := file.AddSheet("Дистракторы")
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating Excel file")
+		return
+	}
+
+	header = options.AddRow()
+	header.AddCell().SetString("ID вопроса")
+	header.AddCell().SetString("Вопрос")
+	header.AddCell().SetString("Вариант ответа")
+	header.AddCell().SetString("Верный")
+	header.AddCell().SetString("Выбран")
+	header.AddCell().SetString("Доля выбора, %")
+	header.AddCell().SetString("Замечания")
+
+	for _, item := range items {
+		for _, option := range item.Options {
+			row := options.AddRow()
+			row.AddCell().SetInt(item.QuestionID)
+			row.AddCell().SetString(item.QuestionText)
+			row.AddCell().SetString(option.AnswerText)
+			if option.IsCorrect {
+				row.AddCell().SetString("Да")
+			} else {
+				row.AddCell().SetString("Нет")
+			}
+			row.AddCell().SetInt(option.Selected)
+			row.AddCell().SetString(fmt.Sprintf("%.1f", option.SelectionRate*100))
+			if option.WeakDistractor {
+				row.AddCell().SetString("Почти не выбирается")
+			} else {
+				row.AddCell().SetString("")
+			}
+		}
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Export Test Statistics", fmt.Sprintf("Exported item analysis of test ID %d", testID))
+
+	// Set headers for file download
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=test_%d_statistics.xlsx", testID))
+
+	// Write the file to the response
+	if err := file.Write(w); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error writing Excel file")
+		return
+	}
+}
+
+// flagLabels describes item flags in Russian for the report
+func flagLabels(flags []string) string {
+	labels := map[string]string{
+		analysis.FlagTooHard:                "слишком трудное",
+		analysis.FlagTooEasy:                "слишком лёгкое",
+		analysis.FlagLowDiscrimination:      "слабо различает",
+		analysis.FlagNegativeDiscrimination: "отрицательная дискриминация",
+	}
+	var result []string
+	for _, flag := range flags {
+		result = append(result, labels[flag])
+	}
+	return strings.Join(result, ", ")
+}
@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// attemptAbandonTimeout is how long an attempt may stay without activity
+	// before the sweeper completes it
+	attemptAbandonTimeout = time.Hour
+	// attemptSweepInterval is how often expired and abandoned attempts are completed
+	attemptSweepInterval = time.Minute
+)
+
+// StartAttemptSweeper periodically completes attempts whose time ran out
+// or which were abandoned by the student
+func StartAttemptSweeper(database *gorm.DB) {
+	go func() {
+		sweepAttempts(database)
+
+		ticker := time.NewTicker(attemptSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepAttempts(database)
+		}
+	}()
+}
+
+// sweepAttempts completes unfinished attempts past their test deadline or idle for too long
+func sweepAttempts(database *gorm.DB) {
+	now := time.Now()
+
+	var attempts []testsModels.TestAttempt
+	if err := database.
+		Where("completed = ?", false).
+		Where("(deadline IS NOT NULL AND deadline < ?) OR COALESCE(last_activity_at, start_time) < ?",
+			now.Add(-utils.AnswerGracePeriod), now.Add(-attemptAbandonTimeout)).
+		Find(&attempts).Error; err != nil {
+		log.Printf("Error listing expired test attempts: %v", err)
+		return
+	}
+
+	for _, attempt := range attempts {
+		// Expired attempts end at their deadline, abandoned ones at the last activity
+		endTime := attempt.StartTime
+		if attempt.LastActivityAt != nil {
+			endTime = *attempt.LastActivityAt
+		}
+		if utils.PastDeadline(attempt.Deadline, now) {
+			endTime = *attempt.Deadline
+		}
+
+		completed, err := completeAttempt(database, attempt.ID, endTime)
+		if err != nil {
+			log.Printf("Error completing test attempt %d: %v", attempt.ID, err)
+			continue
+		}
+		if completed {
+			log.Printf("Auto-completed test attempt %d of student %d", attempt.ID, attempt.StudentID)
+		}
+	}
+}
+
+// completeAttempt marks an attempt as completed and recalculates its score as the sum
+// of the recorded response points; unanswered questions score zero. It returns false if the attempt
+// was already completed. A completed attempt updates the lab grade linked to the test.
+func completeAttempt(database *gorm.DB, attemptID int, endTime time.Time) (bool, error) {
+	result := database.Exec(`
+		UPDATE test_attempts SET
+			completed = true,
+			end_time = ?,
+			score = (SELECT COALESCE(SUM(sr.points), 0) FROM student_responses sr WHERE sr.attempt_id = test_attempts.id)
+		WHERE id = ? AND completed = false
+	`, endTime, attemptID)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false, result.Error
+	}
+
+	logGradeSync(database, attemptID)
+	return true, nil
+}
+
+// rescoreAttempt recalculates the score of an attempt after its responses were graded
+// and updates the lab grade linked to the test
+func rescoreAttempt(database *gorm.DB, attemptID int) error {
+	if err := database.Exec(`
+		UPDATE test_attempts SET
+			score = (SELECT COALESCE(SUM(sr.points), 0) FROM student_responses sr WHERE sr.attempt_id = test_attempts.id)
+		WHERE id = ?
+	`, attemptID).Error; err != nil {
+		return err
+	}
+	return syncTestGrade(database, attemptID)
+}
+
+// pendingReviewSQL is true for attempts with free text answers the teacher has not graded yet
+const pendingReviewSQL = `EXISTS (SELECT 1 FROM student_responses sr
+	WHERE sr.attempt_id = ta.id AND sr.needs_review = true AND sr.reviewed_at IS NULL)`
+
+// touchAttempt records student activity so the sweeper does not treat the attempt as abandoned
+func touchAttempt(database *gorm.DB, attemptID int, now time.Time) {
+	if err := database.Model(&testsModels.TestAttempt{}).Where("id = ?", attemptID).
+		Update("last_activity_at", now).Error; err != nil {
+		log.Printf("Error updating activity of attempt %d: %v", attemptID, err)
+	}
+}
+
+// serveQuestion stamps the moment a question is first served in an attempt.
+// Serving the same question again keeps the original time and deadline.
+func serveQuestion(database *gorm.DB, attempt testsModels.TestAttempt, slot testsModels.AttemptQuestion, timePerQuestion int, now time.Time) (testsModels.AttemptQuestion, error) {
+	if slot.ServedAt != nil {
+		return slot, nil
+	}
+
+	// Only the first request stamps the question
+	deadline := utils.QuestionDeadline(now, timePerQuestion, attempt.Deadline)
+	if err := database.Model(&testsModels.AttemptQuestion{}).
+		Where("id = ? AND served_at IS NULL", slot.ID).
+		Updates(map[string]interface{}{
+			"served_at": now,
+			"deadline":  deadline,
+		}).Error; err != nil {
+		return slot, err
+	}
+
+	err := database.Where("id = ?", slot.ID).First(&slot).Error
+	return slot, err
+}
+
+// recordTimeout stores an empty zero-score response for a served question whose time ran out
+func recordTimeout(database *gorm.DB, served testsModels.AttemptQuestion) error {
+	timeSpent := 0
+	submittedAt := time.Now()
+	if served.Deadline != nil && served.ServedAt != nil {
+		timeSpent = int(served.Deadline.Sub(*served.ServedAt).Seconds())
+		submittedAt = *served.Deadline
+	}
+
+	response := testsModels.StudentResponse{
+		AttemptID:   served.AttemptID,
+		QuestionID:  served.QuestionID,
+		IsCorrect:   false,
+		MaxPoints:   questionPoints(database, served.QuestionID),
+		TimeSpent:   timeSpent,
+		Late:        true,
+		SubmittedAt: submittedAt,
+	}
+	// The student may have answered in the meantime
+	return database.Clauses(clause.OnConflict{DoNothing: true}).Create(&response).Error
+}
+
+// questionPoints returns the weight of a question, one point if it cannot be read
+func questionPoints(database *gorm.DB, questionID int) float64 {
+	var question testsModels.Question
+	if err := database.Select("points").Where("id = ?", questionID).First(&question).Error; err != nil || question.Points <= 0 {
+		return 1
+	}
+	return question.Points
+}
+
+// maxScore sums the weights of the questions drawn for an attempt
+func maxScore(database *gorm.DB, questionIDs []int) (float64, error) {
+	var total float64
+	err := database.Model(&testsModels.Question{}).
+		Where("id IN ?", questionIDs).
+		Select("COALESCE(SUM(points), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// errNotEnoughQuestions is returned when a bank has fewer matching questions than a rule draws
+var errNotEnoughQuestions = errors.New("not enough questions in the bank")
+
+// ruleQuery selects the bank questions matching a rule
+func ruleQuery(database *gorm.DB, rule testsModels.TestRule) *gorm.DB {
+	query := database.Model(&testsModels.Question{}).Where("bank_id = ?", rule.BankID)
+	if rule.Difficulty != "" {
+		query = query.Where("difficulty = ?", rule.Difficulty)
+	}
+	if len(rule.Tags) > 0 {
+		query = query.Where("tags @> ?", rule.Tags)
+	}
+	return query
+}
+
+// drawQuestions picks the questions for a new attempt: the test's own questions
+// in position order followed by random questions drawn by the test rules
+func drawQuestions(database *gorm.DB, test testsModels.Test) ([]int, error) {
+	var questionIDs []int
+	if err := database.Model(&testsModels.Question{}).
+		Where("test_id = ?", test.ID).
+		Order("position, id").
+		Pluck("id", &questionIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var rules []testsModels.TestRule
+	if err := database.Where("test_id = ?", test.ID).Order("position, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		// A question matching several rules is drawn only once
+		query := ruleQuery(database, rule)
+		if len(questionIDs) > 0 {
+			query = query.Where("id NOT IN ?", questionIDs)
+		}
+
+		var drawn []int
+		if err := query.Order("random()").Limit(rule.Count).Pluck("id", &drawn).Error; err != nil {
+			return nil, err
+		}
+		if len(drawn) < rule.Count {
+			return nil, fmt.Errorf("%w: rule %d needs %d, found %d", errNotEnoughQuestions, rule.Position, rule.Count, len(drawn))
+		}
+		questionIDs = append(questionIDs, drawn...)
+	}
+
+	if test.ShuffleQuestions {
+		rand.Shuffle(len(questionIDs), func(i, j int) {
+			questionIDs[i], questionIDs[j] = questionIDs[j], questionIDs[i]
+		})
+	}
+	return questionIDs, nil
+}
+
+// freezeAttempt stores the question and answer order of an attempt.
+// Items of ordering questions are always shuffled, their stored order is the solution.
+// Questions already served keep their serve stamps.
+func freezeAttempt(tx *gorm.DB, attemptID int, questionIDs []int, shuffleAnswers bool) error {
+	var ordering []int
+	if err := tx.Model(&testsModels.Question{}).
+		Where("id IN ? AND question_type = ?", questionIDs, testsModels.QuestionOrdering).
+		Pluck("id", &ordering).Error; err != nil {
+		return err
+	}
+	isOrdering := make(map[int]bool, len(ordering))
+	for _, id := range ordering {
+		isOrdering[id] = true
+	}
+
+	var answers []testsModels.Answer
+	if err := tx.Select("id, question_id").Where("question_id IN ?", questionIDs).Order("id").Find(&answers).Error; err != nil {
+		return err
+	}
+	answerIDs := make(map[int][]int64)
+	for _, answer := range answers {
+		answerIDs[answer.QuestionID] = append(answerIDs[answer.QuestionID], int64(answer.ID))
+	}
+
+	for i, questionID := range questionIDs {
+		order := answerIDs[questionID]
+		if shuffleAnswers || isOrdering[questionID] {
+			rand.Shuffle(len(order), func(a, b int) { order[a], order[b] = order[b], order[a] })
+		}
+
+		var slot testsModels.AttemptQuestion
+		if err := tx.Where(testsModels.AttemptQuestion{AttemptID: attemptID, QuestionID: questionID}).
+			Assign(testsModels.AttemptQuestion{Position: i + 1, AnswerOrder: order}).
+			FirstOrCreate(&slot).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawnQuestion is a question of an attempt with its answers in the frozen order
+type drawnQuestion struct {
+	Slot     testsModels.AttemptQuestion
+	Question testsModels.Question
+}
+
+// loadAttemptQuestions returns the questions of an attempt in the order frozen at its start.
+// Attempts started before questions were frozen are frozen on first use in test order.
+func loadAttemptQuestions(database *gorm.DB, attempt testsModels.TestAttempt) ([]drawnQuestion, error) {
+	var slots []testsModels.AttemptQuestion
+	if err := database.Where("attempt_id = ? AND position > 0", attempt.ID).Order("position").Find(&slots).Error; err != nil {
+		return nil, err
+	}
+
+	if len(slots) == 0 {
+		var questionIDs []int
+		if err := database.Model(&testsModels.Question{}).
+			Where("test_id = ?", attempt.TestID).
+			Order("position, id").
+			Pluck("id", &questionIDs).Error; err != nil {
+			return nil, err
+		}
+		if len(questionIDs) == 0 {
+			return nil, nil
+		}
+
+		if err := database.Transaction(func(tx *gorm.DB) error {
+			return freezeAttempt(tx, attempt.ID, questionIDs, false)
+		}); err != nil {
+			return nil, err
+		}
+
+		if err := database.Where("attempt_id = ? AND position > 0", attempt.ID).Order("position").Find(&slots).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	questionIDs := make([]int, len(slots))
+	for i, slot := range slots {
+		questionIDs[i] = slot.QuestionID
+	}
+
+	var questions []testsModels.Question
+	if err := database.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id IN ?", questionIDs).Find(&questions).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]testsModels.Question, len(questions))
+	for _, q := range questions {
+		byID[q.ID] = q
+	}
+
+	// Questions deleted after the attempt started are skipped
+	result := make([]drawnQuestion, 0, len(slots))
+	for _, slot := range slots {
+		question, ok := byID[slot.QuestionID]
+		if !ok {
+			continue
+		}
+
+		answerIDs := make([]int, len(question.Answers))
+		for i, answer := range question.Answers {
+			answerIDs[i] = answer.ID
+		}
+		ordered := make([]testsModels.Answer, 0, len(question.Answers))
+		for _, i := range utils.OrderByIDs(answerIDs, slot.AnswerOrder) {
+			ordered = append(ordered, question.Answers[i])
+		}
+		question.Answers = ordered
+
+		result = append(result, drawnQuestion{Slot: slot, Question: question})
+	}
+	return result, nil
+}
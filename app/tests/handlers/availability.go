@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	dashboardDB "TeacherJournal/app/dashboard/db"
+	dashboardModels "TeacherJournal/app/dashboard/models"
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// studentTestGroups returns the group links of a test, or of all tests when testID is 0,
+// that apply to a student. The student is stored separately for every teacher of the group,
+// so the groups of any of these records match; group_id IS NULL are old links by name.
+func studentTestGroups(db *gorm.DB, student dashboardModels.Student, testID int) ([]testsModels.TestGroup, error) {
+	query := db.Where(`(group_id IN (`+dashboardDB.SameNameGroupsSQL+`)
+		OR (group_id IS NULL AND group_name = (SELECT name FROM groups WHERE id = ?)))`, student.GroupID, student.GroupID)
+	if testID != 0 {
+		query = query.Where("test_id = ?", testID)
+	}
+
+	var groups []testsModels.TestGroup
+	err := query.Order("id").Find(&groups).Error
+	return groups, err
+}
+
+// groupWindow returns the schedule of a test for a group
+func groupWindow(group testsModels.TestGroup) utils.GroupWindow {
+	return utils.GroupWindow{
+		OpensAt:     group.OpensAt,
+		ClosesAt:    group.ClosesAt,
+		AccessCode:  group.AccessCode,
+		MaxAttempts: group.MaxAttempts,
+	}
+}
+
+// groupWindows returns the schedules of the given group links by test
+func groupWindows(groups []testsModels.TestGroup) map[int][]utils.GroupWindow {
+	windows := make(map[int][]utils.GroupWindow)
+	for _, group := range groups {
+		windows[group.TestID] = append(windows[group.TestID], groupWindow(group))
+	}
+	return windows
+}
+
+// syncTestGroups links a test to exactly the given groups. Links to groups that stay
+// keep their schedule, links to removed groups are deleted. Returns the links by group name.
+func syncTestGroups(tx *gorm.DB, creatorID, testID int, groupNames []string) (map[string]*testsModels.TestGroup, error) {
+	var existing []testsModels.TestGroup
+	if err := tx.Where("test_id = ?", testID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	links := make(map[string]*testsModels.TestGroup)
+	for _, groupName := range groupNames {
+		groupName = strings.TrimSpace(groupName)
+		if groupName == "" || links[groupName] != nil {
+			continue
+		}
+
+		var link *testsModels.TestGroup
+		for i := range existing {
+			if existing[i].GroupName == groupName {
+				link = &existing[i]
+				break
+			}
+		}
+		if link == nil {
+			created := newTestGroup(tx, creatorID, testID, groupName)
+			if err := tx.Create(&created).Error; err != nil {
+				return nil, err
+			}
+			link = &created
+		}
+		links[groupName] = link
+	}
+
+	for _, group := range existing {
+		if links[group.GroupName] == nil || links[group.GroupName].ID != group.ID {
+			if err := tx.Delete(&testsModels.TestGroup{}, group.ID).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	dashboardUtils "TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// BankHandler handles question banks and the rules that draw tests from them
+type BankHandler struct {
+	DB *gorm.DB
+}
+
+// NewBankHandler creates a new BankHandler
+func NewBankHandler(database *gorm.DB) *BankHandler {
+	return &BankHandler{
+		DB: database,
+	}
+}
+
+// validDifficulty reports whether a difficulty level is known
+func validDifficulty(difficulty string) bool {
+	switch difficulty {
+	case models.DifficultyEasy, models.DifficultyMedium, models.DifficultyHard:
+		return true
+	}
+	return false
+}
+
+// CreateBankRequest defines the request body for creating or updating a question bank
+type CreateBankRequest struct {
+	Title       string `json:"title"`
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+}
+
+// BankQuestionRequest defines the request body for adding or updating a bank question
+type BankQuestionRequest struct {
+	QuestionText string                `json:"question_text"`
+	QuestionType string                `json:"question_type"`
+	Points       float64               `json:"points"` // Question weight, 1 by default
+	Difficulty   string                `json:"difficulty"`
+	Tags         []string              `json:"tags"`
+	Answers      []CreateAnswerRequest `json:"answers"`
+}
+
+// TestRuleRequest defines one rule drawing questions from a bank,
+// e.g. {"bank_id": 1, "count": 5, "difficulty": "easy", "tags": ["sql"]}
+type TestRuleRequest struct {
+	BankID     int      `json:"bank_id"`
+	Count      int      `json:"count"`
+	Difficulty string   `json:"difficulty"`
+	Tags       []string `json:"tags"`
+}
+
+// loadBank loads the bank from the URL and checks the user may change it
+func (h *BankHandler) loadBank(w http.ResponseWriter, r *http.Request, userID int, idVar string) (models.QuestionBank, bool) {
+	var bank models.QuestionBank
+
+	vars := mux.Vars(r)
+	bankID, err := strconv.Atoi(vars[idVar])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid bank ID")
+		return bank, false
+	}
+
+	if err := h.DB.First(&bank, bankID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Question bank not found")
+		return bank, false
+	}
+
+	// Check if the user is the creator of the bank or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if bank.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to access this question bank")
+		return bank, false
+	}
+
+	return bank, true
+}
+
+// CreateBank creates a new question bank
+func (h *BankHandler) CreateBank(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse request body
+	var req CreateBankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Title == "" || req.Subject == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Title and subject are required")
+		return
+	}
+
+	bank := models.QuestionBank{
+		Title:       req.Title,
+		Subject:     req.Subject,
+		Description: req.Description,
+		CreatorID:   userID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := h.DB.Create(&bank).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating question bank")
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Create Question Bank", fmt.Sprintf("Created question bank '%s' with ID %d", bank.Title, bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Question bank created successfully", map[string]interface{}{
+		"bank_id": bank.ID,
+	})
+}
+
+// GetBanks returns the question banks of the user with question counts by difficulty
+func (h *BankHandler) GetBanks(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := `
+		SELECT
+			b.id, b.title, b.subject, b.description, b.created_at,
+			COUNT(q.id) as questions_count,
+			SUM(CASE WHEN q.difficulty = 'easy' THEN 1 ELSE 0 END) as easy_count,
+			SUM(CASE WHEN q.difficulty = 'medium' THEN 1 ELSE 0 END) as medium_count,
+			SUM(CASE WHEN q.difficulty = 'hard' THEN 1 ELSE 0 END) as hard_count
+		FROM question_banks b
+		LEFT JOIN questions q ON q.bank_id = b.id
+		WHERE b.creator_id = ?
+	`
+	args := []interface{}{userID}
+	if subject := r.URL.Query().Get("subject"); subject != "" {
+		query += " AND b.subject = ?"
+		args = append(args, subject)
+	}
+	query += " GROUP BY b.id ORDER BY b.subject, b.title"
+
+	var banks []struct {
+		ID             int       `json:"id"`
+		Title          string    `json:"title"`
+		Subject        string    `json:"subject"`
+		Description    string    `json:"description"`
+		CreatedAt      time.Time `json:"created_at"`
+		QuestionsCount int       `json:"questions_count"`
+		EasyCount      int       `json:"easy_count"`
+		MediumCount    int       `json:"medium_count"`
+		HardCount      int       `json:"hard_count"`
+	}
+	if err := h.DB.Raw(query, args...).Scan(&banks).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving question banks")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Question banks retrieved successfully", banks)
+}
+
+// GetBank returns a bank with its questions, optionally filtered by ?difficulty= and ?tag=
+func (h *BankHandler) GetBank(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "id")
+	if !ok {
+		return
+	}
+
+	query := h.DB.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("bank_id = ?", bank.ID)
+	if difficulty := r.URL.Query().Get("difficulty"); difficulty != "" {
+		query = query.Where("difficulty = ?", difficulty)
+	}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		query = query.Where("? = ANY(tags)", strings.ToLower(strings.TrimSpace(tag)))
+	}
+
+	var questions []models.Question
+	if err := query.Order("id").Find(&questions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving questions")
+		return
+	}
+
+	// Collect the tags used in the bank for rule editing
+	var tags []string
+	h.DB.Raw("SELECT DISTINCT unnest(tags) AS tag FROM questions WHERE bank_id = ? ORDER BY tag", bank.ID).Pluck("tag", &tags)
+
+	bank.Questions = questions
+	utils.RespondWithSuccess(w, http.StatusOK, "Question bank retrieved successfully", map[string]interface{}{
+		"bank": bank,
+		"tags": tags,
+	})
+}
+
+// UpdateBank updates the title, subject or description of a bank
+func (h *BankHandler) UpdateBank(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "id")
+	if !ok {
+		return
+	}
+
+	// Parse request body
+	var req CreateBankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Title != "" {
+		updates["title"] = req.Title
+	}
+	if req.Subject != "" {
+		updates["subject"] = req.Subject
+	}
+	if req.Description != "" {
+		updates["description"] = req.Description
+	}
+	if len(updates) > 0 {
+		updates["updated_at"] = time.Now()
+		if err := h.DB.Model(&bank).Updates(updates).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error updating question bank")
+			return
+		}
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Update Question Bank", fmt.Sprintf("Updated question bank ID %d", bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Question bank updated successfully", nil)
+}
+
+// DeleteBank deletes a bank and its questions. Banks used by test rules can't be deleted.
+func (h *BankHandler) DeleteBank(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "id")
+	if !ok {
+		return
+	}
+
+	var ruleCount int64
+	h.DB.Model(&models.TestRule{}).Where("bank_id = ?", bank.ID).Count(&ruleCount)
+	if ruleCount > 0 {
+		utils.RespondWithError(w, http.StatusConflict, "Question bank is used by tests")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		questionIDs := tx.Model(&models.Question{}).Select("id").Where("bank_id = ?", bank.ID)
+		if err := tx.Where("question_id IN (?)", questionIDs).Delete(&models.StudentResponse{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id IN (?)", questionIDs).Delete(&models.AttemptQuestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id IN (?)", questionIDs).Delete(&models.Answer{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bank_id = ?", bank.ID).Delete(&models.Question{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&bank).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting question bank: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Delete Question Bank", fmt.Sprintf("Deleted question bank '%s' with ID %d", bank.Title, bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Question bank deleted successfully", nil)
+}
+
+// AddBankQuestion adds a question with answers to a bank
+func (h *BankHandler) AddBankQuestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "id")
+	if !ok {
+		return
+	}
+
+	// Parse request body
+	var req BankQuestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.QuestionText == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Question text is required")
+		return
+	}
+	if req.QuestionType == "" {
+		req.QuestionType = models.QuestionMultipleChoice // Default
+	}
+	if req.Difficulty == "" {
+		req.Difficulty = models.DifficultyMedium
+	}
+	if !validDifficulty(req.Difficulty) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Difficulty must be easy, medium or hard")
+		return
+	}
+
+	// The answers must fit the question type
+	answers := buildAnswers(req.QuestionType, req.Answers)
+	if err := validateQuestion(req.QuestionType, questionWeight(req.Points), answers); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question: "+err.Error())
+		return
+	}
+
+	var questionID int
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		question := models.Question{
+			BankID:       &bank.ID,
+			QuestionText: req.QuestionText,
+			QuestionType: req.QuestionType,
+			Points:       questionWeight(req.Points),
+			Difficulty:   req.Difficulty,
+			Tags:         pq.StringArray(utils.NormalizeTags(req.Tags)),
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		if err := tx.Create(&question).Error; err != nil {
+			return err
+		}
+		questionID = question.ID
+
+		return createAnswers(tx, question.ID, answers)
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error adding question: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Add Bank Question", fmt.Sprintf("Added question to question bank ID %d", bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Question added successfully", map[string]interface{}{
+		"question_id": questionID,
+	})
+}
+
+// UpdateBankQuestion updates a bank question. Answers, when given, replace the existing ones.
+func (h *BankHandler) UpdateBankQuestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "bank_id")
+	if !ok {
+		return
+	}
+
+	questionID, err := strconv.Atoi(mux.Vars(r)["question_id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question ID")
+		return
+	}
+
+	var question models.Question
+	if err := h.DB.Where("id = ? AND bank_id = ?", questionID, bank.ID).First(&question).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Question not found in this bank")
+		return
+	}
+
+	// Parse request body
+	var req BankQuestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Difficulty != "" && !validDifficulty(req.Difficulty) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Difficulty must be easy, medium or hard")
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.QuestionText != "" {
+		updates["question_text"] = req.QuestionText
+	}
+	if req.QuestionType != "" {
+		updates["question_type"] = req.QuestionType
+	}
+	if req.Points != 0 {
+		updates["points"] = req.Points
+	}
+	if req.Difficulty != "" {
+		updates["difficulty"] = req.Difficulty
+	}
+	if req.Tags != nil {
+		updates["tags"] = pq.StringArray(utils.NormalizeTags(req.Tags))
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			updates["updated_at"] = time.Now()
+			if err := tx.Model(&question).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if req.Answers != nil {
+			if err := tx.Where("question_id = ?", question.ID).Delete(&models.Answer{}).Error; err != nil {
+				return err
+			}
+			questionType := req.QuestionType
+			if questionType == "" {
+				questionType = question.QuestionType
+			}
+			if err := createAnswers(tx, question.ID, buildAnswers(questionType, req.Answers)); err != nil {
+				return err
+			}
+		}
+
+		// The updated question must still be scorable
+		return validateStoredQuestion(tx, question.ID)
+	})
+	if errors.Is(err, errInvalidQuestion) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question: "+err.Error())
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating question: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Update Bank Question", fmt.Sprintf("Updated question ID %d in question bank ID %d", question.ID, bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Question updated successfully", nil)
+}
+
+// DeleteBankQuestion deletes a question from a bank
+func (h *BankHandler) DeleteBankQuestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	bank, ok := h.loadBank(w, r, userID, "bank_id")
+	if !ok {
+		return
+	}
+
+	questionID, err := strconv.Atoi(mux.Vars(r)["question_id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid question ID")
+		return
+	}
+
+	var question models.Question
+	if err := h.DB.Where("id = ? AND bank_id = ?", questionID, bank.ID).First(&question).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Question not found in this bank")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("question_id = ?", question.ID).Delete(&models.StudentResponse{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id = ?", question.ID).Delete(&models.AttemptQuestion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("question_id = ?", question.ID).Delete(&models.Answer{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&question).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting question: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Delete Bank Question", fmt.Sprintf("Deleted question ID %d from question bank ID %d", question.ID, bank.ID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Question deleted successfully", nil)
+}
+
+// errInvalidRule is returned for rules referring to foreign banks or impossible draws
+var errInvalidRule = errors.New("invalid rule")
+
+// buildRules validates rule requests for a test owned by creatorID and converts them to models.
+// Each rule must refer to a bank of the creator that has enough matching questions.
+func buildRules(tx *gorm.DB, creatorID int, isAdmin bool, testID int, requests []TestRuleRequest) ([]models.TestRule, error) {
+	rules := make([]models.TestRule, 0, len(requests))
+	for i, req := range requests {
+		if req.Count <= 0 {
+			return nil, fmt.Errorf("%w: rule %d must draw at least one question", errInvalidRule, i+1)
+		}
+		if req.Difficulty != "" && !validDifficulty(req.Difficulty) {
+			return nil, fmt.Errorf("%w: rule %d has unknown difficulty %q", errInvalidRule, i+1, req.Difficulty)
+		}
+
+		var bank models.QuestionBank
+		if err := tx.First(&bank, req.BankID).Error; err != nil {
+			return nil, fmt.Errorf("%w: question bank %d not found", errInvalidRule, req.BankID)
+		}
+		if bank.CreatorID != creatorID && !isAdmin {
+			return nil, fmt.Errorf("%w: question bank %d belongs to another teacher", errInvalidRule, req.BankID)
+		}
+
+		rule := models.TestRule{
+			TestID:     testID,
+			BankID:     req.BankID,
+			Count:      req.Count,
+			Difficulty: req.Difficulty,
+			Tags:       pq.StringArray(utils.NormalizeTags(req.Tags)),
+			Position:   i + 1,
+		}
+
+		var available int64
+		if err := ruleQuery(tx, rule).Count(&available).Error; err != nil {
+			return nil, err
+		}
+		if int(available) < rule.Count {
+			return nil, fmt.Errorf("%w: rule %d needs %d questions, bank '%s' has %d matching", errInvalidRule, i+1, rule.Count, bank.Title, available)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// replaceRules stores the rules of a test instead of the existing ones
+func replaceRules(tx *gorm.DB, testID int, rules []models.TestRule) error {
+	if err := tx.Where("test_id = ?", testID).Delete(&models.TestRule{}).Error; err != nil {
+		return err
+	}
+	for i := range rules {
+		rules[i].TestID = testID
+		if err := tx.Create(&rules[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	dashboardDB "TeacherJournal/app/dashboard/db"
+	dashboardModels "TeacherJournal/app/dashboard/models"
+	dashboardUtils "TeacherJournal/app/dashboard/utils"
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// syncTestGrade writes the lab grade linked to the test of an attempt. The grade is
+// recomputed from all completed attempts of the student, so running it again changes nothing.
+func syncTestGrade(database *gorm.DB, attemptID int) error {
+	var attempt testsModels.TestAttempt
+	if err := database.Select("id, test_id, student_id").First(&attempt, attemptID).Error; err != nil {
+		return err
+	}
+
+	var link testsModels.TestGradeLink
+	if err := database.Where("test_id = ?", attempt.TestID).First(&link).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var test testsModels.Test
+	if err := database.Select("id, creator_id").First(&test, attempt.TestID).Error; err != nil {
+		return err
+	}
+
+	var student dashboardModels.Student
+	if err := database.First(&student, attempt.StudentID).Error; err != nil {
+		return err
+	}
+	return syncStudentGrade(database, link, test.CreatorID, student)
+}
+
+// errLabGradeKept is returned when the lab already has a grade entered by hand or
+// written by another test; such grades are never overwritten
+var errLabGradeKept = errors.New("lab grade not written by this test is kept")
+
+// syncStudentGrade writes the lab grade of one student. The student is stored separately
+// for every teacher, so the grade goes to the record of the test creator while attempts
+// made under any record of the student count. Only grades written by the test itself are
+// updated; otherwise errLabGradeKept is returned.
+func syncStudentGrade(database *gorm.DB, link testsModels.TestGradeLink, creatorID int, student dashboardModels.Student) error {
+	var target dashboardModels.Student
+	if err := database.Where("teacher_id = ? AND student_fio = ? AND group_id IN ("+dashboardDB.SameNameGroupsSQL+")",
+		creatorID, student.StudentFIO, student.GroupID).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // The teacher does not grade this student
+		}
+		return err
+	}
+
+	// Attempts still waiting for review are left out until graded
+	var percents []float64
+	if err := database.Raw(`
+		SELECT CASE WHEN ta.max_score > 0 THEN ta.score * 100.0 / ta.max_score ELSE 0 END
+		FROM test_attempts ta
+		WHERE ta.test_id = ? AND ta.completed = true AND NOT `+pendingReviewSQL+`
+			AND ta.student_id IN (`+dashboardDB.StudentRecordsSQL+`)
+		ORDER BY ta.end_time, ta.id
+	`, link.TestID, student.StudentFIO, student.GroupID).Scan(&percents).Error; err != nil {
+		return err
+	}
+
+	percent, ok := utils.PolicyPercent(link.Policy, percents)
+	if !ok {
+		return nil
+	}
+	grade := dashboardUtils.FinalMark(percent)
+
+	var labGrade dashboardModels.LabGrade
+	err := database.Where("student_id = ? AND subject = ? AND lab_number = ?", target.ID, link.Subject, link.LabNumber).
+		First(&labGrade).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return database.Create(&dashboardModels.LabGrade{
+			StudentID: target.ID,
+			TeacherID: creatorID,
+			Subject:   link.Subject,
+			LabNumber: link.LabNumber,
+			Grade:     grade,
+			TestID:    &link.TestID,
+		}).Error
+	case err != nil:
+		return err
+	}
+	if labGrade.TestID == nil || *labGrade.TestID != link.TestID {
+		return fmt.Errorf("%w: %s, lab %d of %s", errLabGradeKept, target.StudentFIO, link.LabNumber, link.Subject)
+	}
+	return database.Model(&labGrade).Update("grade", grade).Error
+}
+
+// syncLinkGrades writes the lab grades of every student who completed the test and
+// returns the students whose existing grades were kept
+func syncLinkGrades(database *gorm.DB, link testsModels.TestGradeLink, creatorID int) ([]string, error) {
+	var students []dashboardModels.Student
+	if err := database.Raw(`
+		SELECT DISTINCT ON (s.student_fio, g.name) s.*
+		FROM students s
+		JOIN groups g ON g.id = s.group_id
+		JOIN test_attempts ta ON ta.student_id = s.id
+		WHERE ta.test_id = ? AND ta.completed = true
+		ORDER BY s.student_fio, g.name, s.id
+	`, link.TestID).Scan(&students).Error; err != nil {
+		return nil, err
+	}
+
+	kept := []string{}
+	for _, student := range students {
+		err := syncStudentGrade(database, link, creatorID, student)
+		if errors.Is(err, errLabGradeKept) {
+			kept = append(kept, student.StudentFIO)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// gradeLinkResult is a test link together with the students whose grades it did not overwrite
+type gradeLinkResult struct {
+	testsModels.TestGradeLink
+	KeptGrades []string `json:"kept_grades"`
+}
+
+// GradeLinkRequest defines the request body for linking a test to a lab
+type GradeLinkRequest struct {
+	Subject   string `json:"subject"` // The test's subject when empty
+	LabNumber int    `json:"lab_number"`
+	Policy    string `json:"policy"` // best (default) or last
+}
+
+// SetGradeLink links a test to a lab number and writes the grades of attempts completed so far
+func (h *AdminHandler) SetGradeLink(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	// Check if test exists and belongs to the user
+	var test testsModels.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to modify this test")
+		return
+	}
+
+	// Parse request body
+	var req GradeLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" {
+		req.Subject = test.Subject
+	}
+	if req.Policy == "" {
+		req.Policy = utils.GradePolicyBest
+	}
+	if req.LabNumber < 1 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Lab number must be at least 1")
+		return
+	}
+	if !utils.KnownGradePolicy(req.Policy) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Policy must be best or last")
+		return
+	}
+
+	var link testsModels.TestGradeLink
+	var kept []string
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Another test already writing this lab would overwrite the same grades
+		var taken int64
+		if err := tx.Model(&testsModels.TestGradeLink{}).
+			Joins("JOIN tests t ON t.id = test_grade_links.test_id").
+			Where("t.creator_id = ? AND test_grade_links.subject = ? AND test_grade_links.lab_number = ? AND test_grade_links.test_id <> ?",
+				test.CreatorID, req.Subject, req.LabNumber, testID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errGradeLinkTaken
+		}
+
+		if err := tx.Where(testsModels.TestGradeLink{TestID: testID}).
+			Assign(map[string]interface{}{
+				"subject":    req.Subject,
+				"lab_number": req.LabNumber,
+				"policy":     req.Policy,
+				"updated_at": time.Now(),
+			}).
+			FirstOrCreate(&link).Error; err != nil {
+			return err
+		}
+		kept, err = syncLinkGrades(tx, link, test.CreatorID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errGradeLinkTaken) {
+			utils.RespondWithError(w, http.StatusConflict, err.Error())
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error linking test to lab: "+err.Error())
+		}
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Link Test Grade",
+		fmt.Sprintf("Linked test ID %d to lab %d of %s (%s attempt)", testID, req.LabNumber, req.Subject, req.Policy))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Test linked to lab successfully", gradeLinkResult{
+		TestGradeLink: link,
+		KeptGrades:    kept,
+	})
+}
+
+// errGradeLinkTaken is returned when another test of the teacher already writes the lab
+var errGradeLinkTaken = errors.New("another test is already linked to this lab")
+
+// DeleteGradeLink unlinks a test from its lab. Grades already written stay as grades entered by hand.
+func (h *AdminHandler) DeleteGradeLink(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get test ID from URL
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	// Check if test exists and belongs to the user
+	var test testsModels.Test
+	if err := h.DB.First(&test, testID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to modify this test")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&dashboardModels.LabGrade{}).Where("test_id = ?", testID).
+			Update("test_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("test_id = ?", testID).Delete(&testsModels.TestGradeLink{}).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error unlinking test: "+err.Error())
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Unlink Test Grade", fmt.Sprintf("Unlinked test ID %d from its lab", testID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Test unlinked from lab successfully", nil)
+}
+
+// logGradeSync writes the lab grade of a finished attempt; a failure must not undo the attempt
+func logGradeSync(database *gorm.DB, attemptID int) {
+	err := syncTestGrade(database, attemptID)
+	switch {
+	case errors.Is(err, errLabGradeKept):
+		log.Printf("Lab grade for attempt %d not written: %v", attemptID, err)
+	case err != nil:
+		log.Printf("Error writing lab grade for attempt %d: %v", attemptID, err)
+	}
+}
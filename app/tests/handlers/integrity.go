@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"TeacherJournal/app/tests/integrity"
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"TeacherJournal/app/tests/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxEventsPerRequest limits how many client events one request may record
+const maxEventsPerRequest = 100
+
+// maxEventDetails limits the stored length of event details
+const maxEventDetails = 500
+
+// AttemptEventRequest is one client-side event of an attempt
+type AttemptEventRequest struct {
+	Type       string    `json:"type"` // focus_lost or paste
+	QuestionID *int      `json:"question_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Details    string    `json:"details"`
+}
+
+// RecordEventsRequest defines the request body for recording client events
+type RecordEventsRequest struct {
+	Events []AttemptEventRequest `json:"events"`
+}
+
+// RecordEvents records focus loss and paste events sent by the test page
+func (h *TestHandler) RecordEvents(w http.ResponseWriter, r *http.Request) {
+	// Verify the attempt belongs to the student
+	attempt, ok := h.loadStudentAttempt(w, r)
+	if !ok {
+		return
+	}
+
+	if attempt.Completed {
+		utils.RespondWithError(w, http.StatusBadRequest, "Test attempt is already completed")
+		return
+	}
+
+	// Parse request body
+	var req RecordEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(req.Events) > maxEventsPerRequest {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d events can be sent at once", maxEventsPerRequest))
+		return
+	}
+
+	now := time.Now()
+	events := make([]testsModels.AttemptEvent, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !integrity.KnownEvent(event.Type) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Unknown event type: "+event.Type)
+			return
+		}
+
+		// The client clock is not trusted beyond the attempt itself
+		occurredAt := event.OccurredAt
+		if occurredAt.IsZero() || occurredAt.After(now) || occurredAt.Before(attempt.StartTime) {
+			occurredAt = now
+		}
+
+		details := []rune(event.Details)
+		if len(details) > maxEventDetails {
+			details = details[:maxEventDetails]
+		}
+
+		events = append(events, testsModels.AttemptEvent{
+			AttemptID:  attempt.ID,
+			QuestionID: event.QuestionID,
+			EventType:  event.Type,
+			Details:    string(details),
+			OccurredAt: occurredAt,
+			CreatedAt:  now,
+		})
+	}
+
+	if len(events) > 0 {
+		if err := h.DB.Create(&events).Error; err != nil {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error recording events")
+			return
+		}
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Events recorded successfully", map[string]interface{}{
+		"recorded": len(events),
+	})
+}
+
+// IntegrityReport is an attempt with cheating signals, as shown to the teacher
+type IntegrityReport struct {
+	integrity.Report
+	StudentID   int       `json:"student_id"`
+	StudentName string    `json:"student_name"`
+	GroupName   string    `json:"group_name"`
+	IPAddress   string    `json:"ip_address"`
+	UserAgent   string    `json:"user_agent"`
+	StartTime   time.Time `json:"start_time"`
+}
+
+// integrityReports checks all attempts of a test and returns those with at least one flag
+func integrityReports(db *gorm.DB, testID int) ([]IntegrityReport, error) {
+	var rows []struct {
+		ID          int
+		StudentID   int
+		StartTime   time.Time
+		EndTime     *time.Time
+		IPAddress   string
+		UserAgent   string
+		StudentName string
+		GroupName   string
+	}
+	if err := db.Raw(`
+		SELECT ta.id, ta.student_id, ta.start_time, ta.end_time, ta.ip_address, ta.user_agent,
+			s.student_fio as student_name, s.group_name
+		FROM test_attempts ta
+		JOIN students s ON s.id = ta.student_id
+		WHERE ta.test_id = ?
+		ORDER BY ta.start_time, ta.id
+	`, testID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	reports := []IntegrityReport{}
+	if len(rows) == 0 {
+		return reports, nil
+	}
+
+	attemptIDs := make([]int, len(rows))
+	for i, row := range rows {
+		attemptIDs[i] = row.ID
+	}
+
+	var responses []struct {
+		AttemptID    int
+		QuestionID   int
+		QuestionType string
+		AnswerID     *int
+		Data         testsModels.ResponseAnswer `gorm:"column:answer_data"`
+		IsCorrect    bool
+		TimeSpent    int
+	}
+	if err := db.Raw(`
+		SELECT sr.attempt_id, sr.question_id, q.question_type, sr.answer_id, sr.answer_data, sr.is_correct, sr.time_spent
+		FROM student_responses sr
+		JOIN questions q ON q.id = sr.question_id
+		WHERE sr.attempt_id IN ? AND sr.late = false
+	`, attemptIDs).Scan(&responses).Error; err != nil {
+		return nil, err
+	}
+
+	var events []struct {
+		AttemptID int
+		EventType string
+		Count     int
+	}
+	if err := db.Raw(`
+		SELECT attempt_id, event_type, COUNT(*) as count
+		FROM attempt_events
+		WHERE attempt_id IN ?
+		GROUP BY attempt_id, event_type
+	`, attemptIDs).Scan(&events).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*integrity.Attempt, len(rows))
+	attempts := make([]integrity.Attempt, len(rows))
+	for i, row := range rows {
+		attempts[i] = integrity.Attempt{
+			ID:        row.ID,
+			StudentID: row.StudentID,
+			Group:     row.GroupName,
+			IP:        row.IPAddress,
+			Start:     row.StartTime,
+			End:       row.EndTime,
+		}
+		byID[row.ID] = &attempts[i]
+	}
+	for _, response := range responses {
+		attempt := byID[response.AttemptID]
+		attempt.Responses = append(attempt.Responses, integrity.Response{
+			QuestionID: response.QuestionID,
+			Signature:  integrity.Signature(response.Data, response.AnswerID),
+			Correct:    response.IsCorrect,
+			TimeSpent:  response.TimeSpent,
+			Timed:      !scoring.NeedsReview(response.QuestionType),
+		})
+	}
+	for _, event := range events {
+		switch event.EventType {
+		case integrity.EventFocusLost:
+			byID[event.AttemptID].FocusLost = event.Count
+		case integrity.EventPaste:
+			byID[event.AttemptID].Pastes = event.Count
+		}
+	}
+
+	for i, report := range integrity.Analyze(attempts, time.Now()) {
+		if len(report.Flags) == 0 {
+			continue
+		}
+		row := rows[i]
+		reports = append(reports, IntegrityReport{
+			Report:      report,
+			StudentID:   row.StudentID,
+			StudentName: row.StudentName,
+			GroupName:   row.GroupName,
+			IPAddress:   row.IPAddress,
+			UserAgent:   row.UserAgent,
+			StartTime:   row.StartTime,
+		})
+	}
+	return reports, nil
+}
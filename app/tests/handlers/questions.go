@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errInvalidQuestion is returned when a question cannot be scored with its answers
+var errInvalidQuestion = errors.New("invalid question")
+
+// questionWeight returns the requested question points, one point by default
+func questionWeight(points float64) float64 {
+	if points == 0 {
+		return 1
+	}
+	return points
+}
+
+// buildAnswers converts answer requests into the answers of a question.
+// Ordering items without positions keep the request order as the correct one;
+// every value of numeric and fill in the blank questions is an accepted answer.
+func buildAnswers(questionType string, reqs []CreateAnswerRequest) []testsModels.Answer {
+	now := time.Now()
+	answers := make([]testsModels.Answer, 0, len(reqs))
+	for i, a := range reqs {
+		answer := testsModels.Answer{
+			AnswerText: a.AnswerText,
+			IsCorrect:  a.IsCorrect || scoring.AllAnswersAccepted(questionType),
+			MatchText:  a.MatchText,
+			Tolerance:  a.Tolerance,
+			Position:   a.Position,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if questionType == testsModels.QuestionOrdering && answer.Position == 0 {
+			answer.Position = i + 1
+		}
+		answers = append(answers, answer)
+	}
+	return answers
+}
+
+// validateQuestion checks a new question before it is saved
+func validateQuestion(questionType string, points float64, answers []testsModels.Answer) error {
+	question := testsModels.Question{QuestionType: questionType, Points: points, Answers: answers}
+	if err := scoring.Validate(question); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidQuestion, err)
+	}
+	return nil
+}
+
+// validateStoredQuestion checks a question after a partial update inside a transaction
+func validateStoredQuestion(tx *gorm.DB, questionID int) error {
+	var question testsModels.Question
+	if err := tx.Preload("Answers").Where("id = ?", questionID).First(&question).Error; err != nil {
+		return err
+	}
+	return validateQuestion(question.QuestionType, question.Points, question.Answers)
+}
+
+// createAnswers saves the answers of a new question
+func createAnswers(tx *gorm.DB, questionID int, answers []testsModels.Answer) error {
+	for _, answer := range answers {
+		answer.QuestionID = questionID
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	dashboardUtils "TeacherJournal/app/dashboard/utils"
+	"TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ReviewHandler handles the teacher review queue of free text answers
+type ReviewHandler struct {
+	DB *gorm.DB
+}
+
+// NewReviewHandler creates a new ReviewHandler
+func NewReviewHandler(database *gorm.DB) *ReviewHandler {
+	return &ReviewHandler{
+		DB: database,
+	}
+}
+
+// ReviewItem is a free text response in the review queue
+type ReviewItem struct {
+	ResponseID    int        `json:"response_id"`
+	AttemptID     int        `json:"attempt_id"`
+	TestID        int        `json:"test_id"`
+	TestTitle     string     `json:"test_title"`
+	QuestionID    int        `json:"question_id"`
+	QuestionText  string     `json:"question_text"`
+	ModelAnswer   string     `json:"model_answer"` // Correct answers entered by the teacher, if any
+	StudentID     int        `json:"student_id"`
+	StudentName   string     `json:"student_name"`
+	GroupName     string     `json:"group_name"`
+	TextAnswer    string     `json:"text_answer"`
+	Points        float64    `json:"points"`
+	MaxPoints     float64    `json:"max_points"`
+	ReviewComment string     `json:"review_comment"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	SubmittedAt   time.Time  `json:"submitted_at"`
+}
+
+// GetReviewQueue lists free text responses of the teacher's tests.
+// Query parameters: status (pending - default, reviewed, all), test_id, attempt_id.
+func (h *ReviewHandler) GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+
+	conditions := []string{"sr.needs_review = true"}
+	var args []interface{}
+
+	switch r.URL.Query().Get("status") {
+	case "", "pending":
+		conditions = append(conditions, "sr.reviewed_at IS NULL")
+	case "reviewed":
+		conditions = append(conditions, "sr.reviewed_at IS NOT NULL")
+	case "all":
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Status must be pending, reviewed or all")
+		return
+	}
+
+	// Teachers see only their own tests
+	if userRole != "admin" {
+		conditions = append(conditions, "t.creator_id = ?")
+		args = append(args, userID)
+	}
+
+	if value := r.URL.Query().Get("test_id"); value != "" {
+		testID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid test ID")
+			return
+		}
+		conditions = append(conditions, "ta.test_id = ?")
+		args = append(args, testID)
+	}
+	if value := r.URL.Query().Get("attempt_id"); value != "" {
+		attemptID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+			return
+		}
+		conditions = append(conditions, "ta.id = ?")
+		args = append(args, attemptID)
+	}
+
+	var items []ReviewItem
+	if err := h.DB.Raw(`
+		SELECT
+			sr.id as response_id,
+			ta.id as attempt_id,
+			t.id as test_id,
+			t.title as test_title,
+			q.id as question_id,
+			q.question_text,
+			COALESCE((SELECT STRING_AGG(a.answer_text, ' / ' ORDER BY a.id) FROM answers a
+				WHERE a.question_id = q.id AND a.is_correct = true), '') as model_answer,
+			s.id as student_id,
+			s.student_fio as student_name,
+			s.group_name,
+			sr.text_answer,
+			sr.points,
+			sr.max_points,
+			sr.review_comment,
+			sr.reviewed_at,
+			sr.submitted_at
+		FROM student_responses sr
+		JOIN test_attempts ta ON ta.id = sr.attempt_id
+		JOIN tests t ON t.id = ta.test_id
+		JOIN questions q ON q.id = sr.question_id
+		JOIN students s ON s.id = ta.student_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY sr.submitted_at, sr.id
+	`, args...).Scan(&items).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving review queue")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Review queue retrieved successfully", items)
+}
+
+// GradeResponseRequest defines the request body for grading a free text response
+type GradeResponseRequest struct {
+	Points  float64 `json:"points"`
+	Comment string  `json:"comment"`
+}
+
+// GradeResponse sets the points and comment of a free text response and re-scores its attempt.
+// A graded response may be graded again.
+func (h *ReviewHandler) GradeResponse(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := dashboardUtils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get response ID from URL
+	vars := mux.Vars(r)
+	responseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid response ID")
+		return
+	}
+
+	var response models.StudentResponse
+	if err := h.DB.Where("id = ? AND needs_review = true", responseID).First(&response).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Response not found in the review queue")
+		return
+	}
+
+	var attempt models.TestAttempt
+	if err := h.DB.First(&attempt, response.AttemptID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test attempt not found")
+		return
+	}
+
+	var test models.Test
+	if err := h.DB.First(&test, attempt.TestID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Check if the user is the creator of the test or an admin
+	userRole, _ := dashboardUtils.GetUserRoleFromContext(r.Context())
+	if test.CreatorID != userID && userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to grade this response")
+		return
+	}
+
+	// Parse request body
+	var req GradeResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Points < 0 || req.Points > response.MaxPoints {
+		utils.RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Points must be between 0 and %g", response.MaxPoints))
+		return
+	}
+
+	now := time.Now()
+	var keptGrade interface{}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&response).Updates(map[string]interface{}{
+			"points":         req.Points,
+			"is_correct":     req.Points >= response.MaxPoints,
+			"review_comment": strings.TrimSpace(req.Comment),
+			"reviewed_at":    now,
+			"reviewer_id":    userID,
+		}).Error; err != nil {
+			return err
+		}
+		err := rescoreAttempt(tx, attempt.ID)
+		if errors.Is(err, errLabGradeKept) {
+			keptGrade = err.Error()
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving grade: "+err.Error())
+		return
+	}
+
+	// Report whether the attempt still has answers to grade
+	var pending int64
+	h.DB.Model(&models.StudentResponse{}).
+		Where("attempt_id = ? AND needs_review = true AND reviewed_at IS NULL", attempt.ID).
+		Count(&pending)
+
+	if err := h.DB.First(&attempt, attempt.ID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving test attempt")
+		return
+	}
+
+	// Log the action
+	dashboardUtils.LogAction(h.DB, userID, "Grade Test Response",
+		fmt.Sprintf("Graded response ID %d in attempt ID %d with %g of %g points", response.ID, attempt.ID, req.Points, response.MaxPoints))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Response graded successfully", map[string]interface{}{
+		"response_id":     response.ID,
+		"attempt_id":      attempt.ID,
+		"score":           attempt.Score,
+		"max_score":       attempt.MaxScore,
+		"pending_reviews": pending,
+		"lab_grade_kept":  keptGrade, // Why the linked lab grade was not updated
+	})
+}
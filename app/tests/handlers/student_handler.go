@@ -4,8 +4,9 @@ import (
 	"TeacherJournal/app/dashboard/models"
 	"TeacherJournal/app/tests/utils"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
 
 	"gorm.io/gorm"
 )
@@ -29,7 +30,10 @@ type RegisterStudentRequest struct {
 	GroupName string `json:"group_name"`
 }
 
-// RegisterStudent registers a student or updates their information
+// errStudentRegistered is returned when a student with the same name already has an email
+var errStudentRegistered = errors.New("student already registered")
+
+// RegisterStudent registers a new student; students who already registered log in instead
 func (h *StudentHandler) RegisterStudent(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req RegisterStudentRequest
@@ -45,29 +49,27 @@ func (h *StudentHandler) RegisterStudent(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Check if group exists
-	var groupCount int64
-	err := h.DB.Model(&models.Lesson{}).
-		Where("group_name = ?", req.GroupName).
-		Count(&groupCount).Error
+	var groups []models.Group
+	err := h.DB.Where("name = ? AND archived_at IS NULL", req.GroupName).
+		Find(&groups).Error
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking group: "+err.Error())
 		return
 	}
 
-	if groupCount == 0 {
+	if len(groups) == 0 {
 		utils.RespondWithError(w, http.StatusBadRequest, "Group not found")
 		return
 	}
 
-	// Handle transaction for adding/updating the student
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		// First check if this student already exists by FIO in any group
-		var existingStudents []models.Student
-		if err := tx.Where("student_fio = ?", req.FIO).Find(&existingStudents).Error; err != nil {
-			return err
-		}
+	groupIDs := make([]int, 0, len(groups))
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.ID)
+	}
 
+	// Handle transaction for adding the student
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
 		// Check if the email column exists in the students table
 		// If not, we need to create it first
 		if !tx.Migrator().HasColumn(&models.Student{}, "email") {
@@ -76,60 +78,41 @@ func (h *StudentHandler) RegisterStudent(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		// Update email using SQL directly since the Student model might not have the Email field yet
-		if len(existingStudents) > 0 {
-			if err := tx.Exec("UPDATE students SET email = ? WHERE student_fio = ?", req.Email, req.FIO).Error; err != nil {
-				return err
-			}
+		// A student who has registered in the group before must log in with their email;
+		// registering again would let anyone who knows their name take over the account
+		var registered int64
+		if err := tx.Table("students").
+			Where("student_fio = ? AND group_id IN ? AND email IS NOT NULL AND email <> ''", req.FIO, groupIDs).
+			Count(&registered).Error; err != nil {
+			return err
+		}
+		if registered > 0 {
+			return errStudentRegistered
+		}
 
-			// Check if the student is already in the requested group
-			var studentInGroup models.Student
-			result := tx.Where("student_fio = ? AND group_name = ?", req.FIO, req.GroupName).First(&studentInGroup)
-
-			if result.Error != nil {
-				// Student is not in this group yet, so add them to all teachers of this group
-				var teacherIDs []int
-				if err := tx.Model(&models.Lesson{}).
-					Where("group_name = ?", req.GroupName).
-					Distinct("teacher_id").
-					Pluck("teacher_id", &teacherIDs).Error; err != nil {
-					return err
-				}
-
-				// Add student to each teacher's group
-				for _, teacherID := range teacherIDs {
-					// Create the student with SQL to include the email field
-					if err := tx.Exec(
-						"INSERT INTO students (teacher_id, group_name, student_fio, email) VALUES (?, ?, ?, ?)",
-						teacherID, req.GroupName, req.FIO, req.Email,
-					).Error; err != nil {
-						return err
-					}
-				}
-			}
-		} else {
-			// Student doesn't exist yet, create new student entries for all teachers of this group
-			var teacherIDs []int
-			if err := tx.Model(&models.Lesson{}).
-				Where("group_name = ?", req.GroupName).
-				Distinct("teacher_id").
-				Pluck("teacher_id", &teacherIDs).Error; err != nil {
+		// Claim the roster entries the teachers added for this student in the group
+		if err := tx.Exec(
+			"UPDATE students SET email = ? WHERE student_fio = ? AND group_id IN ? AND (email IS NULL OR email = '')",
+			req.Email, req.FIO, groupIDs,
+		).Error; err != nil {
+			return err
+		}
+
+		// Add student to each teacher's group they are not in yet
+		for _, group := range groups {
+			var count int64
+			if err := tx.Table("students").Where("student_fio = ? AND group_id = ?", req.FIO, group.ID).Count(&count).Error; err != nil {
 				return err
 			}
-
-			if len(teacherIDs) == 0 {
-				return gorm.ErrRecordNotFound
+			if count > 0 {
+				continue
 			}
-
-			// Add student to each teacher's group
-			for _, teacherID := range teacherIDs {
-				// Create the student with SQL to include the email field
-				if err := tx.Exec(
-					"INSERT INTO students (teacher_id, group_name, student_fio, email) VALUES (?, ?, ?, ?)",
-					teacherID, req.GroupName, req.FIO, req.Email,
-				).Error; err != nil {
-					return err
-				}
+			// Create the student with SQL to include the email field
+			if err := tx.Exec(
+				"INSERT INTO students (teacher_id, group_id, group_name, student_fio, email) VALUES (?, ?, ?, ?, ?)",
+				group.TeacherID, group.ID, group.Name, req.FIO, req.Email,
+			).Error; err != nil {
+				return err
 			}
 		}
 
@@ -137,8 +120,8 @@ func (h *StudentHandler) RegisterStudent(w http.ResponseWriter, r *http.Request)
 	})
 
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.RespondWithError(w, http.StatusBadRequest, "No teachers found for this group")
+		if err == errStudentRegistered {
+			utils.RespondWithError(w, http.StatusConflict, "Student is already registered, log in with your email")
 		} else {
 			utils.RespondWithError(w, http.StatusInternalServerError, "Error registering student: "+err.Error())
 		}
@@ -153,15 +136,10 @@ func (h *StudentHandler) RegisterStudent(w http.ResponseWriter, r *http.Request)
 		Email      string `json:"email"`
 	}
 
-	h.DB.Raw("SELECT id, student_fio, group_name, email FROM students WHERE student_fio = ? AND group_name = ? LIMIT 1",
-		req.FIO, req.GroupName).Scan(&student)
+	h.DB.Raw("SELECT id, student_fio, group_name, email FROM students WHERE student_fio = ? AND group_id IN ? ORDER BY id LIMIT 1",
+		req.FIO, groupIDs).Scan(&student)
 
-	utils.RespondWithSuccess(w, http.StatusOK, "Student registered successfully", map[string]interface{}{
-		"student_id": student.ID,
-		"fio":        student.StudentFIO,
-		"email":      student.Email,
-		"group":      student.GroupName,
-	})
+	respondWithStudentSession(w, "Student registered successfully", student.ID, student.StudentFIO, student.Email, student.GroupName)
 }
 
 // StudentLoginRequest defines the request body for student login
@@ -194,7 +172,7 @@ func (h *StudentHandler) LoginStudent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	result := h.DB.Raw(
-		"SELECT id, student_fio, group_name, email FROM students WHERE student_fio = ? AND email = ? LIMIT 1",
+		"SELECT id, student_fio, group_name, email FROM students WHERE student_fio = ? AND email = ? ORDER BY id LIMIT 1",
 		req.FIO, req.Email,
 	).Scan(&student)
 
@@ -203,22 +181,37 @@ func (h *StudentHandler) LoginStudent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return student info
-	utils.RespondWithSuccess(w, http.StatusOK, "Student authenticated successfully", map[string]interface{}{
-		"student_id": student.ID,
-		"fio":        student.StudentFIO,
-		"email":      student.Email,
-		"group":      student.GroupName,
+	respondWithStudentSession(w, "Student authenticated successfully", student.ID, student.StudentFIO, student.Email, student.GroupName)
+}
+
+// respondWithStudentSession returns student info together with a new session token
+func respondWithStudentSession(w http.ResponseWriter, message string, studentID int, fio, email, group string) {
+	token, err := utils.GenerateStudentJWT(studentID, email)
+	if errors.Is(err, utils.ErrStudentSecretMissing) {
+		log.Println("STUDENT_JWT_SECRET is not set, student sessions are disabled")
+		utils.RespondWithError(w, http.StatusServiceUnavailable, "Student sessions are not configured")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error generating session token")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, message, map[string]interface{}{
+		"student_id": studentID,
+		"fio":        fio,
+		"email":      email,
+		"group":      group,
+		"token":      token,
 	})
 }
 
-// GetStudentInfoByID retrieves a student's information by ID
+// GetStudentInfoByID retrieves the information of the authenticated student
 func (h *StudentHandler) GetStudentInfoByID(w http.ResponseWriter, r *http.Request) {
-	// Get student ID from query params
-	studentIDStr := r.URL.Query().Get("student_id")
-	studentID, err := strconv.Atoi(studentIDStr)
-	if err != nil || studentID <= 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Valid student ID is required")
+	// Get student ID from the session
+	studentID, err := utils.GetStudentIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
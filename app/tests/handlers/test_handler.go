@@ -3,15 +3,20 @@ package handlers
 import (
 	dashboardModels "TeacherJournal/app/dashboard/models"
 	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
 	"TeacherJournal/app/tests/utils"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TestHandler handles test-taking operations for students
@@ -26,13 +31,47 @@ func NewTestHandler(database *gorm.DB) *TestHandler {
 	}
 }
 
-// GetAvailableTests retrieves tests available for a student to take
+// loadStudentAttempt loads the attempt from the URL and checks that it belongs
+// to the authenticated student. It writes the error response and returns false otherwise.
+func (h *TestHandler) loadStudentAttempt(w http.ResponseWriter, r *http.Request) (testsModels.TestAttempt, bool) {
+	var attempt testsModels.TestAttempt
+
+	// Get student ID from the session
+	studentID, err := utils.GetStudentIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return attempt, false
+	}
+
+	// Get attempt ID from URL
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["attempt_id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return attempt, false
+	}
+
+	if err := h.DB.Where("id = ?", attemptID).First(&attempt).Error; err != nil {
+		log.Printf("Error finding attempt ID %d: %v", attemptID, err)
+		utils.RespondWithError(w, http.StatusNotFound, "Attempt not found")
+		return attempt, false
+	}
+
+	if attempt.StudentID != studentID {
+		log.Printf("Student %d tried to access attempt %d of student %d", studentID, attemptID, attempt.StudentID)
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to access this attempt")
+		return attempt, false
+	}
+
+	return attempt, true
+}
+
+// GetAvailableTests retrieves tests available for the authenticated student to take
 func (h *TestHandler) GetAvailableTests(w http.ResponseWriter, r *http.Request) {
-	// Get student ID from query params
-	studentIDStr := r.URL.Query().Get("student_id")
-	studentID, err := strconv.Atoi(studentIDStr)
-	if err != nil || studentID <= 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Valid student ID is required")
+	// Get student ID from the session
+	studentID, err := utils.GetStudentIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -45,43 +84,63 @@ func (h *TestHandler) GetAvailableTests(w http.ResponseWriter, r *http.Request)
 
 	// Get all active tests, with information about attempts for this student
 	type TestInfo struct {
-		ID              int        `json:"id"`
-		Title           string     `json:"title"`
-		Description     string     `json:"description"`
-		Subject         string     `json:"subject"`
-		QuestionsCount  int        `json:"questions_count"`
-		CreatedAt       time.Time  `json:"created_at"`
-		MaxAttempts     int        `json:"max_attempts"`
-		TimePerQuestion int        `json:"time_per_question"`
-		AttemptsUsed    int        `json:"attempts_used"`
-		HighestScore    int        `json:"highest_score"`
-		LastAttemptDate *time.Time `json:"last_attempt_date"`
-		CanAttempt      bool       `json:"can_attempt"`
+		ID                 int        `json:"id"`
+		Title              string     `json:"title"`
+		Description        string     `json:"description"`
+		Subject            string     `json:"subject"`
+		QuestionsCount     int        `json:"questions_count"`
+		CreatedAt          time.Time  `json:"created_at"`
+		MaxAttempts        int        `json:"max_attempts"`
+		TimePerQuestion    int        `json:"time_per_question"`
+		TimeLimit          int        `json:"time_limit"`
+		AttemptsUsed       int        `json:"attempts_used"`
+		HighestScore       float64    `json:"highest_score"`
+		LastAttemptDate    *time.Time `json:"last_attempt_date"`
+		CanAttempt         bool       `json:"can_attempt"`
+		Availability       string     `json:"availability"` // open, scheduled or closed for the student's group
+		OpensAt            *time.Time `json:"opens_at"`
+		ClosesAt           *time.Time `json:"closes_at"`
+		RequiresAccessCode bool       `json:"requires_access_code"`
 	}
 
-	var availableTests []TestInfo
+	availableTests := []TestInfo{}
+
+	// Get the tests linked to the student's group with their schedule for the group
+	groups, err := studentTestGroups(h.DB, student, 0)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving available tests")
+		return
+	}
+	windows := groupWindows(groups)
+	if len(windows) == 0 {
+		utils.RespondWithSuccess(w, http.StatusOK, "Available tests retrieved successfully", availableTests)
+		return
+	}
+	testIDs := make([]int, 0, len(windows))
+	for testID := range windows {
+		testIDs = append(testIDs, testID)
+	}
 
-	// Get tests based on student's group - ОБНОВЛЕНО для использования связей test_groups
 	rows, err := h.DB.Raw(`SELECT 
     t.id, 
     t.title, 
     t.description, 
     t.subject, 
-    COUNT(DISTINCT q.id) as questions_count,
+    COUNT(DISTINCT q.id) + COALESCE((SELECT SUM(tr.count) FROM test_rules tr WHERE tr.test_id = t.id), 0) as questions_count,
     t.created_at,
     t.max_attempts,
     t.time_per_question,
+    t.time_limit,
     COUNT(DISTINCT ta.id) as attempts_used,
     COALESCE(MAX(ta.score), 0) as highest_score,
     MAX(ta.start_time) as last_attempt_date
 FROM tests t
 LEFT JOIN questions q ON t.id = q.test_id
 LEFT JOIN test_attempts ta ON t.id = ta.test_id AND ta.student_id = ?
-JOIN test_groups tg ON t.id = tg.test_id AND tg.group_name = ?
-WHERE t.is_active = true
+WHERE t.is_active = true AND t.id IN ?
 GROUP BY t.id
 ORDER BY t.created_at DESC
-	`, studentID, student.GroupName).Rows()
+	`, studentID, testIDs).Rows()
 
 	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving available tests")
@@ -89,6 +148,7 @@ ORDER BY t.created_at DESC
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	for rows.Next() {
 		var test TestInfo
 		var attemptDate *time.Time
@@ -102,6 +162,7 @@ ORDER BY t.created_at DESC
 			&test.CreatedAt,
 			&test.MaxAttempts,
 			&test.TimePerQuestion,
+			&test.TimeLimit,
 			&test.AttemptsUsed,
 			&test.HighestScore,
 			&attemptDate,
@@ -110,8 +171,20 @@ ORDER BY t.created_at DESC
 			return
 		}
 
+		window, _ := utils.PickWindow(windows[test.ID], test.MaxAttempts, now)
+		test.Availability = window.State(now)
+
+		// A closed test stays in the list only for students who took it
+		if test.Availability == utils.WindowClosed && test.AttemptsUsed == 0 {
+			continue
+		}
+
 		test.LastAttemptDate = attemptDate
-		test.CanAttempt = test.AttemptsUsed < test.MaxAttempts
+		test.MaxAttempts = window.AttemptLimit(test.MaxAttempts)
+		test.OpensAt = window.OpensAt
+		test.ClosesAt = window.ClosesAt
+		test.RequiresAccessCode = strings.TrimSpace(window.AccessCode) != ""
+		test.CanAttempt = test.Availability == utils.WindowOpen && test.AttemptsUsed < test.MaxAttempts
 
 		availableTests = append(availableTests, test)
 	}
@@ -119,9 +192,9 @@ ORDER BY t.created_at DESC
 	utils.RespondWithSuccess(w, http.StatusOK, "Available tests retrieved successfully", availableTests)
 }
 
-// StartTestRequest defines the request body for starting a test
+// StartTestRequest defines the optional request body for starting a test
 type StartTestRequest struct {
-	StudentID int `json:"student_id"`
+	AccessCode string `json:"access_code"` // Required when the group has an access code
 }
 
 // StartTestResponse defines the response body for starting a test
@@ -129,8 +202,18 @@ type StartTestResponse struct {
 	AttemptID int `json:"attempt_id"`
 }
 
-// StartTest starts a new test attempt for a student
+// errMaxAttempts is returned when the student has used all attempts of a test
+var errMaxAttempts = errors.New("maximum number of attempts reached")
+
+// StartTest starts a new test attempt for the authenticated student
 func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
+	// Get student ID from the session
+	studentID, err := utils.GetStudentIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
 	// Get test ID from URL
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["id"])
@@ -139,18 +222,6 @@ func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse request body
-	var req StartTestRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	if req.StudentID <= 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Valid student ID is required")
-		return
-	}
-
 	// Check if test exists and is active
 	var test testsModels.Test
 	if err := h.DB.Where("id = ? AND is_active = true", testID).First(&test).Error; err != nil {
@@ -160,40 +231,125 @@ func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
 
 	// Check if student exists
 	var student dashboardModels.Student
-	if err := h.DB.Where("id = ?", req.StudentID).First(&student).Error; err != nil {
+	if err := h.DB.Where("id = ?", studentID).First(&student).Error; err != nil {
 		utils.RespondWithError(w, http.StatusNotFound, "Student not found")
 		return
 	}
 
-	// Check if student has reached the maximum number of attempts
+	// Check that the test is open for the student's group
+	groups, err := studentTestGroups(h.DB, student, testID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error checking test availability")
+		return
+	}
+	now := time.Now()
+	window, ok := utils.PickWindow(groupWindows(groups)[testID], test.MaxAttempts, now)
+	if !ok {
+		utils.RespondWithError(w, http.StatusForbidden, "This test is not assigned to your group")
+		return
+	}
+	switch window.State(now) {
+	case utils.WindowScheduled:
+		utils.RespondWithError(w, http.StatusForbidden, "This test opens at "+window.OpensAt.Format("02.01.2006 15:04"))
+		return
+	case utils.WindowClosed:
+		utils.RespondWithError(w, http.StatusForbidden, "This test is closed for your group")
+		return
+	}
+
+	// The access code is optional in the request body
+	var req StartTestRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if !window.CheckAccessCode(req.AccessCode) {
+		utils.RespondWithError(w, http.StatusForbidden, "Invalid access code")
+		return
+	}
+
+	// Check if student has reached the maximum number of attempts for the group
+	attemptLimit := window.AttemptLimit(test.MaxAttempts)
 	var attemptCount int64
-	h.DB.Model(&testsModels.TestAttempt{}).Where("test_id = ? AND student_id = ?", testID, req.StudentID).Count(&attemptCount)
+	h.DB.Model(&testsModels.TestAttempt{}).Where("test_id = ? AND student_id = ?", testID, studentID).Count(&attemptCount)
 
-	if int(attemptCount) >= test.MaxAttempts {
+	if int(attemptCount) >= attemptLimit {
 		utils.RespondWithError(w, http.StatusForbidden, "Maximum number of attempts reached")
 		return
 	}
 
-	// Get total questions count
-	var questionCount int64
-	h.DB.Model(&testsModels.Question{}).Where("test_id = ?", testID).Count(&questionCount)
+	// Draw the questions of this attempt from the test and its question banks
+	questionIDs, err := drawQuestions(h.DB, test)
+	if err != nil {
+		if errors.Is(err, errNotEnoughQuestions) {
+			log.Printf("Cannot assemble test ID %d: %v", testID, err)
+			utils.RespondWithError(w, http.StatusBadRequest, "Not enough questions in the question bank for this test")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error assembling test questions")
+		}
+		return
+	}
 
-	if questionCount == 0 {
+	if len(questionIDs) == 0 {
 		utils.RespondWithError(w, http.StatusBadRequest, "This test has no questions")
 		return
 	}
 
-	// Create a new test attempt
+	// The attempt score is out of the summed question weights
+	totalPoints, err := maxScore(h.DB, questionIDs)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error assembling test questions")
+		return
+	}
+
+	// Create a new test attempt with its frozen question order;
+	// the whole test deadline is fixed at the start and never runs past the group window
+	deadline := utils.TestDeadline(now, test.TimeLimit)
+	if window.ClosesAt != nil && (deadline == nil || window.ClosesAt.Before(*deadline)) {
+		closesAt := *window.ClosesAt
+		deadline = &closesAt
+	}
 	testAttempt := testsModels.TestAttempt{
 		TestID:         testID,
-		StudentID:      req.StudentID,
-		StartTime:      time.Now(),
+		StudentID:      studentID,
+		StartTime:      now,
+		Deadline:       deadline,
+		LastActivityAt: &now,
 		Score:          0,
-		TotalQuestions: int(questionCount),
+		MaxScore:       totalPoints,
+		TotalQuestions: len(questionIDs),
 		Completed:      false,
+		IPAddress:      utils.ClientIP(r),
+		UserAgent:      r.UserAgent(),
 	}
 
-	if err := h.DB.Create(&testAttempt).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Attempts of the student start one at a time, so parallel requests cannot exceed the limit
+		var locked dashboardModels.Student
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, studentID).Error; err != nil {
+			return err
+		}
+		var attemptCount int64
+		if err := tx.Model(&testsModels.TestAttempt{}).
+			Where("test_id = ? AND student_id = ?", testID, studentID).Count(&attemptCount).Error; err != nil {
+			return err
+		}
+		if int(attemptCount) >= attemptLimit {
+			return errMaxAttempts
+		}
+
+		if err := tx.Create(&testAttempt).Error; err != nil {
+			return err
+		}
+		return freezeAttempt(tx, testAttempt.ID, questionIDs, test.ShuffleAnswers)
+	})
+	if errors.Is(err, errMaxAttempts) {
+		utils.RespondWithError(w, http.StatusForbidden, "Maximum number of attempts reached")
+		return
+	}
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating test attempt")
 		return
 	}
@@ -205,25 +361,16 @@ func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
 
 // GetNextQuestion gets the next unanswered question for a test attempt
 func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
-	// Get attempt ID from URL
-	vars := mux.Vars(r)
-	attemptID, err := strconv.Atoi(vars["attempt_id"])
-	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+	// Verify the attempt belongs to the student and is not completed
+	attempt, ok := h.loadStudentAttempt(w, r)
+	if !ok {
 		return
 	}
+	attemptID := attempt.ID
 
 	// Log the attempt ID for debugging
 	log.Printf("GetNextQuestion called for attempt ID: %d", attemptID)
 
-	// Verify the attempt exists and is not completed
-	var attempt testsModels.TestAttempt
-	if err := h.DB.Where("id = ?", attemptID).First(&attempt).Error; err != nil {
-		log.Printf("Error finding attempt ID %d: %v", attemptID, err)
-		utils.RespondWithError(w, http.StatusNotFound, "Attempt not found")
-		return
-	}
-
 	log.Printf("Found attempt ID %d for test ID %d, student ID %d, completed: %v",
 		attempt.ID, attempt.TestID, attempt.StudentID, attempt.Completed)
 
@@ -236,26 +383,37 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all questions for this test with answers preloaded
-	var questions []testsModels.Question
-	if err := h.DB.Debug().Preload("Answers").Where("test_id = ?", attempt.TestID).Order("position").Find(&questions).Error; err != nil {
-		log.Printf("Error retrieving questions for test ID %d: %v", attempt.TestID, err)
+	// Complete the attempt once the whole test time is over
+	now := time.Now()
+	if utils.PastDeadline(attempt.Deadline, now) {
+		log.Printf("Time for attempt %d is over, completing", attemptID)
+		if _, err := completeAttempt(h.DB, attemptID, *attempt.Deadline); err != nil {
+			log.Printf("Error completing attempt %d: %v", attemptID, err)
+		}
+		utils.RespondWithSuccess(w, http.StatusOK, "Time is over. Test completed.", map[string]interface{}{
+			"completed":    true,
+			"time_expired": true,
+			"attempt_id":   attemptID,
+		})
+		return
+	}
+
+	// Get the questions of this attempt in their frozen order
+	questions, err := loadAttemptQuestions(h.DB, attempt)
+	if err != nil {
+		log.Printf("Error retrieving questions for attempt ID %d: %v", attemptID, err)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving questions")
 		return
 	}
 
 	if len(questions) == 0 {
-		log.Printf("No questions found for test ID %d", attempt.TestID)
+		log.Printf("No questions found for attempt ID %d", attemptID)
 		utils.RespondWithError(w, http.StatusNotFound, "This test has no questions")
 		return
 	}
 
 	// Log found questions for debugging
-	log.Printf("Found %d questions for test ID %d", len(questions), attempt.TestID)
-	for i, q := range questions {
-		log.Printf("Question %d: ID=%d, Text=%s (Type: %s, Answers: %d)",
-			i+1, q.ID, q.QuestionText, q.QuestionType, len(q.Answers))
-	}
+	log.Printf("Found %d questions for attempt ID %d", len(questions), attemptID)
 
 	// Get answered questions for this attempt
 	var answeredQuestionIDs []int
@@ -276,25 +434,37 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 		answeredMap[id] = true
 	}
 
-	// Find the first unanswered question
-	var nextQuestion *testsModels.Question
+	// Find the first unanswered question; served questions whose time ran out
+	// are recorded as unanswered and skipped
+	var next *drawnQuestion
+	answeredCount := len(answeredQuestionIDs)
 	for i := range questions {
-		if !answeredMap[questions[i].ID] {
-			nextQuestion = &questions[i]
-			log.Printf("Found next unanswered question ID %d: %s", nextQuestion.ID, nextQuestion.QuestionText)
-			break
+		slot := questions[i].Slot
+		if answeredMap[slot.QuestionID] {
+			continue
 		}
+		if slot.ServedAt != nil && utils.PastDeadline(slot.Deadline, now) {
+			log.Printf("Question ID %d timed out in attempt ID %d", slot.QuestionID, attemptID)
+			if err := recordTimeout(h.DB, slot); err != nil {
+				log.Printf("Error recording timed out question: %v", err)
+				utils.RespondWithError(w, http.StatusInternalServerError, "Error saving response")
+				return
+			}
+			answeredCount++
+			continue
+		}
+		next = &questions[i]
+		log.Printf("Found next unanswered question ID %d: %s", next.Question.ID, next.Question.QuestionText)
+		break
 	}
 
-	if nextQuestion == nil {
+	if next == nil {
 		// All questions have been answered
 		// Complete the test
 		log.Printf("All questions answered for attempt ID %d, marking as completed", attemptID)
-		now := time.Now()
-		h.DB.Model(&attempt).Updates(map[string]interface{}{
-			"completed": true,
-			"end_time":  now,
-		})
+		if _, err := completeAttempt(h.DB, attemptID, now); err != nil {
+			log.Printf("Error completing attempt %d: %v", attemptID, err)
+		}
 
 		utils.RespondWithSuccess(w, http.StatusOK, "All questions answered. Test completed.", map[string]interface{}{
 			"completed":  true,
@@ -302,6 +472,7 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	nextQuestion := &next.Question
 
 	// Get the test's time per question setting
 	var test testsModels.Test
@@ -309,6 +480,15 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error retrieving test info: %v", err)
 	}
 
+	// Stamp when the question is served; the answer deadline is counted from here
+	served, err := serveQuestion(h.DB, attempt, next.Slot, test.TimePerQuestion, now)
+	if err != nil {
+		log.Printf("Error saving served question: %v", err)
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error serving question")
+		return
+	}
+	touchAttempt(h.DB, attemptID, now)
+
 	// Verify answers are loaded correctly
 	log.Printf("Question ID %d has %d answers", nextQuestion.ID, len(nextQuestion.Answers))
 	for i, ans := range nextQuestion.Answers {
@@ -316,23 +496,35 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 			i+1, ans.ID, ans.AnswerText, ans.IsCorrect)
 	}
 
-	// Strip IsCorrect field from answers for security
+	// Strip IsCorrect field from answers for security; the answers of text, numeric
+	// and fill in the blank questions are the solution and are not sent at all
 	answers := make([]map[string]interface{}, 0)
-	for _, ans := range nextQuestion.Answers {
-		answers = append(answers, map[string]interface{}{
-			"id":          ans.ID,
-			"answer_text": ans.AnswerText,
-		})
+	if !scoring.HidesAnswers(nextQuestion.QuestionType) {
+		for _, ans := range nextQuestion.Answers {
+			answers = append(answers, map[string]interface{}{
+				"id":          ans.ID,
+				"answer_text": ans.AnswerText,
+			})
+		}
 	}
 
 	// Format the question for the response
 	question := map[string]interface{}{
-		"id":            nextQuestion.ID,
-		"question_text": nextQuestion.QuestionText,
-		"question_type": nextQuestion.QuestionType,
-		"position":      nextQuestion.Position,
-		"time_limit":    test.TimePerQuestion,
-		"answers":       answers,
+		"id":             nextQuestion.ID,
+		"question_text":  nextQuestion.QuestionText,
+		"question_type":  nextQuestion.QuestionType,
+		"position":       served.Position,
+		"time_limit":     test.TimePerQuestion,
+		"served_at":      served.ServedAt,
+		"deadline":       served.Deadline,
+		"time_remaining": utils.SecondsRemaining(served.Deadline, now),
+		"answers":        answers,
+		"points":         nextQuestion.Points,
+	}
+
+	// Matching questions also need the right sides to choose from
+	if nextQuestion.QuestionType == testsModels.QuestionMatching {
+		question["match_options"] = scoring.MatchOptions(nextQuestion.Answers)
 	}
 
 	// Log response data for debugging
@@ -340,31 +532,51 @@ func (h *TestHandler) GetNextQuestion(w http.ResponseWriter, r *http.Request) {
 
 	// Return the next question with formatted data
 	utils.RespondWithSuccess(w, http.StatusOK, "Next question retrieved", map[string]interface{}{
-		"question": question,
+		"question":      question,
+		"test_deadline": attempt.Deadline,
 		"progress": map[string]interface{}{
-			"answered": len(answeredQuestionIDs),
+			"answered": answeredCount,
 			"total":    len(questions),
 		},
 	})
 }
 
-// SubmitAnswerRequest defines the request body for submitting an answer
+// SubmitAnswerRequest defines the request body for submitting an answer.
+// The time spent is measured by the server from the moment the question was served.
+// Which fields are used depends on the question type.
 type SubmitAnswerRequest struct {
-	QuestionID int    `json:"question_id"`
-	AnswerID   *int   `json:"answer_id"`
-	TextAnswer string `json:"text_answer"`
-	TimeSpent  int    `json:"time_spent"` // Time in seconds
+	QuestionID    int            `json:"question_id"`
+	AnswerID      *int           `json:"answer_id"`      // Single choice
+	AnswerIDs     []int          `json:"answer_ids"`     // Multiple choice
+	TextAnswer    string         `json:"text_answer"`    // Text, fill in the blank and numeric
+	NumericAnswer *float64       `json:"numeric_answer"` // Numeric sent as a number
+	Matches       map[int]string `json:"matches"`        // Matching: left answer ID to the chosen right side
+	Order         []int          `json:"order"`          // Ordering: answer IDs in the chosen order
+}
+
+// responseAnswer collects the submitted answer into its stored form
+func (req SubmitAnswerRequest) responseAnswer() testsModels.ResponseAnswer {
+	answer := testsModels.ResponseAnswer{
+		AnswerIDs: req.AnswerIDs,
+		Text:      req.TextAnswer,
+		Number:    req.NumericAnswer,
+		Matches:   req.Matches,
+		Order:     req.Order,
+	}
+	if len(answer.AnswerIDs) == 0 && req.AnswerID != nil {
+		answer.AnswerIDs = []int{*req.AnswerID}
+	}
+	return answer
 }
 
 // SubmitAnswer submits a student's answer for a question
 func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
-	// Get attempt ID from URL
-	vars := mux.Vars(r)
-	attemptID, err := strconv.Atoi(vars["attempt_id"])
-	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+	// Verify the attempt belongs to the student
+	attempt, ok := h.loadStudentAttempt(w, r)
+	if !ok {
 		return
 	}
+	attemptID := attempt.ID
 
 	// Log the attempt ID for debugging
 	log.Printf("SubmitAnswer called for attempt ID: %d", attemptID)
@@ -377,16 +589,8 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Received answer submission: question_id=%d, answer_id=%v, text_answer=%q, time_spent=%d",
-		req.QuestionID, req.AnswerID, req.TextAnswer, req.TimeSpent)
-
-	// Verify the attempt exists and is not completed
-	var attempt testsModels.TestAttempt
-	if err := h.DB.Debug().Where("id = ?", attemptID).First(&attempt).Error; err != nil {
-		log.Printf("Error finding attempt ID %d: %v", attemptID, err)
-		utils.RespondWithError(w, http.StatusNotFound, "Attempt not found")
-		return
-	}
+	log.Printf("Received answer submission: question_id=%d, answer_id=%v, text_answer=%q",
+		req.QuestionID, req.AnswerID, req.TextAnswer)
 
 	if attempt.Completed {
 		log.Printf("Attempt %d is already completed", attemptID)
@@ -394,12 +598,23 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Answers after the whole test time are rejected and the attempt is completed
+	now := time.Now()
+	if utils.PastDeadline(attempt.Deadline, now) {
+		log.Printf("Time for attempt %d is over, rejecting answer", attemptID)
+		if _, err := completeAttempt(h.DB, attemptID, *attempt.Deadline); err != nil {
+			log.Printf("Error completing attempt %d: %v", attemptID, err)
+		}
+		utils.RespondWithError(w, http.StatusBadRequest, "Time for this test is over")
+		return
+	}
+
 	log.Printf("Found attempt: test_id=%d, student_id=%d, completed=%v",
 		attempt.TestID, attempt.StudentID, attempt.Completed)
 
 	// Check if the question exists and belongs to this test
 	var question testsModels.Question
-	questionQuery := h.DB.Debug().Where("id = ?", req.QuestionID)
+	questionQuery := h.DB.Debug().Preload("Answers").Where("id = ?", req.QuestionID)
 
 	// Modified: Remove the test_id condition to just find the question by ID first
 	result := questionQuery.First(&question)
@@ -409,16 +624,23 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// After finding the question, check if it belongs to the test
-	if question.TestID != attempt.TestID {
-		log.Printf("Question ID %d belongs to test ID %d, not attempt test ID %d",
-			req.QuestionID, question.TestID, attempt.TestID)
+	// After finding the question, check if it was drawn for this attempt
+	var served testsModels.AttemptQuestion
+	if err := h.DB.Where("attempt_id = ? AND question_id = ?", attemptID, req.QuestionID).First(&served).Error; err != nil {
+		log.Printf("Question ID %d is not part of attempt ID %d", req.QuestionID, attemptID)
 		utils.RespondWithError(w, http.StatusBadRequest, "Question not found in this test")
 		return
 	}
 
-	log.Printf("Found question: id=%d, test_id=%d, text=%q, type=%s",
-		question.ID, question.TestID, question.QuestionText, question.QuestionType)
+	log.Printf("Found question: id=%d, text=%q, type=%s",
+		question.ID, question.QuestionText, question.QuestionType)
+
+	// The question must have been served in this attempt
+	if served.ServedAt == nil {
+		log.Printf("Question ID %d was not served in attempt ID %d", req.QuestionID, attemptID)
+		utils.RespondWithError(w, http.StatusBadRequest, "This question has not been served yet")
+		return
+	}
 
 	// Check if this question was already answered in this attempt
 	var existingResponse testsModels.StudentResponse
@@ -429,65 +651,82 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine if the answer is correct
-	isCorrect := false
-
-	if question.QuestionType == "text" {
-		// For text questions, use exact match for now
-		var correctAnswer string
-		h.DB.Debug().Model(&testsModels.Answer{}).
-			Where("question_id = ? AND is_correct = true", req.QuestionID).
-			Pluck("answer_text", &correctAnswer)
-
-		isCorrect = req.TextAnswer == correctAnswer
-		log.Printf("Text answer check: submitted=%q, correct=%q, match=%v",
-			req.TextAnswer, correctAnswer, isCorrect)
-	} else {
-		// For multiple/single choice questions
-		if req.AnswerID != nil {
-			// Verify the answer belongs to this question
-			var answer testsModels.Answer
-			result = h.DB.Debug().Where("id = ? AND question_id = ?", *req.AnswerID, req.QuestionID).First(&answer)
-			if result.Error != nil {
-				log.Printf("Error finding answer ID %d for question ID %d: %v",
-					*req.AnswerID, req.QuestionID, result.Error)
-				utils.RespondWithError(w, http.StatusBadRequest, "Invalid answer for this question")
-				return
-			}
+	// Score the answer; multiple choice, matching and ordering earn partial credit
+	answer := req.responseAnswer()
+	fraction, err := scoring.Check(question, answer)
+	if err != nil {
+		log.Printf("Invalid answer for question ID %d: %v", req.QuestionID, err)
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid answer for this question")
+		return
+	}
 
-			isCorrect = answer.IsCorrect
-			log.Printf("Choice answer check: answer_id=%d, is_correct=%v", answer.ID, isCorrect)
-		}
+	maxPoints := question.Points
+	if maxPoints <= 0 {
+		maxPoints = 1
+	}
+	points := scoring.Points(fraction, maxPoints)
+	isCorrect := scoring.IsFull(fraction)
+
+	// Free text answers wait in the teacher review queue
+	needsReview := scoring.NeedsReview(question.QuestionType)
+	log.Printf("Answer check: question_id=%d, type=%s, fraction=%.2f", question.ID, question.QuestionType, fraction)
+
+	// Answers after the question deadline are kept but score zero
+	late := utils.PastDeadline(served.Deadline, now)
+	if late {
+		log.Printf("Answer for question ID %d in attempt ID %d arrived after the deadline", req.QuestionID, attemptID)
+		isCorrect = false
+		points = 0
+		needsReview = false
+	}
+
+	// The first chosen answer is kept in answer_id for single answer questions
+	var answerID *int
+	if len(answer.AnswerIDs) > 0 {
+		answerID = &answer.AnswerIDs[0]
 	}
 
 	// Create the student response
 	response := testsModels.StudentResponse{
 		AttemptID:   attemptID,
 		QuestionID:  req.QuestionID,
-		AnswerID:    req.AnswerID,
+		AnswerID:    answerID,
 		TextAnswer:  req.TextAnswer,
+		Data:        answer,
 		IsCorrect:   isCorrect,
-		TimeSpent:   req.TimeSpent,
-		SubmittedAt: time.Now(),
+		Points:      points,
+		MaxPoints:   maxPoints,
+		NeedsReview: needsReview,
+		TimeSpent:   int(now.Sub(*served.ServedAt).Seconds()),
+		Late:        late,
+		SubmittedAt: now,
 	}
 
-	if err := h.DB.Debug().Create(&response).Error; err != nil {
-		log.Printf("Error saving response: %v", err)
+	// A parallel request may have answered the question in the meantime
+	result = h.DB.Debug().Clauses(clause.OnConflict{DoNothing: true}).Create(&response)
+	if result.Error != nil {
+		log.Printf("Error saving response: %v", result.Error)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving response")
 		return
 	}
+	if result.RowsAffected == 0 {
+		log.Printf("Question ID %d was already answered in attempt ID %d", req.QuestionID, attemptID)
+		utils.RespondWithError(w, http.StatusBadRequest, "This question was already answered")
+		return
+	}
 
-	log.Printf("Created student response: id=%d, is_correct=%v", response.ID, isCorrect)
+	log.Printf("Created student response: id=%d, points=%.2f", response.ID, points)
 
-	// Update the test attempt score if the answer is correct
-	if isCorrect {
-		result := h.DB.Debug().Model(&attempt).Update("score", gorm.Expr("score + 1"))
+	// Add the earned points to the test attempt score
+	if points > 0 {
+		result := h.DB.Debug().Model(&attempt).Update("score", gorm.Expr("score + ?", points))
 		if result.Error != nil {
 			log.Printf("Error updating score: %v", result.Error)
 		} else {
 			log.Printf("Updated score for attempt ID %d", attemptID)
 		}
 	}
+	touchAttempt(h.DB, attemptID, now)
 
 	// Check if all questions have been answered
 	var answeredCount int64
@@ -499,17 +738,19 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	// If all questions are answered, complete the test
 	if allQuestionsAnswered {
 		log.Printf("All questions answered, completing attempt ID %d", attemptID)
-		now := time.Now()
-		h.DB.Debug().Model(&attempt).Updates(map[string]interface{}{
-			"completed": true,
-			"end_time":  now,
-		})
+		if _, err := completeAttempt(h.DB, attemptID, now); err != nil {
+			log.Printf("Error completing attempt %d: %v", attemptID, err)
+		}
 	}
 
 	// Return whether the answer was correct and if the test is completed
 	utils.RespondWithSuccess(w, http.StatusOK, "Answer submitted successfully", map[string]interface{}{
-		"is_correct": isCorrect,
-		"completed":  allQuestionsAnswered,
+		"is_correct":     isCorrect,
+		"points":         points,
+		"max_points":     maxPoints,
+		"pending_review": needsReview,
+		"late":           late,
+		"completed":      allQuestionsAnswered,
 		"progress": map[string]interface{}{
 			"answered": answeredCount,
 			"total":    attempt.TotalQuestions,
@@ -519,20 +760,12 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 
 // GetTestResults retrieves detailed results for a completed test attempt
 func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
-	// Get attempt ID from URL
-	vars := mux.Vars(r)
-	attemptID, err := strconv.Atoi(vars["attempt_id"])
-	if err != nil {
-		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
-		return
-	}
-
-	// Verify the attempt exists
-	var attempt testsModels.TestAttempt
-	if err := h.DB.Where("id = ?", attemptID).First(&attempt).Error; err != nil {
-		utils.RespondWithError(w, http.StatusNotFound, "Attempt not found")
+	// Verify the attempt belongs to the student
+	attempt, ok := h.loadStudentAttempt(w, r)
+	if !ok {
 		return
 	}
+	attemptID := attempt.ID
 
 	// Get test information
 	var test testsModels.Test
@@ -556,43 +789,43 @@ func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
 
 	// Get all questions and responses
 	type QuestionResponse struct {
-		QuestionID    int       `json:"question_id"`
-		QuestionText  string    `json:"question_text"`
-		QuestionType  string    `json:"question_type"`
-		Position      int       `json:"position"`
-		AnswerID      *int      `json:"answer_id"`
-		TextAnswer    string    `json:"text_answer"`
-		CorrectAnswer string    `json:"correct_answer"`
-		IsCorrect     bool      `json:"is_correct"`
-		TimeSpent     int       `json:"time_spent"`
-		SubmittedAt   time.Time `json:"submitted_at"`
+		QuestionID    int                        `json:"question_id"`
+		QuestionText  string                     `json:"question_text"`
+		QuestionType  string                     `json:"question_type"`
+		Position      int                        `json:"position"`
+		AnswerID      *int                       `json:"answer_id"`
+		TextAnswer    string                     `json:"text_answer"`
+		AnswerData    testsModels.ResponseAnswer `json:"answer_data"`
+		CorrectAnswer string                     `json:"correct_answer"`
+		IsCorrect     bool                       `json:"is_correct"`
+		Points        float64                    `json:"points"`
+		MaxPoints     float64                    `json:"max_points"`
+		PendingReview bool                       `json:"pending_review"` // Waits for the teacher to grade it
+		ReviewComment string                     `json:"review_comment"`
+		TimeSpent     int                        `json:"time_spent"`
+		Late          bool                       `json:"late"`
+		SubmittedAt   time.Time                  `json:"submitted_at"`
 	}
 
 	var responses []QuestionResponse
+	pendingReview := false
 
-	// Get all questions for this test
-	var allQuestions []struct {
-		ID           int    `json:"id"`
-		QuestionText string `json:"question_text"`
-		QuestionType string `json:"question_type"`
-		Position     int    `json:"position"`
-	}
-
-	if err := h.DB.Model(&testsModels.Question{}).
-		Where("test_id = ?", attempt.TestID).
-		Order("position").
-		Find(&allQuestions).Error; err != nil {
+	// Get the questions of this attempt in the order they were asked
+	allQuestions, err := loadAttemptQuestions(h.DB, attempt)
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving questions")
 		return
 	}
 
 	// For each question, get the student's response and the correct answer
-	for _, q := range allQuestions {
+	for _, drawn := range allQuestions {
+		q := drawn.Question
 		var response QuestionResponse
 		response.QuestionID = q.ID
 		response.QuestionText = q.QuestionText
 		response.QuestionType = q.QuestionType
-		response.Position = q.Position
+		response.Position = drawn.Slot.Position
+		response.MaxPoints = q.Points
 
 		// Get the student's response
 		var studentResponse testsModels.StudentResponse
@@ -602,8 +835,17 @@ func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
 			// Student answered this question
 			response.AnswerID = studentResponse.AnswerID
 			response.TextAnswer = studentResponse.TextAnswer
+			response.AnswerData = studentResponse.Data
 			response.IsCorrect = studentResponse.IsCorrect
+			response.Points = studentResponse.Points
+			response.MaxPoints = studentResponse.MaxPoints
+			response.PendingReview = studentResponse.NeedsReview && studentResponse.ReviewedAt == nil
+			response.ReviewComment = studentResponse.ReviewComment
+			if response.PendingReview {
+				pendingReview = true
+			}
 			response.TimeSpent = studentResponse.TimeSpent
+			response.Late = studentResponse.Late
 			response.SubmittedAt = studentResponse.SubmittedAt
 		} else {
 			// Student didn't answer this question
@@ -611,21 +853,25 @@ func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
 			response.TimeSpent = 0
 		}
 
-		// Get the correct answer
-		var correctAnswer string
-		h.DB.Model(&testsModels.Answer{}).
-			Where("question_id = ? AND is_correct = true", q.ID).
-			Pluck("answer_text", &correctAnswer)
-
-		response.CorrectAnswer = correctAnswer
+		// Describe the correct answer
+		response.CorrectAnswer = scoring.CorrectAnswer(q)
 
 		responses = append(responses, response)
 	}
 
-	// Calculate score as a percentage
+	// Calculate score as a percentage of the question weights;
+	// it is not final while free text answers wait for review
 	scorePercent := 0.0
-	if attempt.TotalQuestions > 0 {
-		scorePercent = float64(attempt.Score) / float64(attempt.TotalQuestions) * 100
+	if attempt.MaxScore > 0 {
+		scorePercent = attempt.Score / attempt.MaxScore * 100
+	}
+
+	status := "in_progress"
+	if attempt.Completed {
+		status = "graded"
+		if pendingReview {
+			status = "pending_review"
+		}
 	}
 
 	// Return the test results
@@ -634,8 +880,12 @@ func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
 			"id":               attempt.ID,
 			"start_time":       attempt.StartTime,
 			"end_time":         attempt.EndTime,
+			"deadline":         attempt.Deadline,
 			"completed":        attempt.Completed,
+			"status":           status,
+			"pending_review":   pendingReview,
 			"score":            attempt.Score,
+			"max_score":        attempt.MaxScore,
 			"total_questions":  attempt.TotalQuestions,
 			"score_percent":    scorePercent,
 			"duration_seconds": int(duration.Seconds()),
@@ -656,13 +906,12 @@ func (h *TestHandler) GetTestResults(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithSuccess(w, http.StatusOK, "Test results retrieved successfully", result)
 }
 
-// GetStudentTestHistory retrieves the test history for a student
+// GetStudentTestHistory retrieves the test history for the authenticated student
 func (h *TestHandler) GetStudentTestHistory(w http.ResponseWriter, r *http.Request) {
-	// Get student ID from query parameters
-	studentIDStr := r.URL.Query().Get("student_id")
-	studentID, err := strconv.Atoi(studentIDStr)
-	if err != nil || studentID <= 0 {
-		utils.RespondWithError(w, http.StatusBadRequest, "Valid student ID is required")
+	// Get student ID from the session
+	studentID, err := utils.GetStudentIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -688,9 +937,11 @@ func (h *TestHandler) GetStudentTestHistory(w http.ResponseWriter, r *http.Reque
 		StartTime       time.Time  `json:"start_time"`
 		EndTime         *time.Time `json:"end_time"`
 		Completed       bool       `json:"completed"`
-		Score           int        `json:"score"`
+		Score           float64    `json:"score"`
+		MaxScore        float64    `json:"max_score"`
 		TotalQuestions  int        `json:"total_questions"`
 		ScorePercent    float64    `json:"score_percent"`
+		PendingReview   bool       `json:"pending_review"`
 		DurationSeconds int        `json:"duration_seconds"`
 	}
 
@@ -707,8 +958,10 @@ func (h *TestHandler) GetStudentTestHistory(w http.ResponseWriter, r *http.Reque
             ta.end_time,
             ta.completed,
             ta.score,
+            ta.max_score,
             ta.total_questions,
-            CASE WHEN ta.total_questions > 0 THEN (ta.score * 100.0 / ta.total_questions) ELSE 0 END as score_percent,
+            CASE WHEN ta.max_score > 0 THEN (ta.score * 100.0 / ta.max_score) ELSE 0 END as score_percent,
+            ` + pendingReviewSQL + ` as pending_review,
             CASE WHEN ta.end_time IS NOT NULL THEN 
                 EXTRACT(EPOCH FROM (ta.end_time - ta.start_time))::integer 
             ELSE 0 END as duration_seconds
@@ -743,8 +996,10 @@ func (h *TestHandler) GetStudentTestHistory(w http.ResponseWriter, r *http.Reque
 			&attempt.EndTime,
 			&attempt.Completed,
 			&attempt.Score,
+			&attempt.MaxScore,
 			&attempt.TotalQuestions,
 			&attempt.ScorePercent,
+			&attempt.PendingReview,
 			&durationSeconds,
 		)
 
@@ -0,0 +1,198 @@
+// Package integrity finds signs of cheating in test attempts. The flags are signals
+// for the teacher to look at, not proof.
+package integrity
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client events sent by the test page
+const (
+	EventFocusLost = "focus_lost" // The student switched to another tab or window
+	EventPaste     = "paste"      // Text was pasted into an answer
+)
+
+// KnownEvent reports whether the client event type is recorded
+func KnownEvent(eventType string) bool {
+	return eventType == EventFocusLost || eventType == EventPaste
+}
+
+// Attempt flags
+const (
+	FlagFocusLost        = "focus_lost"        // Left the test page
+	FlagPaste            = "paste"             // Pasted text into answers
+	FlagFastAnswers      = "fast_answers"      // Answered faster than a question can be read
+	FlagIdenticalAnswers = "identical_answers" // Same answers, mistakes included, as another student of the group
+	FlagSharedIP         = "shared_ip"         // Ran at the same time as another student's attempt from the same IP
+)
+
+const (
+	// FastAnswerSeconds is the answer time below which an answer counts as too fast
+	FastAnswerSeconds = 3
+	// minFastAnswers is how many too fast answers flag an attempt
+	minFastAnswers = 3
+	// minIdenticalAnswers is how many shared answered questions make identical sequences meaningful
+	minIdenticalAnswers = 5
+)
+
+// Response is one answer of an attempt
+type Response struct {
+	QuestionID int
+	Signature  string // Answer normalized for comparison, see Signature
+	Correct    bool
+	TimeSpent  int  // Seconds
+	Timed      bool // Whether answer speed says something; free text answers take long anyway
+}
+
+// Attempt is an attempt with what is known about how it was taken
+type Attempt struct {
+	ID        int
+	StudentID int
+	Group     string
+	IP        string
+	Start     time.Time
+	End       *time.Time // Nil while in progress
+	Responses []Response
+	FocusLost int
+	Pastes    int
+}
+
+// Report lists the signals found for one attempt
+type Report struct {
+	AttemptID     int      `json:"attempt_id"`
+	Flags         []string `json:"flags"`
+	FocusLost     int      `json:"focus_lost"`
+	Pastes        int      `json:"pastes"`
+	FastAnswers   int      `json:"fast_answers"`
+	IdenticalWith []int    `json:"identical_with"` // Attempts with the same answers
+	SameIPWith    []int    `json:"same_ip_with"`   // Concurrent attempts from the same IP
+}
+
+// Analyze checks the attempts of one test. now closes the attempts still in progress.
+func Analyze(attempts []Attempt, now time.Time) []Report {
+	reports := make([]Report, len(attempts))
+	for i, attempt := range attempts {
+		reports[i] = Report{
+			AttemptID:     attempt.ID,
+			FocusLost:     attempt.FocusLost,
+			Pastes:        attempt.Pastes,
+			IdenticalWith: []int{},
+			SameIPWith:    []int{},
+		}
+		for _, response := range attempt.Responses {
+			if response.Timed && response.TimeSpent < FastAnswerSeconds {
+				reports[i].FastAnswers++
+			}
+		}
+	}
+
+	for i := range attempts {
+		for j := i + 1; j < len(attempts); j++ {
+			a, b := attempts[i], attempts[j]
+			if a.StudentID == b.StudentID {
+				continue
+			}
+			if a.Group == b.Group && identical(a, b) {
+				reports[i].IdenticalWith = append(reports[i].IdenticalWith, b.ID)
+				reports[j].IdenticalWith = append(reports[j].IdenticalWith, a.ID)
+			}
+			if a.IP != "" && a.IP == b.IP && overlap(a, b, now) {
+				reports[i].SameIPWith = append(reports[i].SameIPWith, b.ID)
+				reports[j].SameIPWith = append(reports[j].SameIPWith, a.ID)
+			}
+		}
+	}
+
+	for i := range reports {
+		reports[i].Flags = flags(reports[i])
+	}
+	return reports
+}
+
+// flags turns the counted signals into flags
+func flags(report Report) []string {
+	result := []string{}
+	if report.FocusLost > 0 {
+		result = append(result, FlagFocusLost)
+	}
+	if report.Pastes > 0 {
+		result = append(result, FlagPaste)
+	}
+	if report.FastAnswers >= minFastAnswers {
+		result = append(result, FlagFastAnswers)
+	}
+	if len(report.IdenticalWith) > 0 {
+		result = append(result, FlagIdenticalAnswers)
+	}
+	if len(report.SameIPWith) > 0 {
+		result = append(result, FlagSharedIP)
+	}
+	return result
+}
+
+// identical reports whether two attempts answered the same questions the same way.
+// Two strong students may both answer everything correctly, so at least one shared
+// mistake is required.
+func identical(a, b Attempt) bool {
+	answers := make(map[int]Response, len(a.Responses))
+	for _, response := range a.Responses {
+		answers[response.QuestionID] = response
+	}
+
+	common, sharedMistakes := 0, 0
+	for _, response := range b.Responses {
+		other, ok := answers[response.QuestionID]
+		if !ok {
+			continue
+		}
+		if other.Signature != response.Signature {
+			return false
+		}
+		common++
+		if !response.Correct {
+			sharedMistakes++
+		}
+	}
+	return common >= minIdenticalAnswers && sharedMistakes > 0
+}
+
+// overlap reports whether two attempts ran at the same time
+func overlap(a, b Attempt, now time.Time) bool {
+	endA, endB := now, now
+	if a.End != nil {
+		endA = *a.End
+	}
+	if b.End != nil {
+		endB = *b.End
+	}
+	return a.Start.Before(endB) && b.Start.Before(endA)
+}
+
+// Signature normalizes an answer so that equal answers compare equal
+func Signature(data testsModels.ResponseAnswer, answerID *int) string {
+	ids := append([]int{}, data.AnswerIDs...)
+	if len(ids) == 0 && answerID != nil {
+		ids = []int{*answerID}
+	}
+	sort.Ints(ids)
+
+	matches := make([]string, 0, len(data.Matches))
+	for left, right := range data.Matches {
+		matches = append(matches, strconv.Itoa(left)+"="+scoring.Normalize(right))
+	}
+	sort.Strings(matches)
+
+	text := scoring.Normalize(data.Text)
+	if data.Number != nil {
+		text = strconv.FormatFloat(*data.Number, 'g', -1, 64)
+	}
+
+	signature, _ := json.Marshal([]interface{}{ids, text, strings.Join(matches, ";"), data.Order})
+	return string(signature)
+}
@@ -0,0 +1,99 @@
+package integrity
+
+import (
+    testsModels "TeacherJournal/app/tests/models"
+    "testing"
+    "time"
+)
+
+func answers(correct []bool, signatures ...string) []Response {
+    responses := make([]Response, len(signatures))
+    for i, s := range signatures {
+        responses[i] = Response{QuestionID: i + 1, Signature: s, Correct: correct[i], TimeSpent: 30, Timed: true}
+    }
+    return responses
+}
+
+func hasFlag(report Report, flag string) bool {
+    for _, f := range report.Flags {
+        if f == flag {
+            return true
+        }
+    }
+    return false
+}
+
+func TestIdenticalAnswers(t *testing.T) {
+    start := time.Date(2024, 10, 7, 10, 0, 0, 0, time.UTC)
+    end := start.Add(20 * time.Minute)
+    withMistake := []bool{true, true, false, true, true}
+    allCorrect := []bool{true, true, true, true, true}
+
+    attempts := []Attempt{
+        {ID: 1, StudentID: 1, Group: "ИВТ-21", Start: start, End: &end, Responses: answers(withMistake, "a", "b", "x", "d", "e")},
+        {ID: 2, StudentID: 2, Group: "ИВТ-21", Start: start, End: &end, Responses: answers(withMistake, "a", "b", "x", "d", "e")},
+        // Another group is not compared
+        {ID: 3, StudentID: 3, Group: "ИВТ-22", Start: start, End: &end, Responses: answers(withMistake, "a", "b", "x", "d", "e")},
+        // Everything correct is not suspicious
+        {ID: 4, StudentID: 4, Group: "ИВТ-23", Start: start, End: &end, Responses: answers(allCorrect, "a", "b", "c", "d", "e")},
+        {ID: 5, StudentID: 5, Group: "ИВТ-23", Start: start, End: &end, Responses: answers(allCorrect, "a", "b", "c", "d", "e")},
+    }
+
+    reports := Analyze(attempts, end)
+    if !hasFlag(reports[0], FlagIdenticalAnswers) || len(reports[0].IdenticalWith) != 1 || reports[0].IdenticalWith[0] != 2 {
+        t.Fatalf("expected attempts 1 and 2 to be identical: %+v", reports[0])
+    }
+    if hasFlag(reports[2], FlagIdenticalAnswers) || hasFlag(reports[3], FlagIdenticalAnswers) {
+        t.Fatalf("unexpected identical flags: %+v %+v", reports[2], reports[3])
+    }
+}
+
+func TestFastAnswersAndEvents(t *testing.T) {
+    start := time.Date(2024, 10, 7, 10, 0, 0, 0, time.UTC)
+    fast := []Response{
+        {QuestionID: 1, TimeSpent: 1, Timed: true},
+        {QuestionID: 2, TimeSpent: 2, Timed: true},
+        {QuestionID: 3, TimeSpent: 0, Timed: true},
+        {QuestionID: 4, TimeSpent: 0, Timed: false},
+    }
+    reports := Analyze([]Attempt{{ID: 1, StudentID: 1, Start: start, Responses: fast, FocusLost: 2}}, start.Add(time.Minute))
+
+    if reports[0].FastAnswers != 3 || !hasFlag(reports[0], FlagFastAnswers) || !hasFlag(reports[0], FlagFocusLost) || hasFlag(reports[0], FlagPaste) {
+        t.Fatalf("unexpected report %+v", reports[0])
+    }
+}
+
+func TestSharedIP(t *testing.T) {
+    start := time.Date(2024, 10, 7, 10, 0, 0, 0, time.UTC)
+    firstEnd := start.Add(10 * time.Minute)
+    attempts := []Attempt{
+        {ID: 1, StudentID: 1, IP: "10.0.0.5", Start: start, End: &firstEnd},
+        {ID: 2, StudentID: 2, IP: "10.0.0.5", Start: start.Add(5 * time.Minute)}, // Still running
+        {ID: 3, StudentID: 3, IP: "10.0.0.5", Start: start.Add(time.Hour)},      // After the first one
+        {ID: 4, StudentID: 1, IP: "10.0.0.5", Start: start.Add(5 * time.Minute)}, // Same student
+    }
+
+    reports := Analyze(attempts, start.Add(2*time.Hour))
+    if len(reports[0].SameIPWith) != 1 || reports[0].SameIPWith[0] != 2 {
+        t.Fatalf("expected attempt 1 to overlap only attempt 2: %+v", reports[0])
+    }
+    if !hasFlag(reports[2], FlagSharedIP) {
+        t.Fatalf("attempts 2 and 3 are both in progress: %+v", reports[2])
+    }
+}
+
+func TestSignature(t *testing.T) {
+    one := 1
+    if Signature(testsModels.ResponseAnswer{AnswerIDs: []int{3, 1}}, nil) != Signature(testsModels.ResponseAnswer{AnswerIDs: []int{1, 3}}, nil) {
+        t.Fatalf("choice order must not matter")
+    }
+    if Signature(testsModels.ResponseAnswer{}, &one) != Signature(testsModels.ResponseAnswer{AnswerIDs: []int{1}}, nil) {
+        t.Fatalf("legacy answer ID must match answer IDs")
+    }
+    if Signature(testsModels.ResponseAnswer{Text: " Ёлка "}, nil) != Signature(testsModels.ResponseAnswer{Text: "елка"}, nil) {
+        t.Fatalf("text must be normalized")
+    }
+    if Signature(testsModels.ResponseAnswer{Order: []int{1, 2}}, nil) == Signature(testsModels.ResponseAnswer{Order: []int{2, 1}}, nil) {
+        t.Fatalf("ordering must matter")
+    }
+}
@@ -0,0 +1,447 @@
+package interchange
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// giftSpecial are the characters escaped with a backslash in GIFT
+const giftSpecial = `~=#{}:\`
+
+// giftAnswer is one answer of a GIFT answer block
+type giftAnswer struct {
+	Marker   byte     // '=' or '~'
+	Weight   *float64 // Percent weight like %50%
+	Text     string
+	Feedback string
+}
+
+// parseGIFT reads questions in the GIFT format
+func parseGIFT(data []byte) (*Quiz, error) {
+	quiz := &Quiz{}
+
+	text := strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n")
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			parseGIFTQuestion(quiz, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			// Comment
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			flush()
+			quiz.Category = categoryName(strings.TrimPrefix(trimmed, "$CATEGORY:"))
+		default:
+			block = append(block, line)
+		}
+	}
+	flush()
+	return quiz, nil
+}
+
+// parseGIFTQuestion converts one GIFT question and adds it to the quiz
+func parseGIFTQuestion(quiz *Quiz, source string) {
+	source = strings.TrimSpace(source)
+
+	// Optional title ::Title::
+	name := ""
+	if strings.HasPrefix(source, "::") {
+		if end := indexUnescaped(source[2:], "::"); end >= 0 {
+			name = giftUnescape(strings.TrimSpace(source[2 : 2+end]))
+			source = strings.TrimSpace(source[2+end+2:])
+		}
+	}
+
+	open := indexUnescaped(source, "{")
+	closing := -1
+	if open >= 0 {
+		if end := indexUnescaped(source[open+1:], "}"); end >= 0 {
+			closing = open + 1 + end
+		}
+	}
+	if open < 0 || closing < 0 {
+		text := giftText(source)
+		if name == "" {
+			name = questionName(text)
+		}
+		quiz.Skipped = append(quiz.Skipped, Skipped{Name: name, Type: "description", Reason: "not a question"})
+		return
+	}
+
+	// Text after the answers makes a "missing word" question
+	before := strings.TrimSpace(source[:open])
+	after := strings.TrimSpace(source[closing+1:])
+	text := giftText(before)
+	if after != "" {
+		text = giftText(before + " _____ " + after)
+	}
+	if name == "" {
+		name = questionName(text)
+	}
+
+	question, kind, ok := giftQuestion(strings.TrimSpace(source[open+1 : closing]))
+	if !ok {
+		quiz.Skipped = append(quiz.Skipped, Skipped{Name: name, Type: kind, Reason: "unsupported question type"})
+		return
+	}
+	question.QuestionText = text
+	question.Points = 1
+	quiz.Questions = append(quiz.Questions, question)
+}
+
+// giftQuestion converts a GIFT answer block; kind names the GIFT type for the skip report
+func giftQuestion(block string) (testsModels.Question, string, bool) {
+	var question testsModels.Question
+
+	// Essay
+	if block == "" {
+		question.QuestionType = testsModels.QuestionText
+		return question, "essay", true
+	}
+
+	// Numerical
+	if strings.HasPrefix(block, "#") {
+		question.QuestionType = testsModels.QuestionNumeric
+		body := strings.TrimSpace(block[1:])
+		if !strings.HasPrefix(body, "=") {
+			body = "=" + body
+		}
+		for _, answer := range splitGIFTAnswers(body) {
+			if answer.Weight != nil && *answer.Weight < 100 {
+				continue
+			}
+			value, ok := giftNumber(answer.Text)
+			if !ok {
+				return question, "numerical", false
+			}
+			question.Answers = append(question.Answers, value)
+		}
+		return question, "numerical", true
+	}
+
+	// True/false
+	head := strings.ToUpper(strings.TrimSpace(strings.SplitN(block, "#", 2)[0]))
+	switch head {
+	case "T", "TRUE":
+		question.QuestionType = testsModels.QuestionSingleChoice
+		question.Answers = trueFalseAnswers(true)
+		return question, "truefalse", true
+	case "F", "FALSE":
+		question.QuestionType = testsModels.QuestionSingleChoice
+		question.Answers = trueFalseAnswers(false)
+		return question, "truefalse", true
+	}
+
+	answers := splitGIFTAnswers(block)
+	if len(answers) == 0 {
+		return question, "unknown", false
+	}
+
+	hasWrong, hasWeights, hasPairs := false, false, false
+	for _, answer := range answers {
+		if answer.Marker == '~' {
+			hasWrong = true
+		}
+		if answer.Weight != nil {
+			hasWeights = true
+		}
+		if indexUnescaped(answer.Text, "->") >= 0 {
+			hasPairs = true
+		}
+	}
+
+	switch {
+	case hasPairs && !hasWrong:
+		question.QuestionType = testsModels.QuestionMatching
+		for _, answer := range answers {
+			i := indexUnescaped(answer.Text, "->")
+			if i < 0 {
+				return question, "matching", false
+			}
+			left := giftUnescape(strings.TrimSpace(answer.Text[:i]))
+			if left == "" {
+				continue // Extra wrong right sides are not supported
+			}
+			question.Answers = append(question.Answers, testsModels.Answer{
+				AnswerText: left,
+				MatchText:  giftUnescape(strings.TrimSpace(answer.Text[i+2:])),
+			})
+		}
+		return question, "matching", true
+	case !hasWrong:
+		question.QuestionType = testsModels.QuestionFillBlank
+		for _, answer := range answers {
+			if answer.Weight != nil && *answer.Weight < 100 {
+				continue
+			}
+			question.Answers = append(question.Answers, testsModels.Answer{AnswerText: giftUnescape(answer.Text), IsCorrect: true})
+		}
+		return question, "shortanswer", true
+	case hasWeights:
+		question.QuestionType = testsModels.QuestionMultipleChoice
+	default:
+		question.QuestionType = testsModels.QuestionSingleChoice
+	}
+
+	for _, answer := range answers {
+		correct := answer.Marker == '='
+		if answer.Weight != nil {
+			correct = *answer.Weight > 0
+		}
+		question.Answers = append(question.Answers, testsModels.Answer{
+			AnswerText: giftUnescape(answer.Text),
+			IsCorrect:  correct,
+		})
+	}
+	return question, "multichoice", true
+}
+
+// splitGIFTAnswers splits an answer block on unescaped = and ~ markers
+func splitGIFTAnswers(block string) []giftAnswer {
+	var answers []giftAnswer
+	var current *giftAnswer
+	var text strings.Builder
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+		raw := strings.TrimSpace(text.String())
+
+		// Weight %50%
+		if strings.HasPrefix(raw, "%") {
+			if end := strings.Index(raw[1:], "%"); end >= 0 {
+				if weight, err := strconv.ParseFloat(raw[1:1+end], 64); err == nil {
+					current.Weight = &weight
+				}
+				raw = strings.TrimSpace(raw[end+2:])
+			}
+		}
+
+		// Feedback #...
+		if i := indexUnescaped(raw, "#"); i >= 0 {
+			current.Feedback = strings.TrimSpace(raw[i+1:])
+			raw = strings.TrimSpace(raw[:i])
+		}
+		current.Text = raw
+		answers = append(answers, *current)
+		text.Reset()
+	}
+
+	for i := 0; i < len(block); i++ {
+		c := block[i]
+		if c == '\\' && i+1 < len(block) {
+			text.WriteByte(c)
+			text.WriteByte(block[i+1])
+			i++
+			continue
+		}
+		if c == '=' || c == '~' {
+			finish()
+			current = &giftAnswer{Marker: c}
+			continue
+		}
+		text.WriteByte(c)
+	}
+	finish()
+	return answers
+}
+
+// giftNumber reads a numerical answer "value", "value:tolerance" or "min..max"
+func giftNumber(text string) (testsModels.Answer, bool) {
+	text = strings.TrimSpace(giftUnescape(text))
+	answer := testsModels.Answer{IsCorrect: true}
+
+	if i := strings.Index(text, ".."); i >= 0 {
+		low, err1 := scoring.ParseNumber(text[:i])
+		high, err2 := scoring.ParseNumber(text[i+2:])
+		if err1 != nil || err2 != nil {
+			return answer, false
+		}
+		answer.AnswerText = strconv.FormatFloat((low+high)/2, 'f', -1, 64)
+		answer.Tolerance = math.Abs(high-low) / 2
+		return answer, true
+	}
+
+	value := text
+	if i := strings.Index(text, ":"); i >= 0 {
+		tolerance, err := scoring.ParseNumber(text[i+1:])
+		if err != nil {
+			return answer, false
+		}
+		answer.Tolerance = math.Abs(tolerance)
+		value = text[:i]
+	}
+	if _, err := scoring.ParseNumber(value); err != nil {
+		return answer, false
+	}
+	answer.AnswerText = strings.TrimSpace(value)
+	return answer, true
+}
+
+// giftText converts question text, dropping the [html], [plain] or [markdown] prefix
+func giftText(text string) string {
+	text = strings.TrimSpace(text)
+	isHTML := false
+	for _, prefix := range []string{"[html]", "[plain]", "[markdown]", "[moodle]"} {
+		if strings.HasPrefix(text, prefix) {
+			isHTML = prefix == "[html]" || prefix == "[moodle]"
+			text = strings.TrimSpace(strings.TrimPrefix(text, prefix))
+			break
+		}
+	}
+	text = giftUnescape(text)
+	if isHTML {
+		return stripHTML(text)
+	}
+	return text
+}
+
+// indexUnescaped finds a substring that is not preceded by a backslash
+func indexUnescaped(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// giftUnescape removes GIFT escapes
+func giftUnescape(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			switch text[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			default:
+				if strings.IndexByte(giftSpecial, text[i+1]) >= 0 {
+					b.WriteByte(text[i+1])
+					i++
+					continue
+				}
+			}
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+// giftEscape escapes special characters and line breaks
+func giftEscape(text string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(text) {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+		case r < 128 && strings.IndexByte(giftSpecial, byte(r)) >= 0:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeGIFT writes sections of questions in the GIFT format. GIFT has no ordering questions.
+func writeGIFT(sections []Section) ([]byte, []Skipped) {
+	var b strings.Builder
+	var skipped []Skipped
+	for _, section := range sections {
+		if len(section.Category) > 0 {
+			b.WriteString("$CATEGORY: " + categoryPath(section.Category) + "\n\n")
+		}
+		skipped = append(skipped, writeGIFTQuestions(&b, section.Questions)...)
+	}
+	return []byte(b.String()), skipped
+}
+
+// writeGIFTQuestions writes questions in the GIFT format
+func writeGIFTQuestions(b *strings.Builder, questions []testsModels.Question) []Skipped {
+	var skipped []Skipped
+	for _, question := range questions {
+		var answers []string
+		switch question.QuestionType {
+		case testsModels.QuestionSingleChoice:
+			for _, a := range question.Answers {
+				marker := "~"
+				if a.IsCorrect {
+					marker = "="
+				}
+				answers = append(answers, marker+giftEscape(a.AnswerText))
+			}
+		case testsModels.QuestionMultipleChoice:
+			// Matches the partial credit: each wrong choice takes away one correct share
+			correctCount := 0
+			for _, a := range question.Answers {
+				if a.IsCorrect {
+					correctCount++
+				}
+			}
+			share := 100.0
+			if correctCount > 0 {
+				share = 100 / float64(correctCount)
+			}
+			for _, a := range question.Answers {
+				weight := -share
+				if a.IsCorrect {
+					weight = share
+				}
+				answers = append(answers, "~%"+formatFraction(weight)+"%"+giftEscape(a.AnswerText))
+			}
+		case testsModels.QuestionFillBlank:
+			for _, a := range question.Answers {
+				answers = append(answers, "="+giftEscape(a.AnswerText))
+			}
+		case testsModels.QuestionNumeric:
+			for _, a := range question.Answers {
+				value := strings.Replace(strings.TrimSpace(a.AnswerText), ",", ".", 1)
+				answers = append(answers, "="+value+":"+strconv.FormatFloat(a.Tolerance, 'f', -1, 64))
+			}
+		case testsModels.QuestionMatching:
+			for _, a := range question.Answers {
+				answers = append(answers, "="+giftEscape(a.AnswerText)+" -> "+giftEscape(a.MatchText))
+			}
+		case testsModels.QuestionText:
+		default:
+			skipped = append(skipped, Skipped{
+				Name:   questionName(question.QuestionText),
+				Type:   question.QuestionType,
+				Reason: "not supported by GIFT",
+			})
+			continue
+		}
+
+		b.WriteString("::" + giftEscape(questionName(question.QuestionText)) + "::")
+		b.WriteString(giftEscape(question.QuestionText))
+		switch {
+		case question.QuestionType == testsModels.QuestionNumeric:
+			b.WriteString(" {#\n\t" + strings.Join(answers, "\n\t") + "\n}\n\n")
+		case len(answers) == 0:
+			b.WriteString(" {}\n\n")
+		default:
+			b.WriteString(" {\n\t" + strings.Join(answers, "\n\t") + "\n}\n\n")
+		}
+	}
+	return skipped
+}
@@ -0,0 +1,163 @@
+// Package interchange converts test questions from and to the Moodle XML and GIFT formats.
+package interchange
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported formats
+const (
+	FormatMoodleXML = "moodle_xml"
+	FormatGIFT      = "gift"
+)
+
+// Skipped is a question left out of an import or export
+type Skipped struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Section is a set of questions written under one category. Category is the path
+// below the course, e.g. the test title and the name of a question bank.
+type Section struct {
+	Category  []string
+	Questions []testsModels.Question
+}
+
+// Quiz is the result of parsing a file
+type Quiz struct {
+	Category  string // Last category of the file, usable as the test title
+	Questions []testsModels.Question
+	Skipped   []Skipped
+}
+
+// DetectFormat returns the format for a file name
+func DetectFormat(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xml":
+		return FormatMoodleXML, nil
+	case ".gift", ".txt":
+		return FormatGIFT, nil
+	}
+	return "", fmt.Errorf("unsupported file type %q, use .xml or .gift", filepath.Ext(filename))
+}
+
+// FileExtension returns the file extension for a format
+func FileExtension(format string) string {
+	if format == FormatGIFT {
+		return ".gift"
+	}
+	return ".xml"
+}
+
+// Parse reads questions from a file. Questions of unsupported types, and questions
+// that cannot be scored after conversion, are reported as skipped.
+func Parse(format string, data []byte) (*Quiz, error) {
+	var quiz *Quiz
+	var err error
+
+	switch format {
+	case FormatMoodleXML:
+		quiz, err = parseMoodleXML(data)
+	case FormatGIFT:
+		quiz, err = parseGIFT(data)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep only questions that can be scored
+	valid := quiz.Questions[:0]
+	for _, question := range quiz.Questions {
+		if err := scoring.Validate(question); err != nil {
+			quiz.Skipped = append(quiz.Skipped, Skipped{
+				Name:   questionName(question.QuestionText),
+				Type:   question.QuestionType,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		valid = append(valid, question)
+	}
+	quiz.Questions = valid
+	return quiz, nil
+}
+
+// Write converts questions into a file. Questions the format cannot express are reported as skipped.
+func Write(format, category string, questions []testsModels.Question) ([]byte, []Skipped, error) {
+	section := Section{Questions: questions}
+	if category != "" {
+		section.Category = []string{category}
+	}
+	return WriteSections(format, []Section{section})
+}
+
+// WriteSections converts sections of questions into a file, each under its own category.
+// Parse takes the last category of a file as its title.
+func WriteSections(format string, sections []Section) ([]byte, []Skipped, error) {
+	switch format {
+	case FormatMoodleXML:
+		return writeMoodleXML(sections)
+	case FormatGIFT:
+		data, skipped := writeGIFT(sections)
+		return data, skipped, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// categoryPath returns the category path of a section below the course
+func categoryPath(category []string) string {
+	path := "$course$"
+	for _, name := range category {
+		path += "/" + strings.ReplaceAll(name, "/", "-")
+	}
+	return path
+}
+
+// questionName shortens a question text into a name
+func questionName(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= 50 {
+		return text
+	}
+	return string([]rune(text)[:50]) + "…"
+}
+
+var (
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// stripHTML turns HTML question text into plain text
+func stripHTML(text string) string {
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// trueFalseAnswers are the answers of an imported true/false question
+func trueFalseAnswers(correct bool) []testsModels.Answer {
+	return []testsModels.Answer{
+		{AnswerText: "Верно", IsCorrect: correct},
+		{AnswerText: "Неверно", IsCorrect: !correct},
+	}
+}
@@ -0,0 +1,273 @@
+package interchange
+
+import (
+    testsModels "TeacherJournal/app/tests/models"
+    "TeacherJournal/app/tests/scoring"
+    "strings"
+    "testing"
+)
+
+const moodleSample = `<?xml version="1.0" encoding="UTF-8"?>
+<quiz>
+  <question type="category">
+    <category><text>$course$/Базы данных/SQL</text></category>
+  </question>
+  <question type="multichoice">
+    <name><text>СУБД</text></name>
+    <questiontext format="html"><text><![CDATA[<p>Какие из них <b>реляционные</b> СУБД?</p>]]></text></questiontext>
+    <defaultgrade>2.0000000</defaultgrade>
+    <single>false</single>
+    <answer fraction="50" format="html"><text>PostgreSQL</text></answer>
+    <answer fraction="50" format="html"><text>MySQL</text></answer>
+    <answer fraction="-100" format="html"><text>Redis</text></answer>
+  </question>
+  <question type="truefalse">
+    <questiontext format="html"><text>SQL - декларативный язык</text></questiontext>
+    <answer fraction="0"><text>true</text></answer>
+    <answer fraction="100"><text>false</text></answer>
+  </question>
+  <question type="numerical">
+    <questiontext format="html"><text>Сколько нормальных форм до НФБК?</text></questiontext>
+    <answer fraction="100"><text>3</text><tolerance>0</tolerance></answer>
+  </question>
+  <question type="matching">
+    <questiontext format="html"><text>Сопоставьте команды</text></questiontext>
+    <subquestion format="html"><text>SELECT</text><answer><text>Чтение</text></answer></subquestion>
+    <subquestion format="html"><text>DELETE</text><answer><text>Удаление</text></answer></subquestion>
+    <subquestion format="html"><text></text><answer><text>Лишнее</text></answer></subquestion>
+  </question>
+  <question type="calculated">
+    <name><text>Формула</text></name>
+    <questiontext format="html"><text>{a} + {b}</text></questiontext>
+  </question>
+  <question type="shortanswer">
+    <questiontext format="html"><text>Без ответов</text></questiontext>
+    <answer fraction="50"><text>почти</text></answer>
+  </question>
+</quiz>`
+
+func TestParseMoodleXML(t *testing.T) {
+    quiz, err := Parse(FormatMoodleXML, []byte(moodleSample))
+    if err != nil {
+        t.Fatalf("unexpected error %v", err)
+    }
+    if quiz.Category != "SQL" {
+        t.Fatalf("expected category SQL got %q", quiz.Category)
+    }
+    if len(quiz.Questions) != 4 {
+        t.Fatalf("expected 4 questions got %d: %+v", len(quiz.Questions), quiz.Questions)
+    }
+
+    multi := quiz.Questions[0]
+    if multi.QuestionType != testsModels.QuestionMultipleChoice || multi.Points != 2 ||
+        multi.QuestionText != "Какие из них реляционные СУБД?" {
+        t.Fatalf("unexpected multichoice question %+v", multi)
+    }
+    if !multi.Answers[0].IsCorrect || !multi.Answers[1].IsCorrect || multi.Answers[2].IsCorrect {
+        t.Fatalf("unexpected multichoice answers %+v", multi.Answers)
+    }
+
+    trueFalse := quiz.Questions[1]
+    if trueFalse.QuestionType != testsModels.QuestionSingleChoice || trueFalse.Answers[0].IsCorrect || !trueFalse.Answers[1].IsCorrect {
+        t.Fatalf("unexpected true/false question %+v", trueFalse)
+    }
+    if quiz.Questions[2].QuestionType != testsModels.QuestionNumeric || quiz.Questions[2].Answers[0].AnswerText != "3" {
+        t.Fatalf("unexpected numerical question %+v", quiz.Questions[2])
+    }
+    if matching := quiz.Questions[3]; len(matching.Answers) != 2 || matching.Answers[1].MatchText != "Удаление" {
+        t.Fatalf("unexpected matching question %+v", matching)
+    }
+
+    if len(quiz.Skipped) != 2 || quiz.Skipped[0].Type != "calculated" || quiz.Skipped[1].Type != testsModels.QuestionFillBlank {
+        t.Fatalf("unexpected skipped questions %+v", quiz.Skipped)
+    }
+}
+
+const giftSample = `// Вопросы по SQL
+$CATEGORY: $course$/SQL
+
+::Ключ::Первичный ключ может содержать NULL {F}
+
+::Команды::Какие команды относятся к DML? {
+    ~%50%INSERT
+    ~%50%UPDATE
+    ~%-100%CREATE
+}
+
+Столица Франции {=Париж =Paris}
+
+::Пи:: Число пи с точностью до сотых {#3.14:0.005}
+
+Диапазон {#1..5}
+
+Сопоставьте {=SELECT -> Чтение =DELETE -> Удаление}
+
+Оператор {=\=\= ~\!\= ~\:\=} сравнивает значения
+
+Опишите транзакцию {}
+
+Это просто описание без вопроса
+`
+
+func TestParseGIFT(t *testing.T) {
+    quiz, err := Parse(FormatGIFT, []byte(giftSample))
+    if err != nil {
+        t.Fatalf("unexpected error %v", err)
+    }
+    if quiz.Category != "SQL" {
+        t.Fatalf("expected category SQL got %q", quiz.Category)
+    }
+
+    wantTypes := []string{
+        testsModels.QuestionSingleChoice,
+        testsModels.QuestionMultipleChoice,
+        testsModels.QuestionFillBlank,
+        testsModels.QuestionNumeric,
+        testsModels.QuestionNumeric,
+        testsModels.QuestionMatching,
+        testsModels.QuestionSingleChoice,
+        testsModels.QuestionText,
+    }
+    if len(quiz.Questions) != len(wantTypes) {
+        t.Fatalf("expected %d questions got %d: %+v", len(wantTypes), len(quiz.Questions), quiz.Questions)
+    }
+    for i, want := range wantTypes {
+        if quiz.Questions[i].QuestionType != want {
+            t.Fatalf("question %d: expected %s got %s", i, want, quiz.Questions[i].QuestionType)
+        }
+    }
+
+    if answers := quiz.Questions[0].Answers; answers[0].IsCorrect || !answers[1].IsCorrect {
+        t.Fatalf("expected the false answer to be correct: %+v", answers)
+    }
+    if answers := quiz.Questions[1].Answers; !answers[0].IsCorrect || !answers[1].IsCorrect || answers[2].IsCorrect {
+        t.Fatalf("unexpected weighted answers %+v", answers)
+    }
+    if answer := quiz.Questions[3].Answers[0]; answer.AnswerText != "3.14" || answer.Tolerance != 0.005 {
+        t.Fatalf("unexpected numeric answer %+v", answer)
+    }
+    if answer := quiz.Questions[4].Answers[0]; answer.AnswerText != "3" || answer.Tolerance != 2 {
+        t.Fatalf("unexpected range answer %+v", answer)
+    }
+    missing := quiz.Questions[6]
+    if missing.QuestionText != "Оператор _____ сравнивает значения" || missing.Answers[0].AnswerText != "==" || !missing.Answers[0].IsCorrect {
+        t.Fatalf("unexpected missing word question %+v", missing)
+    }
+
+    if len(quiz.Skipped) != 1 || quiz.Skipped[0].Reason != "not a question" {
+        t.Fatalf("unexpected skipped questions %+v", quiz.Skipped)
+    }
+}
+
+func sampleQuestions() []testsModels.Question {
+    return []testsModels.Question{
+        {QuestionType: testsModels.QuestionSingleChoice, QuestionText: "2 + 2 = ?", Points: 1, Answers: []testsModels.Answer{
+            {AnswerText: "4", IsCorrect: true}, {AnswerText: "5"},
+        }},
+        {QuestionType: testsModels.QuestionMultipleChoice, QuestionText: "Чётные числа", Points: 2, Answers: []testsModels.Answer{
+            {AnswerText: "2", IsCorrect: true}, {AnswerText: "4", IsCorrect: true}, {AnswerText: "5"},
+        }},
+        {QuestionType: testsModels.QuestionFillBlank, QuestionText: "Столица России", Points: 1, Answers: []testsModels.Answer{
+            {AnswerText: "Москва", IsCorrect: true}, {AnswerText: "Moscow", IsCorrect: true},
+        }},
+        {QuestionType: testsModels.QuestionNumeric, QuestionText: "Число e", Points: 1, Answers: []testsModels.Answer{
+            {AnswerText: "2,72", IsCorrect: true, Tolerance: 0.01},
+        }},
+        {QuestionType: testsModels.QuestionMatching, QuestionText: "Сопоставьте", Points: 1, Answers: []testsModels.Answer{
+            {AnswerText: "H2O", MatchText: "Вода"}, {AnswerText: "NaCl", MatchText: "Соль"},
+        }},
+        {QuestionType: testsModels.QuestionText, QuestionText: "Объясните {термин}", Points: 3},
+        {QuestionType: testsModels.QuestionOrdering, QuestionText: "Упорядочите", Points: 1, Answers: []testsModels.Answer{
+            {ID: 2, AnswerText: "Второй", Position: 2}, {ID: 1, AnswerText: "Первый", Position: 1},
+        }},
+    }
+}
+
+func TestRoundTrip(t *testing.T) {
+    for _, format := range []string{FormatMoodleXML, FormatGIFT} {
+        questions := sampleQuestions()
+        data, skipped, err := Write(format, "Химия", questions)
+        if err != nil {
+            t.Fatalf("%s: unexpected error %v", format, err)
+        }
+
+        wantCount := len(questions)
+        if format == FormatGIFT {
+            // GIFT has no ordering questions
+            wantCount--
+            if len(skipped) != 1 || skipped[0].Type != testsModels.QuestionOrdering {
+                t.Fatalf("%s: expected the ordering question to be skipped: %+v", format, skipped)
+            }
+        } else if len(skipped) != 0 {
+            t.Fatalf("%s: unexpected skipped questions %+v", format, skipped)
+        }
+
+        quiz, err := Parse(format, data)
+        if err != nil {
+            t.Fatalf("%s: cannot parse own output: %v\n%s", format, err, data)
+        }
+        if quiz.Category != "Химия" || len(quiz.Questions) != wantCount || len(quiz.Skipped) != 0 {
+            t.Fatalf("%s: unexpected round trip %q %d %+v\n%s", format, quiz.Category, len(quiz.Questions), quiz.Skipped, data)
+        }
+
+        for i, got := range quiz.Questions {
+            want := questions[i]
+            if got.QuestionType != want.QuestionType || got.QuestionText != want.QuestionText || len(got.Answers) != len(want.Answers) {
+                t.Fatalf("%s: question %d changed: %+v", format, i, got)
+            }
+            if format == FormatMoodleXML && got.Points != want.Points {
+                t.Fatalf("%s: question %d points changed: %v", format, i, got.Points)
+            }
+            for j := range want.Answers {
+                if got.Answers[j].IsCorrect != (want.Answers[j].IsCorrect || scoring.AllAnswersAccepted(want.QuestionType)) ||
+                    got.Answers[j].MatchText != want.Answers[j].MatchText {
+                    t.Fatalf("%s: question %d answer %d changed: %+v", format, i, j, got.Answers[j])
+                }
+            }
+        }
+
+        if format == FormatMoodleXML {
+            ordering := quiz.Questions[6]
+            if ordering.Answers[0].AnswerText != "Первый" || ordering.Answers[0].Position != 1 {
+                t.Fatalf("unexpected ordering items %+v", ordering.Answers)
+            }
+        }
+    }
+}
+
+func TestWriteSections(t *testing.T) {
+    questions := sampleQuestions()
+    sections := []Section{
+        {Category: []string{"Химия", "Банк/1 (2 random)"}, Questions: questions[:2]},
+        {Category: []string{"Химия"}, Questions: questions[2:4]},
+    }
+    for _, format := range []string{FormatMoodleXML, FormatGIFT} {
+        data, _, err := WriteSections(format, sections)
+        if err != nil {
+            t.Fatalf("%s: unexpected error %v", format, err)
+        }
+        if !strings.Contains(string(data), "$course$/Химия/Банк-1 (2 random)") {
+            t.Fatalf("%s: expected the bank category\n%s", format, data)
+        }
+
+        quiz, err := Parse(format, data)
+        if err != nil {
+            t.Fatalf("%s: cannot parse own output: %v", format, err)
+        }
+        if quiz.Category != "Химия" || len(quiz.Questions) != 4 {
+            t.Fatalf("%s: expected all questions under the test title, got %q %d", format, quiz.Category, len(quiz.Questions))
+        }
+    }
+}
+
+func TestDetectFormat(t *testing.T) {
+    if format, _ := DetectFormat("quiz.XML"); format != FormatMoodleXML {
+        t.Fatalf("expected Moodle XML got %q", format)
+    }
+    if format, _ := DetectFormat("quiz.gift"); format != FormatGIFT {
+        t.Fatalf("expected GIFT got %q", format)
+    }
+    if _, err := DetectFormat("quiz.docx"); err == nil {
+        t.Fatalf("expected an error for .docx")
+    }
+}
@@ -0,0 +1,325 @@
+package interchange
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"TeacherJournal/app/tests/scoring"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Moodle XML question types
+const (
+	moodleCategory    = "category"
+	moodleMultichoice = "multichoice"
+	moodleTrueFalse   = "truefalse"
+	moodleShortAnswer = "shortanswer"
+	moodleNumerical   = "numerical"
+	moodleMatching    = "matching"
+	moodleEssay       = "essay"
+	moodleOrdering    = "ordering"
+	moodleDescription = "description"
+)
+
+type xmlQuiz struct {
+	XMLName   xml.Name      `xml:"quiz"`
+	Questions []xmlQuestion `xml:"question"`
+}
+
+type xmlText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type xmlQuestion struct {
+	Type         string           `xml:"type,attr"`
+	Category     *xmlText         `xml:"category,omitempty"`
+	Name         *xmlText         `xml:"name,omitempty"`
+	QuestionText *xmlText         `xml:"questiontext,omitempty"`
+	DefaultGrade string           `xml:"defaultgrade,omitempty"`
+	Single       string           `xml:"single,omitempty"`
+	UseCase      string           `xml:"usecase,omitempty"`
+	Answers      []xmlAnswer      `xml:"answer"`
+	Subquestions []xmlSubquestion `xml:"subquestion"`
+}
+
+type xmlAnswer struct {
+	Fraction  string `xml:"fraction,attr"`
+	Format    string `xml:"format,attr,omitempty"`
+	Text      string `xml:"text"`
+	Tolerance string `xml:"tolerance,omitempty"`
+}
+
+type xmlSubquestion struct {
+	Format string  `xml:"format,attr,omitempty"`
+	Text   string  `xml:"text"`
+	Answer xmlText `xml:"answer"`
+}
+
+// plainText returns the text of a Moodle text element without markup
+func (t *xmlText) plainText() string {
+	if t == nil {
+		return ""
+	}
+	switch t.Format {
+	case "plain_text", "markdown":
+		return strings.TrimSpace(t.Text)
+	}
+	return stripHTML(t.Text)
+}
+
+// parseMoodleXML reads a Moodle XML quiz
+func parseMoodleXML(data []byte) (*Quiz, error) {
+	var file xmlQuiz
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid Moodle XML: %v", err)
+	}
+
+	quiz := &Quiz{}
+	for _, q := range file.Questions {
+		if q.Type == moodleCategory {
+			if q.Category != nil {
+				quiz.Category = categoryName(q.Category.Text)
+			}
+			continue
+		}
+
+		text := q.QuestionText.plainText()
+		name := q.Name.plainText()
+		if name == "" {
+			name = questionName(text)
+		}
+
+		question, ok := moodleQuestion(q, text)
+		if !ok {
+			reason := "unsupported question type"
+			if q.Type == moodleDescription {
+				reason = "not a question"
+			}
+			quiz.Skipped = append(quiz.Skipped, Skipped{Name: name, Type: q.Type, Reason: reason})
+			continue
+		}
+		quiz.Questions = append(quiz.Questions, question)
+	}
+	return quiz, nil
+}
+
+// moodleQuestion converts a Moodle question of a supported type
+func moodleQuestion(q xmlQuestion, text string) (testsModels.Question, bool) {
+	question := testsModels.Question{
+		QuestionText: text,
+		Points:       1,
+	}
+	if grade, err := strconv.ParseFloat(strings.TrimSpace(q.DefaultGrade), 64); err == nil && grade > 0 {
+		question.Points = grade
+	}
+
+	switch q.Type {
+	case moodleMultichoice:
+		question.QuestionType = testsModels.QuestionMultipleChoice
+		single := strings.EqualFold(strings.TrimSpace(q.Single), "true") || strings.TrimSpace(q.Single) == "1"
+		if single {
+			question.QuestionType = testsModels.QuestionSingleChoice
+		}
+		for _, a := range q.Answers {
+			fraction := parseFraction(a.Fraction)
+			correct := fraction > 0
+			if single {
+				correct = fraction >= 100
+			}
+			question.Answers = append(question.Answers, testsModels.Answer{
+				AnswerText: answerText(a),
+				IsCorrect:  correct,
+			})
+		}
+	case moodleTrueFalse:
+		question.QuestionType = testsModels.QuestionSingleChoice
+		correct := true
+		for _, a := range q.Answers {
+			if parseFraction(a.Fraction) >= 100 {
+				correct = strings.EqualFold(strings.TrimSpace(a.Text), "true")
+			}
+		}
+		question.Answers = trueFalseAnswers(correct)
+	case moodleShortAnswer:
+		question.QuestionType = testsModels.QuestionFillBlank
+		for _, a := range q.Answers {
+			if parseFraction(a.Fraction) >= 100 {
+				question.Answers = append(question.Answers, testsModels.Answer{AnswerText: answerText(a), IsCorrect: true})
+			}
+		}
+	case moodleNumerical:
+		question.QuestionType = testsModels.QuestionNumeric
+		for _, a := range q.Answers {
+			value := strings.TrimSpace(a.Text)
+			if parseFraction(a.Fraction) < 100 || value == "*" {
+				continue
+			}
+			tolerance, _ := strconv.ParseFloat(strings.TrimSpace(a.Tolerance), 64)
+			question.Answers = append(question.Answers, testsModels.Answer{
+				AnswerText: value,
+				IsCorrect:  true,
+				Tolerance:  math.Abs(tolerance),
+			})
+		}
+	case moodleMatching:
+		question.QuestionType = testsModels.QuestionMatching
+		for _, sub := range q.Subquestions {
+			left := (&xmlText{Format: sub.Format, Text: sub.Text}).plainText()
+			if left == "" {
+				continue // Extra wrong right sides are not supported
+			}
+			question.Answers = append(question.Answers, testsModels.Answer{
+				AnswerText: left,
+				MatchText:  strings.TrimSpace(sub.Answer.Text),
+			})
+		}
+	case moodleEssay:
+		question.QuestionType = testsModels.QuestionText
+	case moodleOrdering:
+		// Items are listed in the correct order
+		question.QuestionType = testsModels.QuestionOrdering
+		for i, a := range q.Answers {
+			question.Answers = append(question.Answers, testsModels.Answer{
+				AnswerText: answerText(a),
+				Position:   i + 1,
+			})
+		}
+	default:
+		return question, false
+	}
+	return question, true
+}
+
+// answerText returns the plain text of an answer
+func answerText(a xmlAnswer) string {
+	return (&xmlText{Format: a.Format, Text: a.Text}).plainText()
+}
+
+// parseFraction reads a Moodle answer fraction in percent
+func parseFraction(value string) float64 {
+	fraction, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return fraction
+}
+
+// formatFraction writes a Moodle answer fraction the way Moodle exports it
+func formatFraction(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1e5)/1e5, 'f', -1, 64)
+}
+
+// categoryName returns the last part of a category path like "$course$/Базы данных/SQL"
+func categoryName(path string) string {
+	path = strings.TrimSpace(path)
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	return strings.TrimSpace(path)
+}
+
+// writeMoodleXML writes sections of questions as a Moodle XML quiz
+func writeMoodleXML(sections []Section) ([]byte, []Skipped, error) {
+	file := xmlQuiz{}
+	var skipped []Skipped
+	for _, section := range sections {
+		if len(section.Category) > 0 {
+			file.Questions = append(file.Questions, xmlQuestion{
+				Type:     moodleCategory,
+				Category: &xmlText{Text: categoryPath(section.Category)},
+			})
+		}
+		skipped = append(skipped, writeMoodleQuestions(&file, section.Questions)...)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(file); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), skipped, nil
+}
+
+// writeMoodleQuestions adds questions to a Moodle XML quiz
+func writeMoodleQuestions(file *xmlQuiz, questions []testsModels.Question) []Skipped {
+	var skipped []Skipped
+	for _, question := range questions {
+		q := xmlQuestion{
+			Name:         &xmlText{Text: questionName(question.QuestionText)},
+			QuestionText: &xmlText{Format: "plain_text", Text: question.QuestionText},
+			DefaultGrade: strconv.FormatFloat(question.Points, 'f', 7, 64),
+		}
+
+		switch question.QuestionType {
+		case testsModels.QuestionSingleChoice, testsModels.QuestionMultipleChoice:
+			q.Type = moodleMultichoice
+			q.Single = "true"
+			correctFraction, wrongFraction := 100.0, 0.0
+			if question.QuestionType == testsModels.QuestionMultipleChoice {
+				// Matches the partial credit: each wrong choice takes away one correct share
+				q.Single = "false"
+				correctCount := 0
+				for _, a := range question.Answers {
+					if a.IsCorrect {
+						correctCount++
+					}
+				}
+				if correctCount > 0 {
+					correctFraction = 100 / float64(correctCount)
+					wrongFraction = -correctFraction
+				}
+			}
+			for _, a := range question.Answers {
+				fraction := wrongFraction
+				if a.IsCorrect {
+					fraction = correctFraction
+				}
+				q.Answers = append(q.Answers, xmlAnswer{Fraction: formatFraction(fraction), Format: "plain_text", Text: a.AnswerText})
+			}
+		case testsModels.QuestionFillBlank:
+			q.Type = moodleShortAnswer
+			q.UseCase = "0"
+			for _, a := range question.Answers {
+				q.Answers = append(q.Answers, xmlAnswer{Fraction: "100", Format: "plain_text", Text: a.AnswerText})
+			}
+		case testsModels.QuestionNumeric:
+			q.Type = moodleNumerical
+			for _, a := range question.Answers {
+				q.Answers = append(q.Answers, xmlAnswer{
+					Fraction:  "100",
+					Text:      strings.Replace(strings.TrimSpace(a.AnswerText), ",", ".", 1),
+					Tolerance: strconv.FormatFloat(a.Tolerance, 'f', -1, 64),
+				})
+			}
+		case testsModels.QuestionMatching:
+			q.Type = moodleMatching
+			for _, a := range question.Answers {
+				q.Subquestions = append(q.Subquestions, xmlSubquestion{
+					Format: "plain_text",
+					Text:   a.AnswerText,
+					Answer: xmlText{Text: a.MatchText},
+				})
+			}
+		case testsModels.QuestionText:
+			q.Type = moodleEssay
+		case testsModels.QuestionOrdering:
+			q.Type = moodleOrdering
+			for i, a := range scoring.CorrectOrder(question.Answers) {
+				q.Answers = append(q.Answers, xmlAnswer{Fraction: strconv.Itoa(i + 1), Format: "plain_text", Text: a.AnswerText})
+			}
+		default:
+			skipped = append(skipped, Skipped{
+				Name:   questionName(question.QuestionText),
+				Type:   question.QuestionType,
+				Reason: "unsupported question type",
+			})
+			continue
+		}
+		file.Questions = append(file.Questions, q)
+	}
+	return skipped
+}
@@ -77,21 +77,32 @@ func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// StudentAuthMiddleware verifies student authentication
+// StudentAuthMiddleware validates a student session token and puts the student ID into the context
 func StudentAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// For student auth, we'll use a simplified approach
-		// Get student ID and email from either a token or session
-
-		// TODO: Implement proper student authentication
-		// For now, we'll just check if student_id is provided in query params
-		studentID := r.URL.Query().Get("student_id")
-		if studentID == "" {
+		// Get token from Authorization header
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
 			utils.RespondWithError(w, http.StatusUnauthorized, "Student authentication required")
 			return
 		}
 
-		// Continue with the request
-		next.ServeHTTP(w, r)
+		// Check if format is "Bearer <token>"
+		tokenParts := strings.Split(authHeader, " ")
+		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Authorization header format must be Bearer <token>")
+			return
+		}
+
+		// Parse and validate the student token
+		claims, err := utils.ParseStudentJWT(tokenParts[1])
+		if err != nil {
+			utils.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired student session")
+			return
+		}
+
+		// Add student info to request context
+		ctx := utils.SetStudentContext(r.Context(), claims.StudentID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
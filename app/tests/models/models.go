@@ -2,24 +2,51 @@ package models
 
 import (
 	dashboardModels "TeacherJournal/app/dashboard/models"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+// Question difficulty levels
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// Question types
+const (
+	QuestionSingleChoice   = "single_choice"
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionText           = "text"
+	QuestionNumeric        = "numeric"
+	QuestionMatching       = "matching"
+	QuestionOrdering       = "ordering"
+	QuestionFillBlank      = "fill_blank"
 )
 
 // Test represents a test created by a teacher
 type Test struct {
-	ID              int                  `gorm:"primaryKey" json:"id"`
-	Title           string               `gorm:"not null" json:"title"`
-	Description     string               `gorm:"type:text" json:"description"`
-	Subject         string               `gorm:"not null" json:"subject"`
-	CreatorID       int                  `gorm:"index" json:"creator_id"`
-	Creator         dashboardModels.User `gorm:"foreignKey:CreatorID" json:"-"`
-	IsActive        bool                 `gorm:"default:true" json:"is_active"`
-	CreatedAt       time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt       time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	MaxAttempts     int                  `gorm:"default:1" json:"max_attempts"`
-	TimePerQuestion int                  `gorm:"default:60" json:"time_per_question"` // Time in seconds
-	Questions       []Question           `json:"questions,omitempty"`
-	TestGroups      []TestGroup          `gorm:"foreignKey:TestID" json:"test_groups,omitempty"` // Добавленное поле
+	ID               int                  `gorm:"primaryKey" json:"id"`
+	Title            string               `gorm:"not null" json:"title"`
+	Description      string               `gorm:"type:text" json:"description"`
+	Subject          string               `gorm:"not null" json:"subject"`
+	CreatorID        int                  `gorm:"index" json:"creator_id"`
+	Creator          dashboardModels.User `gorm:"foreignKey:CreatorID" json:"-"`
+	IsActive         bool                 `gorm:"default:true" json:"is_active"`
+	CreatedAt        time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt        time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	MaxAttempts      int                  `gorm:"default:1" json:"max_attempts"`
+	TimePerQuestion  int                  `gorm:"default:60" json:"time_per_question"` // Time in seconds
+	TimeLimit        int                  `gorm:"default:0" json:"time_limit"`         // Whole test time in minutes, 0 - no limit
+	ShuffleQuestions bool                 `gorm:"default:false" json:"shuffle_questions"`
+	ShuffleAnswers   bool                 `gorm:"default:false" json:"shuffle_answers"`
+	Questions        []Question           `json:"questions,omitempty"`
+	Rules            []TestRule           `gorm:"foreignKey:TestID" json:"rules,omitempty"`
+	TestGroups       []TestGroup          `gorm:"foreignKey:TestID" json:"test_groups,omitempty"` // Добавленное поле
 }
 
 // TestGroup представляет связь между тестом и группой студентов
@@ -27,46 +54,156 @@ type TestGroup struct {
 	ID        int       `gorm:"primaryKey" json:"id"`
 	TestID    int       `gorm:"index" json:"test_id"`
 	Test      Test      `gorm:"foreignKey:TestID" json:"-"`
+	GroupID   *int      `gorm:"index" json:"group_id,omitempty"`
 	GroupName string    `gorm:"not null" json:"group_name"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// Schedule of the test for this group
+	OpensAt     *time.Time `json:"opens_at"`                      // Nil - open right away
+	ClosesAt    *time.Time `json:"closes_at"`                     // Nil - never closes
+	AccessCode  string     `gorm:"default:''" json:"access_code"` // Code students enter to start, empty - none
+	MaxAttempts *int       `json:"max_attempts"`                  // Overrides the test's limit when set
+}
+
+// TestGradeLink maps a test to a lab of its subject. Completed attempts write
+// the student's lab grade in the dashboard.
+type TestGradeLink struct {
+	ID        int       `gorm:"primaryKey" json:"id"`
+	TestID    int       `gorm:"uniqueIndex" json:"test_id"`
+	Test      Test      `gorm:"foreignKey:TestID" json:"-"`
+	Subject   string    `gorm:"not null" json:"subject"` // Subject of the lab grades
+	LabNumber int       `gorm:"not null" json:"lab_number"`
+	Policy    string    `gorm:"size:16;not null;default:'best'" json:"policy"` // best or last attempt
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
-// Question represents a question in a test
+// QuestionBank is a reusable set of questions on a subject that tests draw from
+type QuestionBank struct {
+	ID          int                  `gorm:"primaryKey" json:"id"`
+	Title       string               `gorm:"not null" json:"title"`
+	Subject     string               `gorm:"not null" json:"subject"`
+	Description string               `gorm:"type:text" json:"description"`
+	CreatorID   int                  `gorm:"index" json:"creator_id"`
+	Creator     dashboardModels.User `gorm:"foreignKey:CreatorID" json:"-"`
+	CreatedAt   time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time            `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Questions   []Question           `gorm:"foreignKey:BankID" json:"questions,omitempty"`
+}
+
+// TestRule draws random questions from a bank into every attempt of a test,
+// e.g. 5 easy questions tagged "sql"
+type TestRule struct {
+	ID         int            `gorm:"primaryKey" json:"id"`
+	TestID     int            `gorm:"index" json:"test_id"`
+	BankID     int            `gorm:"index" json:"bank_id"`
+	Bank       QuestionBank   `gorm:"foreignKey:BankID" json:"-"`
+	Count      int            `gorm:"not null" json:"count"`
+	Difficulty string         `json:"difficulty"`              // Empty - any difficulty
+	Tags       pq.StringArray `gorm:"type:text[]" json:"tags"` // Questions must have all of these tags
+	Position   int            `gorm:"not null" json:"position"`
+}
+
+// Question represents a question in a test or in a question bank
 type Question struct {
-	ID           int       `gorm:"primaryKey" json:"id"`
-	TestID       int       `gorm:"index" json:"-"`
-	Test         Test      `gorm:"foreignKey:TestID" json:"-"`
-	QuestionText string    `gorm:"type:text;not null" json:"question_text"`
-	QuestionType string    `gorm:"default:multiple_choice" json:"question_type"` // multiple_choice, single_choice, text
-	Position     int       `gorm:"not null" json:"position"`
-	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	Answers      []Answer  `json:"answers,omitempty"`
+	ID           int            `gorm:"primaryKey" json:"id"`
+	TestID       *int           `gorm:"index" json:"-"` // Set for questions added directly to a test
+	Test         Test           `gorm:"foreignKey:TestID" json:"-"`
+	BankID       *int           `gorm:"index" json:"bank_id,omitempty"` // Set for bank questions
+	QuestionText string         `gorm:"type:text;not null" json:"question_text"`
+	QuestionType string         `gorm:"default:multiple_choice" json:"question_type"` // One of the Question* types
+	Points       float64        `gorm:"not null;default:1" json:"points"`             // Weight of the question in the attempt score
+	Difficulty   string         `gorm:"default:medium" json:"difficulty"`
+	Tags         pq.StringArray `gorm:"type:text[]" json:"tags"`
+	Position     int            `gorm:"not null" json:"position"`
+	CreatedAt    time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Answers      []Answer       `json:"answers,omitempty"`
 }
 
-// Answer represents an answer option for a question
+// Answer represents an answer option for a question. Depending on the question type it is
+// a choice, an accepted spelling (fill_blank), a value (numeric), a pair (matching)
+// or an item to put in order (ordering).
 type Answer struct {
 	ID         int       `gorm:"primaryKey" json:"id"`
 	QuestionID int       `gorm:"index" json:"question_id"`
 	Question   Question  `gorm:"foreignKey:QuestionID" json:"-"`
 	AnswerText string    `gorm:"type:text;not null" json:"answer_text"`
 	IsCorrect  bool      `gorm:"not null" json:"is_correct,omitempty"`
+	MatchText  string    `gorm:"type:text" json:"match_text,omitempty"` // Right side of a matching pair
+	Tolerance  float64   `gorm:"default:0" json:"tolerance,omitempty"`  // Allowed deviation of a numeric answer
+	Position   int       `gorm:"default:0" json:"position,omitempty"`   // Correct place of an ordering item
 	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at,omitempty"`
 	UpdatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at,omitempty"`
 }
 
+// ResponseAnswer is the structured answer a student gives to a question
+type ResponseAnswer struct {
+	AnswerIDs []int          `json:"answer_ids,omitempty"` // Chosen answers of choice questions
+	Text      string         `json:"text,omitempty"`       // Text, fill_blank and numeric answers
+	Number    *float64       `json:"number,omitempty"`     // Numeric answer sent as a number
+	Matches   map[int]string `json:"matches,omitempty"`    // Left answer ID to the chosen right side
+	Order     []int          `json:"order,omitempty"`      // Answer IDs in the order given by the student
+}
+
+// Value stores the answer as JSON
+func (a ResponseAnswer) Value() (driver.Value, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan reads the answer from JSON
+func (a *ResponseAnswer) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*a = ResponseAnswer{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return errors.New("unsupported response answer type")
+	}
+}
+
 // StudentResponse represents a student's response to a question
 type StudentResponse struct {
-	ID          int       `gorm:"primaryKey" json:"id"`
-	AttemptID   int       `gorm:"index" json:"attempt_id"`
-	QuestionID  int       `gorm:"index" json:"question_id"`
-	Question    Question  `gorm:"foreignKey:QuestionID" json:"-"`
-	AnswerID    *int      `gorm:"index" json:"answer_id"`
-	Answer      *Answer   `gorm:"foreignKey:AnswerID" json:"-"`
-	TextAnswer  string    `gorm:"type:text" json:"text_answer"` // For text-based questions
-	IsCorrect   bool      `json:"is_correct"`
-	TimeSpent   int       `json:"time_spent"` // Time in seconds
-	SubmittedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"submitted_at"`
+	ID          int            `gorm:"primaryKey" json:"id"`
+	AttemptID   int            `gorm:"index" json:"attempt_id"` // Unique with QuestionID, the index is created in InitDB
+	QuestionID  int            `gorm:"index" json:"question_id"`
+	Question    Question       `gorm:"foreignKey:QuestionID" json:"-"`
+	AnswerID    *int           `gorm:"index" json:"answer_id"`
+	Answer      *Answer        `gorm:"foreignKey:AnswerID" json:"-"`
+	TextAnswer  string         `gorm:"type:text" json:"text_answer"` // For text-based questions
+	Data        ResponseAnswer `gorm:"column:answer_data;type:jsonb" json:"answer_data"`
+	IsCorrect   bool           `json:"is_correct"` // Full points earned
+	Points      float64        `gorm:"not null;default:0" json:"points"`
+	MaxPoints   float64        `gorm:"not null;default:0" json:"max_points"`
+	TimeSpent   int            `json:"time_spent"`                // Time in seconds, measured by the server
+	Late        bool           `gorm:"default:false" json:"late"` // Arrived after the deadline and scored zero
+	SubmittedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"submitted_at"`
+
+	// Free text answers are graded by the teacher; until then they score zero
+	NeedsReview   bool       `gorm:"index;default:false" json:"needs_review"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	ReviewerID    *int       `json:"reviewer_id"`
+	ReviewComment string     `gorm:"type:text" json:"review_comment"`
+}
+
+// AttemptQuestion is a question drawn for an attempt. The question and answer order
+// is frozen when the attempt starts; ServedAt and Deadline are stamped when it is served.
+type AttemptQuestion struct {
+	ID          int           `gorm:"primaryKey" json:"id"`
+	AttemptID   int           `gorm:"uniqueIndex:idx_attempt_question" json:"attempt_id"`
+	QuestionID  int           `gorm:"uniqueIndex:idx_attempt_question" json:"question_id"`
+	Position    int           `gorm:"not null;default:0" json:"position"`
+	AnswerOrder pq.Int64Array `gorm:"type:integer[]" json:"answer_order"` // Answer IDs in display order
+	ServedAt    *time.Time    `json:"served_at"`
+	Deadline    *time.Time    `json:"deadline"` // Nil when neither the question nor the test is timed
 }
 
 // TestAttempt represents a student's attempt at a test
@@ -78,8 +215,25 @@ type TestAttempt struct {
 	Student        dashboardModels.Student `gorm:"foreignKey:StudentID" json:"-"`
 	StartTime      time.Time               `gorm:"default:CURRENT_TIMESTAMP" json:"start_time"`
 	EndTime        *time.Time              `json:"end_time"`
-	Score          int                     `json:"score"`
+	Deadline       *time.Time              `json:"deadline"` // Whole test deadline, nil without a time limit
+	LastActivityAt *time.Time              `gorm:"index" json:"last_activity_at"`
+	Score          float64                 `gorm:"not null;default:0" json:"score"`     // Sum of the response points
+	MaxScore       float64                 `gorm:"not null;default:0" json:"max_score"` // Sum of the question points
 	TotalQuestions int                     `json:"total_questions"`
 	Completed      bool                    `gorm:"default:false" json:"completed"`
+	IPAddress      string                  `gorm:"size:64;index" json:"ip_address"` // Client address when the attempt started
+	UserAgent      string                  `gorm:"type:text" json:"user_agent"`
 	Responses      []StudentResponse       `gorm:"foreignKey:AttemptID" json:"-"`
 }
+
+// AttemptEvent is a client-side event during an attempt, such as leaving the test page
+// or pasting text, recorded as a cheating signal
+type AttemptEvent struct {
+	ID         int       `gorm:"primaryKey" json:"id"`
+	AttemptID  int       `gorm:"index" json:"attempt_id"`
+	QuestionID *int      `json:"question_id"` // Question on screen, if known
+	EventType  string    `gorm:"size:32;not null" json:"event_type"`
+	Details    string    `gorm:"type:text" json:"details,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"` // Client time, CreatedAt is the server time
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
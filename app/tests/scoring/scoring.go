@@ -0,0 +1,368 @@
+// Package scoring checks student answers and turns them into points.
+package scoring
+
+import (
+	testsModels "TeacherJournal/app/tests/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAnswer is returned when an answer refers to options of another question
+// or does not fit the question type
+var ErrInvalidAnswer = errors.New("invalid answer for this question")
+
+// epsilon absorbs float rounding when comparing fractions and numbers
+const epsilon = 1e-9
+
+// KnownType reports whether the question type is supported
+func KnownType(questionType string) bool {
+	switch questionType {
+	case testsModels.QuestionSingleChoice, testsModels.QuestionMultipleChoice, testsModels.QuestionText,
+		testsModels.QuestionNumeric, testsModels.QuestionMatching, testsModels.QuestionOrdering,
+		testsModels.QuestionFillBlank:
+		return true
+	}
+	return false
+}
+
+// HidesAnswers reports whether the answers of a question are the solution itself
+// and must not be shown to students
+func HidesAnswers(questionType string) bool {
+	switch questionType {
+	case testsModels.QuestionText, testsModels.QuestionNumeric, testsModels.QuestionFillBlank:
+		return true
+	}
+	return false
+}
+
+// NeedsReview reports whether answers to the question type are graded by the teacher
+func NeedsReview(questionType string) bool {
+	return questionType == testsModels.QuestionText
+}
+
+// AllAnswersAccepted reports whether every answer of the question type is an accepted
+// answer rather than an option that may be wrong
+func AllAnswersAccepted(questionType string) bool {
+	switch questionType {
+	case testsModels.QuestionNumeric, testsModels.QuestionFillBlank:
+		return true
+	}
+	return false
+}
+
+// Validate checks that a question has the answers its type needs to be scored
+func Validate(question testsModels.Question) error {
+	if !KnownType(question.QuestionType) {
+		return fmt.Errorf("unknown question type %q", question.QuestionType)
+	}
+	if question.Points < 0 {
+		return errors.New("question points must not be negative")
+	}
+
+	switch question.QuestionType {
+	case testsModels.QuestionSingleChoice, testsModels.QuestionMultipleChoice:
+		for _, answer := range question.Answers {
+			if answer.IsCorrect {
+				return nil
+			}
+		}
+		return errors.New("a choice question needs at least one correct answer")
+	case testsModels.QuestionNumeric:
+		if len(question.Answers) == 0 {
+			return errors.New("a numeric question needs at least one value")
+		}
+		for _, answer := range question.Answers {
+			if _, err := ParseNumber(answer.AnswerText); err != nil {
+				return fmt.Errorf("%q is not a number", answer.AnswerText)
+			}
+			if answer.Tolerance < 0 {
+				return errors.New("tolerance must not be negative")
+			}
+		}
+	case testsModels.QuestionFillBlank:
+		if len(question.Answers) == 0 {
+			return errors.New("a fill in the blank question needs at least one accepted answer")
+		}
+	case testsModels.QuestionMatching:
+		if len(question.Answers) < 2 {
+			return errors.New("a matching question needs at least two pairs")
+		}
+		for _, answer := range question.Answers {
+			if strings.TrimSpace(answer.MatchText) == "" {
+				return fmt.Errorf("pair %q has no match", answer.AnswerText)
+			}
+		}
+	case testsModels.QuestionOrdering:
+		if len(question.Answers) < 2 {
+			return errors.New("an ordering question needs at least two items")
+		}
+	}
+	return nil
+}
+
+// Check returns the share of the question points earned by an answer, from 0 to 1.
+// An empty answer earns nothing. Free text answers earn nothing until the teacher grades them.
+func Check(question testsModels.Question, answer testsModels.ResponseAnswer) (float64, error) {
+	switch question.QuestionType {
+	case testsModels.QuestionSingleChoice:
+		return checkSingleChoice(question.Answers, answer.AnswerIDs)
+	case testsModels.QuestionMultipleChoice:
+		return checkMultipleChoice(question.Answers, answer.AnswerIDs)
+	case testsModels.QuestionText:
+		return 0, nil
+	case testsModels.QuestionFillBlank:
+		return checkFillBlank(question.Answers, answer.Text), nil
+	case testsModels.QuestionNumeric:
+		return checkNumeric(question.Answers, answer)
+	case testsModels.QuestionMatching:
+		return checkMatching(question.Answers, answer.Matches)
+	case testsModels.QuestionOrdering:
+		return checkOrdering(question.Answers, answer.Order)
+	}
+	return 0, fmt.Errorf("unknown question type %q", question.QuestionType)
+}
+
+// Points converts a fraction into question points rounded to hundredths
+func Points(fraction, weight float64) float64 {
+	return math.Round(fraction*weight*100) / 100
+}
+
+// IsFull reports whether a fraction means a fully correct answer
+func IsFull(fraction float64) bool {
+	return fraction >= 1-epsilon
+}
+
+// chosenAnswers maps chosen IDs to the question answers, rejecting foreign IDs
+func chosenAnswers(answers []testsModels.Answer, ids []int) ([]testsModels.Answer, error) {
+	byID := make(map[int]testsModels.Answer, len(answers))
+	for _, answer := range answers {
+		byID[answer.ID] = answer
+	}
+
+	seen := make(map[int]bool, len(ids))
+	chosen := make([]testsModels.Answer, 0, len(ids))
+	for _, id := range ids {
+		answer, ok := byID[id]
+		if !ok {
+			return nil, ErrInvalidAnswer
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		chosen = append(chosen, answer)
+	}
+	return chosen, nil
+}
+
+func checkSingleChoice(answers []testsModels.Answer, ids []int) (float64, error) {
+	chosen, err := chosenAnswers(answers, ids)
+	if err != nil {
+		return 0, err
+	}
+	if len(chosen) > 1 {
+		return 0, ErrInvalidAnswer
+	}
+	if len(chosen) == 1 && chosen[0].IsCorrect {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// checkMultipleChoice gives partial credit: every correct choice adds a share,
+// every wrong choice takes one away, and the result is never below zero
+func checkMultipleChoice(answers []testsModels.Answer, ids []int) (float64, error) {
+	chosen, err := chosenAnswers(answers, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	totalCorrect := 0
+	for _, answer := range answers {
+		if answer.IsCorrect {
+			totalCorrect++
+		}
+	}
+	if totalCorrect == 0 {
+		return 0, nil
+	}
+
+	hits := 0
+	for _, answer := range chosen {
+		if answer.IsCorrect {
+			hits++
+		} else {
+			hits--
+		}
+	}
+	return math.Max(0, float64(hits)/float64(totalCorrect)), nil
+}
+
+func checkFillBlank(answers []testsModels.Answer, text string) float64 {
+	given := Normalize(text)
+	if given == "" {
+		return 0
+	}
+	for _, answer := range answers {
+		if given == Normalize(answer.AnswerText) {
+			return 1
+		}
+	}
+	return 0
+}
+
+func checkNumeric(answers []testsModels.Answer, answer testsModels.ResponseAnswer) (float64, error) {
+	var value float64
+	switch {
+	case answer.Number != nil:
+		value = *answer.Number
+	case strings.TrimSpace(answer.Text) != "":
+		parsed, err := ParseNumber(answer.Text)
+		if err != nil {
+			return 0, ErrInvalidAnswer
+		}
+		value = parsed
+	default:
+		return 0, nil
+	}
+
+	for _, accepted := range answers {
+		expected, err := ParseNumber(accepted.AnswerText)
+		if err != nil {
+			continue
+		}
+		if math.Abs(value-expected) <= math.Abs(accepted.Tolerance)+epsilon {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// checkMatching gives a share for every left item matched with its own right side
+func checkMatching(answers []testsModels.Answer, matches map[int]string) (float64, error) {
+	if len(answers) == 0 {
+		return 0, nil
+	}
+
+	byID := make(map[int]testsModels.Answer, len(answers))
+	for _, answer := range answers {
+		byID[answer.ID] = answer
+	}
+
+	correct := 0
+	for id, right := range matches {
+		answer, ok := byID[id]
+		if !ok {
+			return 0, ErrInvalidAnswer
+		}
+		if Normalize(right) == Normalize(answer.MatchText) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(answers)), nil
+}
+
+// checkOrdering gives a share for every item put in its correct place
+func checkOrdering(answers []testsModels.Answer, order []int) (float64, error) {
+	if len(order) == 0 || len(answers) == 0 {
+		return 0, nil
+	}
+	if len(order) != len(answers) {
+		return 0, ErrInvalidAnswer
+	}
+	if _, err := chosenAnswers(answers, order); err != nil {
+		return 0, err
+	}
+
+	expected := CorrectOrder(answers)
+	seen := make(map[int]bool, len(order))
+	correct := 0
+	for i, id := range order {
+		if seen[id] {
+			return 0, ErrInvalidAnswer
+		}
+		seen[id] = true
+		if expected[i].ID == id {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(answers)), nil
+}
+
+// CorrectOrder returns the items of an ordering question in their correct order
+func CorrectOrder(answers []testsModels.Answer) []testsModels.Answer {
+	ordered := append([]testsModels.Answer(nil), answers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Position != ordered[j].Position {
+			return ordered[i].Position < ordered[j].Position
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	return ordered
+}
+
+// MatchOptions returns the right sides of a matching question in alphabetical order,
+// so their order tells nothing about the pairs
+func MatchOptions(answers []testsModels.Answer) []string {
+	options := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		options = append(options, answer.MatchText)
+	}
+	sort.Strings(options)
+	return options
+}
+
+// CorrectAnswer describes the correct answer of a question for the results page
+func CorrectAnswer(question testsModels.Question) string {
+	var parts []string
+	switch question.QuestionType {
+	case testsModels.QuestionNumeric:
+		for _, answer := range question.Answers {
+			if answer.Tolerance > 0 {
+				parts = append(parts, fmt.Sprintf("%s ± %s", answer.AnswerText, strconv.FormatFloat(answer.Tolerance, 'f', -1, 64)))
+			} else {
+				parts = append(parts, answer.AnswerText)
+			}
+		}
+		return strings.Join(parts, " / ")
+	case testsModels.QuestionFillBlank:
+		for _, answer := range question.Answers {
+			parts = append(parts, answer.AnswerText)
+		}
+		return strings.Join(parts, " / ")
+	case testsModels.QuestionMatching:
+		for _, answer := range question.Answers {
+			parts = append(parts, answer.AnswerText+" — "+answer.MatchText)
+		}
+		return strings.Join(parts, "; ")
+	case testsModels.QuestionOrdering:
+		for _, answer := range CorrectOrder(question.Answers) {
+			parts = append(parts, answer.AnswerText)
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	for _, answer := range question.Answers {
+		if answer.IsCorrect {
+			parts = append(parts, answer.AnswerText)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Normalize prepares a short text answer for comparison: case, extra spaces
+// and ё/е differences are ignored
+func Normalize(text string) string {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	return strings.ReplaceAll(text, "ё", "е")
+}
+
+// ParseNumber parses a number written with a dot or a decimal comma
+func ParseNumber(text string) (float64, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	return strconv.ParseFloat(strings.Replace(text, ",", ".", 1), 64)
+}
@@ -0,0 +1,199 @@
+package scoring
+
+import (
+    testsModels "TeacherJournal/app/tests/models"
+    "errors"
+    "math"
+    "testing"
+)
+
+func choiceQuestion(questionType string) testsModels.Question {
+    return testsModels.Question{
+        QuestionType: questionType,
+        Answers: []testsModels.Answer{
+            {ID: 1, AnswerText: "PostgreSQL", IsCorrect: true},
+            {ID: 2, AnswerText: "MySQL", IsCorrect: true},
+            {ID: 3, AnswerText: "Excel"},
+            {ID: 4, AnswerText: "Word"},
+        },
+    }
+}
+
+func TestCheckMultipleChoicePartialCredit(t *testing.T) {
+    question := choiceQuestion(testsModels.QuestionMultipleChoice)
+    cases := []struct {
+        ids  []int
+        want float64
+    }{
+        {[]int{1, 2}, 1},
+        {[]int{1}, 0.5},
+        {[]int{1, 3}, 0},
+        {[]int{3, 4}, 0},
+        {[]int{1, 1}, 0.5},
+        {nil, 0},
+    }
+    for _, c := range cases {
+        got, err := Check(question, testsModels.ResponseAnswer{AnswerIDs: c.ids})
+        if err != nil {
+            t.Fatalf("%v: unexpected error %v", c.ids, err)
+        }
+        if math.Abs(got-c.want) > epsilon {
+            t.Fatalf("%v: expected %v got %v", c.ids, c.want, got)
+        }
+    }
+
+    if _, err := Check(question, testsModels.ResponseAnswer{AnswerIDs: []int{9}}); !errors.Is(err, ErrInvalidAnswer) {
+        t.Fatalf("expected an answer of another question to be rejected, got %v", err)
+    }
+}
+
+func TestCheckSingleChoice(t *testing.T) {
+    question := choiceQuestion(testsModels.QuestionSingleChoice)
+    if got, _ := Check(question, testsModels.ResponseAnswer{AnswerIDs: []int{2}}); got != 1 {
+        t.Fatalf("expected full credit got %v", got)
+    }
+    if _, err := Check(question, testsModels.ResponseAnswer{AnswerIDs: []int{1, 2}}); !errors.Is(err, ErrInvalidAnswer) {
+        t.Fatalf("expected two choices to be rejected, got %v", err)
+    }
+}
+
+func TestCheckNumeric(t *testing.T) {
+    question := testsModels.Question{
+        QuestionType: testsModels.QuestionNumeric,
+        Answers:      []testsModels.Answer{{ID: 1, AnswerText: "3,14", Tolerance: 0.01}},
+    }
+    number := 3.149
+    cases := []struct {
+        answer testsModels.ResponseAnswer
+        want   float64
+    }{
+        {testsModels.ResponseAnswer{Text: "3.15"}, 1},
+        {testsModels.ResponseAnswer{Text: " 3,13 "}, 1},
+        {testsModels.ResponseAnswer{Number: &number}, 1},
+        {testsModels.ResponseAnswer{Text: "3.16"}, 0},
+        {testsModels.ResponseAnswer{}, 0},
+    }
+    for _, c := range cases {
+        got, err := Check(question, c.answer)
+        if err != nil || got != c.want {
+            t.Fatalf("%+v: expected %v got %v (%v)", c.answer, c.want, got, err)
+        }
+    }
+    if _, err := Check(question, testsModels.ResponseAnswer{Text: "пи"}); !errors.Is(err, ErrInvalidAnswer) {
+        t.Fatalf("expected a non-number to be rejected, got %v", err)
+    }
+}
+
+func TestCheckFillBlank(t *testing.T) {
+    question := testsModels.Question{
+        QuestionType: testsModels.QuestionFillBlank,
+        Answers: []testsModels.Answer{
+            {ID: 1, AnswerText: "ёмкость"},
+            {ID: 2, AnswerText: "capacity"},
+        },
+    }
+    for _, text := range []string{"Емкость", "  ЁМКОСТЬ ", "capacity"} {
+        if got, _ := Check(question, testsModels.ResponseAnswer{Text: text}); got != 1 {
+            t.Fatalf("%q: expected to be accepted", text)
+        }
+    }
+    if got, _ := Check(question, testsModels.ResponseAnswer{Text: "объем"}); got != 0 {
+        t.Fatalf("expected a wrong spelling to score zero")
+    }
+}
+
+func TestCheckMatching(t *testing.T) {
+    question := testsModels.Question{
+        QuestionType: testsModels.QuestionMatching,
+        Answers: []testsModels.Answer{
+            {ID: 1, AnswerText: "SELECT", MatchText: "Чтение"},
+            {ID: 2, AnswerText: "INSERT", MatchText: "Добавление"},
+            {ID: 3, AnswerText: "DELETE", MatchText: "Удаление"},
+            {ID: 4, AnswerText: "UPDATE", MatchText: "Изменение"},
+        },
+    }
+    got, err := Check(question, testsModels.ResponseAnswer{Matches: map[int]string{
+        1: "чтение", 2: "Удаление", 3: "Добавление", 4: "Изменение",
+    }})
+    if err != nil || got != 0.5 {
+        t.Fatalf("expected half credit got %v (%v)", got, err)
+    }
+    if _, err := Check(question, testsModels.ResponseAnswer{Matches: map[int]string{7: "Чтение"}}); !errors.Is(err, ErrInvalidAnswer) {
+        t.Fatalf("expected an unknown pair to be rejected, got %v", err)
+    }
+}
+
+func TestCheckOrdering(t *testing.T) {
+    question := testsModels.Question{
+        QuestionType: testsModels.QuestionOrdering,
+        Answers: []testsModels.Answer{
+            {ID: 10, AnswerText: "Анализ", Position: 1},
+            {ID: 11, AnswerText: "Внедрение", Position: 4},
+            {ID: 12, AnswerText: "Проектирование", Position: 2},
+            {ID: 13, AnswerText: "Разработка", Position: 3},
+        },
+    }
+    cases := []struct {
+        order []int
+        want  float64
+    }{
+        {[]int{10, 12, 13, 11}, 1},
+        {[]int{10, 13, 12, 11}, 0.5},
+        {[]int{11, 13, 12, 10}, 0},
+    }
+    for _, c := range cases {
+        got, err := Check(question, testsModels.ResponseAnswer{Order: c.order})
+        if err != nil || got != c.want {
+            t.Fatalf("%v: expected %v got %v (%v)", c.order, c.want, got, err)
+        }
+    }
+    for _, order := range [][]int{{10, 12, 13}, {10, 10, 13, 11}} {
+        if _, err := Check(question, testsModels.ResponseAnswer{Order: order}); !errors.Is(err, ErrInvalidAnswer) {
+            t.Fatalf("%v: expected to be rejected, got %v", order, err)
+        }
+    }
+    if got := CorrectAnswer(question); got != "Анализ, Проектирование, Разработка, Внедрение" {
+        t.Fatalf("unexpected correct answer %q", got)
+    }
+}
+
+func TestValidate(t *testing.T) {
+    invalid := []testsModels.Question{
+        {QuestionType: "essay"},
+        {QuestionType: testsModels.QuestionSingleChoice, Answers: []testsModels.Answer{{AnswerText: "a"}}},
+        {QuestionType: testsModels.QuestionNumeric, Answers: []testsModels.Answer{{AnswerText: "десять"}}},
+        {QuestionType: testsModels.QuestionMatching, Answers: []testsModels.Answer{{AnswerText: "a", MatchText: "b"}, {AnswerText: "c"}}},
+        {QuestionType: testsModels.QuestionOrdering, Answers: []testsModels.Answer{{AnswerText: "a"}}},
+    }
+    for _, question := range invalid {
+        if Validate(question) == nil {
+            t.Fatalf("expected %+v to be invalid", question)
+        }
+    }
+    if err := Validate(choiceQuestion(testsModels.QuestionMultipleChoice)); err != nil {
+        t.Fatalf("unexpected error %v", err)
+    }
+}
+
+func TestPoints(t *testing.T) {
+    if got := Points(1.0/3, 2); got != 0.67 {
+        t.Fatalf("expected 0.67 got %v", got)
+    }
+    if !IsFull(0.1+0.2+0.7) || IsFull(0.5) {
+        t.Fatalf("unexpected IsFull result")
+    }
+}
+
+func TestCheckTextWaitsForReview(t *testing.T) {
+    question := testsModels.Question{
+        QuestionType: testsModels.QuestionText,
+        Answers:      []testsModels.Answer{{ID: 1, AnswerText: "Нормализация", IsCorrect: true}},
+    }
+    got, err := Check(question, testsModels.ResponseAnswer{Text: "Нормализация"})
+    if err != nil || got != 0 {
+        t.Fatalf("expected a text answer to score zero before review, got %v (%v)", got, err)
+    }
+    if !NeedsReview(testsModels.QuestionText) || NeedsReview(testsModels.QuestionFillBlank) {
+        t.Fatalf("only text answers need review")
+    }
+}
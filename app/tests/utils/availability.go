@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+)
+
+// States of a group test window
+const (
+	WindowOpen      = "open"
+	WindowScheduled = "scheduled" // Not open yet
+	WindowClosed    = "closed"
+)
+
+// GroupWindow is when and how one group may take a test
+type GroupWindow struct {
+	OpensAt     *time.Time // Nil - open since the test was published
+	ClosesAt    *time.Time // Nil - never closes
+	AccessCode  string     // Empty - no code needed
+	MaxAttempts *int       // Nil - the test's own limit
+}
+
+// State returns whether the window is open, not open yet or closed at the given time
+func (g GroupWindow) State(now time.Time) string {
+	if g.OpensAt != nil && now.Before(*g.OpensAt) {
+		return WindowScheduled
+	}
+	if g.ClosesAt != nil && !now.Before(*g.ClosesAt) {
+		return WindowClosed
+	}
+	return WindowOpen
+}
+
+// AttemptLimit returns the number of attempts the group is allowed
+func (g GroupWindow) AttemptLimit(testMaxAttempts int) int {
+	if g.MaxAttempts != nil && *g.MaxAttempts > 0 {
+		return *g.MaxAttempts
+	}
+	return testMaxAttempts
+}
+
+// CheckAccessCode reports whether the given code opens the window.
+// Codes are compared ignoring case and surrounding spaces.
+func (g GroupWindow) CheckAccessCode(code string) bool {
+	expected := strings.ToLower(strings.TrimSpace(g.AccessCode))
+	if expected == "" {
+		return true
+	}
+	given := strings.ToLower(strings.TrimSpace(code))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(given)) == 1
+}
+
+// PickWindow chooses the window that applies to a student listed in several groups
+// linked to the same test: an open one with the most attempts, otherwise the one
+// opening soonest, otherwise the one closed last
+func PickWindow(windows []GroupWindow, testMaxAttempts int, now time.Time) (GroupWindow, bool) {
+	if len(windows) == 0 {
+		return GroupWindow{}, false
+	}
+
+	best := windows[0]
+	for _, w := range windows[1:] {
+		if windowBetter(w, best, testMaxAttempts, now) {
+			best = w
+		}
+	}
+	return best, true
+}
+
+// windowBetter reports whether a is preferred over b
+func windowBetter(a, b GroupWindow, testMaxAttempts int, now time.Time) bool {
+	rank := map[string]int{WindowOpen: 0, WindowScheduled: 1, WindowClosed: 2}
+	stateA, stateB := a.State(now), b.State(now)
+	if stateA != stateB {
+		return rank[stateA] < rank[stateB]
+	}
+
+	switch stateA {
+	case WindowOpen:
+		return a.AttemptLimit(testMaxAttempts) > b.AttemptLimit(testMaxAttempts)
+	case WindowScheduled:
+		return a.OpensAt.Before(*b.OpensAt)
+	default:
+		return a.ClosesAt.After(*b.ClosesAt)
+	}
+}
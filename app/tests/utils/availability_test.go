@@ -0,0 +1,71 @@
+package utils
+
+import (
+    "testing"
+    "time"
+)
+
+func TestGroupWindowState(t *testing.T) {
+    now := time.Date(2024, 10, 7, 10, 0, 0, 0, time.UTC)
+    before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+    cases := []struct {
+        window GroupWindow
+        want   string
+    }{
+        {GroupWindow{}, WindowOpen},
+        {GroupWindow{OpensAt: &before, ClosesAt: &after}, WindowOpen},
+        {GroupWindow{OpensAt: &after}, WindowScheduled},
+        {GroupWindow{ClosesAt: &before}, WindowClosed},
+        {GroupWindow{ClosesAt: &now}, WindowClosed},
+    }
+    for i, c := range cases {
+        if got := c.window.State(now); got != c.want {
+            t.Fatalf("case %d: expected %s got %s", i, c.want, got)
+        }
+    }
+}
+
+func TestGroupWindowAttemptsAndCode(t *testing.T) {
+    three := 3
+    if got := (GroupWindow{}).AttemptLimit(1); got != 1 {
+        t.Fatalf("expected the test limit, got %d", got)
+    }
+    if got := (GroupWindow{MaxAttempts: &three}).AttemptLimit(1); got != 3 {
+        t.Fatalf("expected the group override, got %d", got)
+    }
+
+    if !(GroupWindow{}).CheckAccessCode("") {
+        t.Fatalf("a window without a code must open without one")
+    }
+    w := GroupWindow{AccessCode: "Kod42"}
+    if !w.CheckAccessCode(" kod42 ") || w.CheckAccessCode("") || w.CheckAccessCode("kod43") {
+        t.Fatalf("unexpected access code check")
+    }
+}
+
+func TestPickWindow(t *testing.T) {
+    now := time.Date(2024, 10, 7, 10, 0, 0, 0, time.UTC)
+    yesterday, tomorrow, nextWeek := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1), now.AddDate(0, 0, 7)
+    two := 2
+
+    if _, ok := PickWindow(nil, 1, now); ok {
+        t.Fatalf("expected no window")
+    }
+
+    closed := GroupWindow{ClosesAt: &yesterday}
+    later := GroupWindow{OpensAt: &nextWeek}
+    soon := GroupWindow{OpensAt: &tomorrow}
+    open := GroupWindow{}
+    openMore := GroupWindow{MaxAttempts: &two}
+
+    if w, _ := PickWindow([]GroupWindow{closed, later, soon}, 1, now); w.OpensAt != &tomorrow {
+        t.Fatalf("expected the window opening soonest")
+    }
+    if w, _ := PickWindow([]GroupWindow{closed, open, openMore}, 1, now); w.AttemptLimit(1) != 2 {
+        t.Fatalf("expected the open window with more attempts")
+    }
+    if w, _ := PickWindow([]GroupWindow{closed}, 1, now); w.State(now) != WindowClosed {
+        t.Fatalf("expected the closed window")
+    }
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strings"
+)
+
+// NormalizeTags lowercases and trims question tags, dropping empty and repeated ones
+func NormalizeTags(tags []string) []string {
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// OrderByIDs returns the positions of items in the order given by ids. Items missing
+// from ids keep their relative order after the listed ones, ids without an item are skipped.
+func OrderByIDs(itemIDs []int, ids []int64) []int {
+	index := make(map[int]int, len(itemIDs))
+	for i, id := range itemIDs {
+		index[id] = i
+	}
+
+	order := make([]int, 0, len(itemIDs))
+	used := make(map[int]bool, len(itemIDs))
+	for _, id := range ids {
+		if i, ok := index[int(id)]; ok && !used[i] {
+			order = append(order, i)
+			used[i] = true
+		}
+	}
+	for i := range itemIDs {
+		if !used[i] {
+			order = append(order, i)
+		}
+	}
+	return order
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+    got := NormalizeTags([]string{" SQL ", "joins", "", "sql", "Индексы"})
+    want := []string{"sql", "joins", "индексы"}
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("expected %v got %v", want, got)
+    }
+
+    if got := NormalizeTags(nil); got == nil || len(got) != 0 {
+        t.Fatalf("expected empty non-nil slice, got %#v", got)
+    }
+}
+
+func TestOrderByIDs(t *testing.T) {
+    items := []int{10, 11, 12, 13}
+
+    got := OrderByIDs(items, []int64{12, 10, 13, 11})
+    if !reflect.DeepEqual(got, []int{2, 0, 3, 1}) {
+        t.Fatalf("unexpected order %v", got)
+    }
+
+    // Answers added after the attempt started go last, deleted ones are skipped
+    got = OrderByIDs(items, []int64{13, 99, 10})
+    if !reflect.DeepEqual(got, []int{3, 0, 1, 2}) {
+        t.Fatalf("unexpected order with changed answers %v", got)
+    }
+}
@@ -0,0 +1,31 @@
+package utils
+
+// Policies choosing which attempt of a student sets the grade
+const (
+	GradePolicyBest = "best" // The highest score
+	GradePolicyLast = "last" // The most recently completed attempt
+)
+
+// KnownGradePolicy reports whether the grade policy is supported
+func KnownGradePolicy(policy string) bool {
+	return policy == GradePolicyBest || policy == GradePolicyLast
+}
+
+// PolicyPercent picks the result that sets the grade from the attempt percents,
+// listed in completion order. False when there are no attempts.
+func PolicyPercent(policy string, percents []float64) (float64, bool) {
+	if len(percents) == 0 {
+		return 0, false
+	}
+	if policy == GradePolicyLast {
+		return percents[len(percents)-1], true
+	}
+
+	best := percents[0]
+	for _, p := range percents[1:] {
+		if p > best {
+			best = p
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "testing"
+
+func TestPolicyPercent(t *testing.T) {
+    percents := []float64{40, 90, 65}
+
+    if p, ok := PolicyPercent(GradePolicyBest, percents); !ok || p != 90 {
+        t.Fatalf("expected best 90, got %v %v", p, ok)
+    }
+    if p, ok := PolicyPercent(GradePolicyLast, percents); !ok || p != 65 {
+        t.Fatalf("expected last 65, got %v %v", p, ok)
+    }
+    if _, ok := PolicyPercent(GradePolicyBest, nil); ok {
+        t.Fatalf("expected no result without attempts")
+    }
+    if !KnownGradePolicy("best") || KnownGradePolicy("average") {
+        t.Fatalf("unexpected policy check")
+    }
+}
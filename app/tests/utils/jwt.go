@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"TeacherJournal/config"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// StudentRole is the role carried by student session tokens
+const StudentRole = "student"
+
+// Student tokens use their own key so they are never accepted by the
+// teacher APIs, which share the dashboard secret
+var studentJWTSecret = []byte(config.StudentJWTSecret)
+
+// ErrStudentSecretMissing is returned while no student token secret is configured
+var ErrStudentSecretMissing = errors.New("student token secret is not configured")
+
+// studentTokenTTL is how long a student session lasts
+const studentTokenTTL = 12 * time.Hour
+
+// StudentClaims contains the claims stored in a student session token
+type StudentClaims struct {
+	StudentID int    `json:"student_id"`
+	Role      string `json:"role"`
+	Email     string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateStudentJWT generates a session token for a student
+func GenerateStudentJWT(studentID int, email string) (string, error) {
+	if len(studentJWTSecret) == 0 {
+		return "", ErrStudentSecretMissing
+	}
+	claims := StudentClaims{
+		StudentID: studentID,
+		Role:      StudentRole,
+		Email:     email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(studentTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(studentJWTSecret)
+}
+
+// ParseStudentJWT validates a student session token
+func ParseStudentJWT(tokenString string) (*StudentClaims, error) {
+	if len(studentJWTSecret) == 0 {
+		return nil, ErrStudentSecretMissing
+	}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&StudentClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return studentJWTSecret, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*StudentClaims)
+	if !ok || !token.Valid || claims.Role != StudentRole || claims.StudentID <= 0 {
+		return nil, errors.New("invalid student token")
+	}
+	return claims, nil
+}
+
+type studentContextKey struct{}
+
+// SetStudentContext adds the authenticated student ID to the context
+func SetStudentContext(ctx context.Context, studentID int) context.Context {
+	return context.WithValue(ctx, studentContextKey{}, studentID)
+}
+
+// GetStudentIDFromContext retrieves the authenticated student ID from the context
+func GetStudentIDFromContext(ctx context.Context) (int, error) {
+	studentID, ok := ctx.Value(studentContextKey{}).(int)
+	if !ok {
+		return 0, errors.New("student ID not found in context")
+	}
+	return studentID, nil
+}
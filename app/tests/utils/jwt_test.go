@@ -0,0 +1,75 @@
+package utils
+
+import (
+    "context"
+    "testing"
+
+    dashboardUtils "TeacherJournal/app/dashboard/utils"
+)
+
+func init() {
+    studentJWTSecret = []byte("test-student-secret")
+}
+
+func TestGenerateAndParseStudentJWT(t *testing.T) {
+    token, err := GenerateStudentJWT(7, "student@example.com")
+    if err != nil {
+        t.Fatalf("GenerateStudentJWT error: %v", err)
+    }
+
+    claims, err := ParseStudentJWT(token)
+    if err != nil {
+        t.Fatalf("ParseStudentJWT error: %v", err)
+    }
+    if claims.StudentID != 7 || claims.Role != StudentRole || claims.Email != "student@example.com" {
+        t.Fatalf("unexpected claims: %+v", claims)
+    }
+}
+
+func TestStudentAndTeacherTokensAreNotInterchangeable(t *testing.T) {
+    studentToken, err := GenerateStudentJWT(7, "student@example.com")
+    if err != nil {
+        t.Fatalf("GenerateStudentJWT error: %v", err)
+    }
+    if _, err := dashboardUtils.ParseJWT(studentToken); err == nil {
+        t.Fatalf("student token must not be accepted as a teacher token")
+    }
+
+    teacherToken, err := dashboardUtils.GenerateJWT(7, "teacher", "teacher@example.com")
+    if err != nil {
+        t.Fatalf("GenerateJWT error: %v", err)
+    }
+    if _, err := ParseStudentJWT(teacherToken); err == nil {
+        t.Fatalf("teacher token must not be accepted as a student token")
+    }
+}
+
+func TestStudentJWTWithoutSecret(t *testing.T) {
+    token, err := GenerateStudentJWT(7, "student@example.com")
+    if err != nil {
+        t.Fatalf("GenerateStudentJWT error: %v", err)
+    }
+
+    secret := studentJWTSecret
+    studentJWTSecret = nil
+    defer func() { studentJWTSecret = secret }()
+
+    if _, err := GenerateStudentJWT(7, "student@example.com"); err != ErrStudentSecretMissing {
+        t.Fatalf("expected ErrStudentSecretMissing, got %v", err)
+    }
+    if _, err := ParseStudentJWT(token); err != ErrStudentSecretMissing {
+        t.Fatalf("expected tokens to be refused without a secret, got %v", err)
+    }
+}
+
+func TestStudentContext(t *testing.T) {
+    if _, err := GetStudentIDFromContext(context.Background()); err == nil {
+        t.Fatalf("expected error for empty context")
+    }
+
+    ctx := SetStudentContext(context.Background(), 12)
+    id, err := GetStudentIDFromContext(ctx)
+    if err != nil || id != 12 {
+        t.Fatalf("unexpected student id %d, err %v", id, err)
+    }
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"TeacherJournal/config"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies whose forwarding headers are honoured
+var trustedProxies = ParseTrustedProxies(config.TrustedProxies)
+
+// ParseTrustedProxies parses a comma separated list of addresses and CIDR networks.
+// Invalid entries are logged and skipped.
+func ParseTrustedProxies(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Ignoring invalid trusted proxy %q", entry)
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// ClientIP returns the address of the client. Behind nginx the address comes from
+// X-Real-IP, which the proxy sets itself, then from X-Forwarded-For. The headers are
+// only honoured when the request comes from one of the trusted proxies.
+func ClientIP(r *http.Request) string {
+	return clientIP(r, trustedProxies)
+}
+
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrusted(remote, proxies) {
+		return remote
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	// Clients may send their own X-Forwarded-For, so the entries are read from the
+	// right, skipping the trusted proxies that appended them
+	entries := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(entries[i])
+		if ip != "" && !isTrusted(ip, proxies) {
+			return ip
+		}
+	}
+	return remote
+}
+
+// isTrusted reports whether the address belongs to one of the proxies
+func isTrusted(address string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
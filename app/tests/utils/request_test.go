@@ -0,0 +1,43 @@
+package utils
+
+import (
+    "net/http/httptest"
+    "testing"
+)
+
+func TestClientIP(t *testing.T) {
+    proxies := ParseTrustedProxies("172.18.0.0/16, ::1, not-an-address")
+    if len(proxies) != 2 {
+        t.Fatalf("expected 2 valid proxies, got %d", len(proxies))
+    }
+
+    r := httptest.NewRequest("GET", "/api/tests/available", nil)
+    r.RemoteAddr = "172.18.0.3:51234"
+    if ip := clientIP(r, proxies); ip != "172.18.0.3" {
+        t.Fatalf("expected remote address without port, got %q", ip)
+    }
+
+    r.Header.Set("X-Forwarded-For", "10.0.0.1, 203.0.113.7, 172.18.0.2")
+    if ip := clientIP(r, proxies); ip != "203.0.113.7" {
+        t.Fatalf("expected last untrusted forwarded address, got %q", ip)
+    }
+
+    r.Header.Set("X-Real-IP", "198.51.100.4")
+    if ip := clientIP(r, proxies); ip != "198.51.100.4" {
+        t.Fatalf("expected real IP header, got %q", ip)
+    }
+}
+
+func TestClientIPUntrustedProxy(t *testing.T) {
+    r := httptest.NewRequest("GET", "/api/tests/available", nil)
+    r.RemoteAddr = "203.0.113.9:40000"
+    r.Header.Set("X-Real-IP", "198.51.100.4")
+    r.Header.Set("X-Forwarded-For", "198.51.100.4")
+
+    if ip := clientIP(r, ParseTrustedProxies("172.18.0.0/16")); ip != "203.0.113.9" {
+        t.Fatalf("expected headers of an untrusted client to be ignored, got %q", ip)
+    }
+    if ip := clientIP(r, nil); ip != "203.0.113.9" {
+        t.Fatalf("expected headers to be ignored without trusted proxies, got %q", ip)
+    }
+}
@@ -0,0 +1,51 @@
+package utils
+
+import "time"
+
+// AnswerGracePeriod covers network latency between the client timer running out
+// and the answer reaching the server
+const AnswerGracePeriod = 5 * time.Second
+
+// QuestionDeadline returns until when a question served at servedAt may be answered.
+// The per-question limit is in seconds and is ignored when not positive; the whole test
+// deadline caps it. Nil means the question is not timed.
+func QuestionDeadline(servedAt time.Time, perQuestionSeconds int, testDeadline *time.Time) *time.Time {
+	var deadline *time.Time
+	if perQuestionSeconds > 0 {
+		d := servedAt.Add(time.Duration(perQuestionSeconds) * time.Second)
+		deadline = &d
+	}
+	if testDeadline != nil && (deadline == nil || testDeadline.Before(*deadline)) {
+		d := *testDeadline
+		deadline = &d
+	}
+	return deadline
+}
+
+// TestDeadline returns the whole test deadline for an attempt started at start,
+// or nil when the test has no time limit
+func TestDeadline(start time.Time, limitMinutes int) *time.Time {
+	if limitMinutes <= 0 {
+		return nil
+	}
+	d := start.Add(time.Duration(limitMinutes) * time.Minute)
+	return &d
+}
+
+// PastDeadline reports whether now is after the deadline plus the grace period
+func PastDeadline(deadline *time.Time, now time.Time) bool {
+	return deadline != nil && now.After(deadline.Add(AnswerGracePeriod))
+}
+
+// SecondsRemaining returns the whole seconds left until the deadline, never negative.
+// It returns -1 for untimed questions.
+func SecondsRemaining(deadline *time.Time, now time.Time) int {
+	if deadline == nil {
+		return -1
+	}
+	left := deadline.Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	return int((left + time.Second - 1) / time.Second)
+}
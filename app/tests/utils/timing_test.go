@@ -0,0 +1,71 @@
+package utils
+
+import (
+    "testing"
+    "time"
+)
+
+func TestQuestionDeadline(t *testing.T) {
+    served := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+
+    if d := QuestionDeadline(served, 0, nil); d != nil {
+        t.Fatalf("expected untimed question, got %v", d)
+    }
+
+    d := QuestionDeadline(served, 60, nil)
+    if d == nil || !d.Equal(served.Add(time.Minute)) {
+        t.Fatalf("unexpected per-question deadline %v", d)
+    }
+
+    // The whole test deadline caps the question time
+    testDeadline := served.Add(30 * time.Second)
+    d = QuestionDeadline(served, 60, &testDeadline)
+    if d == nil || !d.Equal(testDeadline) {
+        t.Fatalf("expected test deadline, got %v", d)
+    }
+
+    later := served.Add(time.Hour)
+    d = QuestionDeadline(served, 0, &later)
+    if d == nil || !d.Equal(later) {
+        t.Fatalf("expected test deadline for untimed question, got %v", d)
+    }
+}
+
+func TestTestDeadline(t *testing.T) {
+    start := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+    if TestDeadline(start, 0) != nil {
+        t.Fatalf("expected no deadline without a limit")
+    }
+    if d := TestDeadline(start, 45); d == nil || !d.Equal(start.Add(45*time.Minute)) {
+        t.Fatalf("unexpected deadline %v", d)
+    }
+}
+
+func TestPastDeadline(t *testing.T) {
+    deadline := time.Date(2024, 9, 2, 10, 1, 0, 0, time.UTC)
+
+    if PastDeadline(nil, deadline.Add(time.Hour)) {
+        t.Fatalf("untimed question can not be late")
+    }
+    if PastDeadline(&deadline, deadline.Add(AnswerGracePeriod)) {
+        t.Fatalf("answer within the grace period must be accepted")
+    }
+    if !PastDeadline(&deadline, deadline.Add(AnswerGracePeriod+time.Second)) {
+        t.Fatalf("answer after the grace period must be late")
+    }
+}
+
+func TestSecondsRemaining(t *testing.T) {
+    now := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+    deadline := now.Add(1500 * time.Millisecond)
+
+    if got := SecondsRemaining(nil, now); got != -1 {
+        t.Fatalf("expected -1 for untimed question, got %d", got)
+    }
+    if got := SecondsRemaining(&deadline, now); got != 2 {
+        t.Fatalf("expected 2 seconds, got %d", got)
+    }
+    if got := SecondsRemaining(&deadline, now.Add(time.Minute)); got != 0 {
+        t.Fatalf("expected 0 after the deadline, got %d", got)
+    }
+}
@@ -0,0 +1,101 @@
+// app/tickets/cmd/migrate-storage/main.go
+//
+// migrate-storage copies ticket attachment files from one storage backend to another
+// and points their records at the new backend:
+//
+//	migrate-storage -from local -to s3 [-delete] [-dry-run]
+//
+// Backends are configured by the same environment variables as the ticket service.
+// The copy can be interrupted and run again; moved files are skipped.
+package main
+
+import (
+	"TeacherJournal/app/tickets/db"
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/storage"
+	"context"
+	"flag"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	from := flag.String("from", storage.LocalName, "backend to move attachment files from")
+	to := flag.String("to", "", "backend to move attachment files to")
+	deleteSource := flag.Bool("delete", false, "remove files from the source backend after copying")
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be moved")
+	flag.Parse()
+
+	if *to == "" || *to == *from {
+		log.Fatal("Set -to to a backend other than -from")
+	}
+	source, err := storage.FromConfig(*from)
+	if err != nil {
+		log.Fatal("Failed to configure source storage:", err)
+	}
+	target, err := storage.FromConfig(*to)
+	if err != nil {
+		log.Fatal("Failed to configure target storage:", err)
+	}
+
+	// Initialize the database
+	database := db.InitTicketDB()
+	sqlDB, err := database.DB()
+	if err != nil {
+		log.Fatal("Failed to get SQL DB for closing:", err)
+	}
+	defer sqlDB.Close()
+
+	attachments, err := db.GetTicketAttachmentsByStorage(database, source.Name())
+	if err != nil {
+		log.Fatal("Failed to list attachments:", err)
+	}
+
+	var moved, failed int
+	for _, attachment := range attachments {
+		if *dryRun {
+			log.Printf("Would move attachment %d: %s (%d bytes)", attachment.ID, attachment.FilePath, attachment.FileSize)
+			continue
+		}
+		if err := migrate(database, source, target, attachment, *deleteSource); err != nil {
+			log.Printf("Failed to move attachment %d (%s): %v", attachment.ID, attachment.FilePath, err)
+			failed++
+			continue
+		}
+		moved++
+	}
+
+	log.Printf("Moved %d of %d attachments from %s to %s, %d failed", moved, len(attachments), source.Name(), target.Name(), failed)
+	if failed > 0 {
+		log.Fatal("Some attachments were not moved; run the command again to retry them")
+	}
+}
+
+// migrate copies one attachment file and switches its record to the target backend
+func migrate(database *gorm.DB, source, target storage.Storage, attachment models.TicketAttachment, deleteSource bool) error {
+	ctx := context.Background()
+
+	file, size, err := source.Open(ctx, attachment.FilePath)
+	if err != nil {
+		return err
+	}
+	err = target.Put(ctx, attachment.FilePath, file, size, attachment.ContentType)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// The record only changes if no one moved the file meanwhile
+	result := database.Model(&models.TicketAttachment{}).
+		Where("id = ? AND storage = ?", attachment.ID, source.Name()).
+		Update("storage", target.Name())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if deleteSource && result.RowsAffected > 0 {
+		return source.Delete(ctx, attachment.FilePath)
+	}
+	return nil
+}
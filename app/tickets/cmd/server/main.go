@@ -5,8 +5,12 @@ import (
 	"TeacherJournal/app/tickets/auth"
 	"TeacherJournal/app/tickets/db"
 	"TeacherJournal/app/tickets/handlers"
+	"TeacherJournal/app/tickets/notify"
+	"TeacherJournal/app/tickets/storage"
+	"TeacherJournal/config"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -24,14 +28,28 @@ func main() {
 	}
 	defer sqlDB.Close()
 
+	// Send ticket notifications by email
+	notifier := notify.New(newNotifyTransport(), config.AppBaseURL)
+	handlers.EnableEmailReplies(notifier)
+	notifier.Start()
+
+	// Escalate tickets that missed their SLA
+	handlers.StartEscalationChecker(database, notifier)
+
 	// Create router
 	router := mux.NewRouter()
 
 	// API subrouter with /api prefix
 	apiRouter := router.PathPrefix("/api").Subrouter()
 
+	// Open the attachment storage backends
+	files, err := storage.SetFromConfig()
+	if err != nil {
+		log.Fatal("Failed to configure attachment storage:", err)
+	}
+
 	// Initialize ticket handler
-	ticketHandler := handlers.NewTicketHandler(database)
+	ticketHandler := handlers.NewTicketHandler(database, notifier, files)
 
 	// Routes without ID parameter - MUST come before routes with parameters
 	apiRouter.HandleFunc("/tickets", auth.JWTMiddleware(ticketHandler.GetTickets)).Methods("GET")
@@ -40,8 +58,17 @@ func main() {
 	// Stats route - MUST come before routes with ID parameter
 	apiRouter.HandleFunc("/tickets/stats", auth.JWTMiddleware(ticketHandler.GetTicketStats)).Methods("GET")
 
+	// Duty shift routes for escalated tickets (admin only)
+	apiRouter.HandleFunc("/tickets/duty", auth.JWTMiddleware(ticketHandler.GetDutyShifts)).Methods("GET")
+	apiRouter.HandleFunc("/tickets/duty", auth.JWTMiddleware(ticketHandler.CreateDutyShift)).Methods("POST")
+	apiRouter.HandleFunc("/tickets/duty/{id}", auth.JWTMiddleware(ticketHandler.DeleteDutyShift)).Methods("DELETE")
+
+	// Inbound email route for the local MTA, authenticated by a shared secret instead of JWT
+	apiRouter.HandleFunc("/tickets/inbound", ticketHandler.ReceiveEmail).Methods("POST")
+
 	// Attachment download route
 	apiRouter.HandleFunc("/tickets/attachments/{id}", auth.JWTMiddleware(ticketHandler.DownloadAttachment)).Methods("GET")
+	apiRouter.HandleFunc("/tickets/attachments/{id}/url", auth.JWTMiddleware(ticketHandler.GetAttachmentURL)).Methods("GET")
 
 	// Routes with ID parameter
 	apiRouter.HandleFunc("/tickets/{id}", auth.JWTMiddleware(ticketHandler.GetTicket)).Methods("GET")
@@ -77,3 +104,26 @@ func main() {
 	log.Println("Ticket API server started on :8090")
 	log.Fatal(server.ListenAndServe())
 }
+
+// newNotifyTransport creates the email transport chosen in the configuration
+func newNotifyTransport() notify.Transport {
+	if config.NotifyTransport == "smtp" {
+		return &notify.SMTPTransport{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.SMTPFrom,
+		}
+	}
+
+	transport := &notify.LogTransport{}
+	if config.NotifyLogPath != "" {
+		file, err := os.OpenFile(config.NotifyLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal("Failed to open notification log:", err)
+		}
+		transport.Writer = file
+	}
+	return transport
+}
@@ -2,6 +2,9 @@ package db
 
 import (
 	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/sla"
+	"TeacherJournal/app/tickets/storage"
+	"TeacherJournal/app/tickets/workflow"
 	"TeacherJournal/config"
 	"fmt"
 	"log"
@@ -46,16 +49,98 @@ func InitTicketDB() *gorm.DB {
 		&models.TicketAttachment{},
 		&models.TicketHistory{},
 		&models.TicketSubscription{},
+		&models.TicketDutyShift{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to auto-migrate ticket system database:", err)
 	}
 
+	// Older tickets may hold status and priority labels instead of codes
+	if err := normalizeTicketValues(TicketDB); err != nil {
+		log.Fatal("Failed to normalize ticket statuses and priorities:", err)
+	}
+
+	// Attachments saved before storage backends kept paths instead of keys
+	if err := normalizeAttachmentKeys(TicketDB); err != nil {
+		log.Fatal("Failed to convert attachment paths to storage keys:", err)
+	}
+
+	// Start SLA timers of open tickets created before SLA tracking
+	if err := backfillDueDates(TicketDB); err != nil {
+		log.Fatal("Failed to set ticket due dates:", err)
+	}
+
 	log.Println("Ticket system database initialized successfully")
 	return TicketDB
 }
 
+// normalizeTicketValues rewrites stored status and priority spellings to their codes.
+// Values that cannot be recognized are left for an administrator to fix by hand.
+func normalizeTicketValues(db *gorm.DB) error {
+	var statuses []string
+	if err := db.Model(&models.Ticket{}).Distinct().Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+	for _, value := range statuses {
+		status, err := workflow.ParseStatus(value)
+		if err != nil {
+			log.Printf("Unknown ticket status %q left as is", value)
+			continue
+		}
+		if string(status) == value {
+			continue
+		}
+		if err := db.Model(&models.Ticket{}).Where("status = ?", value).Update("status", status).Error; err != nil {
+			return err
+		}
+	}
+
+	var priorities []string
+	if err := db.Model(&models.Ticket{}).Distinct().Pluck("priority", &priorities).Error; err != nil {
+		return err
+	}
+	for _, value := range priorities {
+		priority, err := workflow.ParsePriority(value)
+		if err != nil {
+			log.Printf("Unknown ticket priority %q left as is", value)
+			continue
+		}
+		if string(priority) == value {
+			continue
+		}
+		if err := db.Model(&models.Ticket{}).Where("priority = ?", value).Update("priority", priority).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeAttachmentKeys turns local file paths of old attachments into keys of the local backend
+func normalizeAttachmentKeys(db *gorm.DB) error {
+	var attachments []models.TicketAttachment
+	if err := db.Select("id, file_path").Where("storage = ?", storage.LocalName).Find(&attachments).Error; err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		key := storage.LegacyKey(config.AttachmentStoragePath, attachment.FilePath)
+		if key == attachment.FilePath {
+			continue
+		}
+		if err := db.Model(&models.TicketAttachment{}).Where("id = ?", attachment.ID).Update("file_path", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTicketAttachmentsByStorage retrieves the attachments kept in a storage backend
+func GetTicketAttachmentsByStorage(db *gorm.DB, backend string) ([]models.TicketAttachment, error) {
+	var attachments []models.TicketAttachment
+	result := db.Where("storage = ?", backend).Order("id").Find(&attachments)
+	return attachments, result.Error
+}
+
 // GetTicketByID retrieves a ticket by ID
 func GetTicketByID(db *gorm.DB, ticketID int) (models.Ticket, error) {
 	var ticket models.Ticket
@@ -92,10 +177,10 @@ func CreateTicket(db *gorm.DB, ticket *models.Ticket) error {
 
 	// Ensure default values are set
 	if ticket.Status == "" {
-		ticket.Status = "New"
+		ticket.Status = workflow.StatusNew
 	}
 	if ticket.Priority == "" {
-		ticket.Priority = "Medium"
+		ticket.Priority = workflow.PriorityMedium
 	}
 
 	// Set timestamps
@@ -104,6 +189,11 @@ func CreateTicket(db *gorm.DB, ticket *models.Ticket) error {
 	ticket.UpdatedAt = now
 	ticket.LastActivity = now
 
+	// Start the SLA timers
+	firstResponseDue, resolutionDue := sla.Due(ticket.Priority, now)
+	ticket.FirstResponseDue = &firstResponseDue
+	ticket.ResolutionDue = &resolutionDue
+
 	// Start a transaction
 	return db.Transaction(func(tx *gorm.DB) error {
 		// Create the ticket
@@ -179,6 +269,10 @@ func UpdateTicket(db *gorm.DB, ticketID int, userID int, updates map[string]inte
 		updates["updated_at"] = time.Now()
 		updates["last_activity"] = time.Now()
 
+		// Keep the SLA timers in step with the priority and status
+		if timers := slaUpdates(ticket, updates, time.Now()); len(timers) > 0 {
+			return tx.Model(&models.Ticket{}).Where("id = ?", ticketID).Updates(timers).Error
+		}
 		return nil
 	})
 }
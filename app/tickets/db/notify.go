@@ -0,0 +1,84 @@
+package db
+
+import (
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/notify"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// notificationSettings maps events to the user_notification_settings column that turns them off.
+// Users without a settings row get every notification.
+var notificationSettings = map[string]string{
+	notify.EventCreated:  "notify_new_ticket",
+	notify.EventComment:  "notify_ticket_comment",
+	notify.EventStatus:   "notify_ticket_status",
+	notify.EventAssigned: "notify_ticket_update",
+}
+
+// GetNotificationRecipients returns who to notify about an event of a ticket: its subscribers
+// and assignee, and every admin for new tickets. The user who acted is left out, and so are
+// non-staff users when staffOnly is set, e.g. for internal comments.
+func GetNotificationRecipients(db *gorm.DB, ticket models.Ticket, kind string, actorID int, staffOnly bool) ([]notify.Recipient, error) {
+	column, ok := notificationSettings[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification event %q", kind)
+	}
+
+	var userIDs []int
+	if err := db.Model(&models.TicketSubscription{}).
+		Where("ticket_id = ? AND subscribed = ?", ticket.ID, true).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+
+	// The assignee follows the ticket unless they unsubscribed from it
+	if ticket.AssignedTo != nil {
+		var unsubscribed int64
+		if err := db.Model(&models.TicketSubscription{}).
+			Where("ticket_id = ? AND user_id = ? AND subscribed = ?", ticket.ID, *ticket.AssignedTo, false).
+			Count(&unsubscribed).Error; err != nil {
+			return nil, err
+		}
+		if unsubscribed == 0 {
+			userIDs = append(userIDs, *ticket.AssignedTo)
+		}
+	}
+
+	query := db.Table("users").
+		Select("users.id AS user_id, users.fio AS name, users.login AS email").
+		Joins("LEFT JOIN user_notification_settings uns ON uns.user_id = users.id").
+		Where("users.id <> ?", actorID).
+		Where("COALESCE(uns." + column + ", true)")
+	if kind == notify.EventCreated {
+		query = query.Where("(users.id IN ? OR users.role = ?)", append(userIDs, 0), "admin")
+	} else {
+		query = query.Where("users.id IN ?", append(userIDs, 0))
+	}
+	if staffOnly {
+		query = query.Where("users.role = ?", "admin")
+	}
+
+	var rows []notify.Recipient
+	if err := query.Order("users.id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// Logins that are not addresses cannot be mailed
+	recipients := make([]notify.Recipient, 0, len(rows))
+	for _, row := range rows {
+		if strings.Contains(row.Email, "@") {
+			recipients = append(recipients, row)
+		}
+	}
+	return recipients, nil
+}
+
+// GetUserName returns the full name of a user, or an empty string if unknown
+func GetUserName(db *gorm.DB, userID int) string {
+	var name string
+	db.Table("users").Select("fio").Where("id = ?", userID).Scan(&name)
+	return name
+}
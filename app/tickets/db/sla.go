@@ -0,0 +1,239 @@
+package db
+
+import (
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/sla"
+	"TeacherJournal/app/tickets/workflow"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// unresolvedStatuses are the statuses whose SLA timers still run
+var unresolvedStatuses = []workflow.Status{workflow.StatusNew, workflow.StatusOpen, workflow.StatusInProgress}
+
+// backfillDueDates starts the SLA timers of open tickets created before SLA tracking.
+// The timers start now, so old tickets are not escalated all at once.
+func backfillDueDates(db *gorm.DB) error {
+	var tickets []models.Ticket
+	if err := db.Where("resolution_due IS NULL AND status IN ?", unresolvedStatuses).Find(&tickets).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, ticket := range tickets {
+		firstResponseDue, resolutionDue := sla.Due(ticket.Priority, now)
+		updates := map[string]interface{}{
+			"first_response_due": firstResponseDue,
+			"resolution_due":     resolutionDue,
+		}
+
+		// An answer already given counts as the first response
+		var answeredAt *time.Time
+		if err := db.Model(&models.TicketComment{}).
+			Where("ticket_id = ? AND user_id <> ? AND is_internal = ?", ticket.ID, ticket.CreatedBy, false).
+			Select("MIN(created_at)").Scan(&answeredAt).Error; err != nil {
+			return err
+		}
+		if answeredAt != nil {
+			updates["first_response_at"] = *answeredAt
+		}
+
+		if err := db.Model(&models.Ticket{}).Where("id = ?", ticket.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slaUpdates returns the SLA timer changes caused by updating a ticket. A priority change
+// recomputes the due dates from creation, resolving stops the timers and reopening
+// gives the ticket a new resolution due date.
+func slaUpdates(ticket models.Ticket, updates map[string]interface{}, now time.Time) map[string]interface{} {
+	timers := make(map[string]interface{})
+
+	priority := ticket.Priority
+	if value, ok := updates["priority"]; ok {
+		priority = workflow.Priority(fmt.Sprint(value))
+	}
+	if priority != ticket.Priority && ticket.ResolutionDue != nil {
+		firstResponseDue, resolutionDue := sla.Due(priority, ticket.CreatedAt)
+		timers["first_response_due"] = firstResponseDue
+		timers["resolution_due"] = resolutionDue
+		recordBreaches(ticket, timers, now)
+	}
+
+	value, ok := updates["status"]
+	if !ok {
+		return timers
+	}
+	switch workflow.Status(fmt.Sprint(value)) {
+	case workflow.StatusResolved, workflow.StatusClosed:
+		if ticket.ResolvedAt == nil {
+			timers["resolved_at"] = now
+		}
+		// Resolving a ticket answers it
+		if ticket.FirstResponseAt == nil {
+			timers["first_response_at"] = now
+		}
+	default:
+		if ticket.ResolvedAt != nil {
+			_, resolutionDue := sla.Due(priority, now)
+			timers["resolved_at"] = nil
+			timers["resolution_due"] = resolutionDue
+			recordBreaches(ticket, timers, now)
+		}
+	}
+	return timers
+}
+
+// recordBreaches keeps the breaches of the current due dates in the ticket before they
+// are replaced, so the breach statistics do not lose them
+func recordBreaches(ticket models.Ticket, updates map[string]interface{}, now time.Time) {
+	if sla.Breached(ticket.FirstResponseDue, ticket.FirstResponseAt, now) {
+		updates["first_response_breached"] = true
+	}
+	if sla.Breached(ticket.ResolutionDue, ticket.ResolvedAt, now) {
+		updates["resolution_breached"] = true
+	}
+}
+
+// RecordFirstResponse marks a ticket as answered unless it already was
+func RecordFirstResponse(db *gorm.DB, ticketID int, answeredAt time.Time) error {
+	return db.Model(&models.Ticket{}).
+		Where("id = ? AND first_response_at IS NULL", ticketID).
+		Update("first_response_at", answeredAt).Error
+}
+
+// GetOverdueTickets retrieves unresolved tickets past one of their due dates
+func GetOverdueTickets(db *gorm.DB, now time.Time) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	result := db.Where("status IN ? AND resolved_at IS NULL", unresolvedStatuses).
+		Where("(first_response_at IS NULL AND first_response_due < ?) OR resolution_due < ?", now, now).
+		Order("id").
+		Find(&tickets)
+	return tickets, result.Error
+}
+
+// GetDutyAdmin returns the admin who takes escalated tickets now: the one on the latest
+// started duty shift, otherwise the admin with the fewest unresolved assigned tickets.
+// Returns nil if there are no admins.
+func GetDutyAdmin(db *gorm.DB, now time.Time) (*int, error) {
+	var shift models.TicketDutyShift
+	err := db.Where("starts_at <= ? AND ends_at > ?", now, now).Order("starts_at DESC").First(&shift).Error
+	if err == nil {
+		return &shift.UserID, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var adminIDs []int
+	if err := db.Table("users").
+		Select("users.id").
+		Joins("LEFT JOIN tickets ON tickets.assigned_to = users.id AND tickets.status IN ?", unresolvedStatuses).
+		Where("users.role = ?", "admin").
+		Group("users.id").
+		Order("COUNT(tickets.id), users.id").
+		Limit(1).
+		Pluck("users.id", &adminIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(adminIDs) == 0 {
+		return nil, nil
+	}
+	return &adminIDs[0], nil
+}
+
+// EscalateTicket raises the priority of an overdue ticket, assigns it to assignee when
+// given and restarts its timers under the new priority; the missed due dates are kept
+// as breach flags. Every change is written to the
+// ticket history by the system user 0. It returns false if another checker escalated
+// the ticket first.
+func EscalateTicket(db *gorm.DB, ticket models.Ticket, reason string, assignee *int, now time.Time) (bool, error) {
+	priority, _ := sla.Raise(ticket.Priority)
+	firstResponseDue, resolutionDue := sla.Due(priority, now)
+
+	updates := map[string]interface{}{
+		"priority":         priority,
+		"resolution_due":   resolutionDue,
+		"escalated_at":     now,
+		"escalation_level": ticket.EscalationLevel + 1,
+		"updated_at":       now,
+		"last_activity":    now,
+	}
+	if ticket.FirstResponseAt == nil {
+		updates["first_response_due"] = firstResponseDue
+	}
+	recordBreaches(ticket, updates, now)
+	reassigned := assignee != nil && (ticket.AssignedTo == nil || *ticket.AssignedTo != *assignee)
+	if reassigned {
+		updates["assigned_to"] = *assignee
+	}
+
+	escalated := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The escalation level guards against escalating the same breach twice
+		result := tx.Model(&models.Ticket{}).
+			Where("id = ? AND escalation_level = ?", ticket.ID, ticket.EscalationLevel).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		escalated = true
+
+		history := []models.TicketHistory{{
+			TicketID:   ticket.ID,
+			FieldName:  "escalation",
+			OldValue:   toString(ticket.EscalationLevel),
+			NewValue:   reason,
+			ChangeTime: now,
+		}}
+		if priority != ticket.Priority {
+			history = append(history, models.TicketHistory{
+				TicketID:   ticket.ID,
+				FieldName:  "priority",
+				OldValue:   string(ticket.Priority),
+				NewValue:   string(priority),
+				ChangeTime: now,
+			})
+		}
+		if reassigned {
+			history = append(history, models.TicketHistory{
+				TicketID:   ticket.ID,
+				FieldName:  "assigned_to",
+				OldValue:   toString(ticket.AssignedTo),
+				NewValue:   toString(*assignee),
+				ChangeTime: now,
+			})
+		}
+		return tx.Create(&history).Error
+	})
+	return escalated, err
+}
+
+// GetDutyShifts retrieves duty shifts that have not ended yet
+func GetDutyShifts(db *gorm.DB, now time.Time) ([]models.TicketDutyShift, error) {
+	var shifts []models.TicketDutyShift
+	result := db.Where("ends_at > ?", now).Order("starts_at").Find(&shifts)
+	return shifts, result.Error
+}
+
+// CreateDutyShift creates a new duty shift
+func CreateDutyShift(db *gorm.DB, shift *models.TicketDutyShift) error {
+	shift.CreatedAt = time.Now()
+	return db.Create(shift).Error
+}
+
+// DeleteDutyShift deletes a duty shift
+func DeleteDutyShift(db *gorm.DB, shiftID int) error {
+	result := db.Delete(&models.TicketDutyShift{}, shiftID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
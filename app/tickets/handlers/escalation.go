@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"TeacherJournal/app/tickets/db"
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/notify"
+	"TeacherJournal/app/tickets/sla"
+	"TeacherJournal/app/tickets/utils"
+	"TeacherJournal/app/tickets/workflow"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// escalationCheckInterval is how often overdue tickets are looked for
+const escalationCheckInterval = time.Minute
+
+// StartEscalationChecker periodically escalates tickets that missed their SLA
+func StartEscalationChecker(database *gorm.DB, notifier *notify.Notifier) {
+	go func() {
+		escalateOverdueTickets(database, notifier)
+
+		ticker := time.NewTicker(escalationCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			escalateOverdueTickets(database, notifier)
+		}
+	}()
+}
+
+// escalateOverdueTickets raises the priority of every overdue ticket and hands it to the admin on duty
+func escalateOverdueTickets(database *gorm.DB, notifier *notify.Notifier) {
+	now := time.Now()
+
+	tickets, err := db.GetOverdueTickets(database, now)
+	if err != nil {
+		log.Printf("Error listing overdue tickets: %v", err)
+		return
+	}
+	if len(tickets) == 0 {
+		return
+	}
+
+	assignee, err := db.GetDutyAdmin(database, now)
+	if err != nil {
+		log.Printf("Error finding the admin on duty: %v", err)
+		return
+	}
+
+	for _, ticket := range tickets {
+		reason := sla.Overdue(slaTimers(ticket), now)
+		if reason == "" {
+			continue
+		}
+
+		escalated, err := db.EscalateTicket(database, ticket, reason, assignee, now)
+		if err != nil {
+			log.Printf("Error escalating ticket %d: %v", ticket.ID, err)
+			continue
+		}
+		if !escalated {
+			continue
+		}
+		log.Printf("Escalated ticket %d: %s overdue", ticket.ID, reason)
+
+		// The admin on duty learns about the ticket by email
+		if assignee != nil && (ticket.AssignedTo == nil || *ticket.AssignedTo != *assignee) {
+			ticket.AssignedTo = assignee
+			notifyTicket(database, notifier, ticket, 0, notify.Event{
+				Kind:     notify.EventAssigned,
+				Assignee: db.GetUserName(database, *assignee),
+			}, false)
+		}
+	}
+}
+
+// slaTimers returns the SLA fields of a ticket
+func slaTimers(ticket models.Ticket) sla.Timers {
+	return sla.Timers{
+		FirstResponseDue: ticket.FirstResponseDue,
+		ResolutionDue:    ticket.ResolutionDue,
+		FirstResponseAt:  ticket.FirstResponseAt,
+		ResolvedAt:       ticket.ResolvedAt,
+	}
+}
+
+// slaPolicies returns the SLA targets by priority for display
+func slaPolicies() []map[string]interface{} {
+	policies := make([]map[string]interface{}, 0, len(workflow.Priorities))
+	for _, priority := range workflow.Priorities {
+		policy := sla.For(priority)
+		policies = append(policies, map[string]interface{}{
+			"priority":               priority,
+			"priority_label":         priority.Label(),
+			"first_response_minutes": int(policy.FirstResponse.Minutes()),
+			"resolution_minutes":     int(policy.Resolution.Minutes()),
+		})
+	}
+	return policies
+}
+
+// DutyShiftRequest defines the request body for scheduling a duty shift
+type DutyShiftRequest struct {
+	UserID   int       `json:"user_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// GetDutyShifts returns the current and upcoming duty shifts
+func (h *TicketHandler) GetDutyShifts(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	shifts, err := db.GetDutyShifts(h.DB, time.Now())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving duty shifts")
+		return
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Duty shifts retrieved successfully", map[string]interface{}{
+		"shifts":   shifts,
+		"policies": slaPolicies(),
+	})
+}
+
+// CreateDutyShift schedules an admin to take escalated tickets
+func (h *TicketHandler) CreateDutyShift(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+
+	// Parse request body
+	var req DutyShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if !req.EndsAt.After(req.StartsAt) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Shift must end after it starts")
+		return
+	}
+
+	// Only admins can be on duty
+	var role string
+	if err := h.DB.Table("users").Select("role").Where("id = ?", req.UserID).Scan(&role).Error; err != nil || role != "admin" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Duty user must be an admin")
+		return
+	}
+
+	shift := models.TicketDutyShift{
+		UserID:   req.UserID,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	}
+	if err := db.CreateDutyShift(h.DB, &shift); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating duty shift")
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Create Duty Shift",
+		fmt.Sprintf("Scheduled user %d on duty from %s to %s", req.UserID,
+			req.StartsAt.Format(time.RFC3339), req.EndsAt.Format(time.RFC3339)))
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Duty shift created successfully", shift)
+}
+
+// DeleteDutyShift removes a duty shift
+func (h *TicketHandler) DeleteDutyShift(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	userID, _ := utils.GetUserIDFromContext(r.Context())
+
+	// Get shift ID from URL
+	vars := mux.Vars(r)
+	shiftID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid shift ID")
+		return
+	}
+
+	if err := db.DeleteDutyShift(h.DB, shiftID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.RespondWithError(w, http.StatusNotFound, "Duty shift not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting duty shift")
+		}
+		return
+	}
+
+	// Log the action
+	utils.LogAction(h.DB, userID, "Delete Duty Shift", fmt.Sprintf("Deleted duty shift %d", shiftID))
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Duty shift deleted successfully", nil)
+}
+
+// requireAdmin responds with an error and returns false unless the user is an admin
+func (h *TicketHandler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	// Get user ID from context
+	if _, err := utils.GetUserIDFromContext(r.Context()); err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+
+	// Get user role from context
+	userRole, err := utils.GetUserRoleFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	if userRole != "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "Only admins can manage duty shifts")
+		return false
+	}
+	return true
+}
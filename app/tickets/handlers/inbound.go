@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"TeacherJournal/app/tickets/db"
+	"TeacherJournal/app/tickets/inbound"
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/notify"
+	"TeacherJournal/app/tickets/utils"
+	"TeacherJournal/app/tickets/workflow"
+	"TeacherJournal/config"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// maxInboundEmailSize limits the size of a raw incoming email
+const maxInboundEmailSize = 25 * 1024 * 1024
+
+// inboundSecretHeader carries the shared secret of the local MTA
+const inboundSecretHeader = "X-Inbound-Secret"
+
+// emailOnlyAttachments is the comment text of a reply that only carries files
+const emailOnlyAttachments = "(вложения из письма)"
+
+// ReceiveEmail turns a raw RFC 822 reply posted by the local MTA into a ticket comment.
+// The ticket and author come from the signed Reply-To token, or else from the [#id]
+// subject tag and a sender address verified by the MTA; staff must use the token.
+func (h *TicketHandler) ReceiveEmail(w http.ResponseWriter, r *http.Request) {
+	if config.InboundMailSecret == "" {
+		utils.RespondWithError(w, http.StatusNotFound, "Inbound email is not configured")
+		return
+	}
+	secret := r.Header.Get(inboundSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(config.InboundMailSecret)) != 1 {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Parse the message
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmailSize)
+	email, err := inbound.Parse(r.Body)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid email message: "+err.Error())
+		return
+	}
+
+	// The MTA may deliver the same message again
+	if email.MessageID != "" {
+		var existing models.TicketComment
+		if err := h.DB.Where("message_id = ?", email.MessageID).First(&existing).Error; err == nil {
+			utils.RespondWithSuccess(w, http.StatusOK, "Email already processed", map[string]interface{}{
+				"id":        existing.ID,
+				"ticket_id": existing.TicketID,
+			})
+			return
+		}
+	}
+
+	ticketID, userID, tokened, ok := h.matchEmail(email)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnprocessableEntity, "Cannot match email to a ticket, reply to the notification email")
+		return
+	}
+
+	// Get the ticket
+	ticket, err := db.GetTicketByID(h.DB, ticketID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.RespondWithError(w, http.StatusNotFound, "Ticket not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving ticket")
+		}
+		return
+	}
+
+	// Check if the sender may comment on the ticket
+	var userRole string
+	if err := h.DB.Table("users").Select("role").Where("id = ?", userID).Scan(&userRole).Error; err != nil || userRole == "" {
+		utils.RespondWithError(w, http.StatusForbidden, "Unknown sender")
+		return
+	}
+	if !tokened && userRole == "admin" {
+		utils.RespondWithError(w, http.StatusForbidden, "Staff replies must be sent to the address of the notification")
+		return
+	}
+	if userRole != "admin" && ticket.CreatedBy != userID && (ticket.AssignedTo == nil || *ticket.AssignedTo != userID) {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to comment on this ticket")
+		return
+	}
+	if ticket.Status == workflow.StatusClosed {
+		utils.RespondWithError(w, http.StatusConflict, "Ticket is closed")
+		return
+	}
+
+	content := inbound.StripReply(email.Text)
+	if content == "" {
+		if len(email.Attachments) == 0 {
+			utils.RespondWithError(w, http.StatusUnprocessableEntity, "Email has no reply text")
+			return
+		}
+		content = emailOnlyAttachments
+	}
+
+	// Add the comment
+	comment := models.TicketComment{
+		TicketID:  ticketID,
+		UserID:    userID,
+		Content:   content,
+		MessageID: email.MessageID,
+	}
+	if err := db.AddTicketComment(h.DB, &comment); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error adding comment")
+		return
+	}
+
+	for _, attachment := range email.Attachments {
+		if len(attachment.Data) > config.MaxFileSize {
+			log.Printf("Skipping email attachment %q of ticket %d: file too large", attachment.Name, ticketID)
+			continue
+		}
+		name := attachment.Name
+		if name == "" {
+			name = "attachment"
+		}
+		if err := h.storeAttachment(ticketID, comment.ID, userID, name, attachment.ContentType,
+			int64(len(attachment.Data)), bytes.NewReader(attachment.Data)); err != nil {
+			log.Printf("Error saving email attachment: %v", err)
+		}
+	}
+
+	// Update timers and status and notify followers
+	h.commentAdded(ticket, comment, userRole)
+
+	// Log the action
+	utils.LogTicketAction(h.DB, ticketID, userID, "Add Comment",
+		fmt.Sprintf("Added comment to ticket #%d by email", ticketID))
+
+	utils.RespondWithSuccess(w, http.StatusCreated, "Comment added successfully", map[string]interface{}{
+		"id":        comment.ID,
+		"ticket_id": ticketID,
+	})
+}
+
+// matchEmail finds the ticket and author of a reply; tokened tells whether they come
+// from a signed reply address rather than the subject tag and sender
+func (h *TicketHandler) matchEmail(email *inbound.Email) (ticketID, userID int, tokened, ok bool) {
+	for _, address := range email.Recipients {
+		token := inbound.AddressToken(address)
+		if token == "" {
+			continue
+		}
+		if ticketID, userID, ok := inbound.ParseReplyToken(config.InboundMailSecret, token); ok {
+			return ticketID, userID, true, true
+		}
+	}
+
+	// A reply written from scratch only has the subject tag. The From header is easy to
+	// forge, so the sender counts only when our MTA verified their domain.
+	ticketID, ok = inbound.SubjectTicketID(email.Subject)
+	if !ok || !email.SenderVerified(config.InboundMailAuthServID) {
+		return 0, 0, false, false
+	}
+	var userIDs []int
+	h.DB.Table("users").Where("LOWER(login) = ?", email.From).Limit(1).Pluck("id", &userIDs)
+	if len(userIDs) == 0 {
+		return 0, 0, false, false
+	}
+	return ticketID, userIDs[0], false, true
+}
+
+// replyHeaders gives every notification a Reply-To address that leads back to the ticket
+func replyHeaders(recipient notify.Recipient, ticketID int) map[string]string {
+	token := inbound.ReplyToken(config.InboundMailSecret, ticketID, recipient.UserID)
+	return map[string]string{"Reply-To": inbound.ReplyAddress(config.InboundMailAddress, token)}
+}
+
+// EnableEmailReplies makes notifications answerable by email when inbound mail is configured
+func EnableEmailReplies(notifier *notify.Notifier) {
+	if config.InboundMailSecret != "" && config.InboundMailAddress != "" {
+		notifier.Headers = replyHeaders
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"TeacherJournal/app/tickets/db"
+	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/notify"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// systemActor is the name shown for changes made by the service itself
+const systemActor = "Система поддержки"
+
+// notifyTicket queues an event of a ticket for everyone who follows it. actorID 0 is the service itself.
+func notifyTicket(database *gorm.DB, notifier *notify.Notifier, ticket models.Ticket, actorID int, event notify.Event, staffOnly bool) {
+	if notifier == nil {
+		return
+	}
+
+	recipients, err := db.GetNotificationRecipients(database, ticket, event.Kind, actorID, staffOnly)
+	if err != nil {
+		log.Printf("Error finding recipients for ticket %d: %v", ticket.ID, err)
+		return
+	}
+
+	event.TicketID = ticket.ID
+	event.Title = ticket.Title
+	event.Actor = systemActor
+	if actorID != 0 {
+		event.Actor = db.GetUserName(database, actorID)
+	}
+	notifier.Notify(event, recipients)
+}
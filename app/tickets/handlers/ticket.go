@@ -3,33 +3,45 @@ package handlers
 import (
 	"TeacherJournal/app/tickets/db"
 	"TeacherJournal/app/tickets/models"
+	"TeacherJournal/app/tickets/notify"
+	"TeacherJournal/app/tickets/sla"
+	"TeacherJournal/app/tickets/storage"
 	"TeacherJournal/app/tickets/utils"
+	"TeacherJournal/app/tickets/workflow"
 	"TeacherJournal/config"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
+// attachmentURLExpiry is how long a direct attachment download link stays valid
+const attachmentURLExpiry = 15 * time.Minute
+
 // TicketHandler handles ticket-related routes
 type TicketHandler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Notifier *notify.Notifier // Nil - no email notifications
+	Files    *storage.Set     // Where attachment files are kept
 }
 
 // NewTicketHandler creates a new TicketHandler
-func NewTicketHandler(database *gorm.DB) *TicketHandler {
+func NewTicketHandler(database *gorm.DB, notifier *notify.Notifier, files *storage.Set) *TicketHandler {
 	return &TicketHandler{
-		DB: database,
+		DB:       database,
+		Notifier: notifier,
+		Files:    files,
 	}
 }
 
@@ -53,6 +65,16 @@ func (h *TicketHandler) GetTickets(w http.ResponseWriter, r *http.Request) {
 	status := r.URL.Query().Get("status")
 	sortBy := r.URL.Query().Get("sort")
 
+	// Status filters may come as labels
+	if status != "" && status != "all" && status != "assigned" {
+		parsed, err := workflow.ParseStatus(status)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid status filter")
+			return
+		}
+		status = string(parsed)
+	}
+
 	// Get tickets based on user role and filters
 	tickets, err := db.GetUserTickets(h.DB, userID, status, userRole, sortBy)
 	if err != nil {
@@ -260,20 +282,34 @@ func (h *TicketHandler) GetTicket(w http.ResponseWriter, r *http.Request) {
 			Name  string `json:"name"`
 			Email string `json:"email"`
 		} `json:"assigned_to_user,omitempty"`
-		Comments        []models.TicketComment    `json:"comments,omitempty"`
-		Attachments     []models.TicketAttachment `json:"attachments,omitempty"`
-		History         []models.TicketHistory    `json:"history,omitempty"`
-		StatusOptions   []string                  `json:"status_options"`
-		PriorityOptions []string                  `json:"priority_options"`
-		CategoryOptions []string                  `json:"category_options"`
+		Comments           []models.TicketComment    `json:"comments,omitempty"`
+		Attachments        []models.TicketAttachment `json:"attachments,omitempty"`
+		History            []models.TicketHistory    `json:"history,omitempty"`
+		StatusOptions      []workflow.Option         `json:"status_options"`
+		PriorityOptions    []workflow.Option         `json:"priority_options"`
+		CategoryOptions    []string                  `json:"category_options"`
+		StatusLabel        string                    `json:"status_label"`
+		PriorityLabel      string                    `json:"priority_label"`
+		AllowedTransitions []workflow.Option         `json:"allowed_transitions"` // Statuses the current user may move the ticket to
+		SLA                struct {
+			FirstResponseBreached bool `json:"first_response_breached"`
+			ResolutionBreached    bool `json:"resolution_breached"`
+		} `json:"sla"`
 	}
 
 	// Create response
 	var response TicketDetailResponse
 	response.Ticket = ticket
-	response.StatusOptions = config.TicketStatusValues
-	response.PriorityOptions = config.TicketPriorityValues
+	response.StatusOptions = workflow.StatusOptions(workflow.Statuses)
+	response.PriorityOptions = workflow.PriorityOptions()
 	response.CategoryOptions = config.TicketCategoryValues
+	response.StatusLabel = ticket.Status.Label()
+	response.PriorityLabel = ticket.Priority.Label()
+	roles := workflow.Roles(userID, userRole, ticket.CreatedBy, ticket.AssignedTo)
+	response.AllowedTransitions = workflow.StatusOptions(workflow.Allowed(ticket.Status, roles))
+	now := time.Now()
+	response.SLA.FirstResponseBreached = ticket.FirstResponseBreached || sla.Breached(ticket.FirstResponseDue, ticket.FirstResponseAt, now)
+	response.SLA.ResolutionBreached = ticket.ResolutionBreached || sla.Breached(ticket.ResolutionDue, ticket.ResolvedAt, now)
 
 	// Set creator information
 	if creator, ok := userMap[ticket.CreatedBy]; ok {
@@ -376,6 +412,17 @@ func (h *TicketHandler) CreateTicket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// New tickets always enter the workflow at its start
+	ticket.Status = workflow.StatusNew
+	if ticket.Priority != "" {
+		priority, err := workflow.ParsePriority(string(ticket.Priority))
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid priority")
+			return
+		}
+		ticket.Priority = priority
+	}
+
 	// Set creator ID
 	ticket.CreatedBy = userID
 
@@ -388,6 +435,12 @@ func (h *TicketHandler) CreateTicket(w http.ResponseWriter, r *http.Request) {
 	// Log the action
 	utils.LogAction(h.DB, userID, "Create Ticket", fmt.Sprintf("Created ticket: %s", ticket.Title))
 
+	// Tell staff about the new ticket
+	notifyTicket(h.DB, h.Notifier, ticket, userID, notify.Event{
+		Kind:    notify.EventCreated,
+		Comment: ticket.Description,
+	}, false)
+
 	// Handle file attachments if present
 	if r.MultipartForm != nil && r.MultipartForm.File != nil {
 		files := r.MultipartForm.File["attachments"]
@@ -469,17 +522,42 @@ func (h *TicketHandler) UpdateTicket(w http.ResponseWriter, r *http.Request) {
 
 	// Fields that only creators or admins can update
 	if userRole == "admin" || ticket.CreatedBy == userID {
-		if priority, ok := updateReq["priority"].(string); ok && priority != "" {
-			updates["priority"] = priority
+		if value, ok := updateReq["priority"].(string); ok && value != "" {
+			priority, err := workflow.ParsePriority(value)
+			if err != nil {
+				utils.RespondWithError(w, http.StatusBadRequest, "Invalid priority")
+				return
+			}
+			if priority != ticket.Priority {
+				updates["priority"] = priority
+			}
 		}
 	}
 
-	// Admin-only updates
-	if userRole == "admin" {
-		if status, ok := updateReq["status"].(string); ok && status != "" {
+	// Status changes follow the workflow
+	if value, ok := updateReq["status"].(string); ok && value != "" {
+		status, err := workflow.ParseStatus(value)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid status")
+			return
+		}
+
+		roles := workflow.Roles(userID, userRole, ticket.CreatedBy, ticket.AssignedTo)
+		if err := workflow.Check(ticket.Status, status, roles); err != nil {
+			if errors.Is(err, workflow.ErrForbidden) {
+				utils.RespondWithError(w, http.StatusForbidden, err.Error())
+			} else {
+				utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		if status != ticket.Status {
 			updates["status"] = status
 		}
+	}
 
+	// Admin-only updates
+	if userRole == "admin" {
 		if assignedTo, ok := updateReq["assigned_to"]; ok {
 			// Check if null assignment
 			if assignedTo == nil {
@@ -489,11 +567,6 @@ func (h *TicketHandler) UpdateTicket(w http.ResponseWriter, r *http.Request) {
 				updates["assigned_to"] = int(assignedToID)
 			}
 		}
-	} else if ticket.CreatedBy == userID && ticket.Status == "Resolved" {
-		// Allow creator to reopen a resolved ticket
-		if status, ok := updateReq["status"].(string); ok && status == "Open" {
-			updates["status"] = status
-		}
 	}
 
 	// Apply updates if any
@@ -505,6 +578,23 @@ func (h *TicketHandler) UpdateTicket(w http.ResponseWriter, r *http.Request) {
 
 		// Log the action
 		utils.LogTicketAction(h.DB, ticketID, userID, "Update Ticket", fmt.Sprintf("Updated ticket #%d", ticketID))
+
+		// Notify followers about status and assignee changes
+		if updated, err := db.GetTicketByID(h.DB, ticketID); err == nil {
+			if status, ok := updates["status"].(workflow.Status); ok {
+				notifyTicket(h.DB, h.Notifier, updated, userID, notify.Event{
+					Kind:      notify.EventStatus,
+					OldStatus: ticket.Status,
+					NewStatus: status,
+				}, false)
+			}
+			if assignee, ok := updates["assigned_to"].(int); ok {
+				notifyTicket(h.DB, h.Notifier, updated, userID, notify.Event{
+					Kind:     notify.EventAssigned,
+					Assignee: db.GetUserName(h.DB, assignee),
+				}, false)
+			}
+		}
 	}
 
 	utils.RespondWithSuccess(w, http.StatusOK, "Ticket updated successfully", nil)
@@ -777,14 +867,8 @@ func (h *TicketHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update ticket status if necessary (for regular users only)
-	if userRole != "admin" && ticket.Status == "Resolved" {
-		// If user replies to a resolved ticket, reopen it
-		updates := map[string]interface{}{
-			"status": "InProgress",
-		}
-		db.UpdateTicket(h.DB, ticketID, userID, updates)
-	}
+	// Update timers and status and notify followers
+	h.commentAdded(ticket, comment, userRole)
 
 	// Log the action
 	utils.LogTicketAction(h.DB, ticketID, userID, "Add Comment",
@@ -805,6 +889,41 @@ func (h *TicketHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// commentAdded applies the effects of a new comment on its ticket
+func (h *TicketHandler) commentAdded(ticket models.Ticket, comment models.TicketComment, userRole string) {
+	userID := comment.UserID
+
+	// A public answer by anyone but the creator stops the first response timer
+	if !comment.IsInternal && userID != ticket.CreatedBy && ticket.FirstResponseAt == nil {
+		if err := db.RecordFirstResponse(h.DB, ticket.ID, comment.CreatedAt); err != nil {
+			log.Printf("Error recording first response: %v", err)
+		}
+	}
+
+	// Update ticket status if necessary (for regular users only)
+	roles := workflow.Roles(userID, userRole, ticket.CreatedBy, ticket.AssignedTo)
+	if userRole != "admin" && ticket.Status == workflow.StatusResolved &&
+		workflow.Check(ticket.Status, workflow.StatusInProgress, roles) == nil {
+		// If user replies to a resolved ticket, reopen it
+		updates := map[string]interface{}{
+			"status": workflow.StatusInProgress,
+		}
+		if err := db.UpdateTicket(h.DB, ticket.ID, userID, updates); err == nil {
+			notifyTicket(h.DB, h.Notifier, ticket, userID, notify.Event{
+				Kind:      notify.EventStatus,
+				OldStatus: ticket.Status,
+				NewStatus: workflow.StatusInProgress,
+			}, false)
+		}
+	}
+
+	// Internal notes only go to staff
+	notifyTicket(h.DB, h.Notifier, ticket, userID, notify.Event{
+		Kind:    notify.EventComment,
+		Comment: comment.Content,
+	}, comment.IsInternal)
+}
+
 // GetAttachments returns all attachments for a ticket
 func (h *TicketHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -992,18 +1111,31 @@ func (h *TicketHandler) DownloadAttachment(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Open the file
-	file, err := os.Open(attachment.FilePath)
+	// Open the file in its backend
+	backend, err := h.Files.Get(attachment.Storage)
 	if err != nil {
+		log.Printf("Error opening attachment %d: %v", attachment.ID, err)
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error opening attachment file")
 		return
 	}
+	file, size, err := backend.Open(r.Context(), attachment.FilePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Attachment file not found")
+		} else {
+			log.Printf("Error opening attachment %d: %v", attachment.ID, err)
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error opening attachment file")
+		}
+		return
+	}
 	defer file.Close()
 
 	// Set response headers
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", attachment.FileName))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
 	w.Header().Set("Content-Type", attachment.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(attachment.FileSize, 10))
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
 
 	// Stream the file to the response
 	_, err = io.Copy(w, file)
@@ -1012,6 +1144,80 @@ func (h *TicketHandler) DownloadAttachment(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// GetAttachmentURL returns a link to download an attachment: a short-lived direct link
+// to the storage when it supports them, or else the download route of this service
+func (h *TicketHandler) GetAttachmentURL(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := utils.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get user role from context
+	userRole, err := utils.GetUserRoleFromContext(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Get attachment ID from URL
+	vars := mux.Vars(r)
+	attachmentID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return
+	}
+
+	// Get attachment
+	var attachment models.TicketAttachment
+	if err := h.DB.First(&attachment, attachmentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.RespondWithError(w, http.StatusNotFound, "Attachment not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving attachment")
+		}
+		return
+	}
+
+	// Get the ticket to verify access
+	ticket, err := db.GetTicketByID(h.DB, attachment.TicketID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving ticket")
+		return
+	}
+
+	// Check if user has access to this ticket
+	if userRole != "admin" && ticket.CreatedBy != userID && (ticket.AssignedTo == nil || *ticket.AssignedTo != userID) {
+		utils.RespondWithError(w, http.StatusForbidden, "You don't have permission to download this attachment")
+		return
+	}
+
+	response := map[string]interface{}{
+		"url":      fmt.Sprintf("/api/tickets/attachments/%d", attachment.ID),
+		"direct":   false,
+		"expires":  nil,
+		"filename": attachment.FileName,
+	}
+
+	if config.S3PresignDownloads {
+		if backend, err := h.Files.Get(attachment.Storage); err == nil {
+			if presigner, ok := backend.(storage.Presigner); ok {
+				link, err := presigner.PresignGet(attachment.FilePath, attachment.FileName, attachmentURLExpiry)
+				if err != nil {
+					log.Printf("Error presigning attachment %d: %v", attachment.ID, err)
+				} else {
+					response["url"] = link
+					response["direct"] = true
+					response["expires"] = time.Now().Add(attachmentURLExpiry)
+				}
+			}
+		}
+	}
+
+	utils.RespondWithSuccess(w, http.StatusOK, "Attachment URL retrieved successfully", response)
+}
+
 // GetTicketStats returns statistics about tickets
 func (h *TicketHandler) GetTicketStats(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
@@ -1033,12 +1239,27 @@ func (h *TicketHandler) GetTicketStats(w http.ResponseWriter, r *http.Request) {
 	// Count total tickets
 	h.DB.Model(&models.Ticket{}).Count(&stats.Total)
 
-	// Count tickets by status using case-insensitive comparison
-	h.DB.Model(&models.Ticket{}).Where("LOWER(status) = LOWER(?)", "New").Count(&stats.New)
-	h.DB.Model(&models.Ticket{}).Where("LOWER(status) = LOWER(?)", "Open").Count(&stats.Open)
-	h.DB.Model(&models.Ticket{}).Where("LOWER(status) = LOWER(?)", "InProgress").Or("LOWER(status) = LOWER(?)", "In Progress").Count(&stats.InProgress)
-	h.DB.Model(&models.Ticket{}).Where("LOWER(status) = LOWER(?)", "Resolved").Count(&stats.Resolved)
-	h.DB.Model(&models.Ticket{}).Where("LOWER(status) = LOWER(?)", "Closed").Count(&stats.Closed)
+	// Count tickets by status; stored values are normalized to the workflow codes
+	h.DB.Model(&models.Ticket{}).Where("status = ?", workflow.StatusNew).Count(&stats.New)
+	h.DB.Model(&models.Ticket{}).Where("status = ?", workflow.StatusOpen).Count(&stats.Open)
+	h.DB.Model(&models.Ticket{}).Where("status = ?", workflow.StatusInProgress).Count(&stats.InProgress)
+	h.DB.Model(&models.Ticket{}).Where("status = ?", workflow.StatusResolved).Count(&stats.Resolved)
+	h.DB.Model(&models.Ticket{}).Where("status = ?", workflow.StatusClosed).Count(&stats.Closed)
+
+	// Count SLA breaches, including those of due dates replaced on escalation; tickets
+	// without due dates are not tracked
+	now := time.Now()
+	h.DB.Model(&models.Ticket{}).
+		Where("first_response_breached OR (first_response_at IS NULL AND first_response_due < ?) OR first_response_at > first_response_due", now).
+		Count(&stats.FirstResponseBreaches)
+	h.DB.Model(&models.Ticket{}).
+		Where("resolution_breached OR (resolved_at IS NULL AND resolution_due < ?) OR resolved_at > resolution_due", now).
+		Count(&stats.ResolutionBreaches)
+	h.DB.Model(&models.Ticket{}).
+		Where("resolved_at IS NULL AND status IN ?", []workflow.Status{workflow.StatusNew, workflow.StatusOpen, workflow.StatusInProgress}).
+		Where("(first_response_at IS NULL AND first_response_due < ?) OR resolution_due < ?", now, now).
+		Count(&stats.Overdue)
+	h.DB.Model(&models.Ticket{}).Where("escalation_level > 0").Count(&stats.Escalated)
 
 	// Count tickets assigned to user
 	h.DB.Model(&models.Ticket{}).Where("assigned_to = ?", userID).Count(&stats.AssignedToUser)
@@ -1063,26 +1284,16 @@ func (h *TicketHandler) saveAttachment(ticketID int, commentID int, userID int,
 	}
 	defer file.Close()
 
-	// Create attachments directory if it doesn't exist
-	if err := os.MkdirAll(config.AttachmentStoragePath, os.ModePerm); err != nil {
-		return err
-	}
-
-	// Generate unique filename
-	timestamp := time.Now().Unix()
-	filename := filepath.Base(fileHeader.Filename)
-	safeName := fmt.Sprintf("%d_%d_%s", ticketID, timestamp, strings.ReplaceAll(filename, " ", "_"))
-	filePath := filepath.Join(config.AttachmentStoragePath, safeName)
-
-	// Create destination file
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer dst.Close()
+	return h.storeAttachment(ticketID, commentID, userID, fileHeader.Filename, fileHeader.Header.Get("Content-Type"), fileHeader.Size, file)
+}
 
-	// Copy the file
-	if _, err = io.Copy(dst, file); err != nil {
+// storeAttachment writes an attachment read from file and creates its record
+func (h *TicketHandler) storeAttachment(ticketID, commentID, userID int, name, contentType string, size int64, file io.Reader) error {
+	// Store the file in the current backend
+	now := time.Now()
+	key := storage.Key(ticketID, name, now)
+	backend := h.Files.Current
+	if err := backend.Put(context.Background(), key, file, size, contentType); err != nil {
 		return err
 	}
 
@@ -1095,13 +1306,21 @@ func (h *TicketHandler) saveAttachment(ticketID int, commentID int, userID int,
 	attachment := models.TicketAttachment{
 		TicketID:    ticketID,
 		CommentID:   commentIDPtr,
-		FileName:    filename,
-		FilePath:    filePath,
-		FileSize:    fileHeader.Size,
-		ContentType: fileHeader.Header.Get("Content-Type"),
+		FileName:    filepath.Base(name),
+		FilePath:    key,
+		Storage:     backend.Name(),
+		FileSize:    size,
+		ContentType: contentType,
 		UploadedBy:  userID,
-		UploadedAt:  time.Now(),
+		UploadedAt:  now,
 	}
 
-	return h.DB.Create(&attachment).Error
+	if err := h.DB.Create(&attachment).Error; err != nil {
+		// Do not leave a file without a record
+		if deleteErr := backend.Delete(context.Background(), key); deleteErr != nil {
+			log.Printf("Error removing orphaned attachment file %s: %v", key, deleteErr)
+		}
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,56 @@
+package inbound
+
+import (
+	"regexp"
+	"strings"
+)
+
+// authComment matches comments in Authentication-Results headers
+var authComment = regexp.MustCompile(`\([^)]*\)`)
+
+// SenderVerified reports whether the MTA named authServID confirmed that the message was
+// sent from the domain of its From address: DMARC passed, or a DKIM signature of that
+// domain verified. Results of other servers are ignored, since the sender can write
+// them; the MTA must remove headers claiming its own ID from incoming messages.
+func (e *Email) SenderVerified(authServID string) bool {
+	at := strings.LastIndex(e.From, "@")
+	if authServID == "" || at < 0 {
+		return false
+	}
+	domain := e.From[at+1:]
+
+	for _, header := range e.AuthResults {
+		parts := strings.Split(authComment.ReplaceAllString(strings.ToLower(header), " "), ";")
+		id := strings.Fields(parts[0])
+		if len(id) == 0 || id[0] != strings.ToLower(authServID) {
+			continue
+		}
+		for _, result := range parts[1:] {
+			fields := strings.Fields(result)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "dmarc=pass":
+				if hasProperty(fields[1:], "header.from", domain) {
+					return true
+				}
+			case "dkim=pass":
+				if hasProperty(fields[1:], "header.d", domain) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasProperty reports whether a result carries the property name=value
+func hasProperty(fields []string, name, value string) bool {
+	for _, field := range fields {
+		if field == name+"="+value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package inbound
+
+import (
+    "strings"
+    "testing"
+)
+
+const multipartReply = "From: =?UTF-8?B?0JjQstCw0L0=?= <Ivan@Example.com>\r\n" +
+    "To: support+t12-u3-abc@journal.local\r\n" +
+    "Cc: boss@example.com\r\n" +
+    "Subject: =?UTF-8?B?UmU6IFsjMTJdINCe0YjQuNCx0LrQsA==?=\r\n" +
+    "Message-ID: <reply-1@example.com>\r\n" +
+    "MIME-Version: 1.0\r\n" +
+    "Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+    "\r\n" +
+    "--outer\r\n" +
+    "Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+    "\r\n" +
+    "--inner\r\n" +
+    "Content-Type: text/plain; charset=windows-1251\r\n" +
+    "Content-Transfer-Encoding: quoted-printable\r\n" +
+    "\r\n" +
+    "=CF=F0=EE=E2=E5=F0=FC=F2=E5\r\n" +
+    "--inner\r\n" +
+    "Content-Type: text/html; charset=utf-8\r\n" +
+    "\r\n" +
+    "<p>HTML</p>\r\n" +
+    "--inner--\r\n" +
+    "--outer\r\n" +
+    "Content-Type: text/plain; name=\"log.txt\"\r\n" +
+    "Content-Disposition: attachment; filename=\"log.txt\"\r\n" +
+    "Content-Transfer-Encoding: base64\r\n" +
+    "\r\n" +
+    "ZXJyb3IgbG9n\r\n" +
+    "--outer--\r\n"
+
+func TestParseMultipart(t *testing.T) {
+    email, err := Parse(strings.NewReader(multipartReply))
+    if err != nil {
+        t.Fatalf("parse error: %v", err)
+    }
+    if email.From != "ivan@example.com" || email.MessageID != "reply-1@example.com" {
+        t.Fatalf("unexpected sender or id: %+v", email)
+    }
+    if email.Subject != "Re: [#12] Ошибка" {
+        t.Fatalf("unexpected subject %q", email.Subject)
+    }
+    if len(email.Recipients) != 2 || email.Recipients[0] != "support+t12-u3-abc@journal.local" {
+        t.Fatalf("unexpected recipients %v", email.Recipients)
+    }
+    if strings.TrimSpace(email.Text) != "Проверьте" {
+        t.Fatalf("unexpected text %q", email.Text)
+    }
+    if len(email.Attachments) != 1 || email.Attachments[0].Name != "log.txt" || string(email.Attachments[0].Data) != "error log" {
+        t.Fatalf("unexpected attachments %+v", email.Attachments)
+    }
+}
+
+func TestParseHTMLOnly(t *testing.T) {
+    raw := "From: a@example.com\r\n" +
+        "Subject: [#4]\r\n" +
+        "Content-Type: text/html; charset=utf-8\r\n" +
+        "\r\n" +
+        "<html><head><style>p{}</style></head><body><p>Готово &amp; проверено</p><br>" +
+        "<blockquote>старое письмо</blockquote></body></html>"
+    email, err := Parse(strings.NewReader(raw))
+    if err != nil {
+        t.Fatalf("parse error: %v", err)
+    }
+    if strings.TrimSpace(email.Text) != "Готово & проверено" {
+        t.Fatalf("unexpected text %q", email.Text)
+    }
+}
+
+func TestParseInvalidSender(t *testing.T) {
+    if _, err := Parse(strings.NewReader("Subject: x\r\n\r\nbody")); err == nil {
+        t.Fatalf("expected error for missing sender")
+    }
+}
+
+func TestStripReply(t *testing.T) {
+    cases := map[string]string{
+        "Спасибо, работает.\n\nOn Mon, 10 Mar 2025 at 09:00, Support <support@journal.local> wrote:\n> старый текст": "Спасибо, работает.",
+        "Готово\n\n10 марта 2025 г., в 12:00, Служба поддержки <support@journal.local> пишет:\n> цитата":              "Готово",
+        "Ответ\nOn Mon, 10 Mar 2025 at 09:00, Support <\nsupport@journal.local> wrote:\n> цитата":                      "Ответ",
+        "Ответ\n\n-----Original Message-----\nFrom: someone":                                                         "Ответ",
+        "Ответ\r\n\r\nОт: Поддержка <support@journal.local>\r\nОтправлено: 10 марта 2025\r\nТема: тикет":             "Ответ",
+        "Текст\n-- \nИван Петров\nкафедра ИТ":                                                                        "Текст",
+        "Текст\n\nОтправлено с iPhone":                                                                               "Текст",
+        "> вопрос\nответ на вопрос\n> ещё вопрос\nещё ответ":                                                          "ответ на вопрос\nещё ответ",
+        "От: этого зависит многое, оставьте как есть":                                                                "От: этого зависит многое, оставьте как есть",
+    }
+    for input, want := range cases {
+        if got := StripReply(input); got != want {
+            t.Fatalf("StripReply(%q) = %q, want %q", input, got, want)
+        }
+    }
+}
+
+func TestReplyToken(t *testing.T) {
+    token := ReplyToken("secret", 12, 3)
+    if !strings.HasPrefix(token, "t12-u3-") {
+        t.Fatalf("unexpected token %q", token)
+    }
+    ticketID, userID, ok := ParseReplyToken("secret", strings.ToUpper(token))
+    if !ok || ticketID != 12 || userID != 3 {
+        t.Fatalf("unexpected parse %d %d %v", ticketID, userID, ok)
+    }
+    forged := strings.Replace(token, "u3", "u4", 1)
+    if _, _, ok := ParseReplyToken("secret", forged); ok {
+        t.Fatalf("forged token accepted")
+    }
+    if _, _, ok := ParseReplyToken("", token); ok {
+        t.Fatalf("token accepted without a secret")
+    }
+    if _, _, ok := ParseReplyToken("secret", "garbage"); ok {
+        t.Fatalf("garbage accepted")
+    }
+}
+
+func TestAddresses(t *testing.T) {
+    address := ReplyAddress("support@journal.local", "t1-u2-abcd")
+    if address != "support+t1-u2-abcd@journal.local" {
+        t.Fatalf("unexpected address %q", address)
+    }
+    if AddressToken(address) != "t1-u2-abcd" || AddressToken("support@journal.local") != "" {
+        t.Fatalf("unexpected token extraction")
+    }
+    if id, ok := SubjectTicketID("Re: Fwd: [#42] Ошибка"); !ok || id != 42 {
+        t.Fatalf("unexpected subject id %d %v", id, ok)
+    }
+    if _, ok := SubjectTicketID("Вопрос"); ok {
+        t.Fatalf("expected no id")
+    }
+}
+
+func TestSenderVerified(t *testing.T) {
+    email := &Email{From: "ivan@example.com", AuthResults: []string{
+        "evil.example; dmarc=pass header.from=example.com",
+        "mx.journal.local; spf=pass smtp.mailfrom=example.com; dkim=pass (2048-bit key) header.d=example.com header.s=mail",
+    }}
+    if !email.SenderVerified("mx.journal.local") {
+        t.Fatalf("dkim of the sender domain should verify the sender")
+    }
+    if email.SenderVerified("") || email.SenderVerified("evil.example.org") {
+        t.Fatalf("results of other servers must be ignored")
+    }
+
+    email.AuthResults = []string{"mx.journal.local; spf=pass smtp.mailfrom=example.com; dkim=pass header.d=other.com"}
+    if email.SenderVerified("mx.journal.local") {
+        t.Fatalf("spf and dkim of another domain must not verify the sender")
+    }
+    email.AuthResults = []string{"MX.journal.local 1; dmarc=pass (p=none) header.from=Example.com"}
+    if !email.SenderVerified("mx.journal.local") {
+        t.Fatalf("dmarc pass should verify the sender")
+    }
+}
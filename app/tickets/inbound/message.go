@@ -0,0 +1,192 @@
+// Package inbound reads emails sent in reply to ticket notifications: it parses the
+// message, finds the ticket it answers and keeps only the new text of the reply.
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Email is the part of a message needed to turn it into a comment
+type Email struct {
+	From        string   // Sender address
+	Recipients  []string // To, Cc and delivery addresses
+	Subject     string
+	MessageID   string
+	AuthResults []string // Authentication-Results headers added by mail servers on the way
+	Text        string   // Plain text body; the HTML body converted to text if there is no plain one
+	Attachments []Attachment
+}
+
+// decoder decodes encoded words in any charset known to browsers
+var decoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader converts text in the given charset to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+// Parse reads a raw RFC 822 message
+func Parse(r io.Reader) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	email := &Email{MessageID: strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>")}
+	if subject, err := decoder.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		email.Subject = subject
+	} else {
+		email.Subject = msg.Header.Get("Subject")
+	}
+
+	parser := &mail.AddressParser{WordDecoder: decoder}
+	from, err := parser.Parse(msg.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+	email.From = strings.ToLower(from.Address)
+	email.AuthResults = msg.Header["Authentication-Results"]
+
+	for _, field := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		for _, value := range msg.Header[field] {
+			addresses, err := parser.ParseList(value)
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				email.Recipients = append(email.Recipients, strings.ToLower(address.Address))
+			}
+		}
+	}
+
+	var htmlBody string
+	header := textproto.MIMEHeader(msg.Header)
+	if err := email.walk(header, msg.Body, &htmlBody); err != nil {
+		return nil, err
+	}
+	if email.Text == "" && htmlBody != "" {
+		email.Text = htmlToText(htmlBody)
+	}
+	return email, nil
+}
+
+// walk collects the body and attachments of a message part and its children
+func (e *Email) walk(header textproto.MIMEHeader, body io.Reader, htmlBody *string) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain; charset=us-ascii"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "application/octet-stream", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := e.walk(part.Header, part, htmlBody); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := dispositionParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if decoded, err := decoder.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+
+	isBody := disposition != "attachment" && name == ""
+	switch {
+	case isBody && mediaType == "text/plain" && e.Text == "":
+		e.Text = decodeCharset(params["charset"], data)
+	case isBody && mediaType == "text/html" && *htmlBody == "":
+		*htmlBody = decodeCharset(params["charset"], data)
+	case !isBody:
+		e.Attachments = append(e.Attachments, Attachment{Name: name, ContentType: mediaType, Data: data})
+	}
+	return nil
+}
+
+// decodeTransfer undoes the content transfer encoding of a part
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// decodeCharset converts text to UTF-8; text in an unknown charset is kept as is
+func decodeCharset(charset string, data []byte) string {
+	if charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+		return string(data)
+	}
+	reader, err := charsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+var (
+	htmlQuote  = regexp.MustCompile(`(?is)<blockquote.*</blockquote>`)
+	htmlHidden = regexp.MustCompile(`(?is)<(head|style|script)[^>]*>.*?</(head|style|script)>`)
+	htmlBreak  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTag    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlToText turns an HTML body into plain text, dropping quoted history
+func htmlToText(body string) string {
+	body = htmlHidden.ReplaceAllString(body, "")
+	body = htmlQuote.ReplaceAllString(body, "")
+	body = htmlBreak.ReplaceAllString(body, "\n")
+	body = htmlTag.ReplaceAllString(body, "")
+	return html.UnescapeString(body)
+}
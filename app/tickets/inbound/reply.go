@@ -0,0 +1,59 @@
+package inbound
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// quoteHeader matches the line mail clients put above quoted history,
+	// e.g. "On Mon, 10 Mar 2025 Ivan <ivan@example.com> wrote:" or "10.03.2025, Иван пишет:"
+	quoteHeader = regexp.MustCompile(`(?i)^(on\s.+\swrote|.+\s(пишет|написал|написала|написал\(а\)))\s*:$`)
+	// originalMessage matches separators such as "-----Original Message-----"
+	originalMessage = regexp.MustCompile(`(?i)^-{2,}\s*(original message|forwarded message|исходное сообщение|пересылаемое сообщение)\s*-{2,}$`)
+	// outlookFrom and outlookField match the header block Outlook puts above quoted history
+	outlookFrom  = regexp.MustCompile(`(?i)^\*?(from|от)\s*:\*?\s`)
+	outlookField = regexp.MustCompile(`(?i)^\*?(sent|date|to|subject|отправлено|дата|кому|тема)\s*:`)
+	// mobileSignature matches signatures added by phone mail apps
+	mobileSignature = regexp.MustCompile(`(?i)^(sent from my|отправлено с|отправлено из)\s`)
+)
+
+// StripReply returns the new text of a reply: quoted lines, the quoted history
+// below the client's quote header and the signature are removed
+func StripReply(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if line == "-- " || trimmed == "--" || mobileSignature.MatchString(trimmed) {
+			break
+		}
+		if originalMessage.MatchString(trimmed) || quoteHeader.MatchString(trimmed) {
+			break
+		}
+		// Long quote headers are often wrapped onto the next line
+		if i+1 < len(lines) && quoteHeader.MatchString(trimmed+" "+strings.TrimSpace(lines[i+1])) {
+			break
+		}
+		if outlookFrom.MatchString(trimmed) && outlookBlock(lines[i+1:]) {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// outlookBlock reports whether the lines after a "From:" line continue a quoted header block
+func outlookBlock(lines []string) bool {
+	for i := 0; i < len(lines) && i < 3; i++ {
+		if outlookField.MatchString(strings.TrimSpace(lines[i])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReplyToken signs a ticket and a user, so a reply sent to the address carrying it is
+// matched to both without storing anything. Tokens are lower case because some mail
+// servers change the case of addresses.
+func ReplyToken(secret string, ticketID, userID int) string {
+	return fmt.Sprintf("t%d-u%d-%s", ticketID, userID, signature(secret, ticketID, userID))
+}
+
+// ParseReplyToken checks a token made by ReplyToken and returns what it signs
+func ParseReplyToken(secret, token string) (ticketID, userID int, ok bool) {
+	if secret == "" {
+		return 0, 0, false
+	}
+	parts := strings.Split(strings.ToLower(token), "-")
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "t") || !strings.HasPrefix(parts[1], "u") {
+		return 0, 0, false
+	}
+	ticketID, err := strconv.Atoi(parts[0][1:])
+	if err != nil {
+		return 0, 0, false
+	}
+	userID, err = strconv.Atoi(parts[1][1:])
+	if err != nil {
+		return 0, 0, false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signature(secret, ticketID, userID))) {
+		return 0, 0, false
+	}
+	return ticketID, userID, true
+}
+
+// signature is the truncated HMAC of a ticket and user
+func signature(secret string, ticketID, userID int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%d", ticketID, userID)
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ReplyAddress adds a token to a mailbox address as a subaddress: support@host becomes support+token@host
+func ReplyAddress(address, token string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return address
+	}
+	return address[:at] + "+" + token + address[at:]
+}
+
+// AddressToken returns the subaddress of an address, or an empty string
+func AddressToken(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	local := address[:at]
+	plus := strings.Index(local, "+")
+	if plus < 0 {
+		return ""
+	}
+	return local[plus+1:]
+}
+
+// subjectTag matches the [#id] tag of notification subjects
+var subjectTag = regexp.MustCompile(`\[#(\d+)\]`)
+
+// SubjectTicketID returns the ticket ID tagged in a subject
+func SubjectTicketID(subject string) (int, bool) {
+	match := subjectTag.FindStringSubmatch(subject)
+	if match == nil {
+		return 0, false
+	}
+	ticketID, err := strconv.Atoi(match[1])
+	return ticketID, err == nil
+}
@@ -1,22 +1,35 @@
 package models
 
 import (
+	"TeacherJournal/app/tickets/workflow"
 	"time"
 )
 
 // Ticket represents a support ticket in the system
 type Ticket struct {
-	ID           int       `gorm:"primaryKey" json:"id"`
-	Title        string    `gorm:"not null;type:varchar(255)" json:"title"`
-	Description  string    `gorm:"not null;type:text" json:"description"`
-	Status       string    `gorm:"not null;default:'New';type:varchar(50)" json:"status"`      // New, Open, InProgress, Resolved, Closed
-	Priority     string    `gorm:"not null;default:'Medium';type:varchar(50)" json:"priority"` // Low, Medium, High, Critical
-	Category     string    `gorm:"not null;type:varchar(100)" json:"category"`                 // Technical, Administrative, Account, Feature, Bug, Other
-	CreatedBy    int       `gorm:"column:creator_id;not null" json:"created_by"`               // UserID from main app
-	AssignedTo   *int      `gorm:"column:assigned_to" json:"assigned_to,omitempty"`            // UserID from main app, can be null
-	CreatedAt    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt    time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
-	LastActivity time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"last_activity"`
+	ID           int               `gorm:"primaryKey" json:"id"`
+	Title        string            `gorm:"not null;type:varchar(255)" json:"title"`
+	Description  string            `gorm:"not null;type:text" json:"description"`
+	Status       workflow.Status   `gorm:"not null;default:'New';type:varchar(50)" json:"status"`      // See workflow.Statuses
+	Priority     workflow.Priority `gorm:"not null;default:'Medium';type:varchar(50)" json:"priority"` // See workflow.Priorities
+	Category     string            `gorm:"not null;type:varchar(100)" json:"category"`                 // Technical, Administrative, Account, Feature, Bug, Other
+	CreatedBy    int               `gorm:"column:creator_id;not null" json:"created_by"`               // UserID from main app
+	AssignedTo   *int              `gorm:"column:assigned_to" json:"assigned_to,omitempty"`            // UserID from main app, can be null
+	CreatedAt    time.Time         `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+	LastActivity time.Time         `gorm:"not null;default:CURRENT_TIMESTAMP" json:"last_activity"`
+
+	// SLA timers, see package sla. Tickets created before SLA tracking may have no due dates.
+	FirstResponseDue *time.Time `json:"first_response_due,omitempty"`
+	ResolutionDue    *time.Time `json:"resolution_due,omitempty"`
+	FirstResponseAt  *time.Time `json:"first_response_at,omitempty"` // First public answer by someone other than the creator
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`       // Cleared when the ticket is reopened
+	EscalatedAt      *time.Time `json:"escalated_at,omitempty"`
+	EscalationLevel  int        `gorm:"not null;default:0" json:"escalation_level"` // Times the ticket was escalated
+
+	// Breaches of due dates that were replaced since, by escalation, a priority change or reopening
+	FirstResponseBreached bool `gorm:"not null;default:false" json:"first_response_breached"`
+	ResolutionBreached    bool `gorm:"not null;default:false" json:"resolution_breached"`
 }
 
 // TicketComment represents a comment on a ticket
@@ -28,6 +41,7 @@ type TicketComment struct {
 	Content    string    `gorm:"type:text;not null" json:"content"`
 	CreatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	IsInternal bool      `gorm:"not null;default:false" json:"is_internal"` // For internal notes visible only to staff
+	MessageID  string    `gorm:"type:varchar(255);index" json:"-"`          // Message-ID of the email the comment came from
 }
 
 // TicketAttachment represents a file attached to a ticket
@@ -38,7 +52,8 @@ type TicketAttachment struct {
 	CommentID   *int          `gorm:"default:null" json:"comment_id,omitempty"` // Can be attached to a comment or directly to a ticket
 	Comment     TicketComment `gorm:"foreignKey:CommentID" json:"-"`
 	FileName    string        `gorm:"not null" json:"file_name"`
-	FilePath    string        `gorm:"not null" json:"file_path"` // Server path where file is stored
+	FilePath    string        `gorm:"not null" json:"file_path"`                          // Key of the file in its storage backend
+	Storage     string        `gorm:"type:varchar(20);not null;default:'local'" json:"-"` // Backend holding the file, see package storage
 	FileSize    int64         `gorm:"not null" json:"file_size"`
 	ContentType string        `gorm:"not null" json:"content_type"`
 	UploadedBy  int           `gorm:"not null" json:"uploaded_by"` // UserID from main app
@@ -66,6 +81,15 @@ type TicketSubscription struct {
 	Subscribed bool   `gorm:"not null;default:true" json:"subscribed"`
 }
 
+// TicketDutyShift is a period during which an admin takes escalated tickets
+type TicketDutyShift struct {
+	ID        int       `gorm:"primaryKey" json:"id"`
+	UserID    int       `gorm:"not null;index" json:"user_id"` // Admin UserID from main app
+	StartsAt  time.Time `gorm:"not null;index" json:"starts_at"`
+	EndsAt    time.Time `gorm:"not null" json:"ends_at"`
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
 // UserInfo contains basic user information
 type UserInfo struct {
 	ID    int    `json:"id"`
@@ -84,4 +108,10 @@ type TicketStats struct {
 	Closed         int64 `json:"closed"`
 	AssignedToUser int64 `json:"assigned_to_user"`
 	CreatedByUser  int64 `json:"created_by_user"`
+
+	// SLA breaches over all tracked tickets
+	FirstResponseBreaches int64 `json:"first_response_breaches"`
+	ResolutionBreaches    int64 `json:"resolution_breaches"`
+	Overdue               int64 `json:"overdue"`   // Unresolved tickets past a due date
+	Escalated             int64 `json:"escalated"` // Tickets escalated at least once
 }
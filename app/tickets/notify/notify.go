@@ -0,0 +1,137 @@
+// Package notify emails ticket events to the users who follow them. Events are
+// collected for a short window, so a burst of changes to one ticket arrives as one
+// email, and failed deliveries are retried.
+package notify
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBatchWindow is how long events are collected before they are sent
+	DefaultBatchWindow = 30 * time.Second
+	// DefaultAttempts is how many times a message is tried before it is dropped
+	DefaultAttempts = 3
+	// DefaultRetryDelay is the wait before the first retry; it doubles with every attempt
+	DefaultRetryDelay = 5 * time.Second
+)
+
+// batchKey groups the events of one ticket for one recipient
+type batchKey struct {
+	email    string
+	ticketID int
+}
+
+// batch is the pending events for one recipient and ticket
+type batch struct {
+	recipient Recipient
+	events    []Event
+}
+
+// Notifier queues ticket events and sends them through a transport
+type Notifier struct {
+	Transport   Transport
+	BaseURL     string // Frontend address for ticket links
+	BatchWindow time.Duration
+	Attempts    int
+	RetryDelay  time.Duration
+
+	// Headers returns extra headers of a message, for example a Reply-To address; may be nil
+	Headers func(recipient Recipient, ticketID int) map[string]string
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch
+	order   []batchKey
+}
+
+// New creates a Notifier with the default batching and retry settings
+func New(transport Transport, baseURL string) *Notifier {
+	return &Notifier{
+		Transport:   transport,
+		BaseURL:     baseURL,
+		BatchWindow: DefaultBatchWindow,
+		Attempts:    DefaultAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		pending:     make(map[batchKey]*batch),
+	}
+}
+
+// Start sends the queued events every batch window
+func (n *Notifier) Start() {
+	go func() {
+		ticker := time.NewTicker(n.BatchWindow)
+		defer ticker.Stop()
+		for range ticker.C {
+			n.Flush()
+		}
+	}()
+}
+
+// Notify queues an event for the recipients. A nil Notifier drops it.
+func (n *Notifier) Notify(event Event, recipients []Recipient) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, recipient := range recipients {
+		if recipient.Email == "" {
+			continue
+		}
+		key := batchKey{email: recipient.Email, ticketID: event.TicketID}
+		pending, ok := n.pending[key]
+		if !ok {
+			pending = &batch{recipient: recipient}
+			n.pending[key] = pending
+			n.order = append(n.order, key)
+		}
+		pending.events = append(pending.events, event)
+	}
+}
+
+// Flush sends all queued events, one message per recipient and ticket
+func (n *Notifier) Flush() {
+	n.mu.Lock()
+	pending, order := n.pending, n.order
+	n.pending, n.order = make(map[batchKey]*batch), nil
+	n.mu.Unlock()
+
+	for _, key := range order {
+		b := pending[key]
+		msg, err := Render(b.recipient, b.events, n.BaseURL)
+		if err != nil {
+			log.Printf("Error rendering notification for %s: %v", key.email, err)
+			continue
+		}
+		if n.Headers != nil {
+			msg.Headers = n.Headers(b.recipient, key.ticketID)
+		}
+		if err := n.send(msg); err != nil {
+			log.Printf("Giving up on notification for %s about ticket %d: %v", key.email, key.ticketID, err)
+		}
+	}
+}
+
+// send delivers a message, retrying with a growing delay
+func (n *Notifier) send(msg Message) error {
+	var err error
+	attempts := max(n.Attempts, 1)
+	delay := n.RetryDelay
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = n.Transport.Send(msg); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			log.Printf("Notification to %s failed (attempt %d): %v", msg.To, attempt, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
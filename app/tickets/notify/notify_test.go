@@ -0,0 +1,158 @@
+package notify
+
+import (
+    "TeacherJournal/app/tickets/workflow"
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+type fakeTransport struct {
+    failures int
+    calls    int
+    sent     []Message
+}
+
+func (f *fakeTransport) Send(msg Message) error {
+    f.calls++
+    if f.calls <= f.failures {
+        return errors.New("server unavailable")
+    }
+    f.sent = append(f.sent, msg)
+    return nil
+}
+
+var anna = Recipient{UserID: 1, Name: "Анна", Email: "anna@example.com"}
+
+func TestRenderSingleEvent(t *testing.T) {
+    msg, err := Render(anna, []Event{{
+        Kind:      EventStatus,
+        TicketID:  7,
+        Title:     "Не открывается журнал",
+        Actor:     "Иван",
+        OldStatus: workflow.StatusInProgress,
+        NewStatus: workflow.StatusResolved,
+    }}, "http://journal.local/")
+    if err != nil {
+        t.Fatalf("render error: %v", err)
+    }
+    if msg.To != "anna@example.com" || msg.Subject != "[#7] Статус изменен: Не открывается журнал" {
+        t.Fatalf("unexpected message %+v", msg)
+    }
+    for _, want := range []string{"Здравствуйте, Анна!", "В работе → Решен", "http://journal.local/tickets/7"} {
+        if !strings.Contains(msg.Body, want) {
+            t.Fatalf("body misses %q:\n%s", want, msg.Body)
+        }
+    }
+}
+
+func TestRenderBatch(t *testing.T) {
+    events := []Event{
+        {Kind: EventComment, TicketID: 3, Title: "Ошибка", Actor: "Иван", Comment: "Проверьте ещё раз"},
+        {Kind: EventAssigned, TicketID: 3, Title: "Ошибка", Actor: "Иван", Assignee: "Пётр"},
+    }
+    msg, err := Render(anna, events, "http://journal.local")
+    if err != nil {
+        t.Fatalf("render error: %v", err)
+    }
+    if msg.Subject != "[#3] Обновления по тикету: Ошибка" {
+        t.Fatalf("unexpected subject %q", msg.Subject)
+    }
+    if !strings.Contains(msg.Body, "Проверьте ещё раз") || !strings.Contains(msg.Body, "исполнителем тикета #3 «Ошибка»: Пётр") {
+        t.Fatalf("unexpected body:\n%s", msg.Body)
+    }
+    if _, err := Render(anna, nil, ""); err == nil {
+        t.Fatalf("expected error for no events")
+    }
+}
+
+func TestFlushBatchesByRecipientAndTicket(t *testing.T) {
+    transport := &fakeTransport{}
+    n := New(transport, "http://journal.local")
+    boris := Recipient{UserID: 2, Name: "Борис", Email: "boris@example.com"}
+
+    n.Notify(Event{Kind: EventComment, TicketID: 1, Title: "A", Comment: "one"}, []Recipient{anna, boris})
+    n.Notify(Event{Kind: EventComment, TicketID: 1, Title: "A", Comment: "two"}, []Recipient{anna})
+    n.Notify(Event{Kind: EventCreated, TicketID: 2, Title: "B"}, []Recipient{anna, {Name: "Без почты"}})
+    n.Flush()
+
+    if len(transport.sent) != 3 {
+        t.Fatalf("expected 3 messages got %d", len(transport.sent))
+    }
+    first := transport.sent[0]
+    if first.To != anna.Email || !strings.Contains(first.Body, "one") || !strings.Contains(first.Body, "two") {
+        t.Fatalf("events of one ticket should share a message: %+v", first)
+    }
+    if transport.sent[1].To != boris.Email || strings.Contains(transport.sent[1].Body, "two") {
+        t.Fatalf("unexpected second message %+v", transport.sent[1])
+    }
+
+    n.Flush()
+    if len(transport.sent) != 3 {
+        t.Fatalf("flush should empty the queue")
+    }
+}
+
+func TestFlushRetries(t *testing.T) {
+    transport := &fakeTransport{failures: 2}
+    n := New(transport, "")
+    n.RetryDelay = time.Millisecond
+    n.Headers = func(recipient Recipient, ticketID int) map[string]string {
+        return map[string]string{"Reply-To": "support@example.com"}
+    }
+
+    n.Notify(Event{Kind: EventCreated, TicketID: 5, Title: "C"}, []Recipient{anna})
+    n.Flush()
+    if transport.calls != 3 || len(transport.sent) != 1 {
+        t.Fatalf("expected delivery on the third attempt, calls %d sent %d", transport.calls, len(transport.sent))
+    }
+    if transport.sent[0].Headers["Reply-To"] != "support@example.com" {
+        t.Fatalf("expected extra headers, got %v", transport.sent[0].Headers)
+    }
+
+    transport = &fakeTransport{failures: 5}
+    n.Transport = transport
+    n.Notify(Event{Kind: EventCreated, TicketID: 5, Title: "C"}, []Recipient{anna})
+    n.Flush()
+    if transport.calls != DefaultAttempts || len(transport.sent) != 0 {
+        t.Fatalf("expected %d attempts got %d", DefaultAttempts, transport.calls)
+    }
+}
+
+func TestNilNotifier(t *testing.T) {
+    var n *Notifier
+    n.Notify(Event{Kind: EventCreated}, []Recipient{anna})
+}
+
+func TestLogTransport(t *testing.T) {
+    var buf bytes.Buffer
+    transport := &LogTransport{Writer: &buf}
+    if err := transport.Send(Message{To: "a@example.com", Subject: "Тема", Body: "Текст"}); err != nil {
+        t.Fatalf("send error: %v", err)
+    }
+    if !strings.Contains(buf.String(), "To: a@example.com\nSubject: Тема\n\nТекст") {
+        t.Fatalf("unexpected log %q", buf.String())
+    }
+}
+
+func TestCompose(t *testing.T) {
+    date := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+    raw := string(Compose("support@example.com", Message{
+        To:      "a@example.com",
+        Subject: "Тема",
+        Body:    "строка 1\nстрока 2",
+        Headers: map[string]string{"Reply-To": "r@example.com"},
+    }, date))
+    for _, want := range []string{
+        "From: support@example.com\r\n",
+        "Subject: =?UTF-8?b?0KLQtdC80LA=?=\r\n",
+        "Reply-To: r@example.com\r\n",
+        "\r\n\r\nстрока 1\r\nстрока 2",
+    } {
+        if !strings.Contains(raw, want) {
+            t.Fatalf("message misses %q:\n%s", want, raw)
+        }
+    }
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"TeacherJournal/app/tickets/workflow"
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Ticket events users are notified about
+const (
+	EventCreated  = "created"
+	EventComment  = "comment"
+	EventStatus   = "status"
+	EventAssigned = "assigned"
+)
+
+// Event is something that happened to a ticket
+type Event struct {
+	Kind      string
+	TicketID  int
+	Title     string
+	Actor     string // Name of the user who acted
+	Comment   string // EventComment, EventCreated: the text
+	OldStatus workflow.Status
+	NewStatus workflow.Status
+	Assignee  string // EventAssigned: name of the new assignee
+	Time      time.Time
+}
+
+// Recipient is a user to notify
+type Recipient struct {
+	UserID int
+	Name   string
+	Email  string
+}
+
+// subjects are the subject lines by event kind. The [#id] tag lets replies be matched to the ticket.
+var subjects = map[string]string{
+	EventCreated:  "[#%d] Новый тикет: %s",
+	EventComment:  "[#%d] Новый комментарий: %s",
+	EventStatus:   "[#%d] Статус изменен: %s",
+	EventAssigned: "[#%d] Назначен исполнитель: %s",
+}
+
+var bodies = template.Must(template.New("bodies").Parse(`
+{{define "created"}}{{.Actor}} создал(а) тикет #{{.TicketID}} «{{.Title}}».
+
+{{.Comment}}{{end}}
+{{define "comment"}}{{.Actor}} оставил(а) комментарий к тикету #{{.TicketID}} «{{.Title}}»:
+
+{{.Comment}}{{end}}
+{{define "status"}}{{.Actor}} изменил(а) статус тикета #{{.TicketID}} «{{.Title}}»: {{.OldStatus.Label}} → {{.NewStatus.Label}}.{{end}}
+{{define "assigned"}}{{.Actor}} назначил(а) исполнителем тикета #{{.TicketID}} «{{.Title}}»: {{.Assignee}}.{{end}}
+{{define "message"}}Здравствуйте, {{.Name}}!
+
+{{range $i, $part := .Parts}}{{if $i}}
+
+---
+
+{{end}}{{$part}}{{end}}
+
+Открыть тикет: {{.Link}}
+
+--
+Служба поддержки «Журнал преподавателя».
+Вы получили это письмо, потому что подписаны на тикет. Уведомления можно отключить в настройках профиля.
+{{end}}`))
+
+// Render builds the message for a recipient from one or more events of the same ticket.
+// Several events, collected by batching, become one email.
+func Render(recipient Recipient, events []Event, baseURL string) (Message, error) {
+	if len(events) == 0 {
+		return Message{}, fmt.Errorf("no events to render")
+	}
+	first := events[0]
+
+	subject := fmt.Sprintf(subjects[first.Kind], first.TicketID, first.Title)
+	if len(events) > 1 {
+		subject = fmt.Sprintf("[#%d] Обновления по тикету: %s", first.TicketID, first.Title)
+	}
+
+	parts := make([]string, 0, len(events))
+	for _, event := range events {
+		var buf bytes.Buffer
+		if err := bodies.ExecuteTemplate(&buf, event.Kind, event); err != nil {
+			return Message{}, err
+		}
+		parts = append(parts, strings.TrimSpace(buf.String()))
+	}
+
+	var buf bytes.Buffer
+	err := bodies.ExecuteTemplate(&buf, "message", map[string]interface{}{
+		"Name":  recipient.Name,
+		"Parts": parts,
+		"Link":  fmt.Sprintf("%s/tickets/%d", strings.TrimRight(baseURL, "/"), first.TicketID),
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      recipient.Email,
+		Subject: subject,
+		Body:    strings.TrimSpace(buf.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string // Extra headers such as Reply-To
+}
+
+// Transport delivers messages
+type Transport interface {
+	Send(msg Message) error
+}
+
+// SMTPTransport sends messages through an SMTP server
+type SMTPTransport struct {
+	Host     string
+	Port     string
+	Username string // Empty - no authentication
+	Password string
+	From     string
+}
+
+// Send delivers the message to the SMTP server
+func (t *SMTPTransport) Send(msg Message) error {
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+	return smtp.SendMail(t.Host+":"+t.Port, auth, t.From, []string{msg.To}, Compose(t.From, msg, time.Now()))
+}
+
+// LogTransport writes messages to a writer instead of sending them, for development and tests
+type LogTransport struct {
+	mu     sync.Mutex
+	Writer io.Writer // Nil - the standard logger
+}
+
+// Send writes the message
+func (t *LogTransport) Send(msg Message) error {
+	text := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	if t.Writer == nil {
+		log.Printf("Ticket notification:\n%s", text)
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := io.WriteString(t.Writer, text+"----\n")
+	return err
+}
+
+// Compose renders a message as an RFC 822 email with a UTF-8 body
+func Compose(from string, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(name, msg.Headers[name])
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="UTF-8"`)
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
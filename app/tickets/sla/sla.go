@@ -0,0 +1,87 @@
+// Package sla defines how fast tickets of each priority must be answered and resolved
+// and decides when a ticket is overdue.
+package sla
+
+import (
+	"TeacherJournal/app/tickets/workflow"
+	"time"
+)
+
+// Policy is the time allowed for a ticket of one priority
+type Policy struct {
+	FirstResponse time.Duration // Until staff first answers
+	Resolution    time.Duration // Until the ticket is resolved
+}
+
+// Policies are the SLA targets by priority
+var Policies = map[workflow.Priority]Policy{
+	workflow.PriorityCritical: {FirstResponse: time.Hour, Resolution: 8 * time.Hour},
+	workflow.PriorityHigh:     {FirstResponse: 4 * time.Hour, Resolution: 24 * time.Hour},
+	workflow.PriorityMedium:   {FirstResponse: 8 * time.Hour, Resolution: 72 * time.Hour},
+	workflow.PriorityLow:      {FirstResponse: 24 * time.Hour, Resolution: 7 * 24 * time.Hour},
+}
+
+// For returns the policy of a priority; unknown priorities get the medium one
+func For(priority workflow.Priority) Policy {
+	if policy, ok := Policies[priority]; ok {
+		return policy
+	}
+	return Policies[workflow.PriorityMedium]
+}
+
+// Due returns the first response and resolution due dates of a ticket whose SLA timer starts at start
+func Due(priority workflow.Priority, start time.Time) (firstResponse, resolution time.Time) {
+	policy := For(priority)
+	return start.Add(policy.FirstResponse), start.Add(policy.Resolution)
+}
+
+// Raise returns the next higher priority, or false if the priority is already the highest
+func Raise(priority workflow.Priority) (workflow.Priority, bool) {
+	for i, p := range workflow.Priorities {
+		if p == priority && i+1 < len(workflow.Priorities) {
+			return workflow.Priorities[i+1], true
+		}
+	}
+	return priority, false
+}
+
+// Reasons for escalating a ticket
+const (
+	ReasonFirstResponse = "first_response" // Nobody answered in time
+	ReasonResolution    = "resolution"     // Not resolved in time
+)
+
+// Timers are the SLA fields of a ticket
+type Timers struct {
+	FirstResponseDue *time.Time
+	ResolutionDue    *time.Time
+	FirstResponseAt  *time.Time
+	ResolvedAt       *time.Time
+}
+
+// Breached reports whether a target with the given due date was missed. A target met
+// at met is breached if met came after the due date; one not met yet is breached once
+// the due date has passed. Tickets without a due date are not tracked.
+func Breached(due, met *time.Time, now time.Time) bool {
+	if due == nil {
+		return false
+	}
+	if met != nil {
+		return met.After(*due)
+	}
+	return now.After(*due)
+}
+
+// Overdue returns why an unresolved ticket needs escalation, or an empty string
+func Overdue(timers Timers, now time.Time) string {
+	if timers.ResolvedAt != nil {
+		return ""
+	}
+	if timers.FirstResponseAt == nil && Breached(timers.FirstResponseDue, nil, now) {
+		return ReasonFirstResponse
+	}
+	if Breached(timers.ResolutionDue, nil, now) {
+		return ReasonResolution
+	}
+	return ""
+}
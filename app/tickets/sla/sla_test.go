@@ -0,0 +1,76 @@
+package sla
+
+import (
+    "TeacherJournal/app/tickets/workflow"
+    "testing"
+    "time"
+)
+
+func TestDue(t *testing.T) {
+    start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+    firstResponse, resolution := Due(workflow.PriorityHigh, start)
+    if !firstResponse.Equal(start.Add(4*time.Hour)) || !resolution.Equal(start.Add(24*time.Hour)) {
+        t.Fatalf("unexpected due dates %v %v", firstResponse, resolution)
+    }
+    firstResponse, _ = Due(workflow.Priority("Unknown"), start)
+    if !firstResponse.Equal(start.Add(8 * time.Hour)) {
+        t.Fatalf("unknown priority should use the medium policy, got %v", firstResponse)
+    }
+}
+
+func TestRaise(t *testing.T) {
+    if p, ok := Raise(workflow.PriorityLow); !ok || p != workflow.PriorityMedium {
+        t.Fatalf("expected medium got %v %v", p, ok)
+    }
+    if p, ok := Raise(workflow.PriorityHigh); !ok || p != workflow.PriorityCritical {
+        t.Fatalf("expected critical got %v %v", p, ok)
+    }
+    if p, ok := Raise(workflow.PriorityCritical); ok || p != workflow.PriorityCritical {
+        t.Fatalf("critical cannot be raised, got %v %v", p, ok)
+    }
+}
+
+func TestBreached(t *testing.T) {
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    past := now.Add(-time.Hour)
+    future := now.Add(time.Hour)
+    early := past.Add(-time.Minute)
+
+    if Breached(nil, nil, now) {
+        t.Fatalf("untracked ticket cannot breach")
+    }
+    if !Breached(&past, nil, now) {
+        t.Fatalf("missed due date should breach")
+    }
+    if Breached(&future, nil, now) {
+        t.Fatalf("future due date should not breach")
+    }
+    if Breached(&past, &early, now) {
+        t.Fatalf("target met before due date should not breach")
+    }
+    if !Breached(&past, &now, now) {
+        t.Fatalf("target met late should breach")
+    }
+}
+
+func TestOverdue(t *testing.T) {
+    now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+    past := now.Add(-time.Hour)
+    future := now.Add(time.Hour)
+
+    if reason := Overdue(Timers{FirstResponseDue: &past, ResolutionDue: &future}, now); reason != ReasonFirstResponse {
+        t.Fatalf("expected first response got %q", reason)
+    }
+    if reason := Overdue(Timers{FirstResponseDue: &past, ResolutionDue: &future, FirstResponseAt: &past}, now); reason != "" {
+        t.Fatalf("answered ticket should not be overdue, got %q", reason)
+    }
+    if reason := Overdue(Timers{FirstResponseDue: &past, ResolutionDue: &past, FirstResponseAt: &past}, now); reason != ReasonResolution {
+        t.Fatalf("expected resolution got %q", reason)
+    }
+    if reason := Overdue(Timers{FirstResponseDue: &past, ResolutionDue: &past, ResolvedAt: &past}, now); reason != "" {
+        t.Fatalf("resolved ticket should not be overdue, got %q", reason)
+    }
+    if reason := Overdue(Timers{}, now); reason != "" {
+        t.Fatalf("untracked ticket should not be overdue, got %q", reason)
+    }
+}
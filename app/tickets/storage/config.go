@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"TeacherJournal/config"
+	"fmt"
+)
+
+// FromConfig creates the named backend from the service configuration
+func FromConfig(name string) (Storage, error) {
+	switch name {
+	case LocalName:
+		return &Local{Root: config.AttachmentStoragePath}, nil
+	case S3Name:
+		if config.S3Bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is not set")
+		}
+		return &S3{
+			Endpoint:  config.S3Endpoint,
+			Region:    config.S3Region,
+			Bucket:    config.S3Bucket,
+			AccessKey: config.S3AccessKey,
+			SecretKey: config.S3SecretKey,
+			PathStyle: config.S3PathStyle,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", name)
+	}
+}
+
+// SetFromConfig creates the configured backend for new files together with every
+// other configured backend, so files not yet migrated can still be read
+func SetFromConfig() (*Set, error) {
+	current, err := FromConfig(config.AttachmentStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []Storage
+	for _, name := range []string{LocalName, S3Name} {
+		if name == current.Name() {
+			continue
+		}
+		if other, err := FromConfig(name); err == nil {
+			others = append(others, other)
+		}
+	}
+	return NewSet(current, others...), nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalName is the name of the local disk backend
+const LocalName = "local"
+
+// Local keeps files in a directory of the local disk
+type Local struct {
+	Root string
+}
+
+// Name identifies the backend
+func (l *Local) Name() string {
+	return LocalName
+}
+
+// path returns the file path of a key
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file through a temporary file, so readers never see a partial file
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("expected %d bytes, got %d", size, written)
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// Open opens the file
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// Delete removes the file
+func (l *Local) Delete(ctx context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// LegacyKey turns a file path stored before keys were introduced into a key of the
+// backend rooted at root. Paths outside the root are returned unchanged.
+func LegacyKey(root, filePath string) string {
+	cleanRoot := filepath.Clean(root)
+	cleanPath := filepath.Clean(filePath)
+	if absRoot, err := filepath.Abs(cleanRoot); err == nil && filepath.IsAbs(cleanPath) {
+		cleanRoot = absRoot
+	}
+	if rel, err := filepath.Rel(cleanRoot, cleanPath); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filePath
+}
@@ -0,0 +1,93 @@
+// Package storage keeps ticket attachment files. Files are addressed by a key that
+// is the same in every backend, so they can be moved between backends without
+// changing their records.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Storage is a place attachment files are kept
+type Storage interface {
+	// Name identifies the backend in attachment records
+	Name() string
+	// Put stores size bytes read from r under key, replacing any file there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open streams the file stored under key and returns its size
+	Open(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes the file; a missing file is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by backends that can give out temporary direct download links
+type Presigner interface {
+	PresignGet(key, fileName string, expires time.Duration) (string, error)
+}
+
+// ErrNotFound is returned when no file is stored under a key
+var ErrNotFound = errors.New("file not found in storage")
+
+// Key builds the key of a new attachment of a ticket
+func Key(ticketID int, fileName string, now time.Time) string {
+	name := path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return '_'
+		case r < 0x20 || r == 0x7f || strings.ContainsRune(`"<>?*|:`, r):
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" || name == ".." {
+		name = "file"
+	}
+	return fmt.Sprintf("tickets/%d/%d_%s", ticketID, now.UnixNano(), name)
+}
+
+// validKey reports whether a key stays inside the storage
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// Set is the backend new files are written to, along with the backends older files may still be in
+type Set struct {
+	Current  Storage
+	backends map[string]Storage
+}
+
+// NewSet creates a Set writing to current
+func NewSet(current Storage, others ...Storage) *Set {
+	set := &Set{Current: current, backends: map[string]Storage{current.Name(): current}}
+	for _, other := range others {
+		if other != nil {
+			set.backends[other.Name()] = other
+		}
+	}
+	return set
+}
+
+// Get returns the backend with the given name; records without one are on the local disk
+func (s *Set) Get(name string) (Storage, error) {
+	if name == "" {
+		name = LocalName
+	}
+	if backend, ok := s.backends[name]; ok {
+		return backend, nil
+	}
+	return nil, fmt.Errorf("storage backend %q is not configured", name)
+}
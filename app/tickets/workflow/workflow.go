@@ -0,0 +1,248 @@
+// Package workflow declares ticket statuses and priorities and the status changes
+// each participant of a ticket may make.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Status is the state of a ticket. The code is stored, the label is shown.
+type Status string
+
+// Ticket statuses in workflow order
+const (
+	StatusNew        Status = "New"
+	StatusOpen       Status = "Open"
+	StatusInProgress Status = "InProgress"
+	StatusResolved   Status = "Resolved"
+	StatusClosed     Status = "Closed"
+)
+
+// Statuses lists all statuses in workflow order
+var Statuses = []Status{StatusNew, StatusOpen, StatusInProgress, StatusResolved, StatusClosed}
+
+var statusLabels = map[Status]string{
+	StatusNew:        "Новый",
+	StatusOpen:       "Открыт",
+	StatusInProgress: "В работе",
+	StatusResolved:   "Решен",
+	StatusClosed:     "Закрыт",
+}
+
+// Label returns the Russian name of the status
+func (s Status) Label() string {
+	if label, ok := statusLabels[s]; ok {
+		return label
+	}
+	return string(s)
+}
+
+// Priority is the urgency of a ticket
+type Priority string
+
+// Ticket priorities from lowest to highest
+const (
+	PriorityLow      Priority = "Low"
+	PriorityMedium   Priority = "Medium"
+	PriorityHigh     Priority = "High"
+	PriorityCritical Priority = "Critical"
+)
+
+// Priorities lists all priorities from lowest to highest
+var Priorities = []Priority{PriorityLow, PriorityMedium, PriorityHigh, PriorityCritical}
+
+var priorityLabels = map[Priority]string{
+	PriorityLow:      "Низкий",
+	PriorityMedium:   "Средний",
+	PriorityHigh:     "Высокий",
+	PriorityCritical: "Критический",
+}
+
+// Label returns the Russian name of the priority
+func (p Priority) Label() string {
+	if label, ok := priorityLabels[p]; ok {
+		return label
+	}
+	return string(p)
+}
+
+// statusAliases are other spellings found in older tickets and clients
+var statusAliases = map[string]Status{
+	"in progress": StatusInProgress,
+	"in_progress": StatusInProgress,
+	"открытый":    StatusOpen,
+	"решенный":    StatusResolved,
+	"решённый":    StatusResolved,
+	"решён":       StatusResolved,
+}
+
+// ParseStatus accepts a status code or label in any case
+func ParseStatus(value string) (Status, error) {
+	key := strings.ToLower(strings.TrimSpace(value))
+	for _, status := range Statuses {
+		if key == strings.ToLower(string(status)) || key == strings.ToLower(status.Label()) {
+			return status, nil
+		}
+	}
+	if status, ok := statusAliases[key]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("unknown ticket status %q", value)
+}
+
+// ParsePriority accepts a priority code or label in any case
+func ParsePriority(value string) (Priority, error) {
+	key := strings.ToLower(strings.TrimSpace(value))
+	for _, priority := range Priorities {
+		if key == strings.ToLower(string(priority)) || key == strings.ToLower(priority.Label()) {
+			return priority, nil
+		}
+	}
+	return "", fmt.Errorf("unknown ticket priority %q", value)
+}
+
+// Role is the part a user plays in a ticket. A user may have several.
+type Role string
+
+// Ticket roles
+const (
+	RoleStaff    Role = "staff"    // Administrators handling support
+	RoleAssignee Role = "assignee" // The user the ticket is assigned to
+	RoleCreator  Role = "creator"  // The user who opened the ticket
+)
+
+// Roles returns the roles a user has in a ticket
+func Roles(userID int, userRole string, createdBy int, assignedTo *int) []Role {
+	var roles []Role
+	if userRole == "admin" {
+		roles = append(roles, RoleStaff)
+	}
+	if assignedTo != nil && *assignedTo == userID {
+		roles = append(roles, RoleAssignee)
+	}
+	if createdBy == userID {
+		roles = append(roles, RoleCreator)
+	}
+	return roles
+}
+
+// Transition is a status change and who may make it
+type Transition struct {
+	From  Status
+	To    Status
+	Roles []Role
+}
+
+// Transitions is the ticket workflow. Staff may also close a ticket at any stage,
+// resolved tickets may be reopened by their creator, closed ones only by staff.
+var Transitions = []Transition{
+	{StatusNew, StatusOpen, []Role{RoleStaff, RoleAssignee}},
+	{StatusNew, StatusInProgress, []Role{RoleStaff, RoleAssignee}},
+	{StatusNew, StatusResolved, []Role{RoleStaff, RoleAssignee}},
+	{StatusNew, StatusClosed, []Role{RoleStaff}},
+	{StatusOpen, StatusInProgress, []Role{RoleStaff, RoleAssignee}},
+	{StatusOpen, StatusResolved, []Role{RoleStaff, RoleAssignee}},
+	{StatusOpen, StatusClosed, []Role{RoleStaff}},
+	{StatusInProgress, StatusOpen, []Role{RoleStaff, RoleAssignee}},
+	{StatusInProgress, StatusResolved, []Role{RoleStaff, RoleAssignee}},
+	{StatusInProgress, StatusClosed, []Role{RoleStaff}},
+	{StatusResolved, StatusOpen, []Role{RoleStaff, RoleCreator}},
+	{StatusResolved, StatusInProgress, []Role{RoleStaff, RoleAssignee, RoleCreator}},
+	{StatusResolved, StatusClosed, []Role{RoleStaff, RoleCreator}},
+	{StatusClosed, StatusOpen, []Role{RoleStaff}},
+}
+
+// Errors returned by Check
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrForbidden         = errors.New("status change not allowed")
+)
+
+// Check returns nil if a user with the given roles may move a ticket from one status
+// to another. The error wraps ErrInvalidTransition when the workflow has no such step
+// and ErrForbidden when the step exists but belongs to other roles.
+func Check(from, to Status, roles []Role) error {
+	if from == to {
+		return nil
+	}
+	for _, transition := range Transitions {
+		if transition.From != from || transition.To != to {
+			continue
+		}
+		if hasRole(transition.Roles, roles) {
+			return nil
+		}
+		return fmt.Errorf("%w: only %s may move a ticket from %s to %s",
+			ErrForbidden, joinRoles(transition.Roles), from.Label(), to.Label())
+	}
+
+	allowed := Allowed(from, roles)
+	if len(allowed) == 0 {
+		return fmt.Errorf("%w: a ticket in status %s cannot be moved to %s",
+			ErrInvalidTransition, from.Label(), to.Label())
+	}
+	labels := make([]string, len(allowed))
+	for i, status := range allowed {
+		labels[i] = status.Label()
+	}
+	return fmt.Errorf("%w: a ticket in status %s cannot be moved to %s, allowed: %s",
+		ErrInvalidTransition, from.Label(), to.Label(), strings.Join(labels, ", "))
+}
+
+// Allowed returns the statuses a user with the given roles may move a ticket to
+func Allowed(from Status, roles []Role) []Status {
+	allowed := []Status{}
+	for _, transition := range Transitions {
+		if transition.From == from && hasRole(transition.Roles, roles) {
+			allowed = append(allowed, transition.To)
+		}
+	}
+	return allowed
+}
+
+// hasRole reports whether any of the user roles is permitted
+func hasRole(permitted, roles []Role) bool {
+	for _, role := range roles {
+		for _, p := range permitted {
+			if role == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// joinRoles names the roles for error messages
+func joinRoles(roles []Role) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return strings.Join(names, " or ")
+}
+
+// Option is a value offered to the client with its label
+type Option struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// StatusOptions returns the statuses as options
+func StatusOptions(statuses []Status) []Option {
+	options := make([]Option, len(statuses))
+	for i, status := range statuses {
+		options[i] = Option{Value: string(status), Label: status.Label()}
+	}
+	return options
+}
+
+// PriorityOptions returns all priorities as options
+func PriorityOptions() []Option {
+	options := make([]Option, len(Priorities))
+	for i, priority := range Priorities {
+		options[i] = Option{Value: string(priority), Label: priority.Label()}
+	}
+	return options
+}
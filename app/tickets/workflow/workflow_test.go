@@ -0,0 +1,115 @@
+package workflow
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestParseStatus(t *testing.T) {
+    cases := map[string]Status{
+        "New":         StatusNew,
+        "inprogress":  StatusInProgress,
+        "In Progress": StatusInProgress,
+        "Решенный":    StatusResolved,
+        " закрыт ":    StatusClosed,
+        "Открытый":    StatusOpen,
+    }
+    for value, want := range cases {
+        got, err := ParseStatus(value)
+        if err != nil || got != want {
+            t.Fatalf("ParseStatus(%q) = %v, %v; want %v", value, got, err, want)
+        }
+    }
+    if _, err := ParseStatus("Deleted"); err == nil {
+        t.Fatalf("expected error for unknown status")
+    }
+}
+
+func TestParsePriority(t *testing.T) {
+    if p, err := ParsePriority("Критический"); err != nil || p != PriorityCritical {
+        t.Fatalf("unexpected priority %v err %v", p, err)
+    }
+    if p, err := ParsePriority("low"); err != nil || p != PriorityLow {
+        t.Fatalf("unexpected priority %v err %v", p, err)
+    }
+    if _, err := ParsePriority("Urgent"); err == nil {
+        t.Fatalf("expected error for unknown priority")
+    }
+}
+
+func TestLabels(t *testing.T) {
+    if StatusInProgress.Label() != "В работе" || PriorityHigh.Label() != "Высокий" {
+        t.Fatalf("unexpected labels")
+    }
+    if Status("Other").Label() != "Other" {
+        t.Fatalf("unknown status should keep its code")
+    }
+}
+
+func TestRoles(t *testing.T) {
+    assignee := 5
+    roles := Roles(5, "admin", 3, &assignee)
+    if len(roles) != 2 || roles[0] != RoleStaff || roles[1] != RoleAssignee {
+        t.Fatalf("unexpected roles %v", roles)
+    }
+    if roles := Roles(3, "teacher", 3, nil); len(roles) != 1 || roles[0] != RoleCreator {
+        t.Fatalf("unexpected roles %v", roles)
+    }
+    if roles := Roles(7, "teacher", 3, &assignee); len(roles) != 0 {
+        t.Fatalf("expected no roles got %v", roles)
+    }
+}
+
+func TestCheck(t *testing.T) {
+    staff := []Role{RoleStaff}
+    creator := []Role{RoleCreator}
+
+    if err := Check(StatusNew, StatusOpen, staff); err != nil {
+        t.Fatalf("staff should open a new ticket: %v", err)
+    }
+    if err := Check(StatusResolved, StatusOpen, creator); err != nil {
+        t.Fatalf("creator should reopen a resolved ticket: %v", err)
+    }
+    if err := Check(StatusOpen, StatusOpen, nil); err != nil {
+        t.Fatalf("keeping the status should pass: %v", err)
+    }
+    if err := Check(StatusNew, StatusOpen, creator); !errors.Is(err, ErrForbidden) {
+        t.Fatalf("expected forbidden got %v", err)
+    }
+    if err := Check(StatusClosed, StatusOpen, creator); !errors.Is(err, ErrForbidden) {
+        t.Fatalf("only staff reopens closed tickets, got %v", err)
+    }
+    err := Check(StatusClosed, StatusResolved, staff)
+    if !errors.Is(err, ErrInvalidTransition) {
+        t.Fatalf("expected invalid transition got %v", err)
+    }
+    if err.Error() != "invalid status transition: a ticket in status Закрыт cannot be moved to Решен, allowed: Открыт" {
+        t.Fatalf("unexpected message %q", err.Error())
+    }
+}
+
+func TestAllowed(t *testing.T) {
+    allowed := Allowed(StatusResolved, []Role{RoleCreator})
+    want := []Status{StatusOpen, StatusInProgress, StatusClosed}
+    if len(allowed) != len(want) {
+        t.Fatalf("expected %v got %v", want, allowed)
+    }
+    for i := range want {
+        if allowed[i] != want[i] {
+            t.Fatalf("expected %v got %v", want, allowed)
+        }
+    }
+    if len(Allowed(StatusNew, nil)) != 0 {
+        t.Fatalf("users without roles change nothing")
+    }
+}
+
+func TestStatusOptions(t *testing.T) {
+    options := StatusOptions(Statuses)
+    if len(options) != 5 || options[2].Value != "InProgress" || options[2].Label != "В работе" {
+        t.Fatalf("unexpected options %v", options)
+    }
+    if len(PriorityOptions()) != 4 {
+        t.Fatalf("expected 4 priority options")
+    }
+}
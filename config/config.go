@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 // Get DB connection string from environment or use default
@@ -13,21 +14,65 @@ var DBConnectionString = getEnv("DB_CONNECTION_STRING", fmt.Sprintf("postgres://
 	getEnv("DB_PORT", "5432"),
 	getEnv("DB_NAME", "teacher")))
 
-// TicketStatusValues defines the valid status values for tickets
-var TicketStatusValues = []string{"Новый", "Открытый", "В работе", "Решенный", "Закрыт"}
-
-// TicketPriorityValues defines the valid priority values for tickets
-var TicketPriorityValues = []string{"Низкий", "Средний", "Высокий", "Критический"}
-
 // TicketCategoryValues defines the valid category values for tickets
 var TicketCategoryValues = []string{"Технический", "Административный", "Аккаунт", "Особенность", "Баги", "Другая"}
 
 // AttachmentStoragePath defines where file attachments are stored
 const AttachmentStoragePath = "./attachments"
 
+// Attachment storage backend: "local" keeps files under AttachmentStoragePath,
+// "s3" in a bucket of an S3-compatible service such as MinIO
+var (
+	AttachmentStorage  = getEnv("TICKET_STORAGE", "local")
+	S3Endpoint         = getEnv("S3_ENDPOINT", "http://localhost:9000")
+	S3Region           = getEnv("S3_REGION", "us-east-1")
+	S3Bucket           = getEnv("S3_BUCKET", "")
+	S3AccessKey        = getEnv("S3_ACCESS_KEY", "")
+	S3SecretKey        = getEnv("S3_SECRET_KEY", "")
+	S3PathStyle        = getEnv("S3_PATH_STYLE", "true") == "true"
+	S3PresignDownloads = getEnv("S3_PRESIGN_DOWNLOADS", "true") == "true" // Otherwise downloads go through the service
+)
+
 // MaxFileSize defines the maximum size for uploaded files (5MB)
 const MaxFileSize = 5 * 1024 * 1024
 
+// AppBaseURL is the frontend address used in links sent by email
+var AppBaseURL = getEnv("APP_BASE_URL", "http://localhost:3000")
+
+// Ticket email notifications. NotifyTransport is "smtp" or "log"; the log transport
+// writes messages to NotifyLogPath, or to the service log when it is empty.
+var (
+	NotifyTransport = getEnv("TICKET_NOTIFY_TRANSPORT", "log")
+	NotifyLogPath   = getEnv("TICKET_NOTIFY_LOG", "")
+	SMTPHost        = getEnv("SMTP_HOST", "localhost")
+	SMTPPort        = getEnv("SMTP_PORT", "25")
+	SMTPUsername    = getEnv("SMTP_USERNAME", "")
+	SMTPPassword    = getEnv("SMTP_PASSWORD", "")
+	SMTPFrom        = getEnv("SMTP_FROM", "support@teacher-journal.local")
+)
+
+// Replies to ticket emails. Notifications carry a signed Reply-To subaddress of
+// InboundMailAddress, and the local MTA posts incoming messages with InboundMailSecret.
+// Inbound mail is off while the secret is empty. Replies without the subaddress are
+// matched by the [#id] subject tag only if the MTA whose Authentication-Results ID is
+// InboundMailAuthServID verified the sender domain.
+var (
+	InboundMailAddress    = getEnv("TICKET_INBOUND_ADDRESS", "")
+	InboundMailSecret     = getEnv("TICKET_INBOUND_SECRET", "")
+	InboundMailAuthServID = getEnv("TICKET_INBOUND_AUTHSERV_ID", "")
+)
+
+// StudentJWTSecret signs the session tokens of students in the tests service.
+// Students cannot log in while it is empty.
+var StudentJWTSecret = getEnv("STUDENT_JWT_SECRET", "")
+
+// TrustedProxies lists the addresses or CIDR networks of reverse proxies, separated by commas.
+// X-Real-IP and X-Forwarded-For are only honoured on requests coming from them.
+var TrustedProxies = getEnv("TRUSTED_PROXIES", "")
+
+// ScheduleLocation is the time zone of the university timetable (Moscow time, UTC+3)
+var ScheduleLocation = time.FixedZone("MSK", 3*60*60)
+
 // Helper function to get environment variables with defaults
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -18,6 +18,7 @@ function StudentLayout() {
 
     const handleLogout = () => {
         localStorage.removeItem('testStudentId');
+        localStorage.removeItem('testStudentToken');
         localStorage.removeItem('testStudentInfo');
         navigate('/tests/student/login');
     };
@@ -482,7 +482,11 @@ function formatQuestionType(type) {
     const typeMap = {
         'multiple_choice': 'Множественный выбор',
         'single_choice': 'Одиночный выбор',
-        'text': 'Текстовый ответ'
+        'text': 'Текстовый ответ',
+        'numeric': 'Числовой ответ',
+        'fill_blank': 'Заполнение пропуска',
+        'matching': 'Сопоставление',
+        'ordering': 'Упорядочивание'
     };
 
     return typeMap[type] || type.replace('_', ' ').replace(/\b\w/g, l => l.toUpperCase());
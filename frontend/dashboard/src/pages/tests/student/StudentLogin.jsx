@@ -18,6 +18,7 @@ function StudentLogin() {
         onSuccess: (response) => {
             const studentData = response.data.data;
             localStorage.setItem('testStudentId', studentData.student_id);
+            localStorage.setItem('testStudentToken', studentData.token);
             localStorage.setItem('testStudentInfo', JSON.stringify(studentData));
             navigate('/tests/student');
         },
@@ -31,10 +32,16 @@ function StudentLogin() {
         onSuccess: (response) => {
             const studentData = response.data.data;
             localStorage.setItem('testStudentId', studentData.student_id);
+            localStorage.setItem('testStudentToken', studentData.token);
             localStorage.setItem('testStudentInfo', JSON.stringify(studentData));
             navigate('/tests/student');
         },
         onError: (error) => {
+            if (error.response?.status === 409) {
+                setMode('login');
+                setError('Студент с таким ФИО уже зарегистрирован. Войдите, указав свой email.');
+                return;
+            }
             setError(error.response?.data?.error || 'Не удалось зарегистрироваться. Пожалуйста, попробуйте снова.');
         }
     });
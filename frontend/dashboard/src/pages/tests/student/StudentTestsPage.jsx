@@ -39,6 +39,7 @@ function StudentTestsPage() {
 
     const handleLogout = () => {
         localStorage.removeItem('testStudentId');
+        localStorage.removeItem('testStudentToken');
         localStorage.removeItem('testStudentInfo');
         navigate('/tests/student/login');
     };
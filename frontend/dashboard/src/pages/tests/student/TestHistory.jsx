@@ -50,6 +50,7 @@ function TestHistory() {
 
     const handleLogout = () => {
         localStorage.removeItem('testStudentId');
+        localStorage.removeItem('testStudentToken');
         localStorage.removeItem('testStudentInfo');
         navigate('/tests/student/login');
     };
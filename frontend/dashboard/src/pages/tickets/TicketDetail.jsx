@@ -127,6 +127,13 @@ function TicketDetail() {
 
     const handleDownloadAttachment = async (attachmentId, fileName) => {
         try {
+            // Files in object storage are downloaded directly by a short-lived link
+            const link = await ticketService.getAttachmentUrl(attachmentId);
+            if (link.data?.data?.direct) {
+                window.location.href = link.data.data.url;
+                return;
+            }
+
             const response = await ticketService.downloadAttachment(attachmentId);
 
             const blob = new Blob([response.data]);
@@ -232,8 +239,11 @@ function TicketDetail() {
         );
     }
 
-    const canResolve = currentUser?.role === 'admin' || (currentUser?.id === ticket.assigned_to);
-    const canReopen = currentUser?.role === 'admin' || (currentUser?.id === ticket.created_by && ticket.status === 'Resolved');
+    const statusButtonClass = {
+        InProgress: 'btn-warning',
+        Resolved: 'btn-success',
+        Closed: 'btn-secondary'
+    };
     const canDelete = currentUser?.role === 'admin' || currentUser?.id === ticket.created_by;
     const canEdit = currentUser?.role === 'admin' || currentUser?.id === ticket.created_by;
 
@@ -254,7 +264,7 @@ function TicketDetail() {
                                     color: getStatusColor(ticket.status)
                                 }}
                             >
-                                {ticket.status}
+                                {ticket.status_label || ticket.status}
                             </span>
                             <span
                                 className="ml-2 badge text-sm px-2 py-1"
@@ -263,7 +273,7 @@ function TicketDetail() {
                                     color: getPriorityColor(ticket.priority)
                                 }}
                             >
-                                {ticket.priority}
+                                {ticket.priority_label || ticket.priority}
                             </span>
                         </div>
                         <h1 className="text-2xl font-bold mb-2">{ticket.title}</h1>
@@ -318,59 +328,20 @@ function TicketDetail() {
 
                 {/* Status Actions */}
                 <div className="flex flex-wrap gap-2 mt-4 pt-4 border-t border-border-color">
-                    {currentUser?.role === 'admin' && (
-                        <>
-                            <button
-                                onClick={() => handleStatusChange('New')}
-                                className="btn btn-sm btn-outline"
-                                disabled={ticket.status === 'New'}
-                            >
-                                Отметить как Новый
-                            </button>
-                            <button
-                                onClick={() => handleStatusChange('Open')}
-                                className="btn btn-sm btn-outline"
-                                disabled={ticket.status === 'Open'}
-                            >
-                                Отметить как Открытый
-                            </button>
-                            <button
-                                onClick={() => handleStatusChange('InProgress')}
-                                className="btn btn-sm btn-warning"
-                                disabled={ticket.status === 'InProgress'}
-                            >
-                                Отметить В Работе
-                            </button>
-                        </>
-                    )}
-
-                    {canResolve && (
-                        <button
-                            onClick={() => handleStatusChange('Resolved')}
-                            className="btn btn-sm btn-success"
-                            disabled={ticket.status === 'Resolved' || ticket.status === 'Closed'}
-                        >
-                            Отметить как Решенный
-                        </button>
-                    )}
-
-                    {canReopen && ticket.status === 'Resolved' && (
-                        <button
-                            onClick={() => handleStatusChange('Open')}
-                            className="btn btn-sm btn-outline"
-                        >
-                            Переоткрыть тикет
-                        </button>
-                    )}
-
-                    {currentUser?.role === 'admin' && (
+                    {(ticket.allowed_transitions || []).map((option) => (
                         <button
-                            onClick={() => handleStatusChange('Closed')}
-                            className="btn btn-sm btn-secondary"
-                            disabled={ticket.status === 'Closed'}
+                            key={option.value}
+                            onClick={() => handleStatusChange(option.value)}
+                            className={`btn btn-sm ${statusButtonClass[option.value] || 'btn-outline'}`}
+                            disabled={updateTicketMutation.isPending}
                         >
-                            Закрыть тикет
+                            {ticket.status === 'Resolved' && option.value === 'Open' ? 'Переоткрыть тикет' : option.label}
                         </button>
+                    ))}
+                    {updateTicketMutation.isError && (
+                        <span className="text-danger text-sm self-center">
+                            {updateTicketMutation.error?.response?.data?.error || 'Не удалось изменить статус'}
+                        </span>
                     )}
                 </div>
             </div>
@@ -359,6 +359,16 @@ export const ticketService = {
             throw error;
         }),
 
+    getAttachmentUrl: (id) =>
+        axios.get(`/api/tickets/attachments/${id}/url`, {
+            headers: {
+                'Authorization': `Bearer ${localStorage.getItem('token')}`
+            }
+        }).catch(error => {
+            console.error(`Error getting link to attachment ${id}:`, error.response || error);
+            throw error;
+        }),
+
     getTicketStats: () => {
         const token = localStorage.getItem('token');
         if (!token) {
@@ -18,6 +18,29 @@ const createRequest = (url, method, data = null, params = null) => {
     return axios(config);
 };
 
+// Student requests are authorized with the student session token
+const createStudentRequest = (url, method, data = null, params = null) => {
+    const token = localStorage.getItem('testStudentToken');
+    const config = {
+        url: `/api/tests${url}`,
+        method,
+        headers: {
+            'Authorization': token ? `Bearer ${token}` : undefined,
+            'Content-Type': 'application/json'
+        }
+    };
+
+    if (data) config.data = data;
+    if (params) config.params = params;
+
+    return axios(config);
+};
+
+const studentAuthHeader = () => {
+    const token = localStorage.getItem('testStudentToken');
+    return token ? { 'Authorization': `Bearer ${token}` } : {};
+};
+
 // Admin/Teacher services
 export const adminTestsService = {
     // Get all tests
@@ -73,17 +96,17 @@ export const studentTestsService = {
 
     // Get student info
     getStudentInfo: (studentId) => {
-        return createRequest('/students/info', 'GET', null, { student_id: studentId });
+        return createStudentRequest('/students/info', 'GET');
     },
 
     // Get available tests
     getAvailableTests: (studentId) => {
-        return createRequest('/available', 'GET', null, { student_id: studentId });
+        return createStudentRequest('/available', 'GET');
     },
 
     // Start test
     startTest: (testId, studentId) => {
-        return createRequest(`/start/${testId}`, 'POST', { student_id: parseInt(studentId, 10) });
+        return createStudentRequest(`/start/${testId}`, 'POST');
     },
 
     // Get next question - use axios directly for better debugging
@@ -94,6 +117,7 @@ export const studentTestsService = {
             method: 'GET',
             url: `/api/tests/attempt/${attemptId}/next`,
             headers: {
+                ...studentAuthHeader(),
                 'Content-Type': 'application/json'
             },
             validateStatus: function (status) {
@@ -132,6 +156,7 @@ export const studentTestsService = {
             method: 'POST',
             url: `/api/tests/attempt/${attemptId}/submit`,
             headers: {
+                ...studentAuthHeader(),
                 'Content-Type': 'application/json'
             },
             data: data,
@@ -156,12 +181,12 @@ export const studentTestsService = {
 
     // Get test results
     getTestResults: (attemptId) => {
-        return createRequest(`/attempt/${attemptId}/results`, 'GET');
+        return createStudentRequest(`/attempt/${attemptId}/results`, 'GET');
     },
 
     // Get test history
     getTestHistory: (studentId) => {
-        return createRequest('/history', 'GET', null, { student_id: studentId });
+        return createStudentRequest('/history', 'GET');
     }
 };
 